@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// AccessToken 个人访问令牌，给脚本、CI 之类的不方便走登录流程的场景用
+type AccessToken struct {
+	Id   int64
+	Uid  int64
+	Name string
+	// Prefix 令牌明文的前几位，方便用户在列表里认出是哪一个，明文只在创建的时候返回一次
+	Prefix string
+	// Scopes 令牌能用的权限，格式和角色的权限一样，最终能用的是和用户角色的交集
+	Scopes []string
+	// ExpiresAt 零值表示不过期
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	Ctime      time.Time
+}
+
+func (t AccessToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
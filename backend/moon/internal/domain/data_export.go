@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// DataExport 用户导出自己的数据，每个用户同时只保留最近的一次
+type DataExport struct {
+	Id     string
+	Uid    int64
+	Status DataExportStatus
+	// Size 压缩包的字节数，导出完成之后才有
+	Size  int64
+	Ctime time.Time
+	// ExpiresAt 过了这个时间压缩包就被删掉了，需要重新导出
+	ExpiresAt time.Time
+}
+
+type DataExportStatus uint8
+
+const (
+	DataExportStatusUnknown DataExportStatus = iota
+	DataExportStatusRunning
+	DataExportStatusReady
+	DataExportStatusFailed
+)
+
+func (s DataExportStatus) String() string {
+	switch s {
+	case DataExportStatusRunning:
+		return "running"
+	case DataExportStatusReady:
+		return "ready"
+	case DataExportStatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,12 @@
+package domain
+
+// ExternalIdentity 第三方身份，比如企业 OIDC 登录，(Provider, Subject) 唯一确定一个外部账号
+type ExternalIdentity struct {
+	Provider string
+	// Subject 第三方的用户 ID，OIDC 里就是 id token 的 sub
+	Subject string
+	// Email 第三方给的邮箱，只有 EmailVerified 的时候才能信任
+	Email         string
+	EmailVerified bool
+	UserId        int64
+}
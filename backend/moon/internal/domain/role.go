@@ -0,0 +1,30 @@
+package domain
+
+import "strings"
+
+// Role 角色，一个角色包含多个权限
+// 权限的格式是 资源:操作，比如 user:admin
+type Role struct {
+	Id   int64
+	Name string
+	// Permissions 支持通配符，* 表示所有权限，user:* 表示 user 下的所有权限
+	Permissions []string
+}
+
+// Allows 判定角色是否拥有某个权限
+func (r Role) Allows(perm string) bool {
+	return MatchPermission(r.Permissions, perm)
+}
+
+// MatchPermission patterns 里有没有能匹配 perm 的，patterns 支持和角色权限一样的通配符
+func MatchPermission(patterns []string, perm string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == perm {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(perm, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,9 +3,11 @@ package domain
 import "time"
 
 type User struct {
-	Id       int64
-	Email    string
-	Password string
+	Id    int64
+	Email string
+	// EmailVerified 用户点过验证邮件里的链接，换了邮箱之后要重新验证
+	EmailVerified bool
+	Password      string
 
 	Nickname string
 	// YYYY-MM-DD
@@ -14,14 +16,70 @@ type User struct {
 
 	Phone string
 
+	// Roles 用户的角色，权限通过角色来授予
+	Roles []string
+
+	Status UserStatus
+	// DeletedAt 用户自己注销的时间，宽限期内还可以恢复
+	DeletedAt time.Time
+
 	// UTC 0 的时区
 	Ctime time.Time
 
-	// WechatInfo WechatInfo
+	WechatInfo WechatInfo
+
+	TOTP TOTPInfo
 
 	//Addr Address
 }
 
+// WechatInfo 微信登录拿到的身份
+type WechatInfo struct {
+	// OpenId 在同一个应用下唯一
+	OpenId string
+	// UnionId 在同一个开放平台账号下的所有应用里唯一
+	UnionId string
+}
+
+// TOTPInfo 两步验证
+type TOTPInfo struct {
+	// Secret 加密之后的密钥，开始绑定的时候就有了，Enabled 之后才生效
+	Secret  string
+	Enabled bool
+	// RecoveryCodes 还没用过的恢复码的哈希
+	RecoveryCodes []string
+}
+
+type UserStatus uint8
+
+const (
+	// UserStatusActive 零值，这样老数据默认就是正常状态
+	UserStatusActive UserStatus = iota
+	// UserStatusDisabled 被管理员禁用，不能登录
+	UserStatusDisabled
+	// UserStatusDeleted 用户自己注销了，宽限期过了之后会被彻底删除
+	UserStatusDeleted
+)
+
+// UserQuery 管理后台搜索用户的条件，为空的条件不生效
+type UserQuery struct {
+	// Email 和 Phone 按前缀匹配
+	Email string
+	Phone string
+	// Nickname 按包含匹配
+	Nickname string
+	Offset   int
+	Limit    int
+}
+
+func (u User) Disabled() bool {
+	return u.Status == UserStatusDisabled
+}
+
+func (u User) Deleted() bool {
+	return u.Status == UserStatusDeleted
+}
+
 // TodayIsBirthday 判定今天是不是我的生日
 func (u User) TodayIsBirthday() bool {
 	now := time.Now()
@@ -1,5 +1,11 @@
 package errs
 
+// 通用
+const (
+	// TooManyRequests 触发限流
+	TooManyRequests = 429001
+)
+
 // User 相关
 const (
 	// UserInvalidInput 统一的用户模块的输入错误
@@ -8,6 +14,34 @@ const (
 	UserInvalidOrPassword = 401002
 	// UserDuplicateEmail 用户邮箱冲突
 	UserDuplicateEmail = 401003
+	// UserClientMismatch token 和当前客户端不匹配，可能是 token 被盗用
+	UserClientMismatch = 401004
+	// UserDisabled 账号被管理员禁用
+	UserDisabled = 401005
+	// UserNotFound 用户不存在，只在管理后台使用，登录之类的接口不能暴露用户是否存在
+	UserNotFound = 401006
+	// UserLocked 登录失败次数过多，账号被临时锁定
+	UserLocked = 401007
+	// UserCodeSendTooMany 同一个手机号发送验证码太频繁
+	UserCodeSendTooMany = 401008
+	// UserCodeVerifyTooMany 同一个验证码验证次数太多，需要重新发送
+	UserCodeVerifyTooMany = 401009
+	// UserEmailNotVerified 配置了必须验证邮箱才能登录，但是邮箱还没有验证
+	UserEmailNotVerified = 401010
+	// UserMFARequired 密码对了，还需要提交两步验证的验证码
+	UserMFARequired = 401011
+	// UserPendingDeletion 账号已经注销，还在宽限期里可以恢复
+	UserPendingDeletion = 401012
+	// UserExportInProgress 上一次导出个人数据还没有完成
+	UserExportInProgress = 401013
+	// UserDuplicatePhone 手机号已经被别的账号绑定了
+	UserDuplicatePhone = 401014
+	// UserPasswordNotSet 短信、第三方登录注册的账号没有密码，不能用密码确认身份，也不能修改密码和邮箱
+	UserPasswordNotSet = 401015
+	// UserNoConfirmMethod 没有密码也没有绑定手机号，没法确认身份，要先绑定手机号
+	UserNoConfirmMethod = 401016
+	// UserDuplicateWechat 微信已经绑定在别的账号上了
+	UserDuplicateWechat = 401017
 	// UserInternalServerError 统一的用户模块的系统错误
 	UserInternalServerError = 501001
 )
@@ -0,0 +1,62 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"moon/internal/service"
+	"moon/pkg/logger"
+)
+
+// AccountPurgeJob 定时彻底删除宽限期已经过了的注销账号
+// 多个实例同时跑也没有关系，删除是幂等的
+type AccountPurgeJob struct {
+	svc      service.AccountDeletionService
+	interval time.Duration
+	// batch 一次删除的数量，避免长事务
+	batch int
+	l     logger.LoggerV1
+}
+
+func NewAccountPurgeJob(svc service.AccountDeletionService, interval time.Duration,
+	batch int, l logger.LoggerV1) *AccountPurgeJob {
+	return &AccountPurgeJob{
+		svc:      svc,
+		interval: interval,
+		batch:    batch,
+		l:        l,
+	}
+}
+
+// Run 阻塞直到 ctx 结束
+func (j *AccountPurgeJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		j.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *AccountPurgeJob) purge(ctx context.Context) {
+	var total int64
+	for {
+		cnt, err := j.svc.Purge(ctx, j.batch)
+		total += cnt
+		if err != nil {
+			j.l.Error("清理注销账号失败", logger.Error(err))
+			break
+		}
+		// 不满一批说明已经删完了
+		if cnt < int64(j.batch) {
+			break
+		}
+	}
+	if total > 0 {
+		j.l.Info("清理注销账号", logger.Int64("count", total))
+	}
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository/dao"
+)
+
+var ErrAccessTokenNotFound = dao.ErrRecordNotFound
+
+//go:generate mockgen -source=./access_token.go -package=repomocks -destination=./mocks/access_token.mock.go AccessTokenRepository
+type AccessTokenRepository interface {
+	// Create hash 是令牌明文的哈希，返回令牌 ID
+	Create(ctx context.Context, t domain.AccessToken, hash string) (int64, error)
+	FindByHash(ctx context.Context, hash string) (domain.AccessToken, error)
+	FindByUid(ctx context.Context, uid int64) ([]domain.AccessToken, error)
+	CountByUid(ctx context.Context, uid int64) (int64, error)
+	Delete(ctx context.Context, uid, id int64) error
+	UpdateLastUsed(ctx context.Context, id int64, t time.Time, interval time.Duration) error
+}
+
+type GORMAccessTokenRepository struct {
+	dao dao.AccessTokenDAO
+}
+
+func NewGORMAccessTokenRepository(dao dao.AccessTokenDAO) AccessTokenRepository {
+	return &GORMAccessTokenRepository{dao: dao}
+}
+
+func (r *GORMAccessTokenRepository) Create(ctx context.Context, t domain.AccessToken, hash string) (int64, error) {
+	var expiresAt int64
+	if !t.ExpiresAt.IsZero() {
+		expiresAt = t.ExpiresAt.UnixMilli()
+	}
+	return r.dao.Insert(ctx, dao.AccessToken{
+		Uid:       t.Uid,
+		Name:      t.Name,
+		TokenHash: hash,
+		Prefix:    t.Prefix,
+		Scopes:    joinList(t.Scopes),
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (r *GORMAccessTokenRepository) FindByHash(ctx context.Context, hash string) (domain.AccessToken, error) {
+	t, err := r.dao.FindByHash(ctx, hash)
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+	return r.toDomain(t), nil
+}
+
+func (r *GORMAccessTokenRepository) FindByUid(ctx context.Context, uid int64) ([]domain.AccessToken, error) {
+	ts, err := r.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.AccessToken, 0, len(ts))
+	for _, t := range ts {
+		res = append(res, r.toDomain(t))
+	}
+	return res, nil
+}
+
+func (r *GORMAccessTokenRepository) CountByUid(ctx context.Context, uid int64) (int64, error) {
+	return r.dao.CountByUid(ctx, uid)
+}
+
+func (r *GORMAccessTokenRepository) Delete(ctx context.Context, uid, id int64) error {
+	return r.dao.Delete(ctx, uid, id)
+}
+
+func (r *GORMAccessTokenRepository) UpdateLastUsed(ctx context.Context, id int64, t time.Time, interval time.Duration) error {
+	return r.dao.UpdateLastUsed(ctx, id, t, interval)
+}
+
+func (r *GORMAccessTokenRepository) toDomain(t dao.AccessToken) domain.AccessToken {
+	res := domain.AccessToken{
+		Id:     t.Id,
+		Uid:    t.Uid,
+		Name:   t.Name,
+		Prefix: t.Prefix,
+		Scopes: splitList(t.Scopes),
+		Ctime:  time.UnixMilli(t.Ctime),
+	}
+	if t.ExpiresAt > 0 {
+		res.ExpiresAt = time.UnixMilli(t.ExpiresAt)
+	}
+	if t.LastUsedAt > 0 {
+		res.LastUsedAt = time.UnixMilli(t.LastUsedAt)
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrCodeSendTooMany   = errors.New("发送验证码太频繁")
+	ErrCodeVerifyTooMany = errors.New("验证次数太多")
+	ErrUnknownForCode    = errors.New("验证码相关的未知错误")
+)
+
+// setCodeScript KEYS[1] 验证码，ARGV 依次是验证码的哈希、有效期秒数、重发间隔秒数、可以验证的次数
+// 返回 0 成功，-1 发送太频繁，-2 key 没有过期时间
+var setCodeScript = redis.NewScript(`
+local key = KEYS[1]
+local cntKey = key..":cnt"
+local expiration = tonumber(ARGV[2])
+local ttl = tonumber(redis.call("TTL", key))
+if ttl == -1 then
+	return -2
+end
+if ttl == -2 or ttl < expiration - tonumber(ARGV[3]) then
+	redis.call("SET", key, ARGV[1], "EX", expiration)
+	redis.call("SET", cntKey, ARGV[4], "EX", expiration)
+	return 0
+end
+return -1
+`)
+
+// verifyCodeScript KEYS[1] 验证码，ARGV[1] 用户输入的验证码的哈希
+// 返回 0 验证通过，-1 验证次数用完了，-2 验证码不对，-3 没有发过验证码或者已经过期
+var verifyCodeScript = redis.NewScript(`
+local key = KEYS[1]
+local cntKey = key..":cnt"
+local cnt = tonumber(redis.call("GET", cntKey))
+if cnt == nil then
+	return -3
+end
+if cnt <= 0 then
+	return -1
+end
+if redis.call("GET", key) == ARGV[1] then
+	-- 验证码只能用一次
+	redis.call("DEL", key, cntKey)
+	return 0
+end
+redis.call("DECR", cntKey)
+return -2
+`)
+
+// CodeCache 保存验证码，只保存哈希，Redis 里的数据泄露了也拿不到验证码
+type CodeCache interface {
+	Set(ctx context.Context, biz, phone, codeHash string) error
+	Verify(ctx context.Context, biz, phone, codeHash string) (bool, error)
+}
+
+type RedisCodeCache struct {
+	cmd redis.Cmdable
+	// expiration 验证码的有效期
+	expiration time.Duration
+	// resendInterval 同一个手机号两次发送之间最少间隔多久
+	resendInterval time.Duration
+	// maxAttempts 一个验证码最多可以验证几次
+	maxAttempts int
+}
+
+func NewCodeCache(cmd redis.Cmdable, expiration, resendInterval time.Duration, maxAttempts int) CodeCache {
+	return &RedisCodeCache{
+		cmd:            cmd,
+		expiration:     expiration,
+		resendInterval: resendInterval,
+		maxAttempts:    maxAttempts,
+	}
+}
+
+func (c *RedisCodeCache) Set(ctx context.Context, biz, phone, codeHash string) error {
+	res, err := setCodeScript.Run(ctx, c.cmd, []string{c.key(biz, phone)}, codeHash,
+		int64(c.expiration.Seconds()), int64(c.resendInterval.Seconds()), c.maxAttempts).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return nil
+	case -1:
+		return ErrCodeSendTooMany
+	default:
+		return ErrUnknownForCode
+	}
+}
+
+func (c *RedisCodeCache) Verify(ctx context.Context, biz, phone, codeHash string) (bool, error) {
+	res, err := verifyCodeScript.Run(ctx, c.cmd, []string{c.key(biz, phone)}, codeHash).Int()
+	if err != nil {
+		return false, err
+	}
+	switch res {
+	case 0:
+		return true, nil
+	case -1:
+		return false, ErrCodeVerifyTooMany
+	default:
+		// 验证码不对或者已经过期，对用户来说都是输错了
+		return false, nil
+	}
+}
+
+func (c *RedisCodeCache) key(biz, phone string) string {
+	return fmt.Sprintf("phone_code:%s:%s", biz, phone)
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCodeCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewCodeCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		time.Minute*10, time.Minute, 3)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "login", "13800138000", "hash-1"))
+	// 重发间隔内不能再发
+	assert.Equal(t, ErrCodeSendTooMany, c.Set(ctx, "login", "13800138000", "hash-2"))
+	// 不同的业务互不影响
+	require.NoError(t, c.Set(ctx, "bind", "13800138000", "hash-3"))
+
+	// 过了重发间隔可以再发，旧的验证码失效
+	mr.FastForward(time.Minute + time.Second)
+	require.NoError(t, c.Set(ctx, "login", "13800138000", "hash-2"))
+	ok, err := c.Verify(ctx, "login", "13800138000", "hash-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.Verify(ctx, "login", "13800138000", "hash-2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 验证码只能用一次
+	ok, err = c.Verify(ctx, "login", "13800138000", "hash-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 输错次数用完之后，正确的验证码也不行
+	for i := 0; i < 3; i++ {
+		ok, err = c.Verify(ctx, "bind", "13800138000", "wrong")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+	_, err = c.Verify(ctx, "bind", "13800138000", "hash-3")
+	assert.Equal(t, ErrCodeVerifyTooMany, err)
+
+	// 过期之后验证不通过
+	require.NoError(t, c.Set(ctx, "reset", "13800138000", "hash-4"))
+	mr.FastForward(time.Minute * 11)
+	ok, err = c.Verify(ctx, "reset", "13800138000", "hash-4")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"moon/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// startExportScript KEYS[1] 导出状态，KEYS[2] 压缩包
+// ARGV[1] 导出 ID，ARGV[2] 创建时间毫秒，ARGV[3] 导出中状态的过期时间毫秒，ARGV[4] 导出中的状态值
+// 返回 0 表示已经有一个在导出了，1 表示开始，之前导出的压缩包会被删掉
+var startExportScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") == ARGV[4] then
+	return 0
+end
+redis.call("DEL", KEYS[1], KEYS[2])
+redis.call("HSET", KEYS[1], "id", ARGV[1], "status", ARGV[4], "ctime", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+
+// finishExportScript ARGV[1] 导出 ID，ARGV[2] 压缩包，ARGV[3] 压缩包的过期时间戳毫秒，ARGV[4] 过期时间毫秒，ARGV[5] 完成的状态值
+// 返回 0 表示这次导出已经被替换或者过期了
+var finishExportScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "id") ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[4])
+redis.call("HSET", KEYS[1], "status", ARGV[5], "size", string.len(ARGV[2]), "expires_at", ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// failExportScript ARGV[1] 导出 ID，ARGV[2] 失败状态保留的时间毫秒，ARGV[3] 失败的状态值
+var failExportScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "id") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return 1
+`)
+
+// exportDataScript 导出 ID 对得上才返回压缩包
+var exportDataScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "id") ~= ARGV[1] then
+	return false
+end
+return redis.call("GET", KEYS[2])
+`)
+
+// DataExportCache 保存用户导出数据的状态和压缩包，每个用户只保留最近的一次
+type DataExportCache interface {
+	// Start 开始一次导出，已经有一次在导出的时候返回 false
+	// ttl 是导出中这个状态最多保留多久，进程挂了的话过了 ttl 就可以重新导出
+	Start(ctx context.Context, uid int64, id string, ctime time.Time, ttl time.Duration) (bool, error)
+	// Finish 保存压缩包，导出已经被新的替换了的时候返回 false
+	Finish(ctx context.Context, uid int64, id string, data []byte) (bool, error)
+	Fail(ctx context.Context, uid int64, id string) error
+	// Get 没有导出过或者已经过期了的时候返回 ErrKeyNotExist
+	Get(ctx context.Context, uid int64) (domain.DataExport, error)
+	// Data 导出 ID 对不上或者已经过期了的时候返回 ErrKeyNotExist
+	Data(ctx context.Context, uid int64, id string) ([]byte, error)
+}
+
+type RedisDataExportCache struct {
+	cmd redis.Cmdable
+	// expiration 导出完成或者失败之后保留多久
+	expiration time.Duration
+}
+
+func NewDataExportCache(cmd redis.Cmdable, expiration time.Duration) DataExportCache {
+	return &RedisDataExportCache{
+		cmd:        cmd,
+		expiration: expiration,
+	}
+}
+
+func (c *RedisDataExportCache) Start(ctx context.Context, uid int64, id string, ctime time.Time, ttl time.Duration) (bool, error) {
+	return startExportScript.Run(ctx, c.cmd, []string{c.key(uid), c.dataKey(uid)},
+		id, ctime.UnixMilli(), ttl.Milliseconds(), uint8(domain.DataExportStatusRunning)).Bool()
+}
+
+func (c *RedisDataExportCache) Finish(ctx context.Context, uid int64, id string, data []byte) (bool, error) {
+	expiresAt := time.Now().Add(c.expiration)
+	return finishExportScript.Run(ctx, c.cmd, []string{c.key(uid), c.dataKey(uid)},
+		id, data, expiresAt.UnixMilli(), c.expiration.Milliseconds(), uint8(domain.DataExportStatusReady)).Bool()
+}
+
+func (c *RedisDataExportCache) Fail(ctx context.Context, uid int64, id string) error {
+	return failExportScript.Run(ctx, c.cmd, []string{c.key(uid)},
+		id, c.expiration.Milliseconds(), uint8(domain.DataExportStatusFailed)).Err()
+}
+
+func (c *RedisDataExportCache) Get(ctx context.Context, uid int64) (domain.DataExport, error) {
+	vals, err := c.cmd.HGetAll(ctx, c.key(uid)).Result()
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	if len(vals) == 0 {
+		return domain.DataExport{}, ErrKeyNotExist
+	}
+	status, _ := strconv.ParseUint(vals["status"], 10, 8)
+	size, _ := strconv.ParseInt(vals["size"], 10, 64)
+	ctime, _ := strconv.ParseInt(vals["ctime"], 10, 64)
+	res := domain.DataExport{
+		Id:     vals["id"],
+		Uid:    uid,
+		Status: domain.DataExportStatus(status),
+		Size:   size,
+		Ctime:  time.UnixMilli(ctime),
+	}
+	if expiresAt, _ := strconv.ParseInt(vals["expires_at"], 10, 64); expiresAt > 0 {
+		res.ExpiresAt = time.UnixMilli(expiresAt)
+	}
+	return res, nil
+}
+
+func (c *RedisDataExportCache) Data(ctx context.Context, uid int64, id string) ([]byte, error) {
+	val, err := exportDataScript.Run(ctx, c.cmd, []string{c.key(uid), c.dataKey(uid)}, id).Text()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(val), nil
+}
+
+func (c *RedisDataExportCache) key(uid int64) string {
+	return fmt.Sprintf("users:export:%d", uid)
+}
+
+func (c *RedisDataExportCache) dataKey(uid int64) string {
+	return fmt.Sprintf("users:export_data:%d", uid)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisDataExportCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewDataExportCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour*24)
+	ctx := context.Background()
+	now := time.UnixMilli(1700000000000)
+
+	_, err := c.Get(ctx, 1)
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	ok, err := c.Start(ctx, 1, "e1", now, time.Minute*10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 导出中不能再开始一次
+	ok, err = c.Start(ctx, 1, "e2", now, time.Minute*10)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 别的用户不受影响
+	ok, err = c.Start(ctx, 2, "e3", now, time.Minute*10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	e, err := c.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DataExport{Id: "e1", Uid: 1, Status: domain.DataExportStatusRunning, Ctime: now}, e)
+	_, err = c.Data(ctx, 1, "e1")
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	ok, err = c.Finish(ctx, 1, "e1", []byte("zip"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	e, err = c.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DataExportStatusReady, e.Status)
+	assert.Equal(t, int64(3), e.Size)
+	assert.False(t, e.ExpiresAt.IsZero())
+	data, err := c.Data(ctx, 1, "e1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("zip"), data)
+	_, err = c.Data(ctx, 1, "e3")
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	// 重新导出之后旧的压缩包就没了，旧的导出也不能再写回来
+	ok, err = c.Start(ctx, 1, "e4", now, time.Minute*10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = c.Data(ctx, 1, "e1")
+	assert.Equal(t, ErrKeyNotExist, err)
+	ok, err = c.Finish(ctx, 1, "e1", []byte("zip"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Fail(ctx, 1, "e4"))
+	e, err = c.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DataExportStatusFailed, e.Status)
+
+	// 进程挂了的话，过了 ttl 就可以重新导出
+	mr.FastForward(time.Minute * 11)
+	ok, err = c.Start(ctx, 2, "e5", now, time.Minute*10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	mr.FastForward(time.Hour * 25)
+	_, err = c.Get(ctx, 1)
+	assert.Equal(t, ErrKeyNotExist, err)
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LockoutPolicy 登录失败的锁定策略
+type LockoutPolicy struct {
+	// Threshold 在 Window 内失败多少次之后锁定
+	Threshold int
+	Window    time.Duration
+	// BaseLock 第一次锁定的时长，之后每次锁定翻倍，最多 MaxLock
+	BaseLock time.Duration
+	MaxLock  time.Duration
+	// ResetAfter 这么久没有再被锁定，锁定时长就回到 BaseLock
+	ResetAfter time.Duration
+}
+
+// failScript 记录一次失败，达到阈值就锁定，返回锁定的毫秒数，没有锁定返回 0
+// KEYS[1] 失败次数，KEYS[2] 锁定标记，KEYS[3] 已经锁定过几次
+var failScript = redis.NewScript(`
+local cnt = redis.call("INCR", KEYS[1])
+if cnt == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if cnt < tonumber(ARGV[1]) then
+	return 0
+end
+local level = redis.call("INCR", KEYS[3])
+redis.call("PEXPIRE", KEYS[3], ARGV[5])
+local d = tonumber(ARGV[3]) * math.pow(2, level - 1)
+if d > tonumber(ARGV[4]) then
+	d = tonumber(ARGV[4])
+end
+d = math.floor(d)
+redis.call("SET", KEYS[2], "", "PX", d)
+redis.call("DEL", KEYS[1])
+return d
+`)
+
+// LoginAttemptCache 记录登录失败次数和锁定状态
+// subject 是被锁定的对象，比如账号或者 IP，由调用方决定
+type LoginAttemptCache interface {
+	// LockedFor 返回这些 subject 里剩余锁定时间最长的那个，都没有锁定返回 0
+	LockedFor(ctx context.Context, subjects ...string) (time.Duration, error)
+	// Fail 记录一次失败，触发锁定时返回锁定时长
+	Fail(ctx context.Context, subject string, p LockoutPolicy) (time.Duration, error)
+	// Reset 清空失败次数、锁定标记和锁定次数
+	Reset(ctx context.Context, subject string) error
+}
+
+type RedisLoginAttemptCache struct {
+	cmd redis.Cmdable
+}
+
+func NewLoginAttemptCache(cmd redis.Cmdable) LoginAttemptCache {
+	return &RedisLoginAttemptCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisLoginAttemptCache) LockedFor(ctx context.Context, subjects ...string) (time.Duration, error) {
+	var res time.Duration
+	for _, s := range subjects {
+		ttl, err := c.cmd.PTTL(ctx, c.lockKey(s)).Result()
+		if err != nil {
+			return 0, err
+		}
+		// key 不存在的时候是负数
+		if ttl > res {
+			res = ttl
+		}
+	}
+	return res, nil
+}
+
+func (c *RedisLoginAttemptCache) Fail(ctx context.Context, subject string, p LockoutPolicy) (time.Duration, error) {
+	ms, err := failScript.Run(ctx, c.cmd,
+		[]string{c.failKey(subject), c.lockKey(subject), c.levelKey(subject)},
+		p.Threshold, p.Window.Milliseconds(), p.BaseLock.Milliseconds(),
+		p.MaxLock.Milliseconds(), p.ResetAfter.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (c *RedisLoginAttemptCache) Reset(ctx context.Context, subject string) error {
+	return c.cmd.Del(ctx, c.failKey(subject), c.lockKey(subject), c.levelKey(subject)).Err()
+}
+
+func (c *RedisLoginAttemptCache) failKey(subject string) string {
+	return fmt.Sprintf("users:login_fail:%s", subject)
+}
+
+func (c *RedisLoginAttemptCache) lockKey(subject string) string {
+	return fmt.Sprintf("users:login_lock:%s", subject)
+}
+
+func (c *RedisLoginAttemptCache) levelKey(subject string) string {
+	return fmt.Sprintf("users:login_lock_level:%s", subject)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLoginAttemptCache_Fail(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewLoginAttemptCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+	p := LockoutPolicy{
+		Threshold:  3,
+		Window:     time.Minute,
+		BaseLock:   time.Minute,
+		MaxLock:    time.Minute * 3,
+		ResetAfter: time.Hour,
+	}
+
+	// 没有达到阈值不锁定
+	for i := 0; i < 2; i++ {
+		d, err := c.Fail(ctx, "account:a", p)
+		require.NoError(t, err)
+		assert.Equal(t, time.Duration(0), d)
+	}
+	d, err := c.LockedFor(ctx, "account:a", "ip:1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	// 第一次锁定 BaseLock
+	d, err = c.Fail(ctx, "account:a", p)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, d)
+	d, err = c.LockedFor(ctx, "account:a", "ip:1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, d)
+
+	// 之后每次翻倍，最多 MaxLock
+	for _, want := range []time.Duration{time.Minute * 2, time.Minute * 3} {
+		for i := 0; i < p.Threshold-1; i++ {
+			_, err = c.Fail(ctx, "account:a", p)
+			require.NoError(t, err)
+		}
+		d, err = c.Fail(ctx, "account:a", p)
+		require.NoError(t, err)
+		assert.Equal(t, want, d)
+	}
+
+	// 其他账号不受影响
+	d, err = c.LockedFor(ctx, "account:b")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	// 锁定过期之后可以再试
+	mr.FastForward(time.Minute * 3)
+	d, err = c.LockedFor(ctx, "account:a")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	// 解锁之后锁定时长回到 BaseLock
+	require.NoError(t, c.Reset(ctx, "account:a"))
+	for i := 0; i < p.Threshold-1; i++ {
+		_, err = c.Fail(ctx, "account:a", p)
+		require.NoError(t, err)
+	}
+	d, err = c.Fail(ctx, "account:a", p)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, d)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// attemptScript KEYS[1] 尝试次数，KEYS[2] token 已经用过的标记，ARGV[1] 过期时间毫秒
+// 返回加上这次之后的次数，token 已经用过的返回 0
+var attemptScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+local cnt = redis.call("INCR", KEYS[1])
+if cnt == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return cnt
+`)
+
+// MFACache 两步验证登录的防暴力破解和防重放
+type MFACache interface {
+	// Attempt 记录一次用 mfa token 提交验证码，返回加上这次之后一共试了几次
+	// token 已经用过的返回 0，免得拿用过的 token 去消耗恢复码
+	Attempt(ctx context.Context, tokenId string, ttl time.Duration) (int64, error)
+	// ConsumeToken 标记 mfa token 已经用过，已经用过的返回 false
+	ConsumeToken(ctx context.Context, tokenId string, ttl time.Duration) (bool, error)
+	// UseStep 标记这个用户这个时间窗口的验证码已经用过，防止同一个验证码被重放，已经用过的返回 false
+	UseStep(ctx context.Context, uid int64, step int64, ttl time.Duration) (bool, error)
+}
+
+type RedisMFACache struct {
+	cmd redis.Cmdable
+}
+
+func NewMFACache(cmd redis.Cmdable) MFACache {
+	return &RedisMFACache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisMFACache) Attempt(ctx context.Context, tokenId string, ttl time.Duration) (int64, error) {
+	return attemptScript.Run(ctx, c.cmd, []string{c.attemptKey(tokenId), c.usedKey(tokenId)},
+		ttl.Milliseconds()).Int64()
+}
+
+func (c *RedisMFACache) ConsumeToken(ctx context.Context, tokenId string, ttl time.Duration) (bool, error) {
+	return c.cmd.SetNX(ctx, c.usedKey(tokenId), "", ttl).Result()
+}
+
+func (c *RedisMFACache) UseStep(ctx context.Context, uid int64, step int64, ttl time.Duration) (bool, error) {
+	return c.cmd.SetNX(ctx, fmt.Sprintf("users:totp_used:%d:%d", uid, step), "", ttl).Result()
+}
+
+func (c *RedisMFACache) attemptKey(tokenId string) string {
+	return fmt.Sprintf("users:mfa_attempt:%s", tokenId)
+}
+
+func (c *RedisMFACache) usedKey(tokenId string) string {
+	return fmt.Sprintf("users:mfa_used:%s", tokenId)
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisMFACache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewMFACache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		cnt, err := c.Attempt(ctx, "jti-1", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, cnt)
+	}
+	// 别的 token 单独计数
+	cnt, err := c.Attempt(ctx, "jti-2", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+	mr.FastForward(time.Minute * 2)
+	cnt, err = c.Attempt(ctx, "jti-1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	ok, err := c.ConsumeToken(ctx, "jti-1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.ConsumeToken(ctx, "jti-1", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 用过的 token 不再计数
+	cnt, err = c.Attempt(ctx, "jti-1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cnt)
+
+	ok, err = c.UseStep(ctx, 1, 100, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.UseStep(ctx, 1, 100, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 别的用户同一个窗口不受影响
+	ok, err = c.UseStep(ctx, 2, 100, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// consumeResetTokenScript KEYS[1] 用户的重置 token，ARGV[1] 用户提交的 token 的哈希
+// 返回 1 token 正确并且已经删掉，0 不对或者已经过期
+var consumeResetTokenScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// PasswordResetCache 保存重置密码的 token，只保存哈希
+// 每个用户只有最新发出的 token 有效，重新申请之后旧的链接就失效了
+type PasswordResetCache interface {
+	Set(ctx context.Context, uid int64, tokenHash string) error
+	// Verify 只检查 token 是否正确，不会删掉
+	Verify(ctx context.Context, uid int64, tokenHash string) (bool, error)
+	// Consume token 正确的话删掉并返回 true，一个 token 只能用一次
+	Consume(ctx context.Context, uid int64, tokenHash string) (bool, error)
+}
+
+type RedisPasswordResetCache struct {
+	cmd        redis.Cmdable
+	expiration time.Duration
+}
+
+func NewPasswordResetCache(cmd redis.Cmdable, expiration time.Duration) PasswordResetCache {
+	return &RedisPasswordResetCache{
+		cmd:        cmd,
+		expiration: expiration,
+	}
+}
+
+func (c *RedisPasswordResetCache) Set(ctx context.Context, uid int64, tokenHash string) error {
+	return c.cmd.Set(ctx, c.key(uid), tokenHash, c.expiration).Err()
+}
+
+func (c *RedisPasswordResetCache) Verify(ctx context.Context, uid int64, tokenHash string) (bool, error) {
+	val, err := c.cmd.Get(ctx, c.key(uid)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return val == tokenHash, nil
+}
+
+func (c *RedisPasswordResetCache) Consume(ctx context.Context, uid int64, tokenHash string) (bool, error) {
+	return consumeResetTokenScript.Run(ctx, c.cmd, []string{c.key(uid)}, tokenHash).Bool()
+}
+
+func (c *RedisPasswordResetCache) key(uid int64) string {
+	return fmt.Sprintf("users:password_reset:%d", uid)
+}
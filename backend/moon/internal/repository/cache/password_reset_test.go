@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisPasswordResetCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewPasswordResetCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute*30)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, 1, "hash-1"))
+	// 重新申请之后旧的 token 失效
+	require.NoError(t, c.Set(ctx, 1, "hash-2"))
+	ok, err := c.Consume(ctx, 1, "hash-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 别的用户的 token 不能用
+	ok, err = c.Consume(ctx, 2, "hash-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Verify 不会消耗 token
+	ok, err = c.Verify(ctx, 1, "hash-2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Verify(ctx, 1, "hash-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.Consume(ctx, 1, "hash-2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Verify(ctx, 1, "hash-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 只能用一次
+	ok, err = c.Consume(ctx, 1, "hash-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Set(ctx, 1, "hash-3"))
+	mr.FastForward(time.Minute * 31)
+	ok, err = c.Consume(ctx, 1, "hash-3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
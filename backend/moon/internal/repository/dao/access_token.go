@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -source=./access_token.go -package=daomocks -destination=./mocks/access_token.mock.go AccessTokenDAO
+type AccessTokenDAO interface {
+	Insert(ctx context.Context, t AccessToken) (int64, error)
+	FindByHash(ctx context.Context, hash string) (AccessToken, error)
+	FindByUid(ctx context.Context, uid int64) ([]AccessToken, error)
+	CountByUid(ctx context.Context, uid int64) (int64, error)
+	// Delete 只能删除自己的令牌，不存在或者不属于 uid 的时候返回 ErrRecordNotFound
+	Delete(ctx context.Context, uid, id int64) error
+	// UpdateLastUsed 只有比原来的值新至少 interval 的时候才更新，避免每个请求都写一次数据库
+	UpdateLastUsed(ctx context.Context, id int64, t time.Time, interval time.Duration) error
+}
+
+type GORMAccessTokenDAO struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenDAO(db *gorm.DB) AccessTokenDAO {
+	return &GORMAccessTokenDAO{db: db}
+}
+
+func (dao *GORMAccessTokenDAO) Insert(ctx context.Context, t AccessToken) (int64, error) {
+	now := time.Now().UnixMilli()
+	t.Ctime = now
+	t.Utime = now
+	err := dao.db.WithContext(ctx).Create(&t).Error
+	return t.Id, err
+}
+
+func (dao *GORMAccessTokenDAO) FindByHash(ctx context.Context, hash string) (AccessToken, error) {
+	var t AccessToken
+	err := dao.db.WithContext(ctx).Where("token_hash = ?", hash).First(&t).Error
+	return t, err
+}
+
+func (dao *GORMAccessTokenDAO) FindByUid(ctx context.Context, uid int64) ([]AccessToken, error) {
+	var res []AccessToken
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).Order("id DESC").Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMAccessTokenDAO) CountByUid(ctx context.Context, uid int64) (int64, error) {
+	var cnt int64
+	err := dao.db.WithContext(ctx).Model(&AccessToken{}).Where("uid = ?", uid).Count(&cnt).Error
+	return cnt, err
+}
+
+func (dao *GORMAccessTokenDAO) Delete(ctx context.Context, uid, id int64) error {
+	res := dao.db.WithContext(ctx).Where("id = ? AND uid = ?", id, uid).Delete(&AccessToken{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMAccessTokenDAO) UpdateLastUsed(ctx context.Context, id int64, t time.Time, interval time.Duration) error {
+	ms := t.UnixMilli()
+	return dao.db.WithContext(ctx).Model(&AccessToken{}).
+		Where("id = ? AND last_used_at < ?", id, ms-interval.Milliseconds()).
+		Update("last_used_at", ms).Error
+}
+
+type AccessToken struct {
+	Id   int64  `gorm:"primaryKey,autoIncrement"`
+	Uid  int64  `gorm:"index"`
+	Name string `gorm:"type:varchar(64)"`
+	// TokenHash 令牌明文的 sha256，认证的时候按它查
+	TokenHash string `gorm:"type:varchar(64);uniqueIndex"`
+	Prefix    string `gorm:"type:varchar(32)"`
+	// Scopes 逗号分隔
+	Scopes string `gorm:"type:varchar(1024)"`
+	// ExpiresAt 0 表示不过期
+	ExpiresAt  int64
+	LastUsedAt int64
+
+	Ctime int64
+	Utime int64
+}
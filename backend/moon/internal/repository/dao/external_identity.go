@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrIdentityLinked = errors.New("第三方账号已经绑定了用户")
+
+//go:generate mockgen -source=./external_identity.go -package=daomocks -destination=./mocks/external_identity.mock.go ExternalIdentityDAO
+type ExternalIdentityDAO interface {
+	FindBySubject(ctx context.Context, provider, subject string) (ExternalIdentity, error)
+	// Link 把第三方账号绑定到已有的用户上
+	Link(ctx context.Context, ei ExternalIdentity) error
+	// CreateUser 在一个事务里创建用户并绑定第三方账号，返回用户 ID
+	CreateUser(ctx context.Context, u User, ei ExternalIdentity) (int64, error)
+}
+
+type GORMExternalIdentityDAO struct {
+	db *gorm.DB
+}
+
+func NewExternalIdentityDAO(db *gorm.DB) ExternalIdentityDAO {
+	return &GORMExternalIdentityDAO{db: db}
+}
+
+func (dao *GORMExternalIdentityDAO) FindBySubject(ctx context.Context, provider, subject string) (ExternalIdentity, error) {
+	var ei ExternalIdentity
+	err := dao.db.WithContext(ctx).
+		Where("provider = ? AND subject = ?", provider, subject).First(&ei).Error
+	return ei, err
+}
+
+func (dao *GORMExternalIdentityDAO) Link(ctx context.Context, ei ExternalIdentity) error {
+	now := time.Now().UnixMilli()
+	ei.Ctime = now
+	ei.Utime = now
+	err := dao.db.WithContext(ctx).Create(&ei).Error
+	if isDuplicate(err) {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+func (dao *GORMExternalIdentityDAO) CreateUser(ctx context.Context, u User, ei ExternalIdentity) (int64, error) {
+	now := time.Now().UnixMilli()
+	u.Ctime, u.Utime = now, now
+	ei.Ctime, ei.Utime = now, now
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			if isDuplicate(err) {
+				return ErrDuplicateEmail
+			}
+			return err
+		}
+		ei.UserId = u.Id
+		if err := tx.Create(&ei).Error; err != nil {
+			if isDuplicate(err) {
+				return ErrIdentityLinked
+			}
+			return err
+		}
+		return nil
+	})
+	return u.Id, err
+}
+
+type ExternalIdentity struct {
+	Id int64 `gorm:"primaryKey,autoIncrement"`
+	// 同一个 provider 下 subject 唯一
+	Provider string `gorm:"type:varchar(64);uniqueIndex:idx_provider_subject"`
+	Subject  string `gorm:"type:varchar(255);uniqueIndex:idx_provider_subject"`
+	UserId   int64  `gorm:"index"`
+	// Email 登录时第三方给的邮箱，只用于排查问题
+	Email sql.NullString `gorm:"type:varchar(255)"`
+
+	Ctime int64
+	Utime int64
+}
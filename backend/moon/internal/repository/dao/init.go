@@ -5,5 +5,20 @@ import (
 )
 
 func InitTables(db *gorm.DB) error {
-	return db.AutoMigrate(&User{})
+	err := db.AutoMigrate(&User{}, &Role{}, &ExternalIdentity{}, &AccessToken{})
+	if err != nil {
+		return err
+	}
+	return migratePhoneToE164(db)
+}
+
+// migratePhoneToE164 以前只支持国内手机号，保存的时候没有国家码，现在统一保存成 E.164 格式
+// 只改 11 位的国内手机号，已经是 E.164 格式的不会再匹配，重复执行没有关系
+func migratePhoneToE164(db *gorm.DB) error {
+	err := db.Exec("UPDATE users SET phone = CONCAT('+86', phone) WHERE phone REGEXP '^1[3-9][0-9]{9}$'").Error
+	if err != nil {
+		return err
+	}
+	return db.Exec("UPDATE users SET deleted_phone = CONCAT('+86', deleted_phone) " +
+		"WHERE deleted_phone REGEXP '^1[3-9][0-9]{9}$'").Error
 }
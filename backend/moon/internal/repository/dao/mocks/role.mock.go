@@ -0,0 +1,80 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./role.go
+
+// Package daomocks is a generated GoMock package.
+package daomocks
+
+import (
+	context "context"
+	dao "moon/internal/repository/dao"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRoleDAO is a mock of RoleDAO interface.
+type MockRoleDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockRoleDAOMockRecorder
+}
+
+// MockRoleDAOMockRecorder is the mock recorder for MockRoleDAO.
+type MockRoleDAOMockRecorder struct {
+	mock *MockRoleDAO
+}
+
+// NewMockRoleDAO creates a new mock instance.
+func NewMockRoleDAO(ctrl *gomock.Controller) *MockRoleDAO {
+	mock := &MockRoleDAO{ctrl: ctrl}
+	mock.recorder = &MockRoleDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRoleDAO) EXPECT() *MockRoleDAOMockRecorder {
+	return m.recorder
+}
+
+// DeleteExcept mocks base method.
+func (m *MockRoleDAO) DeleteExcept(ctx context.Context, names []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExcept", ctx, names)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExcept indicates an expected call of DeleteExcept.
+func (mr *MockRoleDAOMockRecorder) DeleteExcept(ctx, names interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExcept", reflect.TypeOf((*MockRoleDAO)(nil).DeleteExcept), ctx, names)
+}
+
+// FindAll mocks base method.
+func (m *MockRoleDAO) FindAll(ctx context.Context) ([]dao.Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindAll", ctx)
+	ret0, _ := ret[0].([]dao.Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindAll indicates an expected call of FindAll.
+func (mr *MockRoleDAOMockRecorder) FindAll(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAll", reflect.TypeOf((*MockRoleDAO)(nil).FindAll), ctx)
+}
+
+// Upsert mocks base method.
+func (m *MockRoleDAO) Upsert(ctx context.Context, r dao.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, r)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockRoleDAOMockRecorder) Upsert(ctx, r interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockRoleDAO)(nil).Upsert), ctx, r)
+}
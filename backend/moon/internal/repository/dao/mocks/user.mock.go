@@ -65,6 +65,66 @@ func (mr *MockUserDAOMockRecorder) FindById(ctx, id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockUserDAO)(nil).FindById), ctx, id)
 }
 
+// FindByPhone mocks base method.
+func (m *MockUserDAO) FindByPhone(ctx context.Context, phone string) (dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByPhone", ctx, phone)
+	ret0, _ := ret[0].(dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByPhone indicates an expected call of FindByPhone.
+func (mr *MockUserDAOMockRecorder) FindByPhone(ctx, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByPhone", reflect.TypeOf((*MockUserDAO)(nil).FindByPhone), ctx, phone)
+}
+
+// FindByWechat mocks base method.
+func (m *MockUserDAO) FindByWechat(ctx context.Context, openId string) (dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByWechat", ctx, openId)
+	ret0, _ := ret[0].(dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByWechat indicates an expected call of FindByWechat.
+func (mr *MockUserDAOMockRecorder) FindByWechat(ctx, openId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByWechat", reflect.TypeOf((*MockUserDAO)(nil).FindByWechat), ctx, openId)
+}
+
+// FindDeletedByEmail mocks base method.
+func (m *MockUserDAO) FindDeletedByEmail(ctx context.Context, email string) (dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDeletedByEmail", ctx, email)
+	ret0, _ := ret[0].(dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDeletedByEmail indicates an expected call of FindDeletedByEmail.
+func (mr *MockUserDAOMockRecorder) FindDeletedByEmail(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDeletedByEmail", reflect.TypeOf((*MockUserDAO)(nil).FindDeletedByEmail), ctx, email)
+}
+
+// FindDeletedByPhone mocks base method.
+func (m *MockUserDAO) FindDeletedByPhone(ctx context.Context, phone string) (dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDeletedByPhone", ctx, phone)
+	ret0, _ := ret[0].(dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDeletedByPhone indicates an expected call of FindDeletedByPhone.
+func (mr *MockUserDAOMockRecorder) FindDeletedByPhone(ctx, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDeletedByPhone", reflect.TypeOf((*MockUserDAO)(nil).FindDeletedByPhone), ctx, phone)
+}
+
 // Insert mocks base method.
 func (m *MockUserDAO) Insert(ctx context.Context, u dao.User) error {
 	m.ctrl.T.Helper()
@@ -79,6 +139,79 @@ func (mr *MockUserDAOMockRecorder) Insert(ctx, u interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockUserDAO)(nil).Insert), ctx, u)
 }
 
+// MarkEmailVerified mocks base method.
+func (m *MockUserDAO) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEmailVerified", ctx, id, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEmailVerified indicates an expected call of MarkEmailVerified.
+func (mr *MockUserDAOMockRecorder) MarkEmailVerified(ctx, id, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEmailVerified", reflect.TypeOf((*MockUserDAO)(nil).MarkEmailVerified), ctx, id, email)
+}
+
+// Purge mocks base method.
+func (m *MockUserDAO) Purge(ctx context.Context, before int64, limit int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx, before, limit)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockUserDAOMockRecorder) Purge(ctx, before, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockUserDAO)(nil).Purge), ctx, before, limit)
+}
+
+// Restore mocks base method.
+func (m *MockUserDAO) Restore(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockUserDAOMockRecorder) Restore(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockUserDAO)(nil).Restore), ctx, id)
+}
+
+// Search mocks base method.
+func (m *MockUserDAO) Search(ctx context.Context, q dao.UserQuery) ([]dao.User, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, q)
+	ret0, _ := ret[0].([]dao.User)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockUserDAOMockRecorder) Search(ctx, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockUserDAO)(nil).Search), ctx, q)
+}
+
+// SoftDelete mocks base method.
+func (m *MockUserDAO) SoftDelete(ctx context.Context, id, now int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SoftDelete", ctx, id, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SoftDelete indicates an expected call of SoftDelete.
+func (mr *MockUserDAOMockRecorder) SoftDelete(ctx, id, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SoftDelete", reflect.TypeOf((*MockUserDAO)(nil).SoftDelete), ctx, id, now)
+}
+
 // Update mocks base method.
 func (m *MockUserDAO) Update(ctx context.Context, u dao.User) error {
 	m.ctrl.T.Helper()
@@ -92,3 +225,115 @@ func (mr *MockUserDAOMockRecorder) Update(ctx, u interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockUserDAO)(nil).Update), ctx, u)
 }
+
+// UpdateEmail mocks base method.
+func (m *MockUserDAO) UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateEmail", ctx, id, oldEmail, newEmail)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateEmail indicates an expected call of UpdateEmail.
+func (mr *MockUserDAOMockRecorder) UpdateEmail(ctx, id, oldEmail, newEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateEmail", reflect.TypeOf((*MockUserDAO)(nil).UpdateEmail), ctx, id, oldEmail, newEmail)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserDAOMockRecorder) UpdatePassword(ctx, id, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserDAO)(nil).UpdatePassword), ctx, id, password)
+}
+
+// UpdatePhone mocks base method.
+func (m *MockUserDAO) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePhone", ctx, id, phone)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePhone indicates an expected call of UpdatePhone.
+func (mr *MockUserDAOMockRecorder) UpdatePhone(ctx, id, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePhone", reflect.TypeOf((*MockUserDAO)(nil).UpdatePhone), ctx, id, phone)
+}
+
+// UpdateRecoveryCodes mocks base method.
+func (m *MockUserDAO) UpdateRecoveryCodes(ctx context.Context, id int64, old, new string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRecoveryCodes", ctx, id, old, new)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRecoveryCodes indicates an expected call of UpdateRecoveryCodes.
+func (mr *MockUserDAOMockRecorder) UpdateRecoveryCodes(ctx, id, old, new interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRecoveryCodes", reflect.TypeOf((*MockUserDAO)(nil).UpdateRecoveryCodes), ctx, id, old, new)
+}
+
+// UpdateRoles mocks base method.
+func (m *MockUserDAO) UpdateRoles(ctx context.Context, id int64, roles string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRoles", ctx, id, roles)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRoles indicates an expected call of UpdateRoles.
+func (mr *MockUserDAOMockRecorder) UpdateRoles(ctx, id, roles interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRoles", reflect.TypeOf((*MockUserDAO)(nil).UpdateRoles), ctx, id, roles)
+}
+
+// UpdateStatus mocks base method.
+func (m *MockUserDAO) UpdateStatus(ctx context.Context, id int64, status uint8) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, id, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatus indicates an expected call of UpdateStatus.
+func (mr *MockUserDAOMockRecorder) UpdateStatus(ctx, id, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockUserDAO)(nil).UpdateStatus), ctx, id, status)
+}
+
+// UpdateTOTP mocks base method.
+func (m *MockUserDAO) UpdateTOTP(ctx context.Context, id int64, secret string, enabled bool, recoveryCodes string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTOTP", ctx, id, secret, enabled, recoveryCodes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTOTP indicates an expected call of UpdateTOTP.
+func (mr *MockUserDAOMockRecorder) UpdateTOTP(ctx, id, secret, enabled, recoveryCodes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTOTP", reflect.TypeOf((*MockUserDAO)(nil).UpdateTOTP), ctx, id, secret, enabled, recoveryCodes)
+}
+
+// UpdateWechat mocks base method.
+func (m *MockUserDAO) UpdateWechat(ctx context.Context, id int64, openId, unionId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWechat", ctx, id, openId, unionId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateWechat indicates an expected call of UpdateWechat.
+func (mr *MockUserDAOMockRecorder) UpdateWechat(ctx, id, openId, unionId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWechat", reflect.TypeOf((*MockUserDAO)(nil).UpdateWechat), ctx, id, openId, unionId)
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockgen -source=./role.go -package=daomocks -destination=./mocks/role.mock.go RoleDAO
+type RoleDAO interface {
+	// Upsert 按照 name 插入或者更新权限
+	Upsert(ctx context.Context, r Role) error
+	FindAll(ctx context.Context) ([]Role, error)
+	// DeleteExcept 删除名字不在 names 里的角色，返回删除的数量
+	DeleteExcept(ctx context.Context, names []string) (int64, error)
+}
+
+type GORMRoleDAO struct {
+	db *gorm.DB
+}
+
+func NewRoleDAO(db *gorm.DB) RoleDAO {
+	return &GORMRoleDAO{db: db}
+}
+
+func (dao *GORMRoleDAO) Upsert(ctx context.Context, r Role) error {
+	now := time.Now().UnixMilli()
+	r.Ctime = now
+	r.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permissions", "utime"}),
+	}).Create(&r).Error
+}
+
+func (dao *GORMRoleDAO) FindAll(ctx context.Context) ([]Role, error) {
+	var res []Role
+	err := dao.db.WithContext(ctx).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMRoleDAO) DeleteExcept(ctx context.Context, names []string) (int64, error) {
+	query := dao.db.WithContext(ctx)
+	if len(names) > 0 {
+		query = query.Where("name NOT IN ?", names)
+	} else {
+		// 配置里一个角色都没有，全部删掉，gorm 默认不允许没有条件的 Delete
+		query = query.Session(&gorm.Session{AllowGlobalUpdate: true})
+	}
+	res := query.Delete(&Role{})
+	return res.RowsAffected, res.Error
+}
+
+type Role struct {
+	Id   int64  `gorm:"primaryKey,autoIncrement"`
+	Name string `gorm:"type:varchar(64);unique"`
+	// 逗号分隔的权限列表
+	Permissions string `gorm:"type:varchar(4096)"`
+
+	Ctime int64
+	Utime int64
+}
@@ -13,15 +13,66 @@ import (
 
 var (
 	ErrDuplicateEmail = errors.New("邮箱冲突")
-	ErrRecordNotFound = gorm.ErrRecordNotFound
+	ErrDuplicatePhone = errors.New("手机号冲突")
+	// ErrDuplicateWechat 微信账号已经绑定在别的用户上了
+	ErrDuplicateWechat = errors.New("微信账号冲突")
+	ErrRecordNotFound  = gorm.ErrRecordNotFound
+)
+
+// 和 domain.UserStatus 一致
+const (
+	statusActive  uint8 = 0
+	statusDeleted uint8 = 2
 )
 
 //go:generate mockgen -source=./user.go -package=daomocks -destination=./mocks/user.mock.go UserDAO
 type UserDAO interface {
 	Insert(ctx context.Context, u User) error
 	FindByEmail(ctx context.Context, email string) (User, error)
+	FindByPhone(ctx context.Context, phone string) (User, error)
+	FindByWechat(ctx context.Context, openId string) (User, error)
 	FindById(ctx context.Context, id int64) (User, error)
 	Update(ctx context.Context, u User) error
+	// UpdateRoles roles 是逗号分隔的角色名
+	UpdateRoles(ctx context.Context, id int64, roles string) error
+	UpdateStatus(ctx context.Context, id int64, status uint8) error
+	// UpdatePassword password 是哈希之后的密码，Update 不会改密码
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	// UpdateTOTP recoveryCodes 是逗号分隔的恢复码哈希
+	UpdateTOTP(ctx context.Context, id int64, secret string, enabled bool, recoveryCodes string) error
+	// UpdateRecoveryCodes 只有恢复码还是 old 的时候才更新，防止并发的请求用掉同一个恢复码
+	UpdateRecoveryCodes(ctx context.Context, id int64, old, new string) error
+	// MarkEmailVerified 只有邮箱还是 email 的时候才更新，验证链接发出去之后邮箱可能已经改了
+	MarkEmailVerified(ctx context.Context, id int64, email string) error
+	// UpdatePhone 绑定或者换绑手机号，phone 为空表示解绑，已经被别人绑定了的时候返回 ErrDuplicatePhone
+	UpdatePhone(ctx context.Context, id int64, phone string) error
+	// UpdateEmail 只有邮箱还是 oldEmail 的时候才换成 newEmail，新邮箱已经点过确认链接了，直接标记为已验证
+	// 新邮箱已经被别人用了的时候返回 ErrDuplicateEmail
+	UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error
+	// UpdateWechat 绑定或者换绑微信，已经被别人绑定了的时候返回 ErrDuplicateWechat
+	UpdateWechat(ctx context.Context, id int64, openId, unionId string) error
+	// Search 返回当前页的用户和满足条件的总数
+	Search(ctx context.Context, q UserQuery) ([]User, int64, error)
+	// SoftDelete 注销账号，邮箱和手机号挪到 deleted_ 开头的列里，这样别人可以用它们重新注册
+	// 微信不挪，彻底删除之前还是绑定在这个账号上
+	// 已经注销过的返回 ErrRecordNotFound
+	SoftDelete(ctx context.Context, id int64, now int64) error
+	// FindDeletedByEmail 找这个邮箱注销之后还在宽限期里的账号
+	FindDeletedByEmail(ctx context.Context, email string) (User, error)
+	// FindDeletedByPhone 找这个手机号注销之后还在宽限期里的账号
+	FindDeletedByPhone(ctx context.Context, phone string) (User, error)
+	// Restore 恢复注销的账号，邮箱或者手机号已经被别人注册了的时候返回 ErrDuplicateEmail 或者 ErrDuplicatePhone
+	Restore(ctx context.Context, id int64) error
+	// Purge 彻底删除 before 之前注销的账号，连同绑定的第三方账号和个人访问令牌，最多删除 limit 个
+	Purge(ctx context.Context, before int64, limit int) (int64, error)
+}
+
+type UserQuery struct {
+	Email    string
+	Phone    string
+	Nickname string
+	Offset   int
+	Limit    int
 }
 
 type GORMUserDAO struct {
@@ -38,6 +89,18 @@ func (dao *GORMUserDAO) FindByEmail(ctx context.Context, email string) (User, er
 	return u, nil
 }
 
+func (dao *GORMUserDAO) FindByPhone(ctx context.Context, phone string) (User, error) {
+	var u User
+	err := dao.db.WithContext(ctx).Where("phone = ?", phone).First(&u).Error
+	return u, err
+}
+
+func (dao *GORMUserDAO) FindByWechat(ctx context.Context, openId string) (User, error) {
+	var u User
+	err := dao.db.WithContext(ctx).Where("wechat_open_id = ?", openId).First(&u).Error
+	return u, err
+}
+
 func (dao *GORMUserDAO) FindById(ctx context.Context, id int64) (User, error) {
 	var u User
 	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&u).Error
@@ -47,20 +110,246 @@ func (dao *GORMUserDAO) FindById(ctx context.Context, id int64) (User, error) {
 func (dao *GORMUserDAO) Update(ctx context.Context, u User) error {
 	now := time.Now().UnixMilli()
 	u.Utime = now
-	err := dao.db.WithContext(ctx).Model(&u).Where("id = ?", u.Id).Updates(map[string]interface{}{
+	// 邮箱和手机号都要验证，分别走 UpdateEmail 和 UpdatePhone
+	return dao.db.WithContext(ctx).Model(&u).Where("id = ?", u.Id).Updates(map[string]interface{}{
 		"nickname": u.Nickname,
 		"birthday": u.Birthday,
 		"about_me": u.AboutMe,
-		"phone":    u.Phone,
 		"utime":    u.Utime,
 	}).Error
+}
+
+func (dao *GORMUserDAO) UpdateRoles(ctx context.Context, id int64, roles string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"roles": roles,
+		"utime": time.Now().UnixMilli(),
+	}).Error
+}
+
+func (dao *GORMUserDAO) UpdateStatus(ctx context.Context, id int64, status uint8) error {
+	// 注销的账号只能由用户自己恢复
+	res := dao.db.WithContext(ctx).Model(&User{}).Where("id = ? AND deleted_at = 0", id).Updates(map[string]interface{}{
+		"status": status,
+		"utime":  time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password": password,
+		"utime":    time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdateTOTP(ctx context.Context, id int64, secret string, enabled bool, recoveryCodes string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":         secret,
+		"totp_enabled":        enabled,
+		"totp_recovery_codes": recoveryCodes,
+		"utime":               time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdateRecoveryCodes(ctx context.Context, id int64, old, new string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND totp_recovery_codes = ?", id, old).Updates(map[string]interface{}{
+		"totp_recovery_codes": new,
+		"utime":               time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND email = ?", id, email).Updates(map[string]interface{}{
+		"email_verified": true,
+		"utime":          time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND deleted_at = 0", id).Updates(map[string]interface{}{
+		"phone": sql.NullString{String: phone, Valid: phone != ""},
+		"utime": time.Now().UnixMilli(),
+	})
+	if isDuplicate(res.Error) {
+		return duplicateErr(res.Error)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND email = ? AND deleted_at = 0", id, oldEmail).Updates(map[string]interface{}{
+		"email":          newEmail,
+		"email_verified": true,
+		"utime":          time.Now().UnixMilli(),
+	})
+	if isDuplicate(res.Error) {
+		return ErrDuplicateEmail
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdateWechat(ctx context.Context, id int64, openId, unionId string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND deleted_at = 0", id).Updates(map[string]interface{}{
+		"wechat_open_id":  sql.NullString{String: openId, Valid: openId != ""},
+		"wechat_union_id": sql.NullString{String: unionId, Valid: unionId != ""},
+		"utime":           time.Now().UnixMilli(),
+	})
+	if isDuplicate(res.Error) {
+		return duplicateErr(res.Error)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) Search(ctx context.Context, q UserQuery) ([]User, int64, error) {
+	query := dao.db.WithContext(ctx).Model(&User{})
+	if q.Email != "" {
+		query = query.Where("email LIKE ?", escapeLike(q.Email)+"%")
+	}
+	if q.Phone != "" {
+		query = query.Where("phone LIKE ?", escapeLike(q.Phone)+"%")
+	}
+	if q.Nickname != "" {
+		query = query.Where("nickname LIKE ?", "%"+escapeLike(q.Nickname)+"%")
+	}
+	var total int64
+	err := query.Count(&total).Error
 	if err != nil {
-		errStr := strings.ToLower(err.Error())
-		if strings.Contains(errStr, "duplicate") || strings.Contains(errStr, "unique") {
-			return ErrDuplicateEmail
-		}
+		return nil, 0, err
 	}
-	return err
+	var res []User
+	err = query.Order("id DESC").Offset(q.Offset).Limit(q.Limit).Find(&res).Error
+	return res, total, err
+}
+
+func (dao *GORMUserDAO) SoftDelete(ctx context.Context, id int64, now int64) error {
+	// MySQL 的 UPDATE 从左到右赋值，所以要先挪走再清空，不能用 Updates(map)，它会按列名排序
+	res := dao.db.WithContext(ctx).Exec("UPDATE users SET deleted_email = email, deleted_phone = phone, "+
+		"email = NULL, phone = NULL, status = ?, deleted_at = ?, utime = ? WHERE id = ? AND deleted_at = 0",
+		statusDeleted, now, now, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) FindDeletedByEmail(ctx context.Context, email string) (User, error) {
+	var u User
+	// 同一个邮箱可能注册、注销了好几次，最近的那个才有可能还在宽限期里
+	err := dao.db.WithContext(ctx).Where("deleted_email = ? AND deleted_at > 0", email).
+		Order("deleted_at DESC").First(&u).Error
+	return u, err
+}
+
+func (dao *GORMUserDAO) FindDeletedByPhone(ctx context.Context, phone string) (User, error) {
+	var u User
+	err := dao.db.WithContext(ctx).Where("deleted_phone = ? AND deleted_at > 0", phone).
+		Order("deleted_at DESC").First(&u).Error
+	return u, err
+}
+
+func (dao *GORMUserDAO) Restore(ctx context.Context, id int64) error {
+	res := dao.db.WithContext(ctx).Exec("UPDATE users SET email = deleted_email, phone = deleted_phone, "+
+		"deleted_email = NULL, deleted_phone = NULL, status = ?, deleted_at = 0, utime = ? WHERE id = ? AND deleted_at > 0",
+		statusActive, time.Now().UnixMilli(), id)
+	if isDuplicate(res.Error) {
+		return duplicateErr(res.Error)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) Purge(ctx context.Context, before int64, limit int) (int64, error) {
+	var ids []int64
+	err := dao.db.WithContext(ctx).Model(&User{}).
+		Where("deleted_at > 0 AND deleted_at < ?", before).
+		Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	var cnt int64
+	err = dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id IN ?", ids).Delete(&ExternalIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("uid IN ?", ids).Delete(&AccessToken{}).Error; err != nil {
+			return err
+		}
+		// 查出来之后用户可能刚好恢复了，所以这里还要再判断一次
+		res := tx.Where("id IN ? AND deleted_at > 0 AND deleted_at < ?", ids, before).Delete(&User{})
+		cnt = res.RowsAffected
+		return res.Error
+	})
+	return cnt, err
+}
+
+// escapeLike 用户输入里的 % 和 _ 不应该当成通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 // Insert implements [UserDAO].
@@ -69,19 +358,38 @@ func (dao *GORMUserDAO) Insert(ctx context.Context, u User) error {
 	u.Ctime = now
 	u.Utime = now
 	err := dao.db.WithContext(ctx).Create(&u).Error
+	if isDuplicate(err) {
+		return duplicateErr(err)
+	}
+	return err
+}
+
+// duplicateErr 根据冲突的唯一索引区分是手机号、微信还是邮箱冲突
+// MySQL 的错误信息是 Duplicate entry 'xxx' for key 'users.phone'，只看 for key 后面，前面的值是用户输入的
+func duplicateErr(err error) error {
+	msg := err.Error()
+	i := strings.LastIndex(msg, "for key")
+	switch {
+	case i >= 0 && strings.Contains(msg[i:], "phone"):
+		return ErrDuplicatePhone
+	case i >= 0 && strings.Contains(msg[i:], "wechat"):
+		return ErrDuplicateWechat
+	default:
+		return ErrDuplicateEmail
+	}
+}
+
+// isDuplicate 是否违反了唯一索引
+func isDuplicate(err error) bool {
+	if err == nil {
+		return false
+	}
 	if me, ok := err.(*mysql.MySQLError); ok {
 		const duplicateErr uint16 = 1062
-		if me.Number == duplicateErr {
-			return ErrDuplicateEmail
-		}
+		return me.Number == duplicateErr
 	}
-	if err != nil {
-		errStr := strings.ToLower(err.Error())
-		if strings.Contains(errStr, "duplicate") || strings.Contains(errStr, "unique") {
-			return ErrDuplicateEmail
-		}
-	}
-	return err
+	errStr := strings.ToLower(err.Error())
+	return strings.Contains(errStr, "duplicate") || strings.Contains(errStr, "unique")
 }
 
 func NewUserDAO(db *gorm.DB) UserDAO {
@@ -98,8 +406,9 @@ type User struct {
 	Id int64 `gorm:"primaryKey,autoIncrement"`
 	// 代表这是一个可以为 NULL 的列
 	//Email    *string
-	Email    sql.NullString `gorm:"unique"`
-	Password string
+	Email         sql.NullString `gorm:"unique"`
+	EmailVerified bool
+	Password      string
 
 	Nickname string `gorm:"type=varchar(128)"`
 	// YYYY-MM-DD
@@ -109,11 +418,27 @@ type User struct {
 	// 代表这是一个可以为 NULL 的列
 	Phone sql.NullString `gorm:"unique"`
 
+	// 逗号分隔的角色名
+	Roles string `gorm:"type:varchar(1024)"`
+	// 0 正常，1 禁用，2 注销
+	Status uint8
+	// DeletedAt 注销的时间，没有注销是 0
+	DeletedAt int64 `gorm:"index"`
+	// DeletedEmail 注销之后邮箱挪到这里，恢复的时候再挪回去
+	DeletedEmail sql.NullString `gorm:"index"`
+	DeletedPhone sql.NullString `gorm:"index"`
+
 	// 1 如果查询要求同时使用 openid 和 unionid，就要创建联合唯一索引
 	// 2 如果查询只用 openid，那么就在 openid 上创建唯一索引，或者 <openid, unionId> 联合索引
 	// 3 如果查询只用 unionid，那么就在 unionid 上创建唯一索引，或者 <unionid, openid> 联合索引
-	// WechatOpenId  sql.NullString `gorm:"unique"`
-	// WechatUnionId sql.NullString
+	WechatOpenId  sql.NullString `gorm:"unique"`
+	WechatUnionId sql.NullString
+
+	// TotpSecret 加密之后的 TOTP 密钥
+	TotpSecret  string `gorm:"type:varchar(255)"`
+	TotpEnabled bool
+	// TotpRecoveryCodes 逗号分隔的恢复码哈希
+	TotpRecoveryCodes string `gorm:"type:varchar(1024)"`
 
 	// 时区，UTC 0 的毫秒数
 	// 创建时间
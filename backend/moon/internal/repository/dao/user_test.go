@@ -29,8 +29,10 @@ func TestGORMUserDAO_Insert(t *testing.T) {
 				assert.NoError(t, err)
 				mockRes := sqlmock.NewResult(123, 1)
 				mock.ExpectExec("INSERT INTO .*").WithArgs(
-					sqlmock.AnyArg(), sqlmock.AnyArg(), "Tom", sqlmock.AnyArg(), sqlmock.AnyArg(),
-					sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+					sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "Tom", sqlmock.AnyArg(),
+					sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+					sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+					sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
 				).WillReturnResult(mockRes)
 				return db
 			},
@@ -175,3 +177,179 @@ func TestGORMUserDAO_FindByEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestGORMUserDAO_Restore(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "恢复成功",
+			mock: func(mock sqlmock.Sqlmock) {
+				// 邮箱要先挪回去再清空 deleted_email
+				mock.ExpectExec("UPDATE users SET email = deleted_email, phone = deleted_phone, deleted_email = NULL.*").
+					WithArgs(uint8(0), sqlmock.AnyArg(), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "邮箱已经被别人注册了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users .*").
+					WillReturnError(&mysqlDriver.MySQLError{Number: 1062})
+			},
+			wantErr: ErrDuplicateEmail,
+		},
+		{
+			name: "没有注销或者已经被清理了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users .*").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrRecordNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			assert.NoError(t, err)
+			err = NewUserDAO(db).Restore(context.Background(), 1)
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGORMUserDAO_UpdateEmail(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "修改成功",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` SET `email`=\\?,`email_verified`=\\?,`utime`=\\? WHERE id = \\? AND email = \\? AND deleted_at = 0").
+					WithArgs("new@example.com", true, sqlmock.AnyArg(), int64(1), "old@example.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "新邮箱已经被别人用了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` .*").
+					WillReturnError(&mysqlDriver.MySQLError{Number: 1062})
+			},
+			wantErr: ErrDuplicateEmail,
+		},
+		{
+			name: "邮箱已经改过了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` .*").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrRecordNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			assert.NoError(t, err)
+			err = NewUserDAO(db).UpdateEmail(context.Background(), 1, "old@example.com", "new@example.com")
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGORMUserDAO_UpdatePhone(t *testing.T) {
+	testCases := []struct {
+		name    string
+		phone   string
+		mock    func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name:  "绑定成功",
+			phone: "+8613800138000",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` SET `phone`=\\?,`utime`=\\? WHERE id = \\? AND deleted_at = 0").
+					WithArgs(sql.NullString{String: "+8613800138000", Valid: true}, sqlmock.AnyArg(), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "解绑写 NULL",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` .*").
+					WithArgs(sql.NullString{}, sqlmock.AnyArg(), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:  "已经被别人绑定了",
+			phone: "+8613800138000",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` .*").WillReturnError(&mysqlDriver.MySQLError{
+					Number: 1062, Message: "Duplicate entry '+8613800138000' for key 'users.phone'"})
+			},
+			wantErr: ErrDuplicatePhone,
+		},
+		{
+			name:  "注销了",
+			phone: "+8613800138000",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE `users` .*").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrRecordNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			assert.NoError(t, err)
+			err = NewUserDAO(db).UpdatePhone(context.Background(), 1, tc.phone)
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDuplicateErr(t *testing.T) {
+	assert.Equal(t, ErrDuplicatePhone, duplicateErr(&mysqlDriver.MySQLError{
+		Number: 1062, Message: "Duplicate entry '+8613800138000' for key 'users.phone'"}))
+	// 冲突的值是用户输入的，不能按值判断
+	assert.Equal(t, ErrDuplicateEmail, duplicateErr(&mysqlDriver.MySQLError{
+		Number: 1062, Message: "Duplicate entry 'phone@example.com' for key 'users.email'"}))
+	assert.Equal(t, ErrDuplicateWechat, duplicateErr(&mysqlDriver.MySQLError{
+		Number: 1062, Message: "Duplicate entry 'openid-1' for key 'users.wechat_open_id'"}))
+}
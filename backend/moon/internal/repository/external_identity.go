@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"moon/internal/domain"
+	"moon/internal/repository/dao"
+)
+
+var ErrIdentityLinked = dao.ErrIdentityLinked
+
+//go:generate mockgen -source=./external_identity.go -package=repomocks -destination=./mocks/external_identity.mock.go ExternalIdentityRepository
+type ExternalIdentityRepository interface {
+	FindBySubject(ctx context.Context, provider, subject string) (domain.ExternalIdentity, error)
+	Link(ctx context.Context, ei domain.ExternalIdentity) error
+	// CreateUser 创建用户并绑定第三方账号，返回用户 ID
+	CreateUser(ctx context.Context, u domain.User, ei domain.ExternalIdentity) (int64, error)
+}
+
+type GORMExternalIdentityRepository struct {
+	dao dao.ExternalIdentityDAO
+}
+
+func NewGORMExternalIdentityRepository(dao dao.ExternalIdentityDAO) ExternalIdentityRepository {
+	return &GORMExternalIdentityRepository{dao: dao}
+}
+
+func (r *GORMExternalIdentityRepository) FindBySubject(ctx context.Context, provider, subject string) (domain.ExternalIdentity, error) {
+	ei, err := r.dao.FindBySubject(ctx, provider, subject)
+	if err != nil {
+		return domain.ExternalIdentity{}, err
+	}
+	return domain.ExternalIdentity{
+		Provider: ei.Provider,
+		Subject:  ei.Subject,
+		Email:    ei.Email.String,
+		UserId:   ei.UserId,
+	}, nil
+}
+
+func (r *GORMExternalIdentityRepository) Link(ctx context.Context, ei domain.ExternalIdentity) error {
+	return r.dao.Link(ctx, r.toEntity(ei))
+}
+
+func (r *GORMExternalIdentityRepository) CreateUser(ctx context.Context, u domain.User, ei domain.ExternalIdentity) (int64, error) {
+	return r.dao.CreateUser(ctx, domainToDaoUser(u), r.toEntity(ei))
+}
+
+func (r *GORMExternalIdentityRepository) toEntity(ei domain.ExternalIdentity) dao.ExternalIdentity {
+	return dao.ExternalIdentity{
+		Provider: ei.Provider,
+		Subject:  ei.Subject,
+		UserId:   ei.UserId,
+		Email:    sql.NullString{String: ei.Email, Valid: ei.Email != ""},
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"moon/internal/domain"
 	"moon/internal/repository/dao"
+	"strings"
 	"time"
 )
 
@@ -28,6 +29,22 @@ func (r *GORMUserRepository) FindByEmail(ctx context.Context, email string) (dom
 	return daoToDomainUser(daoUser), nil
 }
 
+func (r *GORMUserRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	daoUser, err := r.dao.FindByPhone(ctx, phone)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return daoToDomainUser(daoUser), nil
+}
+
+func (r *GORMUserRepository) FindByWechat(ctx context.Context, openId string) (domain.User, error) {
+	daoUser, err := r.dao.FindByWechat(ctx, openId)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return daoToDomainUser(daoUser), nil
+}
+
 func (r *GORMUserRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
 	daoUser, err := r.dao.FindById(ctx, id)
 	if err != nil {
@@ -40,28 +57,157 @@ func (r *GORMUserRepository) Update(ctx context.Context, u domain.User) error {
 	return r.dao.Update(ctx, domainToDaoUser(u))
 }
 
+func (r *GORMUserRepository) UpdateRoles(ctx context.Context, id int64, roles []string) error {
+	return r.dao.UpdateRoles(ctx, id, joinList(roles))
+}
+
+func (r *GORMUserRepository) UpdateStatus(ctx context.Context, id int64, status domain.UserStatus) error {
+	return r.dao.UpdateStatus(ctx, id, uint8(status))
+}
+
+func (r *GORMUserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return r.dao.UpdatePassword(ctx, id, password)
+}
+
+func (r *GORMUserRepository) UpdateTOTP(ctx context.Context, id int64, info domain.TOTPInfo) error {
+	return r.dao.UpdateTOTP(ctx, id, info.Secret, info.Enabled, joinList(info.RecoveryCodes))
+}
+
+func (r *GORMUserRepository) UpdateRecoveryCodes(ctx context.Context, id int64, old, new []string) error {
+	return r.dao.UpdateRecoveryCodes(ctx, id, joinList(old), joinList(new))
+}
+
+func (r *GORMUserRepository) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	return r.dao.MarkEmailVerified(ctx, id, email)
+}
+
+func (r *GORMUserRepository) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	return r.dao.UpdatePhone(ctx, id, phone)
+}
+
+func (r *GORMUserRepository) UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	return r.dao.UpdateEmail(ctx, id, oldEmail, newEmail)
+}
+
+func (r *GORMUserRepository) UpdateWechat(ctx context.Context, id int64, info domain.WechatInfo) error {
+	return r.dao.UpdateWechat(ctx, id, info.OpenId, info.UnionId)
+}
+
+func (r *GORMUserRepository) Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error) {
+	users, total, err := r.dao.Search(ctx, dao.UserQuery{
+		Email:    q.Email,
+		Phone:    q.Phone,
+		Nickname: q.Nickname,
+		Offset:   q.Offset,
+		Limit:    q.Limit,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]domain.User, 0, len(users))
+	for _, u := range users {
+		res = append(res, daoToDomainUser(u))
+	}
+	return res, total, nil
+}
+
+func (r *GORMUserRepository) SoftDelete(ctx context.Context, id int64, now time.Time) error {
+	return r.dao.SoftDelete(ctx, id, now.UnixMilli())
+}
+
+func (r *GORMUserRepository) FindDeletedByEmail(ctx context.Context, email string) (domain.User, error) {
+	daoUser, err := r.dao.FindDeletedByEmail(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return daoToDomainUser(daoUser), nil
+}
+
+func (r *GORMUserRepository) FindDeletedByPhone(ctx context.Context, phone string) (domain.User, error) {
+	daoUser, err := r.dao.FindDeletedByPhone(ctx, phone)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return daoToDomainUser(daoUser), nil
+}
+
+func (r *GORMUserRepository) Restore(ctx context.Context, id int64) error {
+	return r.dao.Restore(ctx, id)
+}
+
+func (r *GORMUserRepository) Purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return r.dao.Purge(ctx, before.UnixMilli(), limit)
+}
+
 func domainToDaoUser(u domain.User) dao.User {
 	return dao.User{
-		Id:       u.Id,
-		Email:    sql.NullString{String: u.Email, Valid: u.Email != ""},
-		Password: u.Password,
-		Nickname: u.Nickname,
-		Birthday: u.Birthday.UnixMilli(),
-		AboutMe:  u.AboutMe,
-		Phone:    sql.NullString{String: u.Phone, Valid: u.Phone != ""},
-		Ctime:    u.Ctime.UnixMilli(),
+		Id:            u.Id,
+		Email:         sql.NullString{String: u.Email, Valid: u.Email != ""},
+		EmailVerified: u.EmailVerified,
+		Password:      u.Password,
+		Nickname:      u.Nickname,
+		Birthday:      u.Birthday.UnixMilli(),
+		AboutMe:       u.AboutMe,
+		Phone:         sql.NullString{String: u.Phone, Valid: u.Phone != ""},
+		WechatOpenId: sql.NullString{
+			String: u.WechatInfo.OpenId,
+			Valid:  u.WechatInfo.OpenId != "",
+		},
+		WechatUnionId: sql.NullString{
+			String: u.WechatInfo.UnionId,
+			Valid:  u.WechatInfo.UnionId != "",
+		},
+		TotpSecret:        u.TOTP.Secret,
+		TotpEnabled:       u.TOTP.Enabled,
+		TotpRecoveryCodes: joinList(u.TOTP.RecoveryCodes),
+		Roles:             joinList(u.Roles),
+		Status:            uint8(u.Status),
+		Ctime:             u.Ctime.UnixMilli(),
 	}
 }
 
 func daoToDomainUser(u dao.User) domain.User {
 	return domain.User{
-		Id:       u.Id,
-		Email:    u.Email.String,
-		Password: u.Password,
-		Nickname: u.Nickname,
-		Birthday: time.UnixMilli(u.Birthday),
-		AboutMe:  u.AboutMe,
-		Phone:    u.Phone.String,
-		Ctime:    time.UnixMilli(u.Ctime),
+		Id:            u.Id,
+		Email:         u.Email.String,
+		EmailVerified: u.EmailVerified,
+		Password:      u.Password,
+		Nickname:      u.Nickname,
+		Birthday:      time.UnixMilli(u.Birthday),
+		AboutMe:       u.AboutMe,
+		Phone:         u.Phone.String,
+		WechatInfo: domain.WechatInfo{
+			OpenId:  u.WechatOpenId.String,
+			UnionId: u.WechatUnionId.String,
+		},
+		TOTP: domain.TOTPInfo{
+			Secret:        u.TotpSecret,
+			Enabled:       u.TotpEnabled,
+			RecoveryCodes: splitList(u.TotpRecoveryCodes),
+		},
+		Roles:     splitList(u.Roles),
+		Status:    domain.UserStatus(u.Status),
+		DeletedAt: toTime(u.DeletedAt),
+		Ctime:     time.UnixMilli(u.Ctime),
+	}
+}
+
+// toTime 0 表示没有，转成零值，不然会变成 1970 年
+func toTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// joinList 角色、权限之类的列表在数据库里用逗号分隔存储
+func joinList(vals []string) string {
+	return strings.Join(vals, ",")
+}
+
+func splitList(val string) []string {
+	if val == "" {
+		return nil
 	}
+	return strings.Split(val, ",")
 }
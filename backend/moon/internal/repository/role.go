@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"moon/internal/domain"
+	"moon/internal/repository/dao"
+)
+
+//go:generate mockgen -source=./role.go -package=repomocks -destination=./mocks/role.mock.go RoleRepository
+type RoleRepository interface {
+	// Save 按照角色名保存，已经存在的角色会覆盖权限
+	Save(ctx context.Context, r domain.Role) error
+	FindAll(ctx context.Context) ([]domain.Role, error)
+	// DeleteExcept 删除名字不在 names 里的角色，返回删除的数量
+	DeleteExcept(ctx context.Context, names []string) (int64, error)
+}
+
+type GORMRoleRepository struct {
+	dao dao.RoleDAO
+}
+
+func NewGORMRoleRepository(dao dao.RoleDAO) RoleRepository {
+	return &GORMRoleRepository{dao: dao}
+}
+
+func (r *GORMRoleRepository) Save(ctx context.Context, role domain.Role) error {
+	return r.dao.Upsert(ctx, dao.Role{
+		Name:        role.Name,
+		Permissions: joinList(role.Permissions),
+	})
+}
+
+func (r *GORMRoleRepository) FindAll(ctx context.Context) ([]domain.Role, error) {
+	roles, err := r.dao.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Role, 0, len(roles))
+	for _, role := range roles {
+		res = append(res, domain.Role{
+			Id:          role.Id,
+			Name:        role.Name,
+			Permissions: splitList(role.Permissions),
+		})
+	}
+	return res, nil
+}
+
+func (r *GORMRoleRepository) DeleteExcept(ctx context.Context, names []string) (int64, error) {
+	return r.dao.DeleteExcept(ctx, names)
+}
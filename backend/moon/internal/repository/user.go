@@ -4,19 +4,51 @@ import (
 	"context"
 	"moon/internal/domain"
 	"moon/internal/repository/dao"
+	"time"
 )
 
 var (
 	ErrDuplicateUser = dao.ErrDuplicateEmail
-	ErrUserNotFound  = dao.ErrRecordNotFound
+	// ErrDuplicatePhone 手机号已经被别的账号绑定了
+	ErrDuplicatePhone = dao.ErrDuplicatePhone
+	// ErrDuplicateWechat 微信账号已经绑定在别的用户上了
+	ErrDuplicateWechat = dao.ErrDuplicateWechat
+	ErrUserNotFound    = dao.ErrRecordNotFound
 )
 
 //go:generate mockgen -source=./user.go -package=repomocks -destination=./mocks/user.mock.go UserRepository
 type UserRepository interface {
 	Create(ctx context.Context, u domain.User) error
 	FindByEmail(ctx context.Context, email string) (domain.User, error)
+	FindByPhone(ctx context.Context, phone string) (domain.User, error)
+	FindByWechat(ctx context.Context, openId string) (domain.User, error)
 	FindById(ctx context.Context, id int64) (domain.User, error)
 	Update(ctx context.Context, u domain.User) error
+	UpdateRoles(ctx context.Context, id int64, roles []string) error
+	UpdateStatus(ctx context.Context, id int64, status domain.UserStatus) error
+	// UpdatePassword password 是哈希之后的密码
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateTOTP(ctx context.Context, id int64, info domain.TOTPInfo) error
+	// UpdateRecoveryCodes 恢复码已经被别的请求改过的时候返回 ErrUserNotFound
+	UpdateRecoveryCodes(ctx context.Context, id int64, old, new []string) error
+	MarkEmailVerified(ctx context.Context, id int64, email string) error
+	// UpdatePhone phone 为空表示解绑，已经被别人绑定了的时候返回 ErrDuplicatePhone
+	UpdatePhone(ctx context.Context, id int64, phone string) error
+	// UpdateEmail 邮箱已经不是 oldEmail 的时候返回 ErrUserNotFound，newEmail 被别人用了的时候返回 ErrDuplicateUser
+	UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error
+	// UpdateWechat 已经被别人绑定了的时候返回 ErrDuplicateWechat
+	UpdateWechat(ctx context.Context, id int64, info domain.WechatInfo) error
+	Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error)
+	// SoftDelete 注销账号，邮箱和手机号会被释放出来，已经注销过的返回 ErrUserNotFound
+	SoftDelete(ctx context.Context, id int64, now time.Time) error
+	// FindDeletedByEmail 找这个邮箱最近注销的账号
+	FindDeletedByEmail(ctx context.Context, email string) (domain.User, error)
+	// FindDeletedByPhone 找这个手机号最近注销的账号
+	FindDeletedByPhone(ctx context.Context, phone string) (domain.User, error)
+	// Restore 邮箱或者手机号已经被别人注册了的时候返回 ErrDuplicateUser 或者 ErrDuplicatePhone
+	Restore(ctx context.Context, id int64) error
+	// Purge 彻底删除 before 之前注销的账号，返回删除的数量
+	Purge(ctx context.Context, before time.Time, limit int) (int64, error)
 }
 
 type CachedUserRepository struct {
@@ -34,6 +66,14 @@ func (c *CachedUserRepository) FindByEmail(ctx context.Context, email string) (d
 	return c.repo.FindByEmail(ctx, email)
 }
 
+func (c *CachedUserRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	return c.repo.FindByPhone(ctx, phone)
+}
+
+func (c *CachedUserRepository) FindByWechat(ctx context.Context, openId string) (domain.User, error) {
+	return c.repo.FindByWechat(ctx, openId)
+}
+
 func (c *CachedUserRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
 	return c.repo.FindById(ctx, id)
 }
@@ -42,6 +82,66 @@ func (c *CachedUserRepository) Update(ctx context.Context, u domain.User) error
 	return c.repo.Update(ctx, u)
 }
 
+func (c *CachedUserRepository) UpdateRoles(ctx context.Context, id int64, roles []string) error {
+	return c.repo.UpdateRoles(ctx, id, roles)
+}
+
+func (c *CachedUserRepository) UpdateStatus(ctx context.Context, id int64, status domain.UserStatus) error {
+	return c.repo.UpdateStatus(ctx, id, status)
+}
+
+func (c *CachedUserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return c.repo.UpdatePassword(ctx, id, password)
+}
+
+func (c *CachedUserRepository) UpdateTOTP(ctx context.Context, id int64, info domain.TOTPInfo) error {
+	return c.repo.UpdateTOTP(ctx, id, info)
+}
+
+func (c *CachedUserRepository) UpdateRecoveryCodes(ctx context.Context, id int64, old, new []string) error {
+	return c.repo.UpdateRecoveryCodes(ctx, id, old, new)
+}
+
+func (c *CachedUserRepository) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	return c.repo.MarkEmailVerified(ctx, id, email)
+}
+
+func (c *CachedUserRepository) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	return c.repo.UpdatePhone(ctx, id, phone)
+}
+
+func (c *CachedUserRepository) UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	return c.repo.UpdateEmail(ctx, id, oldEmail, newEmail)
+}
+
+func (c *CachedUserRepository) UpdateWechat(ctx context.Context, id int64, info domain.WechatInfo) error {
+	return c.repo.UpdateWechat(ctx, id, info)
+}
+
+func (c *CachedUserRepository) Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error) {
+	return c.repo.Search(ctx, q)
+}
+
+func (c *CachedUserRepository) SoftDelete(ctx context.Context, id int64, now time.Time) error {
+	return c.repo.SoftDelete(ctx, id, now)
+}
+
+func (c *CachedUserRepository) FindDeletedByEmail(ctx context.Context, email string) (domain.User, error) {
+	return c.repo.FindDeletedByEmail(ctx, email)
+}
+
+func (c *CachedUserRepository) FindDeletedByPhone(ctx context.Context, phone string) (domain.User, error) {
+	return c.repo.FindDeletedByPhone(ctx, phone)
+}
+
+func (c *CachedUserRepository) Restore(ctx context.Context, id int64) error {
+	return c.repo.Restore(ctx, id)
+}
+
+func (c *CachedUserRepository) Purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return c.repo.Purge(ctx, before, limit)
+}
+
 func NewCachedUserRepository(dao dao.UserDAO, repo UserRepository) UserRepository {
 	return &CachedUserRepository{
 		dao:  dao,
@@ -41,6 +41,32 @@ func (m *mockUserDAO) FindByEmail(ctx context.Context, email string) (dao.User,
 	return dao.User{}, dao.ErrRecordNotFound
 }
 
+func (m *mockUserDAO) FindByPhone(ctx context.Context, phone string) (dao.User, error) {
+	_ = m.Called(ctx, phone)
+	if m.err != nil {
+		return dao.User{}, m.err
+	}
+	for _, u := range m.users {
+		if u.Phone.String == phone {
+			return u, nil
+		}
+	}
+	return dao.User{}, dao.ErrRecordNotFound
+}
+
+func (m *mockUserDAO) FindByWechat(ctx context.Context, openId string) (dao.User, error) {
+	_ = m.Called(ctx, openId)
+	if m.err != nil {
+		return dao.User{}, m.err
+	}
+	for _, u := range m.users {
+		if u.WechatOpenId.String == openId {
+			return u, nil
+		}
+	}
+	return dao.User{}, dao.ErrRecordNotFound
+}
+
 func (m *mockUserDAO) FindById(ctx context.Context, id int64) (dao.User, error) {
 	_ = m.Called(ctx, id)
 	if m.err != nil {
@@ -59,6 +85,81 @@ func (m *mockUserDAO) Update(ctx context.Context, u dao.User) error {
 	return m.err
 }
 
+func (m *mockUserDAO) UpdateRoles(ctx context.Context, id int64, roles string) error {
+	_ = m.Called(ctx, id, roles)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdateStatus(ctx context.Context, id int64, status uint8) error {
+	_ = m.Called(ctx, id, status)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	_ = m.Called(ctx, id, password)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdateTOTP(ctx context.Context, id int64, secret string, enabled bool, recoveryCodes string) error {
+	_ = m.Called(ctx, id, secret, enabled, recoveryCodes)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdateRecoveryCodes(ctx context.Context, id int64, old, new string) error {
+	_ = m.Called(ctx, id, old, new)
+	return m.err
+}
+
+func (m *mockUserDAO) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	_ = m.Called(ctx, id, email)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	_ = m.Called(ctx, id, phone)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	_ = m.Called(ctx, id, oldEmail, newEmail)
+	return m.err
+}
+
+func (m *mockUserDAO) UpdateWechat(ctx context.Context, id int64, openId, unionId string) error {
+	_ = m.Called(ctx, id, openId, unionId)
+	return m.err
+}
+
+func (m *mockUserDAO) Search(ctx context.Context, q dao.UserQuery) ([]dao.User, int64, error) {
+	_ = m.Called(ctx, q)
+	return nil, 0, m.err
+}
+
+func (m *mockUserDAO) SoftDelete(ctx context.Context, id int64, now int64) error {
+	_ = m.Called(ctx, id, now)
+	return m.err
+}
+
+func (m *mockUserDAO) FindDeletedByEmail(ctx context.Context, email string) (dao.User, error) {
+	_ = m.Called(ctx, email)
+	return dao.User{}, m.err
+}
+
+func (m *mockUserDAO) FindDeletedByPhone(ctx context.Context, phone string) (dao.User, error) {
+	_ = m.Called(ctx, phone)
+	return dao.User{}, m.err
+}
+
+func (m *mockUserDAO) Restore(ctx context.Context, id int64) error {
+	_ = m.Called(ctx, id)
+	return m.err
+}
+
+func (m *mockUserDAO) Purge(ctx context.Context, before int64, limit int) (int64, error) {
+	_ = m.Called(ctx, before, limit)
+	return 0, m.err
+}
+
 func TestGORMUserRepository_Create(t *testing.T) {
 	tests := []struct {
 		name      string
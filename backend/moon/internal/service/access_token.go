@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+)
+
+var (
+	ErrTooManyAccessTokens = errors.New("个人访问令牌数量达到上限")
+	ErrInvalidAccessToken  = errors.New("个人访问令牌无效或者已经过期")
+	ErrAccessTokenNotFound = repository.ErrAccessTokenNotFound
+)
+
+const (
+	// AccessTokenPrefix 一眼就能看出是个人访问令牌，也方便代码扫描工具发现泄露的令牌
+	AccessTokenPrefix = "moon_pat_"
+	// accessTokenShownLen 列表里展示的前缀长度
+	accessTokenShownLen = len(AccessTokenPrefix) + 4
+	// lastUsedInterval 最近使用时间的精度，高频调用的脚本不会每个请求都写一次数据库
+	lastUsedInterval = time.Minute
+)
+
+// AccessTokenService 个人访问令牌，数据库里只保存哈希
+type AccessTokenService interface {
+	// Create 创建令牌，返回令牌信息和明文，明文只有这一次能拿到
+	Create(ctx context.Context, t domain.AccessToken) (domain.AccessToken, string, error)
+	List(ctx context.Context, uid int64) ([]domain.AccessToken, error)
+	// Revoke 删除令牌，不存在或者不属于 uid 的时候返回 ErrAccessTokenNotFound
+	Revoke(ctx context.Context, uid, id int64) error
+	// Authenticate 校验令牌明文，不存在或者过期了返回 ErrInvalidAccessToken
+	Authenticate(ctx context.Context, token string) (domain.AccessToken, error)
+	// Touch 记录令牌最近一次使用的时间
+	Touch(ctx context.Context, t domain.AccessToken) error
+}
+
+type accessTokenService struct {
+	repo repository.AccessTokenRepository
+	// maxPerUser 每个用户最多能有几个令牌
+	maxPerUser int64
+}
+
+func NewAccessTokenService(repo repository.AccessTokenRepository, maxPerUser int64) AccessTokenService {
+	return &accessTokenService{
+		repo:       repo,
+		maxPerUser: maxPerUser,
+	}
+}
+
+func (s *accessTokenService) Create(ctx context.Context, t domain.AccessToken) (domain.AccessToken, string, error) {
+	cnt, err := s.repo.CountByUid(ctx, t.Uid)
+	if err != nil {
+		return domain.AccessToken{}, "", err
+	}
+	if cnt >= s.maxPerUser {
+		return domain.AccessToken{}, "", ErrTooManyAccessTokens
+	}
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return domain.AccessToken{}, "", err
+	}
+	token := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	t.Prefix = token[:accessTokenShownLen]
+	t.Ctime = time.Now()
+	t.Id, err = s.repo.Create(ctx, t, s.hash(token))
+	if err != nil {
+		return domain.AccessToken{}, "", err
+	}
+	return t, token, nil
+}
+
+func (s *accessTokenService) List(ctx context.Context, uid int64) ([]domain.AccessToken, error) {
+	return s.repo.FindByUid(ctx, uid)
+}
+
+func (s *accessTokenService) Revoke(ctx context.Context, uid, id int64) error {
+	return s.repo.Delete(ctx, uid, id)
+}
+
+func (s *accessTokenService) Authenticate(ctx context.Context, token string) (domain.AccessToken, error) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return domain.AccessToken{}, ErrInvalidAccessToken
+	}
+	t, err := s.repo.FindByHash(ctx, s.hash(token))
+	if err == repository.ErrAccessTokenNotFound {
+		return domain.AccessToken{}, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+	if t.Expired(time.Now()) {
+		return domain.AccessToken{}, ErrInvalidAccessToken
+	}
+	return t, nil
+}
+
+func (s *accessTokenService) Touch(ctx context.Context, t domain.AccessToken) error {
+	now := time.Now()
+	if now.Sub(t.LastUsedAt) < lastUsedInterval {
+		return nil
+	}
+	return s.repo.UpdateLastUsed(ctx, t.Id, now, lastUsedInterval)
+}
+
+// hash 令牌是 32 字节的随机数，sha256 就够了，这样才能按哈希直接查
+func (s *accessTokenService) hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
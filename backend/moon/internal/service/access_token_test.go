@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAccessTokenRepository struct {
+	tokens map[string]domain.AccessToken
+	nextId int64
+}
+
+func (m *mockAccessTokenRepository) Create(ctx context.Context, t domain.AccessToken, hash string) (int64, error) {
+	m.nextId++
+	t.Id = m.nextId
+	m.tokens[hash] = t
+	return t.Id, nil
+}
+
+func (m *mockAccessTokenRepository) FindByHash(ctx context.Context, hash string) (domain.AccessToken, error) {
+	if t, ok := m.tokens[hash]; ok {
+		return t, nil
+	}
+	return domain.AccessToken{}, repository.ErrAccessTokenNotFound
+}
+
+func (m *mockAccessTokenRepository) FindByUid(ctx context.Context, uid int64) ([]domain.AccessToken, error) {
+	var res []domain.AccessToken
+	for _, t := range m.tokens {
+		if t.Uid == uid {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockAccessTokenRepository) CountByUid(ctx context.Context, uid int64) (int64, error) {
+	ts, _ := m.FindByUid(ctx, uid)
+	return int64(len(ts)), nil
+}
+
+func (m *mockAccessTokenRepository) Delete(ctx context.Context, uid, id int64) error {
+	for h, t := range m.tokens {
+		if t.Id == id && t.Uid == uid {
+			delete(m.tokens, h)
+			return nil
+		}
+	}
+	return repository.ErrAccessTokenNotFound
+}
+
+func (m *mockAccessTokenRepository) UpdateLastUsed(ctx context.Context, id int64, at time.Time, interval time.Duration) error {
+	for h, t := range m.tokens {
+		if t.Id == id {
+			t.LastUsedAt = at
+			m.tokens[h] = t
+		}
+	}
+	return nil
+}
+
+func TestAccessTokenService(t *testing.T) {
+	repo := &mockAccessTokenRepository{tokens: map[string]domain.AccessToken{}}
+	svc := NewAccessTokenService(repo, 2)
+	ctx := context.Background()
+
+	at, token, err := svc.Create(ctx, domain.AccessToken{Uid: 1, Name: "ci", Scopes: []string{"user:admin"}})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, AccessTokenPrefix))
+	assert.True(t, strings.HasPrefix(token, at.Prefix))
+	// 只保存哈希
+	for h := range repo.tokens {
+		assert.NotContains(t, h, token[len(AccessTokenPrefix):])
+	}
+
+	got, err := svc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.Uid)
+	assert.Equal(t, []string{"user:admin"}, got.Scopes)
+
+	for _, bad := range []string{"", "Bearer " + token, token + "x", strings.TrimPrefix(token, AccessTokenPrefix)} {
+		_, err = svc.Authenticate(ctx, bad)
+		assert.Equal(t, ErrInvalidAccessToken, err, bad)
+	}
+
+	require.NoError(t, svc.Touch(ctx, got))
+	got, err = svc.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), got.LastUsedAt, time.Second)
+
+	// 过期了
+	_, expired, err := svc.Create(ctx, domain.AccessToken{Uid: 1, Name: "old", ExpiresAt: time.Now().Add(-time.Second)})
+	require.NoError(t, err)
+	_, err = svc.Authenticate(ctx, expired)
+	assert.Equal(t, ErrInvalidAccessToken, err)
+
+	_, _, err = svc.Create(ctx, domain.AccessToken{Uid: 1, Name: "third"})
+	assert.Equal(t, ErrTooManyAccessTokens, err)
+
+	assert.Equal(t, ErrAccessTokenNotFound, svc.Revoke(ctx, 2, at.Id))
+	require.NoError(t, svc.Revoke(ctx, 1, at.Id))
+	_, err = svc.Authenticate(ctx, token)
+	assert.Equal(t, ErrInvalidAccessToken, err)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"moon/pkg/passwordx"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrUserPendingDeletion 密码对了，但是账号已经注销了，还在宽限期里可以恢复
+	ErrUserPendingDeletion = errors.New("账号已注销")
+	ErrRestoreExpired      = errors.New("已经过了恢复账号的宽限期")
+	ErrInvalidRestoreToken = errors.New("恢复账号的 token 无效或者已经过期")
+	// ErrPasswordNotSet 短信、第三方登录注册的账号没有密码，要用短信验证码确认
+	ErrPasswordNotSet = errors.New("账号没有设置密码")
+	// ErrPasswordRequired 设置了密码的账号要用密码确认
+	ErrPasswordRequired = errors.New("账号设置了密码，需要用密码确认")
+	// ErrNoDeleteCredential 没有密码也没有手机号，比如只用微信登录的账号，要先绑定手机号
+	ErrNoDeleteCredential = errors.New("账号没有设置密码也没有绑定手机号")
+)
+
+const (
+	purposeRestoreAccount = "restore_account"
+	bizDeleteAccount      = "delete_account"
+)
+
+// AccountDeletionService 用户自己注销账号，宽限期内可以恢复，过了之后彻底删除
+type AccountDeletionService interface {
+	// Delete 校验密码之后注销账号，返回彻底删除的时间
+	// 没有密码的账号返回 ErrPasswordNotSet 或者 ErrNoDeleteCredential
+	Delete(ctx context.Context, uid int64, password string) (time.Time, error)
+	// SendDeleteCode 没有密码的账号给绑定的手机号发验证码，返回这个手机号
+	SendDeleteCode(ctx context.Context, uid int64) (string, error)
+	// DeleteWithCode 用短信验证码确认注销，只有没有密码的账号能用
+	DeleteWithCode(ctx context.Context, uid int64, code string) (time.Time, error)
+	// BeginRestore 宽限期内用密码登录的时候，签发一个恢复账号用的 token
+	BeginRestore(u domain.User) (RestoreChallenge, error)
+	// Restore 恢复账号，返回用户 ID
+	// 邮箱已经被别人注册了的时候返回 ErrDuplicateEmail，手机号已经被别人绑定了的时候返回 ErrDuplicatePhone
+	Restore(ctx context.Context, token string) (int64, error)
+	// Purge 彻底删除宽限期已经过了的账号，一次最多 limit 个，返回删除的数量
+	Purge(ctx context.Context, limit int) (int64, error)
+}
+
+type RestoreChallenge struct {
+	Token string
+	// PurgeAt 到了这个时间就不能恢复了
+	PurgeAt time.Time
+}
+
+type AccountDeletionConfig struct {
+	GracePeriod time.Duration
+	// TokenKey 签名恢复 token 的密钥，和 access token 的密钥分开
+	TokenKey        []byte
+	TokenExpiration time.Duration
+}
+
+type AccountRestoreClaims struct {
+	jwt.RegisteredClaims
+	Uid int64
+	// Purpose 防止别的用途的 token 被拿来恢复账号
+	Purpose string
+}
+
+type accountDeletionService struct {
+	repo    repository.UserRepository
+	hasher  *passwordx.Manager
+	codeSvc CodeService
+	cfg     AccountDeletionConfig
+}
+
+func NewAccountDeletionService(repo repository.UserRepository, hasher *passwordx.Manager,
+	codeSvc CodeService, cfg AccountDeletionConfig) AccountDeletionService {
+	return &accountDeletionService{
+		repo:    repo,
+		hasher:  hasher,
+		codeSvc: codeSvc,
+		cfg:     cfg,
+	}
+}
+
+func (s *accountDeletionService) Delete(ctx context.Context, uid int64, password string) (time.Time, error) {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if u.Password == "" {
+		return time.Time{}, s.passwordlessErr(u)
+	}
+	ok, _, err := s.hasher.Verify(u.Password, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, ErrInvalidUserOrPassword
+	}
+	return s.softDelete(ctx, uid)
+}
+
+func (s *accountDeletionService) SendDeleteCode(ctx context.Context, uid int64) (string, error) {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if u.Password != "" {
+		return "", ErrPasswordRequired
+	}
+	if u.Phone == "" {
+		return "", ErrNoDeleteCredential
+	}
+	return u.Phone, s.codeSvc.Send(ctx, bizDeleteAccount, u.Phone)
+}
+
+func (s *accountDeletionService) DeleteWithCode(ctx context.Context, uid int64, code string) (time.Time, error) {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if u.Password != "" {
+		return time.Time{}, ErrPasswordRequired
+	}
+	if u.Phone == "" {
+		return time.Time{}, ErrNoDeleteCredential
+	}
+	ok, err := s.codeSvc.Verify(ctx, bizDeleteAccount, u.Phone, code)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, ErrInvalidCode
+	}
+	return s.softDelete(ctx, uid)
+}
+
+// passwordlessErr 没有密码的账号用短信验证码确认，连手机号都没有的要先绑定一个
+func (s *accountDeletionService) passwordlessErr(u domain.User) error {
+	if u.Phone == "" {
+		return ErrNoDeleteCredential
+	}
+	return ErrPasswordNotSet
+}
+
+func (s *accountDeletionService) softDelete(ctx context.Context, uid int64) (time.Time, error) {
+	now := time.Now()
+	err := s.repo.SoftDelete(ctx, uid, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(s.cfg.GracePeriod), nil
+}
+
+func (s *accountDeletionService) BeginRestore(u domain.User) (RestoreChallenge, error) {
+	purgeAt := u.DeletedAt.Add(s.cfg.GracePeriod)
+	// 过了宽限期但是还没有轮到清理的，也不能再恢复了
+	if !time.Now().Before(purgeAt) {
+		return RestoreChallenge{}, ErrRestoreExpired
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, AccountRestoreClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.TokenExpiration)),
+		},
+		Uid:     u.Id,
+		Purpose: purposeRestoreAccount,
+	}).SignedString(s.cfg.TokenKey)
+	if err != nil {
+		return RestoreChallenge{}, err
+	}
+	return RestoreChallenge{Token: token, PurgeAt: purgeAt}, nil
+}
+
+func (s *accountDeletionService) Restore(ctx context.Context, token string) (int64, error) {
+	var claims AccountRestoreClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return s.cfg.TokenKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purposeRestoreAccount {
+		return 0, ErrInvalidRestoreToken
+	}
+	err = s.repo.Restore(ctx, claims.Uid)
+	switch err {
+	case nil:
+		return claims.Uid, nil
+	// 已经恢复过了，或者刚好被清理掉了
+	case repository.ErrUserNotFound:
+		return 0, ErrInvalidRestoreToken
+	case repository.ErrDuplicateUser:
+		return 0, ErrDuplicateEmail
+	case repository.ErrDuplicatePhone:
+		return 0, ErrDuplicatePhone
+	default:
+		return 0, err
+	}
+}
+
+func (s *accountDeletionService) Purge(ctx context.Context, limit int) (int64, error) {
+	return s.repo.Purge(ctx, time.Now().Add(-s.cfg.GracePeriod), limit)
+}
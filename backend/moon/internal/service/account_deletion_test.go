@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"moon/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountDeletionService(t *testing.T) {
+	hasher := newTestHasher()
+	hashed, err := hasher.Hash("correct horse battery")
+	require.NoError(t, err)
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Password: hashed},
+	}}
+	cfg := AccountDeletionConfig{
+		GracePeriod:     time.Hour * 24 * 30,
+		TokenKey:        []byte("restore-key"),
+		TokenExpiration: time.Minute * 10,
+	}
+	svc := NewAccountDeletionService(repo, hasher, &mockCodeService{}, cfg)
+	userSvc := NewUserService(repo, hasher)
+	ctx := context.Background()
+
+	_, err = svc.Delete(ctx, 1, "wrong password")
+	assert.Equal(t, ErrInvalidUserOrPassword, err)
+
+	purgeAt, err := svc.Delete(ctx, 1, "correct horse battery")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(cfg.GracePeriod), purgeAt, time.Second)
+
+	// 密码不对的时候和不存在的账号一样，不能用来探测账号是不是注销了
+	_, err = userSvc.Login(ctx, "a@example.com", "wrong password")
+	assert.Equal(t, ErrInvalidUserOrPassword, err)
+	u, err := userSvc.Login(ctx, "a@example.com", "correct horse battery")
+	require.Equal(t, ErrUserPendingDeletion, err)
+
+	ch, err := svc.BeginRestore(u)
+	require.NoError(t, err)
+	assert.WithinDuration(t, purgeAt, ch.PurgeAt, time.Millisecond)
+
+	for _, bad := range []string{"", "garbage", ch.Token + "x"} {
+		_, err = svc.Restore(ctx, bad)
+		assert.Equal(t, ErrInvalidRestoreToken, err, bad)
+	}
+	uid, err := svc.Restore(ctx, ch.Token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), uid)
+	// 只能恢复一次
+	_, err = svc.Restore(ctx, ch.Token)
+	assert.Equal(t, ErrInvalidRestoreToken, err)
+
+	u, err = userSvc.Login(ctx, "a@example.com", "correct horse battery")
+	require.NoError(t, err)
+	assert.False(t, u.Deleted())
+}
+
+func TestAccountDeletionService_DeleteWithCode(t *testing.T) {
+	hashed, err := newTestHasher().Hash("correct horse battery")
+	require.NoError(t, err)
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Password: hashed, Phone: "+8613700137000"},
+		// 短信登录注册的账号没有邮箱也没有密码
+		"":              {Id: 2, Phone: "+8613800138000"},
+		"c@example.com": {Id: 3, Email: "c@example.com"},
+	}}
+	codeSvc := &mockCodeService{}
+	svc := NewAccountDeletionService(repo, newTestHasher(), codeSvc, AccountDeletionConfig{
+		GracePeriod: time.Hour, TokenKey: []byte("restore-key"), TokenExpiration: time.Minute,
+	})
+	ctx := context.Background()
+
+	// 没有密码的账号不能用密码注销
+	_, err = svc.Delete(ctx, 2, "")
+	assert.Equal(t, ErrPasswordNotSet, err)
+	_, err = svc.Delete(ctx, 3, "")
+	assert.Equal(t, ErrNoDeleteCredential, err)
+	// 有密码的账号不能用验证码注销
+	_, err = svc.SendDeleteCode(ctx, 1)
+	assert.Equal(t, ErrPasswordRequired, err)
+	_, err = svc.DeleteWithCode(ctx, 1, "123456")
+	assert.Equal(t, ErrPasswordRequired, err)
+	_, err = svc.SendDeleteCode(ctx, 3)
+	assert.Equal(t, ErrNoDeleteCredential, err)
+	assert.Empty(t, codeSvc.sent)
+
+	phone, err := svc.SendDeleteCode(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "+8613800138000", phone)
+	assert.Equal(t, []string{"delete_account:+8613800138000"}, codeSvc.sent)
+	_, err = svc.DeleteWithCode(ctx, 2, "000000")
+	assert.Equal(t, ErrInvalidCode, err)
+	assert.False(t, repo.users[""].Deleted())
+
+	purgeAt, err := svc.DeleteWithCode(ctx, 2, "123456")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), purgeAt, time.Second)
+	assert.True(t, repo.users["deleted:"].Deleted())
+}
+
+func TestAccountDeletionService_RestoreEmailTaken(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"deleted:a@example.com": {Id: 1, Status: domain.UserStatusDeleted, DeletedAt: time.Now()},
+		// 注销之后别人用这个邮箱注册了
+		"a@example.com": {Id: 2, Email: "a@example.com"},
+	}}
+	svc := NewAccountDeletionService(repo, newTestHasher(), &mockCodeService{}, AccountDeletionConfig{
+		GracePeriod: time.Hour, TokenKey: []byte("restore-key"), TokenExpiration: time.Minute,
+	})
+	ch, err := svc.BeginRestore(repo.users["deleted:a@example.com"])
+	require.NoError(t, err)
+	_, err = svc.Restore(context.Background(), ch.Token)
+	assert.Equal(t, ErrDuplicateEmail, err)
+}
+
+func TestAccountDeletionService_Purge(t *testing.T) {
+	now := time.Now()
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"deleted:old@example.com": {Id: 1, Status: domain.UserStatusDeleted, DeletedAt: now.Add(-time.Hour * 2)},
+		"deleted:new@example.com": {Id: 2, Status: domain.UserStatusDeleted, DeletedAt: now.Add(-time.Minute)},
+		"active@example.com":      {Id: 3, Email: "active@example.com"},
+	}}
+	svc := NewAccountDeletionService(repo, newTestHasher(), &mockCodeService{}, AccountDeletionConfig{
+		GracePeriod: time.Hour, TokenKey: []byte("restore-key"), TokenExpiration: time.Minute,
+	})
+
+	// 过了宽限期还没有清理的也不能恢复了
+	_, err := svc.BeginRestore(repo.users["deleted:old@example.com"])
+	assert.Equal(t, ErrRestoreExpired, err)
+
+	cnt, err := svc.Purge(context.Background(), 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+	assert.NotContains(t, repo.users, "deleted:old@example.com")
+	assert.Contains(t, repo.users, "deleted:new@example.com")
+	assert.Contains(t, repo.users, "active@example.com")
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"moon/internal/repository/cache"
+	"moon/internal/service/sms"
+)
+
+var (
+	ErrCodeSendTooMany   = cache.ErrCodeSendTooMany
+	ErrCodeVerifyTooMany = cache.ErrCodeVerifyTooMany
+)
+
+// CodeService 短信验证码，biz 区分不同的业务，比如登录和绑定手机号的验证码不能混用
+type CodeService interface {
+	Send(ctx context.Context, biz, phone string) error
+	Verify(ctx context.Context, biz, phone, code string) (bool, error)
+}
+
+type codeService struct {
+	cache cache.CodeCache
+	sms   sms.Service
+	// tplId 验证码短信的模板
+	tplId string
+}
+
+func NewCodeService(c cache.CodeCache, smsSvc sms.Service, tplId string) CodeService {
+	return &codeService{
+		cache: c,
+		sms:   smsSvc,
+		tplId: tplId,
+	}
+}
+
+func (s *codeService) Send(ctx context.Context, biz, phone string) error {
+	code, err := s.generate()
+	if err != nil {
+		return err
+	}
+	err = s.cache.Set(ctx, biz, phone, s.hash(biz, phone, code))
+	if err != nil {
+		return err
+	}
+	// 这里发送失败的话，用户要等到可以重发的时候才能再试，
+	// 但是先发短信再写 Redis 的话，写失败了用户会收到一个没用的验证码
+	return s.sms.Send(ctx, s.tplId, []string{code}, phone)
+}
+
+func (s *codeService) Verify(ctx context.Context, biz, phone, code string) (bool, error) {
+	return s.cache.Verify(ctx, biz, phone, s.hash(biz, phone, code))
+}
+
+// generate 六位数字，必须用 crypto/rand，math/rand 生成的验证码可以被预测
+func (s *codeService) generate() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hash 带上 biz 和手机号，相同的验证码在不同的 key 里哈希也不一样
+func (s *codeService) hash(biz, phone, code string) string {
+	sum := sha256.Sum256([]byte(biz + ":" + phone + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"moon/internal/repository/cache"
+	"moon/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrExportInProgress = errors.New("已经有一个导出任务在进行中")
+	// ErrExportNotFound 导出 ID 不对，或者压缩包已经过期删掉了
+	ErrExportNotFound = errors.New("导出任务不存在")
+	ErrExportNotReady = errors.New("导出还没有完成")
+)
+
+// Exporter 导出某一类个人数据，每个 Exporter 在压缩包里对应一个 <Name>.json
+// 新的模块要导出自己的数据，实现这个接口然后在 ioc 里加到列表里就可以了
+type Exporter interface {
+	// Name 压缩包里的文件名，不能重复
+	Name() string
+	// Export 返回的值会被序列化成 JSON，不能包含密码哈希、密钥之类的数据
+	Export(ctx context.Context, uid int64) (any, error)
+}
+
+// DataExportService 用户导出自己的数据，导出在后台进行，完成之后下载一个 ZIP 压缩包
+type DataExportService interface {
+	// Start 开始导出，上一次还没导出完的时候返回 ErrExportInProgress
+	// 每个用户只保留最近一次导出的结果
+	Start(ctx context.Context, uid int64) (domain.DataExport, error)
+	Get(ctx context.Context, uid int64, id string) (domain.DataExport, error)
+	// Download 返回压缩包，还没导出完的时候返回 ErrExportNotReady
+	Download(ctx context.Context, uid int64, id string) ([]byte, error)
+}
+
+type DataExportConfig struct {
+	// Timeout 一次导出最多跑多久
+	Timeout time.Duration
+}
+
+type dataExportService struct {
+	cache     cache.DataExportCache
+	exporters []Exporter
+	cfg       DataExportConfig
+	l         logger.LoggerV1
+}
+
+func NewDataExportService(c cache.DataExportCache, exporters []Exporter,
+	cfg DataExportConfig, l logger.LoggerV1) DataExportService {
+	return &dataExportService{
+		cache:     c,
+		exporters: exporters,
+		cfg:       cfg,
+		l:         l,
+	}
+}
+
+func (s *dataExportService) Start(ctx context.Context, uid int64) (domain.DataExport, error) {
+	e := domain.DataExport{
+		Id:     uuid.NewString(),
+		Uid:    uid,
+		Status: domain.DataExportStatusRunning,
+		Ctime:  time.Now(),
+	}
+	ok, err := s.cache.Start(ctx, uid, e.Id, e.Ctime, s.cfg.Timeout)
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	if !ok {
+		return domain.DataExport{}, ErrExportInProgress
+	}
+	go s.run(uid, e.Id)
+	return e, nil
+}
+
+// run 在后台导出，和发起导出的请求没有关系
+func (s *dataExportService) run(uid int64, id string) {
+	// Exporter 是各个模块自己实现的，panic 了不能把整个进程带走，也不能让导出一直卡在进行中
+	defer func() {
+		if r := recover(); r != nil {
+			s.l.Error("导出用户数据 panic", logger.Int64("uid", uid), logger.String("id", id),
+				logger.String("panic", fmt.Sprint(r)), logger.String("stack", string(debug.Stack())))
+			s.fail(uid, id)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+	data, err := s.archive(ctx, uid)
+	if err != nil {
+		s.l.Error("导出用户数据失败", logger.Int64("uid", uid), logger.String("id", id), logger.Error(err))
+		s.fail(uid, id)
+		return
+	}
+	ok, err := s.cache.Finish(ctx, uid, id, data)
+	if err != nil {
+		s.l.Error("保存导出的数据失败", logger.Int64("uid", uid), logger.String("id", id), logger.Error(err))
+		return
+	}
+	if !ok {
+		// 超过了 Timeout，用户已经重新发起了导出
+		s.l.Warn("导出完成的时候已经被新的导出替换了", logger.Int64("uid", uid), logger.String("id", id))
+	}
+}
+
+func (s *dataExportService) fail(uid int64, id string) {
+	// 超时的时候导出用的 ctx 已经不能用了
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := s.cache.Fail(ctx, uid, id); err != nil {
+		s.l.Error("记录导出失败出错", logger.Int64("uid", uid), logger.Error(err))
+	}
+}
+
+func (s *dataExportService) archive(ctx context.Context, uid int64) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range s.exporters {
+		val, err := e.Export(ctx, uid)
+		if err != nil {
+			return nil, fmt.Errorf("导出 %s 失败 %w", e.Name(), err)
+		}
+		w, err := zw.Create(e.Name() + ".json")
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(val); err != nil {
+			return nil, fmt.Errorf("导出 %s 失败 %w", e.Name(), err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *dataExportService) Get(ctx context.Context, uid int64, id string) (domain.DataExport, error) {
+	e, err := s.cache.Get(ctx, uid)
+	if err == cache.ErrKeyNotExist {
+		return domain.DataExport{}, ErrExportNotFound
+	}
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	if e.Id != id {
+		return domain.DataExport{}, ErrExportNotFound
+	}
+	return e, nil
+}
+
+func (s *dataExportService) Download(ctx context.Context, uid int64, id string) ([]byte, error) {
+	e, err := s.Get(ctx, uid, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != domain.DataExportStatusReady {
+		return nil, ErrExportNotReady
+	}
+	data, err := s.cache.Data(ctx, uid, id)
+	if err == cache.ErrKeyNotExist {
+		return nil, ErrExportNotFound
+	}
+	return data, err
+}
+
+// ProfileExporter 导出用户资料
+type ProfileExporter struct {
+	repo repository.UserRepository
+}
+
+func NewProfileExporter(repo repository.UserRepository) *ProfileExporter {
+	return &ProfileExporter{repo: repo}
+}
+
+func (e *ProfileExporter) Name() string {
+	return "profile"
+}
+
+// profileExport 不包含密码哈希、TOTP 密钥和恢复码
+type profileExport struct {
+	Id            int64    `json:"id"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Phone         string   `json:"phone"`
+	Nickname      string   `json:"nickname"`
+	Birthday      string   `json:"birthday"`
+	AboutMe       string   `json:"about_me"`
+	Roles         []string `json:"roles"`
+	MFAEnabled    bool     `json:"mfa_enabled"`
+	WechatOpenId  string   `json:"wechat_open_id"`
+	WechatUnionId string   `json:"wechat_union_id"`
+	Ctime         string   `json:"ctime"`
+}
+
+func (e *ProfileExporter) Export(ctx context.Context, uid int64) (any, error) {
+	u, err := e.repo.FindById(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := profileExport{
+		Id:            u.Id,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Phone:         u.Phone,
+		Nickname:      u.Nickname,
+		AboutMe:       u.AboutMe,
+		Roles:         u.Roles,
+		MFAEnabled:    u.TOTP.Enabled,
+		WechatOpenId:  u.WechatInfo.OpenId,
+		WechatUnionId: u.WechatInfo.UnionId,
+		Ctime:         u.Ctime.UTC().Format(time.RFC3339),
+	}
+	if !u.Birthday.IsZero() {
+		res.Birthday = u.Birthday.Format(time.DateOnly)
+	}
+	return res, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository/cache"
+	"moon/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockDataExportCache struct {
+	mu      sync.Mutex
+	exports map[int64]domain.DataExport
+	data    map[int64][]byte
+}
+
+func newMockDataExportCache() *mockDataExportCache {
+	return &mockDataExportCache{exports: map[int64]domain.DataExport{}, data: map[int64][]byte{}}
+}
+
+func (m *mockDataExportCache) Start(ctx context.Context, uid int64, id string, ctime time.Time, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.exports[uid].Status == domain.DataExportStatusRunning {
+		return false, nil
+	}
+	m.exports[uid] = domain.DataExport{Id: id, Uid: uid, Status: domain.DataExportStatusRunning, Ctime: ctime}
+	delete(m.data, uid)
+	return true, nil
+}
+
+func (m *mockDataExportCache) Finish(ctx context.Context, uid int64, id string, data []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.exports[uid]
+	if e.Id != id {
+		return false, nil
+	}
+	e.Status, e.Size = domain.DataExportStatusReady, int64(len(data))
+	m.exports[uid], m.data[uid] = e, data
+	return true, nil
+}
+
+func (m *mockDataExportCache) Fail(ctx context.Context, uid int64, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.exports[uid]
+	if e.Id == id {
+		e.Status = domain.DataExportStatusFailed
+		m.exports[uid] = e
+	}
+	return nil
+}
+
+func (m *mockDataExportCache) Get(ctx context.Context, uid int64) (domain.DataExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.exports[uid]
+	if !ok {
+		return domain.DataExport{}, cache.ErrKeyNotExist
+	}
+	return e, nil
+}
+
+func (m *mockDataExportCache) Data(ctx context.Context, uid int64, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[uid]
+	if !ok || m.exports[uid].Id != id {
+		return nil, cache.ErrKeyNotExist
+	}
+	return data, nil
+}
+
+type funcExporter struct {
+	name string
+	fn   func(ctx context.Context, uid int64) (any, error)
+}
+
+func (e funcExporter) Name() string {
+	return e.name
+}
+
+func (e funcExporter) Export(ctx context.Context, uid int64) (any, error) {
+	return e.fn(ctx, uid)
+}
+
+func waitExport(t *testing.T, svc DataExportService, uid int64, id string) domain.DataExport {
+	var e domain.DataExport
+	require.Eventually(t, func() bool {
+		var err error
+		e, err = svc.Get(context.Background(), uid, id)
+		require.NoError(t, err)
+		return e.Status != domain.DataExportStatusRunning
+	}, time.Second, time.Millisecond*10)
+	return e
+}
+
+func TestDataExportService(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Password: "hash", Nickname: "Tom",
+			Birthday: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+			TOTP:     domain.TOTPInfo{Secret: "secret", Enabled: true, RecoveryCodes: []string{"code"}}},
+	}}
+	// 第一次导出的时候卡住，用来测试导出中不能重复发起
+	release := make(chan struct{})
+	var once sync.Once
+	c := newMockDataExportCache()
+	svc := NewDataExportService(c, []Exporter{
+		NewProfileExporter(repo),
+		funcExporter{name: "sessions", fn: func(ctx context.Context, uid int64) (any, error) {
+			once.Do(func() { <-release })
+			return []string{"s1"}, nil
+		}},
+	}, DataExportConfig{Timeout: time.Minute}, logger.NewNopLogger())
+	ctx := context.Background()
+
+	_, err := svc.Get(ctx, 1, "nope")
+	assert.Equal(t, ErrExportNotFound, err)
+
+	e, err := svc.Start(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DataExportStatusRunning, e.Status)
+	_, err = svc.Start(ctx, 1)
+	assert.Equal(t, ErrExportInProgress, err)
+	_, err = svc.Download(ctx, 1, e.Id)
+	assert.Equal(t, ErrExportNotReady, err)
+	close(release)
+
+	assert.Equal(t, domain.DataExportStatusReady, waitExport(t, svc, 1, e.Id).Status)
+	// 别人不能拿 ID 下载
+	_, err = svc.Download(ctx, 2, e.Id)
+	assert.Equal(t, ErrExportNotFound, err)
+	data, err := svc.Download(ctx, 1, e.Id)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+	require.Len(t, files, 2)
+	var profile map[string]any
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "a@example.com", profile["email"])
+	assert.Equal(t, "2000-01-02", profile["birthday"])
+	assert.Equal(t, true, profile["mfa_enabled"])
+	// 密码哈希、TOTP 密钥和恢复码不能导出
+	for _, s := range []string{"hash", "secret", "code"} {
+		assert.NotContains(t, string(files["profile.json"]), `"`+s+`"`)
+	}
+	assert.JSONEq(t, `["s1"]`, string(files["sessions.json"]))
+
+	// 导出完成之后可以重新导出，旧的就不能下载了
+	e2, err := svc.Start(ctx, 1)
+	require.NoError(t, err)
+	waitExport(t, svc, 1, e2.Id)
+	_, err = svc.Download(ctx, 1, e.Id)
+	assert.Equal(t, ErrExportNotFound, err)
+}
+
+func TestDataExportService_Fail(t *testing.T) {
+	svc := NewDataExportService(newMockDataExportCache(), []Exporter{
+		funcExporter{name: "broken", fn: func(ctx context.Context, uid int64) (any, error) {
+			return nil, errors.New("mock error")
+		}},
+	}, DataExportConfig{Timeout: time.Minute}, logger.NewNopLogger())
+	ctx := context.Background()
+
+	e, err := svc.Start(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DataExportStatusFailed, waitExport(t, svc, 1, e.Id).Status)
+	_, err = svc.Download(ctx, 1, e.Id)
+	assert.Equal(t, ErrExportNotReady, err)
+	// 失败了可以重新导出
+	_, err = svc.Start(ctx, 1)
+	assert.NoError(t, err)
+}
+
+func TestDataExportService_Panic(t *testing.T) {
+	svc := NewDataExportService(newMockDataExportCache(), []Exporter{
+		funcExporter{name: "broken", fn: func(ctx context.Context, uid int64) (any, error) {
+			var m map[string]int
+			m["boom"]++
+			return m, nil
+		}},
+	}, DataExportConfig{Timeout: time.Minute}, logger.NewNopLogger())
+	ctx := context.Background()
+
+	e, err := svc.Start(ctx, 1)
+	require.NoError(t, err)
+	// 进程还活着，导出标记为失败，不用等到超时就能重新导出
+	assert.Equal(t, domain.DataExportStatusFailed, waitExport(t, svc, 1, e.Id).Status)
+	_, err = svc.Start(ctx, 1)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,45 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"moon/internal/service/email"
+	"moon/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// Service 本地开发用的邮件服务，不真的发邮件，只是打日志
+// 配置了 dir 的话每封邮件写成一个 .eml 文件，方便测试脚本读取验证链接
+type Service struct {
+	l   logger.LoggerV1
+	dir string
+}
+
+func NewService(l logger.LoggerV1, dir string) *Service {
+	return &Service{
+		l:   l,
+		dir: dir,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, msg email.Message) error {
+	s.l.Info("本地邮件服务",
+		logger.String("to", msg.To),
+		logger.String("subject", msg.Subject))
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	// 文件名按时间排序，最新的邮件在最后
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), uuid.NewString())
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+	return os.WriteFile(filepath.Join(s.dir, name), []byte(content), 0600)
+}
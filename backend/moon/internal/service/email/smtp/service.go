@@ -0,0 +1,93 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"moon/internal/service/email"
+)
+
+var errHeaderInjection = errors.New("邮件头部不能包含换行")
+
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From 发件人，比如 Moon <no-reply@example.com>
+	From string
+}
+
+// Service 通过 SMTP 发邮件，服务器支持 STARTTLS 的时候会自动加密
+// net/smtp 不允许在明文连接上用 PLAIN 认证，除非连的是 localhost
+type Service struct {
+	cfg  Config
+	auth smtp.Auth
+}
+
+func NewService(cfg Config) *Service {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return &Service{cfg: cfg, auth: auth}
+}
+
+func (s *Service) Send(ctx context.Context, msg email.Message) error {
+	from, err := envelopeAddress(s.cfg.From)
+	if err != nil {
+		return err
+	}
+	data, err := buildMessage(s.cfg.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	// net/smtp 不支持 context，超时交给服务器和系统的 TCP 超时
+	return smtp.SendMail(addr, s.auth, from, []string{msg.To}, data)
+}
+
+// envelopeAddress 从 "名字 <地址>" 里取出地址
+func envelopeAddress(from string) (string, error) {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		j := strings.LastIndex(from, ">")
+		if j < i {
+			return "", fmt.Errorf("发件人格式不对 %s", from)
+		}
+		return from[i+1 : j], nil
+	}
+	return from, nil
+}
+
+func buildMessage(from string, msg email.Message, now time.Time) ([]byte, error) {
+	for _, h := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, errHeaderInjection
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + msg.To + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	buf.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	// RFC 2045 要求每行不超过 76 个字符
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes(), nil
+}
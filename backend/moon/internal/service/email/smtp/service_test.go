@@ -0,0 +1,60 @@
+package smtp
+
+import (
+	"encoding/base64"
+	"mime"
+	"strings"
+	"testing"
+	"time"
+
+	"moon/internal/service/email"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMessage(t *testing.T) {
+	msg := email.Message{
+		To:      "a@example.com",
+		Subject: "验证你的邮箱",
+		Body:    strings.Repeat("请点击下面的链接完成验证。", 10),
+	}
+	data, err := buildMessage("Moon <no-reply@example.com>", msg, time.Unix(0, 0))
+	require.NoError(t, err)
+
+	header, body, ok := strings.Cut(string(data), "\r\n\r\n")
+	require.True(t, ok)
+	assert.Contains(t, header, "To: a@example.com\r\n")
+	var subject string
+	for _, line := range strings.Split(header, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Subject: "); ok {
+			subject, err = new(mime.WordDecoder).DecodeHeader(v)
+			require.NoError(t, err)
+		}
+	}
+	assert.Equal(t, msg.Subject, subject)
+
+	for _, line := range strings.Split(strings.TrimSpace(body), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Body, string(decoded))
+}
+
+func TestBuildMessage_HeaderInjection(t *testing.T) {
+	_, err := buildMessage("no-reply@example.com", email.Message{
+		To:      "a@example.com\r\nBcc: b@example.com",
+		Subject: "hi",
+	}, time.Now())
+	assert.Equal(t, errHeaderInjection, err)
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	addr, err := envelopeAddress("Moon <no-reply@example.com>")
+	require.NoError(t, err)
+	assert.Equal(t, "no-reply@example.com", addr)
+	addr, err = envelopeAddress("no-reply@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "no-reply@example.com", addr)
+}
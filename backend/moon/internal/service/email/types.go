@@ -0,0 +1,15 @@
+package email
+
+import "context"
+
+// Service 发邮件的抽象，接入 SES、SendGrid 之类的服务商只需要实现这个接口
+type Service interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	// Body 纯文本
+	Body string
+}
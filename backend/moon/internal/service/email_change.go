@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"moon/internal/repository"
+	"moon/internal/service/email"
+	"moon/pkg/passwordx"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrSameEmail = errors.New("新邮箱和现在的邮箱一样")
+
+const purposeChangeEmail = "change_email"
+
+// EmailChangeService 修改邮箱，新邮箱点了确认链接之后才会真的换
+type EmailChangeService interface {
+	// Request 校验密码之后给新邮箱发确认链接，同时通知老邮箱
+	// 新邮箱已经被别人用了的时候返回 ErrDuplicateEmail，账号没有设置过密码的返回 ErrPasswordNotSet
+	Request(ctx context.Context, uid int64, password string, newEmail string) error
+	// Confirm 校验链接里的 token 并换成新邮箱，返回用户 ID
+	// 链接发出去之后邮箱又改过了的时候返回 ErrInvalidEmailToken，新邮箱这期间被别人注册了返回 ErrDuplicateEmail
+	Confirm(ctx context.Context, token string) (int64, error)
+}
+
+type EmailChangeConfig struct {
+	// Key 签名 token 的密钥，可以和验证邮箱的共用，Purpose 不一样
+	Key        []byte
+	Expiration time.Duration
+	// LinkBase 确认链接，token 会拼在 query 里
+	LinkBase string
+}
+
+type emailChangeService struct {
+	repo   repository.UserRepository
+	mailer email.Service
+	hasher *passwordx.Manager
+	cfg    EmailChangeConfig
+}
+
+func NewEmailChangeService(repo repository.UserRepository, mailer email.Service,
+	hasher *passwordx.Manager, cfg EmailChangeConfig) EmailChangeService {
+	return &emailChangeService{
+		repo:   repo,
+		mailer: mailer,
+		hasher: hasher,
+		cfg:    cfg,
+	}
+}
+
+func (s *emailChangeService) Request(ctx context.Context, uid int64, password string, newEmail string) error {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	// 短信、第三方登录注册的用户没有密码，不能当成密码不对
+	if u.Password == "" {
+		return ErrPasswordNotSet
+	}
+	ok, _, err := s.hasher.Verify(u.Password, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidUserOrPassword
+	}
+	if newEmail == u.Email {
+		return ErrSameEmail
+	}
+	// 这里只是提前告诉用户，真正的校验靠唯一索引
+	_, err = s.repo.FindByEmail(ctx, newEmail)
+	switch err {
+	case nil:
+		return ErrDuplicateEmail
+	case repository.ErrUserNotFound:
+	default:
+		return err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, EmailVerifyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.Expiration)),
+		},
+		Uid:      u.Id,
+		Email:    newEmail,
+		OldEmail: u.Email,
+		Purpose:  purposeChangeEmail,
+	}).SignedString(s.cfg.Key)
+	if err != nil {
+		return err
+	}
+	link := s.cfg.LinkBase + "?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(ctx, email.Message{
+		To:      newEmail,
+		Subject: "请确认你的新邮箱",
+		Body: fmt.Sprintf("你好 %s，\n\n你正在把账号的邮箱改成 %s，请在 %s 内点击下面的链接确认：\n\n%s\n\n确认之前还是用原来的邮箱登录。如果不是你本人操作的，请忽略这封邮件。",
+			u.Nickname, newEmail, humanDuration(s.cfg.Expiration), link),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, email.Message{
+		To:      u.Email,
+		Subject: "你的账号正在修改邮箱",
+		Body: fmt.Sprintf("你好 %s，\n\n有人用你的密码申请把账号的邮箱改成 %s，新邮箱确认之后这个邮箱就不能再用来登录了。\n\n如果不是你本人操作的，说明密码可能已经泄露，请马上修改密码。",
+			u.Nickname, maskEmail(newEmail)),
+	})
+}
+
+func (s *emailChangeService) Confirm(ctx context.Context, token string) (int64, error) {
+	var claims EmailVerifyClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return s.cfg.Key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purposeChangeEmail || claims.OldEmail == "" {
+		return 0, ErrInvalidEmailToken
+	}
+	err = s.repo.UpdateEmail(ctx, claims.Uid, claims.OldEmail, claims.Email)
+	switch err {
+	case nil:
+		return claims.Uid, nil
+	case repository.ErrUserNotFound:
+		return 0, ErrInvalidEmailToken
+	case repository.ErrDuplicateUser:
+		return 0, ErrDuplicateEmail
+	default:
+		return 0, err
+	}
+}
+
+// maskEmail 通知老邮箱的时候不把新邮箱完整地写出来，a***@example.com
+func maskEmail(addr string) string {
+	for i := 0; i < len(addr); i++ {
+		if addr[i] == '@' {
+			if i == 0 {
+				return addr
+			}
+			return addr[:1] + "***" + addr[i:]
+		}
+	}
+	return addr
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var changeLinkRegexp = regexp.MustCompile(`https://example\.com/confirm\?token=(\S+)`)
+
+func newTestEmailChangeService(t *testing.T) (EmailChangeService, *mockUserRepository, *mockMailer) {
+	hash, err := newTestHasher().Hash("correct horse battery")
+	require.NoError(t, err)
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Password: hash, Nickname: "a"},
+		"b@example.com": {Id: 2, Email: "b@example.com"},
+		"no-email-3":    {Id: 3, Phone: "+8613800138000"},
+	}}
+	mailer := &mockMailer{}
+	svc := NewEmailChangeService(repo, mailer, newTestHasher(), EmailChangeConfig{
+		Key:        []byte("test-key"),
+		Expiration: time.Hour,
+		LinkBase:   "https://example.com/confirm",
+	})
+	return svc, repo, mailer
+}
+
+func changeTokenFromMail(t *testing.T, body string) string {
+	m := changeLinkRegexp.FindStringSubmatch(body)
+	require.Len(t, m, 2)
+	token, err := url.QueryUnescape(m[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestEmailChangeService(t *testing.T) {
+	svc, repo, mailer := newTestEmailChangeService(t)
+	ctx := context.Background()
+
+	assert.Equal(t, ErrInvalidUserOrPassword, svc.Request(ctx, 1, "wrong", "c@example.com"))
+	assert.Equal(t, ErrSameEmail, svc.Request(ctx, 1, "correct horse battery", "a@example.com"))
+	assert.Equal(t, ErrDuplicateEmail, svc.Request(ctx, 1, "correct horse battery", "b@example.com"))
+	// 短信注册的账号没有密码
+	assert.Equal(t, ErrPasswordNotSet, svc.Request(ctx, 3, "", "c@example.com"))
+	assert.Empty(t, mailer.sent)
+
+	require.NoError(t, svc.Request(ctx, 1, "correct horse battery", "c@example.com"))
+	require.Len(t, mailer.sent, 2)
+	assert.Equal(t, "c@example.com", mailer.sent[0].To)
+	// 老邮箱只收到通知，不能用来确认
+	assert.Equal(t, "a@example.com", mailer.sent[1].To)
+	assert.NotContains(t, mailer.sent[1].Body, "https://example.com/confirm")
+	assert.Contains(t, mailer.sent[1].Body, "c***@example.com")
+	// 确认之前还没换
+	_, ok := repo.users["a@example.com"]
+	assert.True(t, ok)
+
+	token := changeTokenFromMail(t, mailer.sent[0].Body)
+	_, err := svc.Confirm(ctx, token+"x")
+	assert.Equal(t, ErrInvalidEmailToken, err)
+
+	uid, err := svc.Confirm(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), uid)
+	u, ok := repo.users["c@example.com"]
+	require.True(t, ok)
+	assert.Equal(t, int64(1), u.Id)
+	assert.True(t, u.EmailVerified)
+	_, ok = repo.users["a@example.com"]
+	assert.False(t, ok)
+
+	// 只能用一次
+	_, err = svc.Confirm(ctx, token)
+	assert.Equal(t, ErrInvalidEmailToken, err)
+}
+
+func TestEmailChangeService_Conflict(t *testing.T) {
+	svc, repo, mailer := newTestEmailChangeService(t)
+	ctx := context.Background()
+	require.NoError(t, svc.Request(ctx, 1, "correct horse battery", "c@example.com"))
+	// 确认之前新邮箱被别人注册了
+	repo.users["c@example.com"] = domain.User{Id: 3, Email: "c@example.com"}
+	_, err := svc.Confirm(ctx, changeTokenFromMail(t, mailer.sent[0].Body))
+	assert.Equal(t, ErrDuplicateEmail, err)
+}
+
+func TestEmailChangeService_WrongPurpose(t *testing.T) {
+	svc, _, _ := newTestEmailChangeService(t)
+	verifySvc, _, verifyMailer := newTestEmailVerificationService(time.Hour)
+	require.NoError(t, verifySvc.Send(context.Background(), "a@example.com"))
+	// 验证邮箱的链接不能拿来改邮箱
+	_, err := svc.Confirm(context.Background(), tokenFromMail(t, verifyMailer.sent[0]))
+	assert.Equal(t, ErrInvalidEmailToken, err)
+}
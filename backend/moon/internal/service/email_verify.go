@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"moon/internal/service/email"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrEmailNotVerified  = errors.New("邮箱还没有验证")
+	ErrInvalidEmailToken = errors.New("邮箱验证链接无效或者已经过期")
+)
+
+const purposeVerifyEmail = "verify_email"
+
+// EmailVerificationService 注册之后给邮箱发验证链接
+type EmailVerificationService interface {
+	// Send 给这个邮箱的用户发验证链接，已经验证过的不会再发
+	Send(ctx context.Context, email string) error
+	// Verify 校验链接里的 token，通过之后把邮箱标记为已验证
+	Verify(ctx context.Context, token string) error
+	// CheckLogin 配置了必须验证邮箱才能登录的时候，没有验证过的返回 ErrEmailNotVerified
+	CheckLogin(u domain.User) error
+}
+
+type EmailVerificationConfig struct {
+	// Key 签名 token 的密钥，和 access token 的密钥分开
+	Key        []byte
+	Expiration time.Duration
+	// LinkBase 邮件里的链接，token 会拼在 query 里
+	LinkBase        string
+	RequireForLogin bool
+}
+
+type EmailVerifyClaims struct {
+	jwt.RegisteredClaims
+	Uid   int64
+	Email string
+	// OldEmail 修改邮箱的时候才有，邮箱已经不是 OldEmail 了链接就作废
+	OldEmail string `json:",omitempty"`
+	// Purpose 防止别的用途的 token 被拿来验证邮箱
+	Purpose string
+}
+
+type emailVerificationService struct {
+	repo   repository.UserRepository
+	mailer email.Service
+	cfg    EmailVerificationConfig
+}
+
+func NewEmailVerificationService(repo repository.UserRepository, mailer email.Service,
+	cfg EmailVerificationConfig) EmailVerificationService {
+	return &emailVerificationService{
+		repo:   repo,
+		mailer: mailer,
+		cfg:    cfg,
+	}
+}
+
+func (s *emailVerificationService) Send(ctx context.Context, addr string) error {
+	u, err := s.repo.FindByEmail(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerified {
+		return nil
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, EmailVerifyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.Expiration)),
+		},
+		Uid:     u.Id,
+		Email:   u.Email,
+		Purpose: purposeVerifyEmail,
+	}).SignedString(s.cfg.Key)
+	if err != nil {
+		return err
+	}
+	link := s.cfg.LinkBase + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, email.Message{
+		To:      u.Email,
+		Subject: "请验证你的邮箱",
+		Body: fmt.Sprintf("你好 %s，\n\n请在 %s 内点击下面的链接完成邮箱验证：\n\n%s\n\n如果不是你本人注册的，请忽略这封邮件。",
+			u.Nickname, humanDuration(s.cfg.Expiration), link),
+	})
+}
+
+func (s *emailVerificationService) Verify(ctx context.Context, token string) error {
+	var claims EmailVerifyClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return s.cfg.Key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purposeVerifyEmail {
+		return ErrInvalidEmailToken
+	}
+	err = s.repo.MarkEmailVerified(ctx, claims.Uid, claims.Email)
+	// 发出链接之后邮箱改过了，这个链接就作废了
+	if err == repository.ErrUserNotFound {
+		return ErrInvalidEmailToken
+	}
+	return err
+}
+
+func (s *emailVerificationService) CheckLogin(u domain.User) error {
+	if s.cfg.RequireForLogin && !u.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// humanDuration 邮件里给人看的时长
+func humanDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d 小时", d/time.Hour)
+	}
+	return fmt.Sprintf("%d 分钟", d/time.Minute)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"moon/internal/domain"
+	"moon/internal/service/email"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMailer struct {
+	sent []email.Message
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg email.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkRegexp = regexp.MustCompile(`https://example\.com/verify\?token=(\S+)`)
+
+func newTestEmailVerificationService(expiration time.Duration) (*emailVerificationService, *mockUserRepository, *mockMailer) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Nickname: "a"},
+	}}
+	mailer := &mockMailer{}
+	svc := NewEmailVerificationService(repo, mailer, EmailVerificationConfig{
+		Key:        []byte("test-key"),
+		Expiration: expiration,
+		LinkBase:   "https://example.com/verify",
+	}).(*emailVerificationService)
+	return svc, repo, mailer
+}
+
+// tokenFromMail 从邮件正文里取出验证链接的 token
+func tokenFromMail(t *testing.T, msg email.Message) string {
+	m := linkRegexp.FindStringSubmatch(msg.Body)
+	require.Len(t, m, 2)
+	token, err := url.QueryUnescape(m[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestEmailVerificationService_SendAndVerify(t *testing.T) {
+	svc, repo, mailer := newTestEmailVerificationService(time.Hour)
+	ctx := context.Background()
+
+	require.NoError(t, svc.Send(ctx, "a@example.com"))
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "a@example.com", mailer.sent[0].To)
+	token := tokenFromMail(t, mailer.sent[0])
+
+	assert.Equal(t, ErrInvalidEmailToken, svc.Verify(ctx, token+"x"))
+	assert.False(t, repo.users["a@example.com"].EmailVerified)
+
+	require.NoError(t, svc.Verify(ctx, token))
+	assert.True(t, repo.users["a@example.com"].EmailVerified)
+
+	// 验证过了就不再发
+	require.NoError(t, svc.Send(ctx, "a@example.com"))
+	assert.Len(t, mailer.sent, 1)
+
+	assert.Equal(t, ErrUserNotFound, svc.Send(ctx, "nobody@example.com"))
+}
+
+func TestEmailVerificationService_Expired(t *testing.T) {
+	svc, _, mailer := newTestEmailVerificationService(-time.Minute)
+	ctx := context.Background()
+	require.NoError(t, svc.Send(ctx, "a@example.com"))
+	assert.Equal(t, ErrInvalidEmailToken, svc.Verify(ctx, tokenFromMail(t, mailer.sent[0])))
+}
+
+func TestEmailVerificationService_EmailChanged(t *testing.T) {
+	svc, repo, mailer := newTestEmailVerificationService(time.Hour)
+	ctx := context.Background()
+	require.NoError(t, svc.Send(ctx, "a@example.com"))
+	// 链接发出去之后改了邮箱，老链接不能把新邮箱标记为已验证
+	u := repo.users["a@example.com"]
+	delete(repo.users, "a@example.com")
+	u.Email = "b@example.com"
+	repo.users[u.Email] = u
+	assert.Equal(t, ErrInvalidEmailToken, svc.Verify(ctx, tokenFromMail(t, mailer.sent[0])))
+	assert.False(t, repo.users["b@example.com"].EmailVerified)
+}
+
+func TestEmailVerificationService_CheckLogin(t *testing.T) {
+	svc, _, _ := newTestEmailVerificationService(time.Hour)
+	assert.NoError(t, svc.CheckLogin(domain.User{}))
+	svc.cfg.RequireForLogin = true
+	assert.Equal(t, ErrEmailNotVerified, svc.CheckLogin(domain.User{}))
+	assert.NoError(t, svc.CheckLogin(domain.User{EmailVerified: true}))
+}
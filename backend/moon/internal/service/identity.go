@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+)
+
+// ExternalIdentityService 第三方登录的账号绑定
+type ExternalIdentityService interface {
+	// FindOrCreateUser 找到第三方账号绑定的用户，第一次登录的时候自动注册
+	// linkByEmail 为 true 并且第三方和我们都确认过邮箱的时候，绑定到邮箱相同的已有用户上，
+	// 只有完全信任这个第三方的时候才能打开，不然别人在第三方注册一个同样的邮箱就能登录进来。
+	// 绑定的用户注销了还没有彻底删除的时候，返回这个用户和 ErrUserPendingDeletion
+	FindOrCreateUser(ctx context.Context, ei domain.ExternalIdentity, linkByEmail bool) (domain.User, error)
+}
+
+type externalIdentityService struct {
+	repo     repository.ExternalIdentityRepository
+	userRepo repository.UserRepository
+}
+
+func NewExternalIdentityService(repo repository.ExternalIdentityRepository,
+	userRepo repository.UserRepository) ExternalIdentityService {
+	return &externalIdentityService{
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *externalIdentityService) FindOrCreateUser(ctx context.Context, ei domain.ExternalIdentity,
+	linkByEmail bool) (domain.User, error) {
+	u, err := s.findLinked(ctx, ei)
+	if err != repository.ErrUserNotFound {
+		return u, err
+	}
+
+	if linkByEmail && ei.EmailVerified && ei.Email != "" {
+		u, err = s.userRepo.FindByEmail(ctx, ei.Email)
+		switch {
+		case err == nil && u.EmailVerified:
+			ei.UserId = u.Id
+			err = s.repo.Link(ctx, ei)
+			// 绑定冲突说明并发的请求已经绑定过了
+			if err != nil && err != repository.ErrIdentityLinked {
+				return domain.User{}, err
+			}
+			return s.findLinked(ctx, ei)
+		// 本地账号的邮箱没有验证过，可能是攻击者抢先用受害者的邮箱注册的，
+		// 绑定上去的话受害者用 IdP 登录就进了攻击者的账号，所以当作邮箱被占用，注册新账号
+		case err == nil, err == repository.ErrUserNotFound:
+		default:
+			return domain.User{}, err
+		}
+	}
+
+	var nu domain.User
+	if ei.EmailVerified {
+		// IdP 已经确认过这个邮箱，不用我们再验证一次
+		nu.Email = ei.Email
+		nu.EmailVerified = true
+	}
+	_, err = s.repo.CreateUser(ctx, nu, ei)
+	if err == repository.ErrDuplicateUser && nu.Email != "" {
+		// 邮箱已经被别的账号用了，又不允许自动绑定，那就注册一个没有邮箱的账号
+		_, err = s.repo.CreateUser(ctx, domain.User{}, ei)
+	}
+	if err != nil && err != repository.ErrIdentityLinked {
+		return domain.User{}, err
+	}
+	return s.findLinked(ctx, ei)
+}
+
+func (s *externalIdentityService) findLinked(ctx context.Context, ei domain.ExternalIdentity) (domain.User, error) {
+	linked, err := s.repo.FindBySubject(ctx, ei.Provider, ei.Subject)
+	if err != nil {
+		return domain.User{}, err
+	}
+	u, err := s.userRepo.FindById(ctx, linked.UserId)
+	if err == nil && u.Deleted() {
+		return u, ErrUserPendingDeletion
+	}
+	return u, err
+}
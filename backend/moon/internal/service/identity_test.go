@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockExternalIdentityRepository struct {
+	userRepo   *mockUserRepository
+	identities map[string]domain.ExternalIdentity
+	nextId     int64
+}
+
+func (m *mockExternalIdentityRepository) FindBySubject(ctx context.Context, provider, subject string) (domain.ExternalIdentity, error) {
+	if ei, ok := m.identities[provider+":"+subject]; ok {
+		return ei, nil
+	}
+	return domain.ExternalIdentity{}, repository.ErrUserNotFound
+}
+
+func (m *mockExternalIdentityRepository) Link(ctx context.Context, ei domain.ExternalIdentity) error {
+	key := ei.Provider + ":" + ei.Subject
+	if _, ok := m.identities[key]; ok {
+		return repository.ErrIdentityLinked
+	}
+	m.identities[key] = ei
+	return nil
+}
+
+func (m *mockExternalIdentityRepository) CreateUser(ctx context.Context, u domain.User, ei domain.ExternalIdentity) (int64, error) {
+	if _, ok := m.userRepo.users[u.Email]; ok && u.Email != "" {
+		return 0, repository.ErrDuplicateUser
+	}
+	m.nextId++
+	u.Id = m.nextId
+	key := u.Email
+	if key == "" {
+		key = fmt.Sprintf("no-email-%d", u.Id)
+	}
+	m.userRepo.users[key] = u
+	ei.UserId = u.Id
+	return u.Id, m.Link(ctx, ei)
+}
+
+func TestExternalIdentityService_FindOrCreateUser(t *testing.T) {
+	existing := domain.User{Id: 100, Email: "a@example.com", EmailVerified: true}
+	tests := []struct {
+		name        string
+		ei          domain.ExternalIdentity
+		linkByEmail bool
+		linked      bool
+		wantId      int64
+		wantEmail   string
+	}{
+		{
+			name:   "已经绑定过",
+			ei:     domain.ExternalIdentity{Provider: "corp", Subject: "s1"},
+			linked: true,
+			wantId: 100, wantEmail: "a@example.com",
+		},
+		{
+			name:        "允许按邮箱绑定",
+			ei:          domain.ExternalIdentity{Provider: "corp", Subject: "s1", Email: "a@example.com", EmailVerified: true},
+			linkByEmail: true,
+			wantId:      100, wantEmail: "a@example.com",
+		},
+		{
+			name:        "邮箱没验证过不能绑定",
+			ei:          domain.ExternalIdentity{Provider: "corp", Subject: "s1", Email: "b@example.com"},
+			linkByEmail: true,
+			wantId:      1,
+		},
+		{
+			name:        "本地账号的邮箱没验证过不能绑定",
+			ei:          domain.ExternalIdentity{Provider: "corp", Subject: "s1", Email: "u@example.com", EmailVerified: true},
+			linkByEmail: true,
+			wantId:      1,
+			wantEmail:   "",
+		},
+		{
+			name:      "不允许按邮箱绑定，邮箱被占用就注册没有邮箱的账号",
+			ei:        domain.ExternalIdentity{Provider: "corp", Subject: "s1", Email: "a@example.com", EmailVerified: true},
+			wantId:    1,
+			wantEmail: "",
+		},
+		{
+			name:   "新用户带着验证过的邮箱注册",
+			ei:     domain.ExternalIdentity{Provider: "corp", Subject: "s1", Email: "c@example.com", EmailVerified: true},
+			wantId: 1, wantEmail: "c@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := &mockUserRepository{users: map[string]domain.User{
+				existing.Email: existing,
+				// 攻击者抢先用受害者的邮箱注册，没有验证
+				"u@example.com": {Id: 200, Email: "u@example.com"},
+			}}
+			repo := &mockExternalIdentityRepository{
+				userRepo:   userRepo,
+				identities: map[string]domain.ExternalIdentity{},
+			}
+			if tt.linked {
+				repo.identities["corp:s1"] = domain.ExternalIdentity{Provider: "corp", Subject: "s1", UserId: existing.Id}
+			}
+			svc := NewExternalIdentityService(repo, userRepo)
+			u, err := svc.FindOrCreateUser(context.Background(), tt.ei, tt.linkByEmail)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantId, u.Id)
+			assert.Equal(t, tt.wantEmail, u.Email)
+		})
+	}
+}
+
+func TestExternalIdentityService_FindOrCreateUser_Deleted(t *testing.T) {
+	deleted := domain.User{Id: 100, Status: domain.UserStatusDeleted}
+	userRepo := &mockUserRepository{users: map[string]domain.User{"deleted-100": deleted}}
+	repo := &mockExternalIdentityRepository{
+		userRepo: userRepo,
+		identities: map[string]domain.ExternalIdentity{
+			"corp:s1": {Provider: "corp", Subject: "s1", UserId: deleted.Id},
+		},
+	}
+	svc := NewExternalIdentityService(repo, userRepo)
+	u, err := svc.FindOrCreateUser(context.Background(),
+		domain.ExternalIdentity{Provider: "corp", Subject: "s1"}, false)
+	assert.Equal(t, ErrUserPendingDeletion, err)
+	// 带上用户，handler 要用它发恢复 token
+	assert.Equal(t, deleted.Id, u.Id)
+}
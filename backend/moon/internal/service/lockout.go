@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"moon/internal/repository/cache"
+)
+
+var ErrAccountLocked = errors.New("登录失败次数过多，账号已被临时锁定")
+
+// LoginLockoutService 按账号和 IP 统计登录失败次数，防止暴力破解密码
+type LoginLockoutService interface {
+	// Check 账号或者 IP 被锁定的时候返回 ErrAccountLocked 和剩余的锁定时长
+	Check(ctx context.Context, email, ip string) (time.Duration, error)
+	// Fail 记录一次登录失败，触发锁定的时候返回 ErrAccountLocked 和锁定时长
+	Fail(ctx context.Context, email, ip string) (time.Duration, error)
+	// Succeed 登录成功之后清空账号的失败记录
+	Succeed(ctx context.Context, email string) error
+	// Unlock 管理员手动解锁账号
+	Unlock(ctx context.Context, email string) error
+}
+
+type LockoutConfig struct {
+	Account cache.LockoutPolicy
+	// IP 的阈值应该比账号大很多，同一个出口 IP 后面可能有很多正常用户
+	IP cache.LockoutPolicy
+}
+
+type loginLockoutService struct {
+	cache cache.LoginAttemptCache
+	cfg   LockoutConfig
+}
+
+func NewLoginLockoutService(c cache.LoginAttemptCache, cfg LockoutConfig) LoginLockoutService {
+	return &loginLockoutService{
+		cache: c,
+		cfg:   cfg,
+	}
+}
+
+func (s *loginLockoutService) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	d, err := s.cache.LockedFor(ctx, accountSubject(email), ipSubject(ip))
+	if err != nil {
+		return 0, err
+	}
+	if d > 0 {
+		return d, ErrAccountLocked
+	}
+	return 0, nil
+}
+
+func (s *loginLockoutService) Fail(ctx context.Context, email, ip string) (time.Duration, error) {
+	accountLock, err := s.cache.Fail(ctx, accountSubject(email), s.cfg.Account)
+	if err != nil {
+		return 0, err
+	}
+	ipLock, err := s.cache.Fail(ctx, ipSubject(ip), s.cfg.IP)
+	if err != nil {
+		return 0, err
+	}
+	d := max(accountLock, ipLock)
+	if d > 0 {
+		return d, ErrAccountLocked
+	}
+	return 0, nil
+}
+
+func (s *loginLockoutService) Succeed(ctx context.Context, email string) error {
+	return s.cache.Reset(ctx, accountSubject(email))
+}
+
+func (s *loginLockoutService) Unlock(ctx context.Context, email string) error {
+	return s.cache.Reset(ctx, accountSubject(email))
+}
+
+// accountSubject 邮箱大小写不同也算同一个账号，不然改一下大小写就能绕过去
+func accountSubject(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"moon/internal/repository/cache"
+	"moon/pkg/cryptox"
+	"moon/pkg/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+var (
+	ErrMFAAlreadyEnabled  = errors.New("已经开启了两步验证")
+	ErrMFANotEnrolled     = errors.New("还没有生成两步验证的密钥")
+	ErrMFANotEnabled      = errors.New("没有开启两步验证")
+	ErrInvalidMFACode     = errors.New("验证码不对")
+	ErrInvalidMFAToken    = errors.New("两步验证已经过期，请重新登录")
+	ErrMFATooManyAttempts = errors.New("验证码错误次数太多，请重新登录")
+)
+
+const (
+	purposeMFA = "mfa"
+	// totpSkew 前后各允许一个时间窗口，容忍手机和服务器的时钟误差
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+// recoveryCodeEncoding 小写的 Crockford base32，没有 i l o u 这些容易看错的字母
+var recoveryCodeEncoding = base32.NewEncoding("0123456789abcdefghjkmnpqrstvwxyz").WithPadding(base32.NoPadding)
+
+// MFAService TOTP 两步验证
+type MFAService interface {
+	// Enroll 生成新的密钥，需要 Confirm 之后才生效，已经开启的返回 ErrMFAAlreadyEnabled
+	Enroll(ctx context.Context, uid int64) (MFAEnrollment, error)
+	// Confirm 用第一个验证码确认绑定，返回恢复码明文，只有这一次能看到
+	Confirm(ctx context.Context, uid int64, code string) ([]string, error)
+	// Disable 关闭两步验证，code 可以是验证码也可以是恢复码
+	Disable(ctx context.Context, uid int64, code string) error
+	// Begin 密码验证通过之后发一个短期的 mfa token，验证码通过之后才真正登录
+	Begin(ctx context.Context, uid int64) (MFAChallenge, error)
+	// Verify 校验 mfa token 和验证码（或者恢复码），返回用户 ID
+	// 验证码不对的时候也返回 token 里的用户 ID，调用方按账号记录失败次数
+	Verify(ctx context.Context, token, code string) (int64, error)
+}
+
+type MFAEnrollment struct {
+	// Secret base32 编码，给没法扫码的时候手动输入
+	Secret string
+	URI    string
+	// QRCode PNG 格式的二维码
+	QRCode []byte
+}
+
+type MFAChallenge struct {
+	Token     string
+	ExpiresIn time.Duration
+}
+
+type MFAConfig struct {
+	// Issuer 显示在验证器 App 里的名字
+	Issuer string
+	// TokenKey 签名 mfa token 的密钥，和 access token 的密钥分开
+	TokenKey        []byte
+	TokenExpiration time.Duration
+	// MaxAttempts 一个 mfa token 最多能试几次验证码
+	MaxAttempts int64
+}
+
+type MFAClaims struct {
+	jwt.RegisteredClaims
+	Uid     int64
+	Purpose string
+}
+
+type mfaService struct {
+	repo  repository.UserRepository
+	cache cache.MFACache
+	// aead 加密保存在数据库里的密钥
+	aead *cryptox.AEAD
+	cfg  MFAConfig
+}
+
+func NewMFAService(repo repository.UserRepository, c cache.MFACache, aead *cryptox.AEAD, cfg MFAConfig) MFAService {
+	return &mfaService{
+		repo:  repo,
+		cache: c,
+		aead:  aead,
+		cfg:   cfg,
+	}
+}
+
+func (s *mfaService) Enroll(ctx context.Context, uid int64) (MFAEnrollment, error) {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if u.TOTP.Enabled {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	enc, err := s.aead.Encrypt(secret, s.ad(uid))
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	// 重新 Enroll 会覆盖掉之前没有确认的密钥
+	err = s.repo.UpdateTOTP(ctx, uid, domain.TOTPInfo{Secret: enc})
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	uri := totp.URI(s.cfg.Issuer, s.account(u), secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	return MFAEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    uri,
+		QRCode: png,
+	}, nil
+}
+
+func (s *mfaService) Confirm(ctx context.Context, uid int64, code string) ([]string, error) {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTP.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if u.TOTP.Secret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	ok, err := s.checkTOTP(ctx, u, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		c, err := s.newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+		hashes = append(hashes, s.hashRecoveryCode(uid, c))
+	}
+	err = s.repo.UpdateTOTP(ctx, uid, domain.TOTPInfo{
+		Secret:        u.TOTP.Secret,
+		Enabled:       true,
+		RecoveryCodes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) Disable(ctx context.Context, uid int64, code string) error {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !u.TOTP.Enabled {
+		return ErrMFANotEnabled
+	}
+	if err = s.checkCode(ctx, u, code); err != nil {
+		return err
+	}
+	return s.repo.UpdateTOTP(ctx, uid, domain.TOTPInfo{})
+}
+
+func (s *mfaService) Begin(ctx context.Context, uid int64) (MFAChallenge, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, MFAClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.TokenExpiration)),
+		},
+		Uid:     uid,
+		Purpose: purposeMFA,
+	}).SignedString(s.cfg.TokenKey)
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	return MFAChallenge{Token: token, ExpiresIn: s.cfg.TokenExpiration}, nil
+}
+
+func (s *mfaService) Verify(ctx context.Context, token, code string) (int64, error) {
+	var claims MFAClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return s.cfg.TokenKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purposeMFA || claims.ID == "" {
+		return 0, ErrInvalidMFAToken
+	}
+	// 6 位数字只有一百万种，每个 token 只能试几次，试完了只能重新输密码
+	cnt, err := s.cache.Attempt(ctx, claims.ID, s.cfg.TokenExpiration)
+	if err != nil {
+		return 0, err
+	}
+	if cnt == 0 {
+		return 0, ErrInvalidMFAToken
+	}
+	if cnt > s.cfg.MaxAttempts {
+		return 0, ErrMFATooManyAttempts
+	}
+	u, err := s.repo.FindById(ctx, claims.Uid)
+	if err == repository.ErrUserNotFound {
+		return 0, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	// 发出 token 之后关掉了两步验证，让他重新登录
+	if !u.TOTP.Enabled {
+		return 0, ErrInvalidMFAToken
+	}
+	if err = s.checkCode(ctx, u, code); err != nil {
+		return u.Id, err
+	}
+	ok, err := s.cache.ConsumeToken(ctx, claims.ID, s.cfg.TokenExpiration)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrInvalidMFAToken
+	}
+	return u.Id, nil
+}
+
+// checkCode 先当成 TOTP 验证码，不是 6 位数字的再当成恢复码，恢复码用过之后删掉
+func (s *mfaService) checkCode(ctx context.Context, u domain.User, code string) error {
+	if len(code) == totp.Digits {
+		ok, err := s.checkTOTP(ctx, u, code)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		return ErrInvalidMFACode
+	}
+	hash := s.hashRecoveryCode(u.Id, code)
+	rest := make([]string, 0, len(u.TOTP.RecoveryCodes))
+	for _, h := range u.TOTP.RecoveryCodes {
+		if h != hash {
+			rest = append(rest, h)
+		}
+	}
+	if len(rest) == len(u.TOTP.RecoveryCodes) {
+		return ErrInvalidMFACode
+	}
+	err := s.repo.UpdateRecoveryCodes(ctx, u.Id, u.TOTP.RecoveryCodes, rest)
+	// 并发的请求已经用掉了
+	if err == repository.ErrUserNotFound {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+func (s *mfaService) checkTOTP(ctx context.Context, u domain.User, code string) (bool, error) {
+	secret, err := s.aead.Decrypt(u.TOTP.Secret, s.ad(u.Id))
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+	// 同一个验证码在有效期内只能用一次
+	return s.cache.UseStep(ctx, u.Id, step, time.Duration(2*totpSkew+1)*totp.Period*time.Second)
+}
+
+// ad 把密文和用户绑定，别人的密文复制过来也解不开
+func (s *mfaService) ad(uid int64) []byte {
+	return []byte("totp:" + strconv.FormatInt(uid, 10))
+}
+
+func (s *mfaService) account(u domain.User) string {
+	switch {
+	case u.Email != "":
+		return u.Email
+	case u.Phone != "":
+		return u.Phone
+	default:
+		return strconv.FormatInt(u.Id, 10)
+	}
+}
+
+func (s *mfaService) newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	c := recoveryCodeEncoding.EncodeToString(b)[:10]
+	return c[:5] + "-" + c[5:], nil
+}
+
+// hashRecoveryCode 恢复码熵足够大，带上用户 ID 做 sha256 就够了
+// 用户输入的时候可能有大小写、空格、没有中划线，统一处理一下
+func (s *mfaService) hashRecoveryCode(uid int64, code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(strconv.FormatInt(uid, 10) + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
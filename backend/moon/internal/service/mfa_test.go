@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"moon/internal/domain"
+	"moon/pkg/cryptox"
+	"moon/pkg/totp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMFACache struct {
+	attempts map[string]int64
+	used     map[string]bool
+}
+
+func (m *mockMFACache) Attempt(ctx context.Context, tokenId string, ttl time.Duration) (int64, error) {
+	if m.used["token:"+tokenId] {
+		return 0, nil
+	}
+	m.attempts[tokenId]++
+	return m.attempts[tokenId], nil
+}
+
+func (m *mockMFACache) ConsumeToken(ctx context.Context, tokenId string, ttl time.Duration) (bool, error) {
+	return m.setNX("token:" + tokenId), nil
+}
+
+func (m *mockMFACache) UseStep(ctx context.Context, uid int64, step int64, ttl time.Duration) (bool, error) {
+	return m.setNX(fmt.Sprintf("step:%d:%d", uid, step)), nil
+}
+
+func (m *mockMFACache) setNX(key string) bool {
+	if m.used[key] {
+		return false
+	}
+	m.used[key] = true
+	return true
+}
+
+func newTestMFAService(t *testing.T, repo *mockUserRepository) MFAService {
+	aead, err := cryptox.NewAEAD([]byte(strings.Repeat("k", 32)))
+	require.NoError(t, err)
+	return NewMFAService(repo, &mockMFACache{attempts: map[string]int64{}, used: map[string]bool{}}, aead, MFAConfig{
+		Issuer:          "Moon",
+		TokenKey:        []byte("mfa-key"),
+		TokenExpiration: time.Minute * 5,
+		MaxAttempts:     3,
+	})
+}
+
+func TestMFAService(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com"},
+	}}
+	svc := newTestMFAService(t, repo)
+	ctx := context.Background()
+
+	_, err := svc.Confirm(ctx, 1, "123456")
+	assert.Equal(t, ErrMFANotEnrolled, err)
+
+	enrollment, err := svc.Enroll(ctx, 1)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Moon:a@example.com?")
+	assert.NotEmpty(t, enrollment.QRCode)
+	// 数据库里只有密文
+	stored := repo.users["a@example.com"].TOTP
+	assert.NotContains(t, stored.Secret, enrollment.Secret)
+	assert.False(t, stored.Enabled)
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	step := totp.Step(time.Now())
+
+	_, err = svc.Confirm(ctx, 1, "000000")
+	assert.Equal(t, ErrInvalidMFACode, err)
+	codes, err := svc.Confirm(ctx, 1, totp.Code(secret, step))
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	assert.Regexp(t, `^[0-9a-z]{5}-[0-9a-z]{5}$`, codes[0])
+	assert.True(t, repo.users["a@example.com"].TOTP.Enabled)
+	assert.NotContains(t, repo.users["a@example.com"].TOTP.RecoveryCodes, codes[0])
+
+	_, err = svc.Enroll(ctx, 1)
+	assert.Equal(t, ErrMFAAlreadyEnabled, err)
+
+	// 用过的验证码不能再用
+	challenge, err := svc.Begin(ctx, 1)
+	require.NoError(t, err)
+	_, err = svc.Verify(ctx, challenge.Token, totp.Code(secret, step))
+	assert.Equal(t, ErrInvalidMFACode, err)
+	uid, err := svc.Verify(ctx, challenge.Token, totp.Code(secret, step+1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), uid)
+	// token 只能用一次
+	_, err = svc.Verify(ctx, challenge.Token, codes[0])
+	assert.Equal(t, ErrInvalidMFAToken, err)
+	_, err = svc.Verify(ctx, "garbage", totp.Code(secret, step-1))
+	assert.Equal(t, ErrInvalidMFAToken, err)
+
+	// 恢复码，大小写和中划线无所谓，只能用一次
+	challenge, err = svc.Begin(ctx, 1)
+	require.NoError(t, err)
+	uid, err = svc.Verify(ctx, challenge.Token, strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), uid)
+	assert.Len(t, repo.users["a@example.com"].TOTP.RecoveryCodes, 9)
+	challenge, err = svc.Begin(ctx, 1)
+	require.NoError(t, err)
+	_, err = svc.Verify(ctx, challenge.Token, codes[1])
+	assert.Equal(t, ErrInvalidMFACode, err)
+
+	require.NoError(t, svc.Disable(ctx, 1, codes[2]))
+	assert.Equal(t, domain.TOTPInfo{}, repo.users["a@example.com"].TOTP)
+	assert.Equal(t, ErrMFANotEnabled, svc.Disable(ctx, 1, codes[3]))
+}
+
+func TestMFAService_VerifyTooManyAttempts(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com"},
+	}}
+	svc := newTestMFAService(t, repo)
+	ctx := context.Background()
+	enrollment, err := svc.Enroll(ctx, 1)
+	require.NoError(t, err)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	step := totp.Step(time.Now())
+	_, err = svc.Confirm(ctx, 1, totp.Code(secret, step))
+	require.NoError(t, err)
+
+	challenge, err := svc.Begin(ctx, 1)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		uid, err := svc.Verify(ctx, challenge.Token, "abcde-abcde")
+		assert.Equal(t, ErrInvalidMFACode, err)
+		assert.Equal(t, int64(1), uid)
+	}
+	// 次数用完之后正确的验证码也不行
+	_, err = svc.Verify(ctx, challenge.Token, totp.Code(secret, step+1))
+	assert.Equal(t, ErrMFATooManyAttempts, err)
+}
@@ -0,0 +1,244 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"moon/internal/domain"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNonceMismatch = errors.New("id token 的 nonce 不匹配")
+
+// HTTPClient *http.Client 就实现了这个接口，测试的时候可以换成指向本地假 IdP 的 client
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// signingMethods id token 允许的签名算法，不允许 none 和 HMAC，
+// HMAC 的密钥是 client secret，拿到 client secret 的人就能伪造 id token
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512", "EdDSA"}
+
+type Config struct {
+	// Name 用在路由和外部身份表里，比如 corp，一旦上线就不能改
+	Name     string
+	Issuer   string
+	ClientId string
+	// ClientSecret 公开客户端可以为空，只靠 PKCE
+	ClientSecret string
+	RedirectURL  string
+	// Scopes 为空表示 openid email profile
+	Scopes []string
+	// LinkByEmail 第三方确认过的邮箱和已有用户相同的时候，直接绑定到这个用户
+	LinkByEmail bool
+	// JWKSCacheTTL 为空表示一个小时
+	JWKSCacheTTL time.Duration
+}
+
+// Discovery /.well-known/openid-configuration 里我们用得到的字段
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// Azp 有多个 audience 的时候必须是我们自己
+	Azp string `json:"azp"`
+}
+
+// Provider 一个 OIDC IdP，和具体的厂商无关
+type Provider struct {
+	cfg    Config
+	client HTTPClient
+
+	// discovery 第一次用的时候才拉取，这样 IdP 暂时不可用也不影响启动
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      *keySet
+}
+
+func NewProvider(cfg Config, client HTTPClient) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.JWKSCacheTTL <= 0 {
+		cfg.JWKSCacheTTL = time.Hour
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) LinkByEmail() bool {
+	return p.cfg.LinkByEmail
+}
+
+// AuthURL state 防 CSRF，nonce 防 id token 重放，verifier 是 PKCE 的 code_verifier，
+// 这三个都要由调用方保存下来，回调的时候用
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.loadDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientId)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange 用 code 换 id token，校验之后返回外部身份
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (domain.ExternalIdentity, error) {
+	d, err := p.loadDiscovery(ctx)
+	if err != nil {
+		return domain.ExternalIdentity{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientId)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return domain.ExternalIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic，RFC 6749 要求先做 form 编码
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientId), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return domain.ExternalIdentity{}, err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return domain.ExternalIdentity{}, err
+	}
+	if res.Error != "" || resp.StatusCode != http.StatusOK {
+		return domain.ExternalIdentity{}, fmt.Errorf("换取 token 失败 %d, %s %s",
+			resp.StatusCode, res.Error, res.ErrorDescription)
+	}
+	if res.IDToken == "" {
+		return domain.ExternalIdentity{}, errors.New("IdP 没有返回 id token")
+	}
+
+	claims, err := p.VerifyIDToken(ctx, res.IDToken, nonce)
+	if err != nil {
+		return domain.ExternalIdentity{}, err
+	}
+	return domain.ExternalIdentity{
+		Provider:      p.cfg.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+// VerifyIDToken 校验签名、iss、aud、exp 和 nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDTokenClaims, error) {
+	d, err := p.loadDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var claims IDTokenClaims
+	_, err = jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		// 容忍一点 IdP 和我们之间的时钟误差
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token 没有 sub")
+	}
+	if len(claims.Audience) > 1 && claims.Azp != p.cfg.ClientId {
+		return nil, errors.New("id token 的 azp 不是我们")
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return &claims, nil
+}
+
+func (p *Provider) loadDiscovery(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("拉取 OIDC discovery 失败，状态码 %d", resp.StatusCode)
+	}
+	var d Discovery
+	if err = json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	// OIDC Discovery 规范要求返回的 issuer 和配置的一模一样，防止被别的 IdP 冒充
+	if strings.TrimRight(d.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery 的 issuer %s 和配置的 %s 不一致", d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery 缺少必要的 endpoint")
+	}
+	p.discovery = &d
+	p.keys = newKeySet(p.client, d.JWKSURI, p.cfg.JWKSCacheTTL)
+	return p.discovery, nil
+}
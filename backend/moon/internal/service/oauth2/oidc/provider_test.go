@@ -0,0 +1,262 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIdP 一个最小的 OIDC IdP，code 就是 authorize 的时候记下来的 challenge 的 key
+type fakeIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	kid       string
+	key       *rsa.PrivateKey
+	jwksHits  int
+	challenge map[string]string
+	// claims 签进 id token 的内容，测试里按需修改
+	claims jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	idp := &fakeIdP{t: t, challenge: map[string]string{}}
+	idp.rotate("k1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksHits++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		id, secret, _ := r.BasicAuth()
+		challenge, ok := idp.challenge[r.PostForm.Get("code")]
+		if id != "client-1" || secret != "secret" || !ok ||
+			Challenge(r.PostForm.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign()})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	idp.claims = jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            "client-1",
+		"sub":            "sub-1",
+		"email":          "a@example.com",
+		"email_verified": true,
+	}
+	return idp
+}
+
+func (idp *fakeIdP) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(idp.t, err)
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.kid, idp.key = kid, key
+}
+
+// authorize 模拟用户在 IdP 登录，返回 code
+func (idp *fakeIdP) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(idp.t, err)
+	q := u.Query()
+	require.Equal(idp.t, "S256", q.Get("code_challenge_method"))
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims["nonce"] = q.Get("nonce")
+	code := "code-" + q.Get("state")
+	idp.challenge[code] = q.Get("code_challenge")
+	return code
+}
+
+func (idp *fakeIdP) sign() string {
+	claims := jwt.MapClaims{
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	s, err := token.SignedString(idp.key)
+	require.NoError(idp.t, err)
+	return s
+}
+
+func (idp *fakeIdP) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "corp",
+		Issuer:       idp.server.URL,
+		ClientId:     "client-1",
+		ClientSecret: "secret",
+		RedirectURL:  "https://example.com/oauth2/oidc/corp/callback",
+	}, idp.server.Client())
+}
+
+// login 走一遍 AuthURL 到 Exchange，nonce 为空表示用 AuthURL 里的
+func login(t *testing.T, idp *fakeIdP, p *Provider, nonce string) (domain.ExternalIdentity, error) {
+	ctx := context.Background()
+	verifier, err := NewVerifier()
+	require.NoError(t, err)
+	n, err := NewNonce()
+	require.NoError(t, err)
+	authURL, err := p.AuthURL(ctx, "state-1", n, verifier)
+	require.NoError(t, err)
+	code := idp.authorize(authURL)
+	if nonce == "" {
+		nonce = n
+	}
+	return p.Exchange(ctx, code, verifier, nonce)
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mutate  func(idp *fakeIdP)
+		nonce   string
+		wantErr bool
+		wantEI  domain.ExternalIdentity
+	}{
+		{
+			name: "登录成功",
+			wantEI: domain.ExternalIdentity{
+				Provider:      "corp",
+				Subject:       "sub-1",
+				Email:         "a@example.com",
+				EmailVerified: true,
+			},
+		},
+		{
+			name:    "nonce 不对",
+			nonce:   "other-nonce",
+			wantErr: true,
+		},
+		{
+			name: "aud 不是我们",
+			mutate: func(idp *fakeIdP) {
+				idp.claims["aud"] = "client-2"
+			},
+			wantErr: true,
+		},
+		{
+			name: "多个 aud 但是 azp 不是我们",
+			mutate: func(idp *fakeIdP) {
+				idp.claims["aud"] = []string{"client-1", "client-2"}
+				idp.claims["azp"] = "client-2"
+			},
+			wantErr: true,
+		},
+		{
+			name: "iss 不对",
+			mutate: func(idp *fakeIdP) {
+				idp.claims["iss"] = "https://evil.example.com"
+			},
+			wantErr: true,
+		},
+		{
+			name: "已经过期",
+			mutate: func(idp *fakeIdP) {
+				idp.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			if tc.mutate != nil {
+				tc.mutate(idp)
+			}
+			ei, err := login(t, idp, idp.provider(), tc.nonce)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantEI, ei)
+		})
+	}
+}
+
+func TestProvider_ExchangeWrongVerifier(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+	authURL, err := p.AuthURL(ctx, "state-1", "nonce-1", "verifier-1")
+	require.NoError(t, err)
+	code := idp.authorize(authURL)
+	_, err = p.Exchange(ctx, code, "verifier-2", "nonce-1")
+	assert.Error(t, err)
+}
+
+func TestProvider_KeyRotation(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := idp.provider()
+	_, err := login(t, idp, p, "")
+	require.NoError(t, err)
+	_, err = login(t, idp, p, "")
+	require.NoError(t, err)
+	// 缓存命中，只拉取了一次
+	assert.Equal(t, 1, idp.jwksHits)
+
+	idp.rotate("k2")
+	// 刚拉取过，不认识的 kid 不会马上去拉
+	_, err = login(t, idp, p, "")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, 1, idp.jwksHits)
+
+	p.keys.minRefresh = 0
+	_, err = login(t, idp, p, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, idp.jwksHits)
+}
+
+func TestProvider_DiscoveryIssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := NewProvider(Config{
+		Name:     "corp",
+		Issuer:   idp.server.URL + "/other",
+		ClientId: "client-1",
+	}, idp.server.Client())
+	_, err := p.AuthURL(context.Background(), "s", "n", "v")
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"moon/internal/domain"
+)
+
+// HTTPClient *http.Client 就实现了这个接口，测试的时候可以换成指向本地假服务的 client
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type Service interface {
+	// AuthURL 用户扫码登录的地址，state 会在回调的时候原样带回来
+	AuthURL(ctx context.Context, state string) (string, error)
+	// VerifyCode 用回调拿到的 code 换取用户的 openid 和 unionid
+	VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error)
+}
+
+type Config struct {
+	AppId     string
+	AppSecret string
+	// RedirectURL 微信回调的地址，也就是 /oauth2/wechat/callback
+	RedirectURL string
+	// AuthBase 和 APIBase 为空表示用微信官方的地址，测试的时候可以改成本地假服务
+	AuthBase string
+	APIBase  string
+}
+
+type service struct {
+	cfg    Config
+	client HTTPClient
+}
+
+func NewService(cfg Config, client HTTPClient) Service {
+	if cfg.AuthBase == "" {
+		cfg.AuthBase = "https://open.weixin.qq.com"
+	}
+	if cfg.APIBase == "" {
+		cfg.APIBase = "https://api.weixin.qq.com"
+	}
+	return &service{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+func (s *service) AuthURL(ctx context.Context, state string) (string, error) {
+	// 微信要求参数按这个顺序，url.Values.Encode 会按字母排序，所以这里手动拼
+	const tpl = "%s/connect/qrconnect?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_login&state=%s#wechat_redirect"
+	return fmt.Sprintf(tpl, s.cfg.AuthBase, url.QueryEscape(s.cfg.AppId),
+		url.QueryEscape(s.cfg.RedirectURL), url.QueryEscape(state)), nil
+}
+
+func (s *service) VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error) {
+	q := url.Values{}
+	q.Set("appid", s.cfg.AppId)
+	q.Set("secret", s.cfg.AppSecret)
+	q.Set("code", code)
+	q.Set("grant_type", "authorization_code")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		s.cfg.APIBase+"/sns/oauth2/access_token?"+q.Encode(), nil)
+	if err != nil {
+		return domain.WechatInfo{}, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return domain.WechatInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	var res Result
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return domain.WechatInfo{}, err
+	}
+	// 微信出错的时候 HTTP 状态码也是 200，要看 errcode
+	if res.ErrCode != 0 {
+		return domain.WechatInfo{}, fmt.Errorf("换取 access token 失败 %d, %s", res.ErrCode, res.ErrMsg)
+	}
+	if res.OpenId == "" {
+		return domain.WechatInfo{}, fmt.Errorf("微信没有返回 openid")
+	}
+	return domain.WechatInfo{
+		OpenId:  res.OpenId,
+		UnionId: res.UnionId,
+	}, nil
+}
+
+type Result struct {
+	ErrCode int64  `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+
+	OpenId  string `json:"openid"`
+	Scope   string `json:"scope"`
+	UnionId string `json:"unionid"`
+}
@@ -0,0 +1,64 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"moon/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_AuthURL(t *testing.T) {
+	svc := NewService(Config{
+		AppId:       "app-id",
+		RedirectURL: "https://example.com/oauth2/wechat/callback",
+	}, http.DefaultClient)
+	authURL, err := svc.AuthURL(context.Background(), "state-1")
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "open.weixin.qq.com", u.Host)
+	assert.Equal(t, "app-id", u.Query().Get("appid"))
+	assert.Equal(t, "https://example.com/oauth2/wechat/callback", u.Query().Get("redirect_uri"))
+	assert.Equal(t, "state-1", u.Query().Get("state"))
+	assert.Equal(t, "wechat_redirect", u.Fragment)
+}
+
+func TestService_VerifyCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/sns/oauth2/access_token" || q.Get("appid") != "app-id" ||
+			q.Get("secret") != "secret" || q.Get("grant_type") != "authorization_code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var res Result
+		switch q.Get("code") {
+		case "good":
+			res = Result{AccessToken: "at", OpenId: "openid-1", UnionId: "unionid-1"}
+		default:
+			res = Result{ErrCode: 40029, ErrMsg: "invalid code"}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	svc := NewService(Config{
+		AppId:     "app-id",
+		AppSecret: "secret",
+		APIBase:   server.URL,
+	}, server.Client())
+
+	info, err := svc.VerifyCode(context.Background(), "good")
+	require.NoError(t, err)
+	assert.Equal(t, domain.WechatInfo{OpenId: "openid-1", UnionId: "unionid-1"}, info)
+
+	_, err = svc.VerifyCode(context.Background(), "bad")
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"moon/internal/repository/cache"
+	"moon/internal/service/email"
+	"moon/pkg/passwordx"
+)
+
+var ErrInvalidResetToken = errors.New("重置密码的链接无效或者已经过期")
+
+// PasswordResetService 忘记密码之后通过邮件里的链接重置
+type PasswordResetService interface {
+	// Forgot 给这个邮箱的用户发重置链接，邮箱不存在的时候返回 ErrUserNotFound
+	Forgot(ctx context.Context, email string) error
+	// Peek 校验 token 但是不消耗，返回 token 对应的用户，用来在重置之前检查新密码
+	Peek(ctx context.Context, token string) (domain.User, error)
+	// Reset 校验 token 并修改密码，返回用户 ID，调用方负责撤销这个用户的所有会话
+	Reset(ctx context.Context, token, password string) (int64, error)
+}
+
+type PasswordResetConfig struct {
+	Expiration time.Duration
+	// LinkBase 邮件里的链接，一般是前端填写新密码的页面，token 会拼在 query 里
+	LinkBase string
+}
+
+type passwordResetService struct {
+	repo   repository.UserRepository
+	cache  cache.PasswordResetCache
+	mailer email.Service
+	hasher *passwordx.Manager
+	cfg    PasswordResetConfig
+}
+
+func NewPasswordResetService(repo repository.UserRepository, c cache.PasswordResetCache,
+	mailer email.Service, hasher *passwordx.Manager, cfg PasswordResetConfig) PasswordResetService {
+	return &passwordResetService{
+		repo:   repo,
+		cache:  c,
+		mailer: mailer,
+		hasher: hasher,
+		cfg:    cfg,
+	}
+}
+
+func (s *passwordResetService) Forgot(ctx context.Context, addr string) error {
+	u, err := s.repo.FindByEmail(ctx, addr)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	// token 里带上用户 ID，这样 Redis 里可以按用户保存，只有最新的链接有效
+	token := fmt.Sprintf("%d.%s", u.Id, base64.RawURLEncoding.EncodeToString(b))
+	if err = s.cache.Set(ctx, u.Id, s.hash(token)); err != nil {
+		return err
+	}
+	link := s.cfg.LinkBase + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, email.Message{
+		To:      u.Email,
+		Subject: "重置你的密码",
+		Body: fmt.Sprintf("你好 %s，\n\n请在 %s 内点击下面的链接重置密码，链接只能使用一次：\n\n%s\n\n如果不是你本人操作的，请忽略这封邮件，你的密码不会被修改。",
+			u.Nickname, humanDuration(s.cfg.Expiration), link),
+	})
+}
+
+func (s *passwordResetService) Peek(ctx context.Context, token string) (domain.User, error) {
+	uid, err := s.parseUid(token)
+	if err != nil {
+		return domain.User{}, err
+	}
+	ok, err := s.cache.Verify(ctx, uid, s.hash(token))
+	if err != nil {
+		return domain.User{}, err
+	}
+	if !ok {
+		return domain.User{}, ErrInvalidResetToken
+	}
+	u, err := s.repo.FindById(ctx, uid)
+	if err == repository.ErrUserNotFound {
+		return domain.User{}, ErrInvalidResetToken
+	}
+	return u, err
+}
+
+func (s *passwordResetService) Reset(ctx context.Context, token, password string) (int64, error) {
+	uid, err := s.parseUid(token)
+	if err != nil {
+		return 0, err
+	}
+	// 先算好哈希再消费 token，免得 token 用掉了密码却没改成
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return 0, err
+	}
+	ok, err := s.cache.Consume(ctx, uid, s.hash(token))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrInvalidResetToken
+	}
+	err = s.repo.UpdatePassword(ctx, uid, hashed)
+	if err == repository.ErrUserNotFound {
+		return 0, ErrInvalidResetToken
+	}
+	return uid, err
+}
+
+// parseUid token 的格式是 "用户 ID.随机串"
+func (s *passwordResetService) parseUid(token string) (int64, error) {
+	uidStr, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidResetToken
+	}
+	uid, err := strconv.ParseInt(uidStr, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidResetToken
+	}
+	return uid, nil
+}
+
+// hash token 的熵足够大，不需要加盐或者用慢哈希
+func (s *passwordResetService) hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"moon/internal/domain"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPasswordResetCache struct {
+	tokens map[int64]string
+}
+
+func (m *mockPasswordResetCache) Set(ctx context.Context, uid int64, tokenHash string) error {
+	m.tokens[uid] = tokenHash
+	return nil
+}
+
+func (m *mockPasswordResetCache) Verify(ctx context.Context, uid int64, tokenHash string) (bool, error) {
+	return m.tokens[uid] == tokenHash, nil
+}
+
+func (m *mockPasswordResetCache) Consume(ctx context.Context, uid int64, tokenHash string) (bool, error) {
+	if m.tokens[uid] != tokenHash {
+		return false, nil
+	}
+	delete(m.tokens, uid)
+	return true, nil
+}
+
+var resetLinkRegexp = regexp.MustCompile(`https://example\.com/reset\?token=(\S+)`)
+
+func TestPasswordResetService(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Password: "old"},
+	}}
+	mailer := &mockMailer{}
+	svc := NewPasswordResetService(repo, &mockPasswordResetCache{tokens: map[int64]string{}}, mailer, newTestHasher(),
+		PasswordResetConfig{Expiration: time.Minute * 30, LinkBase: "https://example.com/reset"})
+	ctx := context.Background()
+
+	assert.Equal(t, ErrUserNotFound, svc.Forgot(ctx, "nobody@example.com"))
+	assert.Empty(t, mailer.sent)
+
+	require.NoError(t, svc.Forgot(ctx, "a@example.com"))
+	require.Len(t, mailer.sent, 1)
+	m := resetLinkRegexp.FindStringSubmatch(mailer.sent[0].Body)
+	require.Len(t, m, 2)
+	token, err := url.QueryUnescape(m[1])
+	require.NoError(t, err)
+
+	for _, bad := range []string{"", "garbage", "2" + token[1:], token + "x"} {
+		_, err = svc.Peek(ctx, bad)
+		assert.Equal(t, ErrInvalidResetToken, err, bad)
+		_, err = svc.Reset(ctx, bad, "NewPassword123!")
+		assert.Equal(t, ErrInvalidResetToken, err, bad)
+	}
+
+	// Peek 可以多次调用
+	for i := 0; i < 2; i++ {
+		u, err := svc.Peek(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), u.Id)
+	}
+
+	uid, err := svc.Reset(ctx, token, "NewPassword123!")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), uid)
+	ok, _, err := newTestHasher().Verify(repo.users["a@example.com"].Password, "NewPassword123!")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 只能用一次
+	_, err = svc.Reset(ctx, token, "Another123!")
+	assert.Equal(t, ErrInvalidResetToken, err)
+	_, err = svc.Peek(ctx, token)
+	assert.Equal(t, ErrInvalidResetToken, err)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"moon/internal/repository"
+)
+
+const (
+	bizBindPhone   = "bind_phone"
+	bizUnbindPhone = "unbind_phone"
+)
+
+var (
+	ErrInvalidCode   = errors.New("验证码有误")
+	ErrSamePhone     = errors.New("已经绑定了这个手机号")
+	ErrPhoneNotBound = errors.New("还没有绑定手机号")
+	// ErrPhoneRequired 短信登录注册的账号没有邮箱，解绑之后就登录不了了
+	ErrPhoneRequired = errors.New("手机号是唯一的登录方式，不能解绑")
+)
+
+// PhoneService 绑定和解绑手机号，都要先验证短信验证码
+// 手机号都是 E.164 格式，由调用方规范化
+type PhoneService interface {
+	// SendBindCode 给要绑定的手机号发验证码，已经被别的账号绑定了的时候返回 ErrDuplicatePhone
+	SendBindCode(ctx context.Context, uid int64, phone string) error
+	// Bind 验证码对了才绑定，已经绑定过的换成新的号码
+	Bind(ctx context.Context, uid int64, phone, code string) error
+	// SendUnbindCode 给当前绑定的手机号发验证码，返回这个手机号
+	SendUnbindCode(ctx context.Context, uid int64) (string, error)
+	Unbind(ctx context.Context, uid int64, code string) error
+}
+
+type phoneService struct {
+	repo    repository.UserRepository
+	codeSvc CodeService
+}
+
+func NewPhoneService(repo repository.UserRepository, codeSvc CodeService) PhoneService {
+	return &phoneService{
+		repo:    repo,
+		codeSvc: codeSvc,
+	}
+}
+
+func (s *phoneService) SendBindCode(ctx context.Context, uid int64, phone string) error {
+	// 这里只是提前告诉用户，真正的校验靠唯一索引
+	u, err := s.repo.FindByPhone(ctx, phone)
+	switch {
+	case err == nil && u.Id == uid:
+		return ErrSamePhone
+	case err == nil:
+		return ErrDuplicatePhone
+	case err != repository.ErrUserNotFound:
+		return err
+	}
+	return s.codeSvc.Send(ctx, bizBindPhone, phone)
+}
+
+func (s *phoneService) Bind(ctx context.Context, uid int64, phone, code string) error {
+	ok, err := s.codeSvc.Verify(ctx, bizBindPhone, phone, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return s.repo.UpdatePhone(ctx, uid, phone)
+}
+
+func (s *phoneService) SendUnbindCode(ctx context.Context, uid int64) (string, error) {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if u.Phone == "" {
+		return "", ErrPhoneNotBound
+	}
+	if u.Email == "" && u.WechatInfo.OpenId == "" {
+		return "", ErrPhoneRequired
+	}
+	return u.Phone, s.codeSvc.Send(ctx, bizUnbindPhone, u.Phone)
+}
+
+func (s *phoneService) Unbind(ctx context.Context, uid int64, code string) error {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if u.Phone == "" {
+		return ErrPhoneNotBound
+	}
+	if u.Email == "" && u.WechatInfo.OpenId == "" {
+		return ErrPhoneRequired
+	}
+	ok, err := s.codeSvc.Verify(ctx, bizUnbindPhone, u.Phone, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return s.repo.UpdatePhone(ctx, uid, "")
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"moon/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCodeService 验证码固定是 123456，记录发给了谁
+type mockCodeService struct {
+	sent []string
+}
+
+func (m *mockCodeService) Send(ctx context.Context, biz, phone string) error {
+	m.sent = append(m.sent, biz+":"+phone)
+	return nil
+}
+
+func (m *mockCodeService) Verify(ctx context.Context, biz, phone, code string) (bool, error) {
+	for _, s := range m.sent {
+		if s == biz+":"+phone {
+			return code == "123456", nil
+		}
+	}
+	return false, nil
+}
+
+func TestPhoneService_Bind(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com"},
+		"b@example.com": {Id: 2, Email: "b@example.com", Phone: "+8613900139000"},
+	}}
+	codeSvc := &mockCodeService{}
+	svc := NewPhoneService(repo, codeSvc)
+	ctx := context.Background()
+
+	assert.Equal(t, ErrDuplicatePhone, svc.SendBindCode(ctx, 1, "+8613900139000"))
+	assert.Empty(t, codeSvc.sent)
+
+	require.NoError(t, svc.SendBindCode(ctx, 1, "+8613800138000"))
+	assert.Equal(t, []string{"bind_phone:+8613800138000"}, codeSvc.sent)
+	assert.Equal(t, ErrInvalidCode, svc.Bind(ctx, 1, "+8613800138000", "000000"))
+	// 验证码是发给这个号码的，不能拿来绑定别的号码
+	assert.Equal(t, ErrInvalidCode, svc.Bind(ctx, 1, "+8613700137000", "123456"))
+	assert.Empty(t, repo.users["a@example.com"].Phone)
+
+	require.NoError(t, svc.Bind(ctx, 1, "+8613800138000", "123456"))
+	assert.Equal(t, "+8613800138000", repo.users["a@example.com"].Phone)
+	assert.Equal(t, ErrSamePhone, svc.SendBindCode(ctx, 1, "+8613800138000"))
+
+	// 发验证码之后号码被别人绑定了，靠唯一索引兜底
+	require.NoError(t, svc.SendBindCode(ctx, 1, "+8613600136000"))
+	u := repo.users["b@example.com"]
+	u.Phone = "+8613600136000"
+	repo.users["b@example.com"] = u
+	assert.Equal(t, ErrDuplicatePhone, svc.Bind(ctx, 1, "+8613600136000", "123456"))
+}
+
+func TestPhoneService_Unbind(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]domain.User{
+		"a@example.com": {Id: 1, Email: "a@example.com", Phone: "+8613800138000"},
+		// 短信登录注册的账号没有邮箱
+		"":              {Id: 2, Phone: "+8613900139000"},
+		"c@example.com": {Id: 3, Email: "c@example.com"},
+	}}
+	codeSvc := &mockCodeService{}
+	svc := NewPhoneService(repo, codeSvc)
+	ctx := context.Background()
+
+	_, err := svc.SendUnbindCode(ctx, 2)
+	assert.Equal(t, ErrPhoneRequired, err)
+	_, err = svc.SendUnbindCode(ctx, 3)
+	assert.Equal(t, ErrPhoneNotBound, err)
+	assert.Empty(t, codeSvc.sent)
+
+	phone, err := svc.SendUnbindCode(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "+8613800138000", phone)
+	assert.Equal(t, []string{"unbind_phone:+8613800138000"}, codeSvc.sent)
+	assert.Equal(t, ErrInvalidCode, svc.Unbind(ctx, 1, "000000"))
+	require.NoError(t, svc.Unbind(ctx, 1, "123456"))
+	assert.Empty(t, repo.users["a@example.com"].Phone)
+}
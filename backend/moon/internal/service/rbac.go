@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+)
+
+type RBACService interface {
+	// Roles 用户当前的角色，签发 access token 的时候写进 UserClaims
+	Roles(ctx context.Context, uid int64) ([]string, error)
+	// HasPermission 这些角色里是否有任何一个拥有 perm 权限
+	HasPermission(ctx context.Context, roles []string, perm string) (bool, error)
+	// SyncRoles 让数据库里的角色和 roles 完全一致，不在 roles 里的角色会被删掉，返回删掉的数量。
+	// 用户身上还挂着被删掉的角色名，但是它不再授予任何权限
+	SyncRoles(ctx context.Context, roles []domain.Role) (int64, error)
+	// EnsureUserWithRole 确保 seed.Email 对应的用户存在并且拥有 seed.Role 角色，用于启动时创建初始管理员。
+	// 用户不存在的时候用 seed.Password 注册一个；邮箱已经被别人注册了的时候，
+	// 只有打开了 PromoteExisting 并且邮箱验证过，才会把角色授予这个账号，否则返回 ErrAdminEmailTaken
+	EnsureUserWithRole(ctx context.Context, seed AdminSeed) error
+}
+
+var ErrAdminEmailTaken = errors.New("管理员邮箱已经被一个没有验证过的账号注册了，或者没有允许提升已有账号")
+
+// AdminSeed 启动时创建的初始管理员
+type AdminSeed struct {
+	Email    string
+	Password string
+	Role     string
+	// PromoteExisting 邮箱已经注册过的时候是否把角色授予这个账号，账号的邮箱必须验证过
+	PromoteExisting bool
+}
+
+type rbacService struct {
+	userSvc  UserService
+	userRepo repository.UserRepository
+	roleRepo repository.RoleRepository
+
+	// 角色的定义很少变化，在本地缓存一下，避免每个请求都去查数据库
+	mu       sync.RWMutex
+	roles    map[string]domain.Role
+	loadedAt time.Time
+	ttl      time.Duration
+}
+
+func NewRBACService(userSvc UserService, userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository) RBACService {
+	return &rbacService{
+		userSvc:  userSvc,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+		ttl:      time.Minute,
+	}
+}
+
+func (s *rbacService) Roles(ctx context.Context, uid int64) ([]string, error) {
+	u, err := s.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return u.Roles, nil
+}
+
+func (s *rbacService) HasPermission(ctx context.Context, roles []string, perm string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+	defs, err := s.loadRoles(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range roles {
+		if r, ok := defs[name]; ok && r.Allows(perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *rbacService) SyncRoles(ctx context.Context, roles []domain.Role) (int64, error) {
+	// 不管成功与否都让缓存失效，下次重新加载
+	defer func() {
+		s.mu.Lock()
+		s.roles = nil
+		s.mu.Unlock()
+	}()
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		if err := s.roleRepo.Save(ctx, r); err != nil {
+			return 0, fmt.Errorf("保存角色 %s 失败 %w", r.Name, err)
+		}
+		names = append(names, r.Name)
+	}
+	return s.roleRepo.DeleteExcept(ctx, names)
+}
+
+func (s *rbacService) EnsureUserWithRole(ctx context.Context, seed AdminSeed) error {
+	u, err := s.userRepo.FindByEmail(ctx, seed.Email)
+	switch err {
+	case nil:
+		if hasRole(u.Roles, seed.Role) {
+			return nil
+		}
+		// 别人可能抢先用这个邮箱注册了，不能直接把管理员给出去
+		if !seed.PromoteExisting || !u.EmailVerified {
+			return ErrAdminEmailTaken
+		}
+		return s.userRepo.UpdateRoles(ctx, u.Id, append(u.Roles, seed.Role))
+	case repository.ErrUserNotFound:
+		return s.seedAdmin(ctx, seed)
+	default:
+		return err
+	}
+}
+
+// seedAdmin 注册一个新的管理员，邮箱是运维配置的，直接当作验证过
+func (s *rbacService) seedAdmin(ctx context.Context, seed AdminSeed) error {
+	nickname, _, _ := strings.Cut(seed.Email, "@")
+	err := s.userSvc.Signup(ctx, seed.Email, seed.Password, nickname)
+	if err == ErrDuplicateEmail {
+		// 并发启动的时候被另一个实例抢先创建了，不知道是谁创建的，按已有账号处理
+		return ErrAdminEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	u, err := s.userRepo.FindByEmail(ctx, seed.Email)
+	if err != nil {
+		return err
+	}
+	err = s.userRepo.MarkEmailVerified(ctx, u.Id, u.Email)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.UpdateRoles(ctx, u.Id, append(u.Roles, seed.Role))
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *rbacService) loadRoles(ctx context.Context) (map[string]domain.Role, error) {
+	s.mu.RLock()
+	roles, loadedAt := s.roles, s.loadedAt
+	s.mu.RUnlock()
+	if roles != nil && time.Since(loadedAt) < s.ttl {
+		return roles, nil
+	}
+
+	list, err := s.roleRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles = make(map[string]domain.Role, len(list))
+	for _, r := range list {
+		roles[r.Name] = r
+	}
+	s.mu.Lock()
+	s.roles, s.loadedAt = roles, time.Now()
+	s.mu.Unlock()
+	return roles, nil
+}
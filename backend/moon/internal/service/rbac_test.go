@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"moon/internal/domain"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRoleRepository struct {
+	roles map[string]domain.Role
+	loads int
+}
+
+func (m *mockRoleRepository) Save(ctx context.Context, r domain.Role) error {
+	m.roles[r.Name] = r
+	return nil
+}
+
+func (m *mockRoleRepository) FindAll(ctx context.Context) ([]domain.Role, error) {
+	m.loads++
+	res := make([]domain.Role, 0, len(m.roles))
+	for _, r := range m.roles {
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (m *mockRoleRepository) DeleteExcept(ctx context.Context, names []string) (int64, error) {
+	var cnt int64
+	for name := range m.roles {
+		if !slices.Contains(names, name) {
+			delete(m.roles, name)
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func TestRBACService_HasPermission(t *testing.T) {
+	roleRepo := &mockRoleRepository{roles: map[string]domain.Role{
+		"admin":  {Name: "admin", Permissions: []string{"*"}},
+		"editor": {Name: "editor", Permissions: []string{"article:*", "user:read"}},
+	}}
+	svc := NewRBACService(nil, &mockUserRepository{}, roleRepo)
+
+	tests := []struct {
+		name  string
+		roles []string
+		perm  string
+		want  bool
+	}{
+		{name: "超级管理员", roles: []string{"admin"}, perm: "user:admin", want: true},
+		{name: "通配符", roles: []string{"editor"}, perm: "article:publish", want: true},
+		{name: "精确匹配", roles: []string{"editor"}, perm: "user:read", want: true},
+		{name: "没有权限", roles: []string{"editor"}, perm: "user:admin", want: false},
+		{name: "未知角色", roles: []string{"ghost"}, perm: "user:read", want: false},
+		{name: "没有角色", perm: "user:read", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := svc.HasPermission(context.Background(), tt.roles, tt.perm)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+	// 角色定义会被缓存
+	assert.Equal(t, 1, roleRepo.loads)
+}
+
+func TestRBACService_SyncRoles(t *testing.T) {
+	roleRepo := &mockRoleRepository{roles: map[string]domain.Role{
+		"admin":  {Name: "admin", Permissions: []string{"*"}},
+		"editor": {Name: "editor", Permissions: []string{"article:*", "user:read"}},
+	}}
+	svc := NewRBACService(nil, &mockUserRepository{}, roleRepo)
+	ctx := context.Background()
+	ok, err := svc.HasPermission(ctx, []string{"editor"}, "user:read")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 配置里删掉了 editor，并且收回了 admin 的部分权限
+	cnt, err := svc.SyncRoles(ctx, []domain.Role{{Name: "admin", Permissions: []string{"user:*"}}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+	assert.Equal(t, map[string]domain.Role{
+		"admin": {Name: "admin", Permissions: []string{"user:*"}},
+	}, roleRepo.roles)
+
+	// 缓存已经失效了，马上生效
+	ok, err = svc.HasPermission(ctx, []string{"editor"}, "user:read")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = svc.HasPermission(ctx, []string{"admin"}, "article:publish")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRBACService_EnsureUserWithRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*mockUserRepository)
+		promote   bool
+		wantErr   error
+		wantUser  domain.User
+	}{
+		{
+			name: "用户不存在",
+			mockSetup: func(m *mockUserRepository) {
+				m.users = make(map[string]domain.User)
+			},
+			wantUser: domain.User{Email: "admin@example.com", Nickname: "admin",
+				EmailVerified: true, Roles: []string{"admin"}},
+		},
+		{
+			name: "用户已存在",
+			mockSetup: func(m *mockUserRepository) {
+				m.users = map[string]domain.User{
+					"admin@example.com": {Id: 1, Email: "admin@example.com", EmailVerified: true, Roles: []string{"editor"}},
+				}
+			},
+			wantErr: ErrAdminEmailTaken,
+			wantUser: domain.User{Id: 1, Email: "admin@example.com",
+				EmailVerified: true, Roles: []string{"editor"}},
+		},
+		{
+			name: "允许提升已有账号",
+			mockSetup: func(m *mockUserRepository) {
+				m.users = map[string]domain.User{
+					"admin@example.com": {Id: 1, Email: "admin@example.com", EmailVerified: true, Roles: []string{"editor"}},
+				}
+			},
+			promote: true,
+			wantUser: domain.User{Id: 1, Email: "admin@example.com",
+				EmailVerified: true, Roles: []string{"editor", "admin"}},
+		},
+		{
+			name: "已有账号邮箱没有验证",
+			mockSetup: func(m *mockUserRepository) {
+				m.users = map[string]domain.User{
+					"admin@example.com": {Id: 1, Email: "admin@example.com"},
+				}
+			},
+			promote:  true,
+			wantErr:  ErrAdminEmailTaken,
+			wantUser: domain.User{Id: 1, Email: "admin@example.com"},
+		},
+		{
+			name: "已经是管理员",
+			mockSetup: func(m *mockUserRepository) {
+				m.users = map[string]domain.User{
+					"admin@example.com": {Id: 1, Email: "admin@example.com", Roles: []string{"admin"}},
+				}
+			},
+			wantUser: domain.User{Id: 1, Email: "admin@example.com", Roles: []string{"admin"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := &mockUserRepository{}
+			tt.mockSetup(userRepo)
+			userSvc := NewUserService(userRepo, newTestHasher())
+			svc := NewRBACService(userSvc, userRepo, &mockRoleRepository{})
+
+			err := svc.EnsureUserWithRole(context.Background(), AdminSeed{
+				Email:           "admin@example.com",
+				Password:        "correct horse battery",
+				Role:            "admin",
+				PromoteExisting: tt.promote,
+			})
+			assert.Equal(t, tt.wantErr, err)
+			u := userRepo.users["admin@example.com"]
+			// 密码是哈希过的，不好比较
+			u.Password = ""
+			assert.Equal(t, tt.wantUser, u)
+		})
+	}
+}
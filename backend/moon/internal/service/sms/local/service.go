@@ -0,0 +1,53 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"moon/pkg/logger"
+)
+
+// Service 本地开发用的短信服务，不真的发短信，只是打日志
+// 配置了 file 的话还会追加写到文件里，方便测试脚本读取验证码
+type Service struct {
+	l    logger.LoggerV1
+	file string
+	mu   sync.Mutex
+}
+
+func NewService(l logger.LoggerV1, file string) *Service {
+	return &Service{
+		l:    l,
+		file: file,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	s.l.Info("本地短信服务",
+		logger.String("tpl", tplId),
+		logger.String("args", strings.Join(args, ",")),
+		logger.String("numbers", strings.Join(numbers, ",")))
+	if s.file == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, number := range numbers {
+		_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339),
+			number, tplId, strings.Join(args, ","))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package sms
+
+import "context"
+
+// Service 短信服务商的抽象，接入阿里云、腾讯云之类的服务商只需要实现这个接口
+type Service interface {
+	// Send tplId 是服务商那边的模板 ID，args 按顺序填进模板
+	Send(ctx context.Context, tplId string, args []string, numbers ...string) error
+}
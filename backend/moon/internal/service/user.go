@@ -5,41 +5,62 @@ import (
 	"errors"
 	"moon/internal/domain"
 	"moon/internal/repository"
-
-	"golang.org/x/crypto/bcrypt"
+	"moon/pkg/passwordx"
 )
 
 var (
 	ErrDuplicateEmail        = errors.New("邮箱冲突")
+	ErrDuplicatePhone        = repository.ErrDuplicatePhone
+	ErrDuplicateWechat       = repository.ErrDuplicateWechat
 	ErrInvalidUserOrPassword = errors.New("用户不存在或者密码不对")
+	ErrUserDisabled          = errors.New("用户已被禁用")
+	ErrUserNotFound          = repository.ErrUserNotFound
 )
 
 type UserService interface {
 	Signup(ctx context.Context, email, password, nickname string) error
+	// Login 注销了还在宽限期里的账号，密码对的时候返回用户和 ErrUserPendingDeletion
 	Login(ctx context.Context, email, password string) (domain.User, error)
 	FindById(ctx context.Context, id int64) (domain.User, error)
+	// FindOrCreate 手机号登录，第一次登录的时候自动注册
+	// 这个手机号的账号注销了还没有彻底删除的时候，返回这个用户和 ErrUserPendingDeletion
+	FindOrCreate(ctx context.Context, phone string) (domain.User, error)
+	// FindOrCreateByWechat 微信登录，第一次登录的时候自动注册
+	// 绑定的账号注销了还没有彻底删除的时候，返回这个用户和 ErrUserPendingDeletion
+	FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error)
+	// BindWechat 给已经登录的用户绑定微信，已经绑定过的换成新的微信账号
+	// 这个微信已经绑定在别的账号上的时候返回 ErrDuplicateWechat
+	BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) error
 	Update(ctx context.Context, u domain.User) error
+	// ChangePassword 原密码不对的时候返回 ErrInvalidUserOrPassword，没有设置过密码的返回 ErrPasswordNotSet
+	ChangePassword(ctx context.Context, uid int64, oldPassword, newPassword string) error
+	// Search 管理后台搜索用户，返回当前页和总数
+	Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error)
+	Disable(ctx context.Context, id int64) error
+	Enable(ctx context.Context, id int64) error
 }
 
 type userService struct {
-	repo repository.UserRepository
+	repo   repository.UserRepository
+	hasher *passwordx.Manager
 }
 
-func NewUserService(repo repository.UserRepository) UserService {
+func NewUserService(repo repository.UserRepository, hasher *passwordx.Manager) UserService {
 	return &userService{
-		repo: repo,
+		repo:   repo,
+		hasher: hasher,
 	}
 }
 
 func (s *userService) Signup(ctx context.Context, email, password, nickname string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
 	user := domain.User{
 		Email:    email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Nickname: nickname,
 	}
 
@@ -53,20 +74,53 @@ func (s *userService) Signup(ctx context.Context, email, password, nickname stri
 func (s *userService) Login(ctx context.Context, email, password string) (domain.User, error) {
 	u, err := s.repo.FindByEmail(ctx, email)
 	if err == repository.ErrUserNotFound {
-		return domain.User{}, ErrInvalidUserOrPassword
+		return s.loginDeleted(ctx, email, password)
 	}
 
 	if err != nil {
 		return domain.User{}, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+	ok, rehash, err := s.hasher.Verify(u.Password, password)
 	if err != nil {
+		return domain.User{}, err
+	}
+	if !ok {
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
+	// 密码对了才告诉他被禁用了，免得被人用来探测账号
+	if u.Disabled() {
+		return domain.User{}, ErrUserDisabled
+	}
+	// 只有登录的时候能拿到明文，顺便把老算法、老参数的哈希升级掉
+	// 升级失败不影响这次登录，下次登录的时候再试
+	if rehash {
+		if hashed, err := s.hasher.Hash(password); err == nil {
+			_ = s.repo.UpdatePassword(ctx, u.Id, hashed)
+		}
+	}
 	return u, nil
 }
 
+// loginDeleted 邮箱找不到的时候，看看是不是注销了还没有彻底删除的账号
+func (s *userService) loginDeleted(ctx context.Context, email, password string) (domain.User, error) {
+	u, err := s.repo.FindDeletedByEmail(ctx, email)
+	if err == repository.ErrUserNotFound {
+		return domain.User{}, ErrInvalidUserOrPassword
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	ok, _, err := s.hasher.Verify(u.Password, password)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if !ok {
+		return domain.User{}, ErrInvalidUserOrPassword
+	}
+	return u, ErrUserPendingDeletion
+}
+
 func (s *userService) FindById(ctx context.Context, id int64) (domain.User, error) {
 	u, err := s.repo.FindById(ctx, id)
 	if err == repository.ErrUserNotFound {
@@ -75,6 +129,96 @@ func (s *userService) FindById(ctx context.Context, id int64) (domain.User, erro
 	return u, err
 }
 
+func (s *userService) FindOrCreate(ctx context.Context, phone string) (domain.User, error) {
+	// 绝大多数请求都是老用户，先查一下
+	u, err := s.repo.FindByPhone(ctx, phone)
+	if err != repository.ErrUserNotFound {
+		return u, err
+	}
+	// 注销之后手机号释放出来了，这时候注册新账号的话，原来的账号就因为手机号冲突恢复不了了
+	u, err = s.repo.FindDeletedByPhone(ctx, phone)
+	switch err {
+	case nil:
+		return u, ErrUserPendingDeletion
+	case repository.ErrUserNotFound:
+	default:
+		return domain.User{}, err
+	}
+	err = s.repo.Create(ctx, domain.User{Phone: phone})
+	// 并发的时候别的请求可能已经创建了，唯一索引冲突的话直接再查一次
+	if err != nil && err != repository.ErrDuplicatePhone {
+		return domain.User{}, err
+	}
+	// 这里可能有主从延迟，需要的话可以强制走主库
+	return s.repo.FindByPhone(ctx, phone)
+}
+
+func (s *userService) FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error) {
+	u, err := s.repo.FindByWechat(ctx, info.OpenId)
+	switch {
+	// 注销的时候微信没有释放出来，彻底删除之前一直绑定在原来的账号上，
+	// 这样宽限期内既不会注册出新账号，恢复的时候也不会冲突
+	case err == nil && u.Deleted():
+		return u, ErrUserPendingDeletion
+	case err != repository.ErrUserNotFound:
+		return u, err
+	}
+	err = s.repo.Create(ctx, domain.User{WechatInfo: info})
+	if err != nil && err != repository.ErrDuplicateWechat {
+		return domain.User{}, err
+	}
+	return s.repo.FindByWechat(ctx, info.OpenId)
+}
+
+func (s *userService) BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) error {
+	// 这里只是提前判断一下，真正的校验靠唯一索引
+	u, err := s.repo.FindByWechat(ctx, info.OpenId)
+	switch {
+	case err == nil && u.Id == uid:
+		return nil
+	case err == nil:
+		return ErrDuplicateWechat
+	case err != repository.ErrUserNotFound:
+		return err
+	}
+	return s.repo.UpdateWechat(ctx, uid, info)
+}
+
 func (s *userService) Update(ctx context.Context, u domain.User) error {
 	return s.repo.Update(ctx, u)
 }
+
+func (s *userService) ChangePassword(ctx context.Context, uid int64, oldPassword, newPassword string) error {
+	u, err := s.repo.FindById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	// 短信、第三方登录注册的用户没有密码，不能当成原密码不对
+	if u.Password == "" {
+		return ErrPasswordNotSet
+	}
+	ok, _, err := s.hasher.Verify(u.Password, oldPassword)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidUserOrPassword
+	}
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePassword(ctx, uid, hashed)
+}
+
+func (s *userService) Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error) {
+	return s.repo.Search(ctx, q)
+}
+
+func (s *userService) Disable(ctx context.Context, id int64) error {
+	return s.repo.UpdateStatus(ctx, id, domain.UserStatusDisabled)
+}
+
+func (s *userService) Enable(ctx context.Context, id int64) error {
+	return s.repo.UpdateStatus(ctx, id, domain.UserStatusActive)
+}
@@ -4,12 +4,23 @@ import (
 	"context"
 	"moon/internal/domain"
 	"moon/internal/repository"
+	"moon/pkg/passwordx"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// newTestHasher 参数调小一点，不然测试跑得太慢
+func newTestHasher() *passwordx.Manager {
+	return passwordx.NewManager(
+		passwordx.NewArgon2id(passwordx.Argon2idParams{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}),
+		passwordx.NewBcrypt(bcrypt.MinCost))
+}
+
 type mockUserRepository struct {
 	users     map[string]domain.User
 	emailUsed bool
@@ -34,6 +45,25 @@ func (m *mockUserRepository) FindByEmail(ctx context.Context, email string) (dom
 	return domain.User{}, repository.ErrUserNotFound
 }
 
+func (m *mockUserRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	// 注销之后手机号就释放出来了
+	for _, u := range m.users {
+		if u.Phone == phone && !u.Deleted() {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindByWechat(ctx context.Context, openId string) (domain.User, error) {
+	for _, u := range m.users {
+		if u.WechatInfo.OpenId == openId {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
 func (m *mockUserRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
 	for _, u := range m.users {
 		if u.Id == id {
@@ -48,6 +78,184 @@ func (m *mockUserRepository) Update(ctx context.Context, u domain.User) error {
 	return nil
 }
 
+func (m *mockUserRepository) UpdateRoles(ctx context.Context, id int64, roles []string) error {
+	for email, u := range m.users {
+		if u.Id == id {
+			u.Roles = roles
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) UpdateStatus(ctx context.Context, id int64, status domain.UserStatus) error {
+	for email, u := range m.users {
+		if u.Id == id {
+			u.Status = status
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	for email, u := range m.users {
+		if u.Id == id {
+			u.Password = password
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) UpdateTOTP(ctx context.Context, id int64, info domain.TOTPInfo) error {
+	for email, u := range m.users {
+		if u.Id == id {
+			u.TOTP = info
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) UpdateRecoveryCodes(ctx context.Context, id int64, old, new []string) error {
+	for email, u := range m.users {
+		if u.Id == id && slices.Equal(u.TOTP.RecoveryCodes, old) {
+			u.TOTP.RecoveryCodes = new
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	u, ok := m.users[email]
+	if !ok || u.Id != id {
+		return repository.ErrUserNotFound
+	}
+	u.EmailVerified = true
+	m.users[email] = u
+	return nil
+}
+
+func (m *mockUserRepository) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	for _, u := range m.users {
+		if phone != "" && u.Phone == phone && u.Id != id {
+			return repository.ErrDuplicatePhone
+		}
+	}
+	for email, u := range m.users {
+		if u.Id == id && !u.Deleted() {
+			u.Phone = phone
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) UpdateEmail(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	u, ok := m.users[oldEmail]
+	if !ok || u.Id != id {
+		return repository.ErrUserNotFound
+	}
+	if _, ok = m.users[newEmail]; ok {
+		return repository.ErrDuplicateUser
+	}
+	delete(m.users, oldEmail)
+	u.Email, u.EmailVerified = newEmail, true
+	m.users[newEmail] = u
+	return nil
+}
+
+func (m *mockUserRepository) UpdateWechat(ctx context.Context, id int64, info domain.WechatInfo) error {
+	for _, u := range m.users {
+		if u.WechatInfo.OpenId == info.OpenId && u.Id != id {
+			return repository.ErrDuplicateWechat
+		}
+	}
+	for email, u := range m.users {
+		if u.Id == id && !u.Deleted() {
+			u.WechatInfo = info
+			m.users[email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) SoftDelete(ctx context.Context, id int64, now time.Time) error {
+	for email, u := range m.users {
+		if u.Id == id && !u.Deleted() {
+			// 邮箱释放出来，key 换成注销前的邮箱加上前缀
+			delete(m.users, email)
+			u.Status = domain.UserStatusDeleted
+			u.DeletedAt = now
+			m.users["deleted:"+email] = u
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindDeletedByEmail(ctx context.Context, email string) (domain.User, error) {
+	if u, ok := m.users["deleted:"+email]; ok {
+		return u, nil
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindDeletedByPhone(ctx context.Context, phone string) (domain.User, error) {
+	for _, u := range m.users {
+		if u.Phone == phone && u.Deleted() {
+			return u, nil
+		}
+	}
+	return domain.User{}, repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Restore(ctx context.Context, id int64) error {
+	for key, u := range m.users {
+		if u.Id != id || !u.Deleted() {
+			continue
+		}
+		email := strings.TrimPrefix(key, "deleted:")
+		if _, ok := m.users[email]; ok {
+			return repository.ErrDuplicateUser
+		}
+		delete(m.users, key)
+		u.Status = domain.UserStatusActive
+		u.DeletedAt = time.Time{}
+		m.users[email] = u
+		return nil
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Purge(ctx context.Context, before time.Time, limit int) (int64, error) {
+	var cnt int64
+	for key, u := range m.users {
+		if u.Deleted() && u.DeletedAt.Before(before) && cnt < int64(limit) {
+			delete(m.users, key)
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (m *mockUserRepository) Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error) {
+	var res []domain.User
+	for _, u := range m.users {
+		res = append(res, u)
+	}
+	return res, int64(len(res)), nil
+}
+
 func TestUserService_Signup(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -85,7 +293,7 @@ func TestUserService_Signup(t *testing.T) {
 			mockRepo := &mockUserRepository{}
 			tt.mockSetup(mockRepo)
 
-			svc := &userService{repo: mockRepo}
+			svc := NewUserService(mockRepo, newTestHasher())
 			err := svc.Signup(context.Background(), tt.email, tt.password, tt.nickname)
 
 			assert.Equal(t, tt.wantErr, err)
@@ -151,6 +359,21 @@ func TestUserService_Login(t *testing.T) {
 			},
 			wantErr: ErrInvalidUserOrPassword,
 		},
+		{
+			name:     "用户已被禁用",
+			email:    "test@example.com",
+			password: password,
+			mockSetup: func(m *mockUserRepository) {
+				m.users = make(map[string]domain.User)
+				m.users["test@example.com"] = domain.User{
+					Id:       1,
+					Email:    "test@example.com",
+					Password: string(hashedPassword),
+					Status:   domain.UserStatusDisabled,
+				}
+			},
+			wantErr: ErrUserDisabled,
+		},
 	}
 
 	for _, tt := range tests {
@@ -158,7 +381,7 @@ func TestUserService_Login(t *testing.T) {
 			mockRepo := &mockUserRepository{}
 			tt.mockSetup(mockRepo)
 
-			svc := &userService{repo: mockRepo}
+			svc := NewUserService(mockRepo, newTestHasher())
 			user, err := svc.Login(context.Background(), tt.email, tt.password)
 
 			if tt.wantErr != nil {
@@ -166,6 +389,137 @@ func TestUserService_Login(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.email, user.Email)
+				// 老的 bcrypt 哈希登录之后升级成 argon2id
+				assert.True(t, strings.HasPrefix(mockRepo.users[tt.email].Password, "$argon2id$"))
+			}
+		})
+	}
+}
+
+func TestUserService_FindOrCreate(t *testing.T) {
+	mockRepo := &mockUserRepository{users: map[string]domain.User{
+		"old@example.com": {Id: 1, Email: "old@example.com", Phone: "13800138000"},
+	}}
+	svc := NewUserService(mockRepo, newTestHasher())
+
+	// 老用户直接返回
+	u, err := svc.FindOrCreate(context.Background(), "13800138000")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), u.Id)
+
+	// 新用户自动注册
+	u, err = svc.FindOrCreate(context.Background(), "13900139000")
+	assert.NoError(t, err)
+	assert.Equal(t, "13900139000", u.Phone)
+	assert.Len(t, mockRepo.users, 2)
+
+	// 注销了还在宽限期里的，不能用释放出来的手机号注册新账号
+	assert.NoError(t, mockRepo.SoftDelete(context.Background(), 1, time.Now()))
+	u, err = svc.FindOrCreate(context.Background(), "13800138000")
+	assert.Equal(t, ErrUserPendingDeletion, err)
+	assert.Equal(t, int64(1), u.Id)
+	assert.Len(t, mockRepo.users, 2)
+}
+
+func TestUserService_FindOrCreateByWechat(t *testing.T) {
+	deleted := domain.User{Id: 1, Email: "old@example.com", Status: domain.UserStatusDeleted,
+		WechatInfo: domain.WechatInfo{OpenId: "openid-1"}}
+	mockRepo := &mockUserRepository{users: map[string]domain.User{"deleted:old@example.com": deleted}}
+	svc := NewUserService(mockRepo, newTestHasher())
+
+	// 注销了还在宽限期里的，不能注册新账号
+	u, err := svc.FindOrCreateByWechat(context.Background(), domain.WechatInfo{OpenId: "openid-1"})
+	assert.Equal(t, ErrUserPendingDeletion, err)
+	assert.Equal(t, deleted, u)
+	assert.Len(t, mockRepo.users, 1)
+
+	// 新用户自动注册
+	u, err = svc.FindOrCreateByWechat(context.Background(), domain.WechatInfo{OpenId: "openid-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "openid-2", u.WechatInfo.OpenId)
+	assert.Len(t, mockRepo.users, 2)
+}
+
+func TestUserService_BindWechat(t *testing.T) {
+	info := domain.WechatInfo{OpenId: "openid-1", UnionId: "unionid-1"}
+	tests := []struct {
+		name    string
+		users   map[string]domain.User
+		uid     int64
+		wantErr error
+		want    domain.WechatInfo
+	}{
+		{
+			name: "绑定成功",
+			users: map[string]domain.User{
+				"a@example.com": {Id: 1, Email: "a@example.com"},
+			},
+			uid:  1,
+			want: info,
+		},
+		{
+			name: "换绑",
+			users: map[string]domain.User{
+				"a@example.com": {Id: 1, Email: "a@example.com", WechatInfo: domain.WechatInfo{OpenId: "openid-old"}},
+			},
+			uid:  1,
+			want: info,
+		},
+		{
+			name: "已经绑定了这个微信",
+			users: map[string]domain.User{
+				"a@example.com": {Id: 1, Email: "a@example.com", WechatInfo: info},
+			},
+			uid:  1,
+			want: info,
+		},
+		{
+			name: "微信已经绑定在别的账号上",
+			users: map[string]domain.User{
+				"a@example.com": {Id: 1, Email: "a@example.com"},
+				"wechat":        {Id: 2, WechatInfo: info},
+			},
+			uid:     1,
+			wantErr: ErrDuplicateWechat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockUserRepository{users: tt.users}
+			err := NewUserService(repo, newTestHasher()).BindWechat(context.Background(), tt.uid, info)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, repo.users["a@example.com"].WechatInfo)
+		})
+	}
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("Password123!"), bcrypt.DefaultCost)
+	tests := []struct {
+		name        string
+		stored      string
+		oldPassword string
+		wantErr     error
+	}{
+		{name: "修改成功", stored: string(hashed), oldPassword: "Password123!"},
+		{name: "原密码不对", stored: string(hashed), oldPassword: "Wrong123!", wantErr: ErrInvalidUserOrPassword},
+		{name: "短信注册的账号没有密码", oldPassword: "Password123!", wantErr: ErrPasswordNotSet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockUserRepository{users: map[string]domain.User{
+				"test@example.com": {Id: 1, Email: "test@example.com", Password: tt.stored},
+			}}
+			svc := NewUserService(repo, newTestHasher())
+			err := svc.ChangePassword(context.Background(), 1, tt.oldPassword, "NewPassword123!")
+			assert.Equal(t, tt.wantErr, err)
+			stored := repo.users["test@example.com"].Password
+			if tt.wantErr == nil {
+				ok, _, err := newTestHasher().Verify(stored, "NewPassword123!")
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			} else {
+				assert.Equal(t, tt.stored, stored)
 			}
 		})
 	}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	regexp "github.com/dlclark/regexp2"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// scopeRegexPattern 和角色的权限一样，资源:操作，支持 * 和 user:* 这样的通配符
+	scopeRegexPattern  = `^(\*|[a-z0-9_]+(:[a-z0-9_]+)*(:\*)?)$`
+	maxAccessTokenName = 64
+	maxScopes          = 20
+	// maxAccessTokenDays 最长有效期，0 表示不过期
+	maxAccessTokenDays = 365
+)
+
+// AccessTokenHandler 管理个人访问令牌，只有登录会话能用，令牌不能用来创建令牌
+type AccessTokenHandler struct {
+	scopeRexExp *regexp.Regexp
+	svc         service.AccessTokenService
+}
+
+func NewAccessTokenHandler(svc service.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		scopeRexExp: regexp.MustCompile(scopeRegexPattern, regexp.None),
+		svc:         svc,
+	}
+}
+
+func (h *AccessTokenHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	g := server.Group("/users/tokens", middleware.RequireSession())
+	g.POST("", ginx.WrapBodyAndClaims(h.Create))
+	g.GET("", ginx.WrapClaims(h.List))
+	g.DELETE("/:id", ginx.WrapClaims(h.Revoke))
+}
+
+// Create 返回的明文只有这一次，之后只能看到前几位
+func (h *AccessTokenHandler) Create(ctx *gin.Context, req CreateAccessTokenReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxAccessTokenName {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "名字不能为空，最多 64 个字"}, nil
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAccessTokenDays {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "有效期最长 365 天"}, nil
+	}
+	if len(req.Scopes) > maxScopes {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "权限范围太多了"}, nil
+	}
+	for _, s := range req.Scopes {
+		ok, err := h.scopeRexExp.MatchString(s)
+		if err != nil {
+			return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+		}
+		if !ok {
+			return ginx.Result{Code: errs.UserInvalidInput, Msg: "权限范围格式不对：" + s}, nil
+		}
+	}
+	t := domain.AccessToken{
+		Uid:    uc.Uid,
+		Name:   name,
+		Scopes: req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		t.ExpiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays)
+	}
+	t, token, err := h.svc.Create(ctx, t)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "OK", Data: CreateAccessTokenResp{
+			AccessTokenVO: toAccessTokenVO(t),
+			Token:         token,
+		}}, nil
+	case service.ErrTooManyAccessTokens:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "令牌数量达到上限，请先删除不用的令牌"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *AccessTokenHandler) List(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	ts, err := h.svc.List(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	res := make([]AccessTokenVO, 0, len(ts))
+	for _, t := range ts {
+		res = append(res, toAccessTokenVO(t))
+	}
+	return ginx.Result{Msg: "OK", Data: res}, nil
+}
+
+// Revoke 删除之后马上失效
+func (h *AccessTokenHandler) Revoke(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "令牌不存在"}, nil
+	}
+	err = h.svc.Revoke(ctx, uc.Uid, id)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "令牌已删除"}, nil
+	case service.ErrAccessTokenNotFound:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "令牌不存在"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func toAccessTokenVO(t domain.AccessToken) AccessTokenVO {
+	vo := AccessTokenVO{
+		Id:     t.Id,
+		Name:   t.Name,
+		Prefix: t.Prefix,
+		Scopes: t.Scopes,
+		Ctime:  t.Ctime.UnixMilli(),
+	}
+	if vo.Scopes == nil {
+		vo.Scopes = []string{}
+	}
+	if !t.ExpiresAt.IsZero() {
+		vo.ExpiresAt = t.ExpiresAt.UnixMilli()
+	}
+	if !t.LastUsedAt.IsZero() {
+		vo.LastUsedAt = t.LastUsedAt.UnixMilli()
+	}
+	return vo
+}
@@ -0,0 +1,166 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAccessTokenService struct {
+	mock.Mock
+}
+
+func (m *mockAccessTokenService) Create(ctx context.Context, t domain.AccessToken) (domain.AccessToken, string, error) {
+	args := m.Called(ctx, t)
+	return args.Get(0).(domain.AccessToken), args.String(1), args.Error(2)
+}
+
+func (m *mockAccessTokenService) List(ctx context.Context, uid int64) ([]domain.AccessToken, error) {
+	args := m.Called(ctx, uid)
+	return args.Get(0).([]domain.AccessToken), args.Error(1)
+}
+
+func (m *mockAccessTokenService) Revoke(ctx context.Context, uid, id int64) error {
+	args := m.Called(ctx, uid, id)
+	return args.Error(0)
+}
+
+func (m *mockAccessTokenService) Authenticate(ctx context.Context, token string) (domain.AccessToken, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(domain.AccessToken), args.Error(1)
+}
+
+func (m *mockAccessTokenService) Touch(ctx context.Context, t domain.AccessToken) error {
+	args := m.Called(ctx, t)
+	return args.Error(0)
+}
+
+func doAccessTokenRequest(h *AccessTokenHandler, uc ijwt.UserClaims, method, path string, body any) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user", uc)
+	})
+	h.RegisterRoutes(router, middleware.NewPublicRoutes())
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAccessTokenHandler_Create(t *testing.T) {
+	session := ijwt.UserClaims{Uid: 1, Ssid: "current-ssid"}
+	tests := []struct {
+		name      string
+		req       CreateAccessTokenReq
+		mockSetup func(*mockAccessTokenService)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "创建成功",
+			req:  CreateAccessTokenReq{Name: " ci ", Scopes: []string{"user:*"}, ExpiresInDays: 30},
+			mockSetup: func(m *mockAccessTokenService) {
+				m.On("Create", mock.Anything, mock.MatchedBy(func(t domain.AccessToken) bool {
+					return t.Uid == 1 && t.Name == "ci" &&
+						t.ExpiresAt.Sub(time.Now()) > time.Hour*24*29
+				})).Return(domain.AccessToken{Id: 3, Name: "ci", Prefix: "moon_pat_abcd", Ctime: time.UnixMilli(1000)},
+					"moon_pat_abcdefg", nil)
+			},
+			wantMsg: "OK",
+		},
+		{
+			name:     "名字为空",
+			req:      CreateAccessTokenReq{Name: "  "},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "名字不能为空，最多 64 个字",
+		},
+		{
+			name:     "有效期太长",
+			req:      CreateAccessTokenReq{Name: "ci", ExpiresInDays: 366},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "有效期最长 365 天",
+		},
+		{
+			name:     "权限范围格式不对",
+			req:      CreateAccessTokenReq{Name: "ci", Scopes: []string{"user admin"}},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "权限范围格式不对：user admin",
+		},
+		{
+			name: "数量达到上限",
+			req:  CreateAccessTokenReq{Name: "ci"},
+			mockSetup: func(m *mockAccessTokenService) {
+				m.On("Create", mock.Anything, mock.Anything).
+					Return(domain.AccessToken{}, "", service.ErrTooManyAccessTokens)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "令牌数量达到上限，请先删除不用的令牌",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockAccessTokenService)
+			if tt.mockSetup != nil {
+				tt.mockSetup(svc)
+			}
+			w := doAccessTokenRequest(NewAccessTokenHandler(svc), session, http.MethodPost, "/users/tokens", tt.req)
+			require.Equal(t, http.StatusOK, w.Code)
+			var resp ginx.Result
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			if tt.wantMsg == "OK" {
+				data := resp.Data.(map[string]any)
+				assert.Equal(t, "moon_pat_abcdefg", data["token"])
+				assert.Equal(t, "moon_pat_abcd", data["prefix"])
+			}
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAccessTokenHandler_RequireSession(t *testing.T) {
+	svc := new(mockAccessTokenService)
+	// 用令牌认证的请求不能管理令牌
+	w := doAccessTokenRequest(NewAccessTokenHandler(svc), ijwt.UserClaims{Uid: 1, TokenId: 3},
+		http.MethodPost, "/users/tokens", CreateAccessTokenReq{Name: "more"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	svc.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestAccessTokenHandler_Revoke(t *testing.T) {
+	svc := new(mockAccessTokenService)
+	svc.On("Revoke", mock.Anything, int64(1), int64(3)).Return(nil)
+	svc.On("Revoke", mock.Anything, int64(1), int64(4)).Return(service.ErrAccessTokenNotFound)
+	h := NewAccessTokenHandler(svc)
+	session := ijwt.UserClaims{Uid: 1, Ssid: "current-ssid"}
+
+	for path, wantMsg := range map[string]string{
+		"/users/tokens/3":   "令牌已删除",
+		"/users/tokens/4":   "令牌不存在",
+		"/users/tokens/abc": "令牌不存在",
+	} {
+		w := doAccessTokenRequest(h, session, http.MethodDelete, path, nil)
+		var resp ginx.Result
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, wantMsg, resp.Msg, path)
+	}
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+	"moon/pkg/phonex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler 注销和恢复账号
+type AccountHandler struct {
+	ijwt.Handler
+	svc service.AccountDeletionService
+}
+
+func NewAccountHandler(svc service.AccountDeletionService, hdl ijwt.Handler) *AccountHandler {
+	return &AccountHandler{
+		Handler: hdl,
+		svc:     svc,
+	}
+}
+
+func (h *AccountHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	ug := server.Group("/users")
+	// 恢复 token 是宽限期内用密码登录的时候拿到的
+	public.Add(ug, http.MethodPost, "/restore")
+	// 个人访问令牌不能用来注销账号
+	ug.DELETE("/me", middleware.RequireSession(), ginx.WrapBodyAndClaims(h.Delete))
+	ug.POST("/me/deletion/code", middleware.RequireSession(), ginx.WrapClaims(h.SendDeleteCode))
+	ug.POST("/restore", ginx.WrapBody(h.Restore))
+}
+
+// beginRestore 注销了还在宽限期里的账号登录的时候，发一个恢复账号用的 token
+// 已经过了宽限期、还没有轮到清理的返回 service.ErrRestoreExpired，由调用方决定怎么提示
+func beginRestore(deletionSvc service.AccountDeletionService, u domain.User) (ginx.Result, error) {
+	ch, err := deletionSvc.BeginRestore(u)
+	if err != nil {
+		return ginx.Result{}, err
+	}
+	return ginx.Result{
+		Code: errs.UserPendingDeletion,
+		Msg:  "账号已注销，宽限期内可以恢复",
+		Data: PendingDeletionVO{
+			RestoreToken: ch.Token,
+			PurgeAt:      ch.PurgeAt.UnixMilli(),
+		},
+	}, nil
+}
+
+// beginOAuth2Restore 第三方登录已经证明了身份，和密码登录一样发恢复 token
+func beginOAuth2Restore(deletionSvc service.AccountDeletionService, u domain.User) (ginx.Result, error) {
+	res, err := beginRestore(deletionSvc, u)
+	switch err {
+	case nil:
+		return res, nil
+	case service.ErrRestoreExpired:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "账号已注销，正在清理，请稍后再试"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// SendDeleteCode 没有密码的账号注销之前，给绑定的手机号发验证码
+func (h *AccountHandler) SendDeleteCode(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	phone, err := h.svc.SendDeleteCode(ctx, uc.Uid)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "发送成功", Data: SendDeleteAccountCodeResp{Phone: phonex.Mask(phone)}}, nil
+	case service.ErrPasswordRequired:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "账号设置了密码，请用密码确认"}, nil
+	case service.ErrNoDeleteCredential:
+		return ginx.Result{Code: errs.UserNoConfirmMethod, Msg: "账号没有设置密码也没有绑定手机号，请先绑定手机号"}, nil
+	case service.ErrCodeSendTooMany:
+		return ginx.Result{Code: errs.UserCodeSendTooMany, Msg: "短信发送太频繁，请稍后再试"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// Delete 注销之后所有设备都退出登录，宽限期内用密码登录可以恢复
+// 设置了密码的账号用密码确认，没有密码的账号用短信验证码确认
+func (h *AccountHandler) Delete(ctx *gin.Context, req DeleteAccountReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	var (
+		purgeAt time.Time
+		err     error
+	)
+	if req.Code != "" {
+		purgeAt, err = h.svc.DeleteWithCode(ctx, uc.Uid, req.Code)
+	} else {
+		purgeAt, err = h.svc.Delete(ctx, uc.Uid, req.Password)
+	}
+	switch err {
+	case nil:
+	case service.ErrInvalidUserOrPassword:
+		return ginx.Result{Code: errs.UserInvalidOrPassword, Msg: "密码不对"}, nil
+	case service.ErrPasswordNotSet:
+		return ginx.Result{Code: errs.UserPasswordNotSet, Msg: "账号没有设置密码，请用短信验证码确认"}, nil
+	case service.ErrPasswordRequired:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "账号设置了密码，请用密码确认"}, nil
+	case service.ErrNoDeleteCredential:
+		return ginx.Result{Code: errs.UserNoConfirmMethod, Msg: "账号没有设置密码也没有绑定手机号，请先绑定手机号"}, nil
+	case service.ErrInvalidCode:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证码有误"}, nil
+	case service.ErrCodeVerifyTooMany:
+		return ginx.Result{Code: errs.UserCodeVerifyTooMany, Msg: "验证次数太多，请重新获取验证码"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	// 和禁用一样，让已经签发的 token 和个人访问令牌立刻失效
+	// 到时间彻底删除之后不再需要这个标记，不能一直占着 Redis
+	err = h.BlockUserUntil(ctx, uc.Uid, purgeAt)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError,
+			Msg: "账号已注销，但是退出其他设备失败，请稍后在其他设备上手动退出"}, err
+	}
+	if err = h.ClearToken(ctx); err != nil {
+		ginx.L.Error("注销账号之后清除 token 失败", logger.Error(err))
+	}
+	return ginx.Result{
+		Msg:  "账号已注销",
+		Data: DeleteAccountResp{PurgeAt: purgeAt.UnixMilli()},
+	}, nil
+}
+
+// Restore 恢复之后需要重新登录，开启了两步验证的还要走两步验证
+func (h *AccountHandler) Restore(ctx *gin.Context, req RestoreAccountReq) (ginx.Result, error) {
+	uid, err := h.svc.Restore(ctx, req.RestoreToken)
+	switch err {
+	case nil:
+	case service.ErrInvalidRestoreToken:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "恢复链接无效或者已经过期，请重新登录"}, nil
+	case service.ErrDuplicateEmail:
+		return ginx.Result{Code: errs.UserDuplicateEmail, Msg: "邮箱已经被别的账号使用了，不能恢复"}, nil
+	case service.ErrDuplicatePhone:
+		return ginx.Result{Code: errs.UserDuplicatePhone, Msg: "手机号已经被别的账号绑定了，不能恢复"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	err = h.UnblockUser(ctx, uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	ginx.L.Info("账号已恢复", logger.Int64("uid", uid), logger.String("ip", ctx.ClientIP()))
+	return ginx.Result{Msg: "账号已恢复，请重新登录"}, nil
+}
@@ -0,0 +1,235 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAccountDeletionService struct {
+	mock.Mock
+}
+
+func (m *mockAccountDeletionService) Delete(ctx context.Context, uid int64, password string) (time.Time, error) {
+	args := m.Called(ctx, uid, password)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *mockAccountDeletionService) SendDeleteCode(ctx context.Context, uid int64) (string, error) {
+	args := m.Called(ctx, uid)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockAccountDeletionService) DeleteWithCode(ctx context.Context, uid int64, code string) (time.Time, error) {
+	args := m.Called(ctx, uid, code)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *mockAccountDeletionService) BeginRestore(u domain.User) (service.RestoreChallenge, error) {
+	args := m.Called(u)
+	return args.Get(0).(service.RestoreChallenge), args.Error(1)
+}
+
+func (m *mockAccountDeletionService) Restore(ctx context.Context, token string) (int64, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockAccountDeletionService) Purge(ctx context.Context, limit int) (int64, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func doAccountRequest(t *testing.T, h *AccountHandler, uc *ijwt.UserClaims, method, path string, body any) ginx.Result {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		if uc != nil {
+			ctx.Set("user", *uc)
+		}
+	})
+	h.RegisterRoutes(router, middleware.NewPublicRoutes())
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ginx.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestAccountHandler_Delete(t *testing.T) {
+	purgeAt := time.UnixMilli(1700000000000)
+	withPassword := DeleteAccountReq{Password: "correct horse battery"}
+	withCode := DeleteAccountReq{Code: "123456"}
+	tests := []struct {
+		name      string
+		req       DeleteAccountReq
+		mockSetup func(*mockAccountDeletionService, *mockJWTHandler)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "注销成功，所有设备退出登录",
+			req:  withPassword,
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Delete", mock.Anything, int64(1), "correct horse battery").Return(purgeAt, nil)
+				h.On("BlockUserUntil", mock.Anything, int64(1), purgeAt).Return(nil)
+				h.On("ClearToken", mock.Anything).Return(nil)
+			},
+			wantMsg: "账号已注销",
+		},
+		{
+			name: "密码不对",
+			req:  withPassword,
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Delete", mock.Anything, int64(1), "correct horse battery").
+					Return(time.Time{}, service.ErrInvalidUserOrPassword)
+			},
+			wantCode: errs.UserInvalidOrPassword,
+			wantMsg:  "密码不对",
+		},
+		{
+			name: "没有密码的账号提示用验证码",
+			req:  DeleteAccountReq{},
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Delete", mock.Anything, int64(1), "").Return(time.Time{}, service.ErrPasswordNotSet)
+			},
+			wantCode: errs.UserPasswordNotSet,
+			wantMsg:  "账号没有设置密码，请用短信验证码确认",
+		},
+		{
+			name: "验证码注销成功",
+			req:  withCode,
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("DeleteWithCode", mock.Anything, int64(1), "123456").Return(purgeAt, nil)
+				h.On("BlockUserUntil", mock.Anything, int64(1), purgeAt).Return(nil)
+				h.On("ClearToken", mock.Anything).Return(nil)
+			},
+			wantMsg: "账号已注销",
+		},
+		{
+			name: "验证码有误",
+			req:  withCode,
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("DeleteWithCode", mock.Anything, int64(1), "123456").Return(time.Time{}, service.ErrInvalidCode)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "验证码有误",
+		},
+		{
+			name: "没有密码也没有手机号",
+			req:  withCode,
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("DeleteWithCode", mock.Anything, int64(1), "123456").Return(time.Time{}, service.ErrNoDeleteCredential)
+			},
+			wantCode: errs.UserNoConfirmMethod,
+			wantMsg:  "账号没有设置密码也没有绑定手机号，请先绑定手机号",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockAccountDeletionService)
+			hdl := new(mockJWTHandler)
+			tt.mockSetup(svc, hdl)
+			resp := doAccountRequest(t, NewAccountHandler(svc, hdl), &ijwt.UserClaims{Uid: 1, Ssid: "ssid"},
+				http.MethodDelete, "/users/me", tt.req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			if tt.wantCode == 0 {
+				assert.Equal(t, map[string]any{"purge_at": float64(1700000000000)}, resp.Data)
+			}
+			svc.AssertExpectations(t)
+			hdl.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAccountHandler_SendDeleteCode(t *testing.T) {
+	svc := new(mockAccountDeletionService)
+	svc.On("SendDeleteCode", mock.Anything, int64(1)).Return("+8613800138000", nil).Once()
+	resp := doAccountRequest(t, NewAccountHandler(svc, new(mockJWTHandler)), &ijwt.UserClaims{Uid: 1, Ssid: "ssid"},
+		http.MethodPost, "/users/me/deletion/code", nil)
+	assert.Equal(t, 0, resp.Code)
+	assert.Equal(t, map[string]any{"phone": "+86138****8000"}, resp.Data)
+
+	svc.On("SendDeleteCode", mock.Anything, int64(1)).Return("", service.ErrPasswordRequired).Once()
+	resp = doAccountRequest(t, NewAccountHandler(svc, new(mockJWTHandler)), &ijwt.UserClaims{Uid: 1, Ssid: "ssid"},
+		http.MethodPost, "/users/me/deletion/code", nil)
+	assert.Equal(t, errs.UserInvalidInput, resp.Code)
+	assert.Equal(t, "账号设置了密码，请用密码确认", resp.Msg)
+	svc.AssertExpectations(t)
+}
+
+func TestAccountHandler_Restore(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*mockAccountDeletionService, *mockJWTHandler)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "恢复成功",
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Restore", mock.Anything, "restore-token").Return(int64(1), nil)
+				h.On("UnblockUser", mock.Anything, int64(1)).Return(nil)
+			},
+			wantMsg: "账号已恢复，请重新登录",
+		},
+		{
+			name: "token 无效",
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Restore", mock.Anything, "restore-token").Return(int64(0), service.ErrInvalidRestoreToken)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "恢复链接无效或者已经过期，请重新登录",
+		},
+		{
+			name: "邮箱已经被别人注册了",
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Restore", mock.Anything, "restore-token").Return(int64(0), service.ErrDuplicateEmail)
+			},
+			wantCode: errs.UserDuplicateEmail,
+			wantMsg:  "邮箱已经被别的账号使用了，不能恢复",
+		},
+		{
+			name: "手机号已经被别人绑定了",
+			mockSetup: func(s *mockAccountDeletionService, h *mockJWTHandler) {
+				s.On("Restore", mock.Anything, "restore-token").Return(int64(0), service.ErrDuplicatePhone)
+			},
+			wantCode: errs.UserDuplicatePhone,
+			wantMsg:  "手机号已经被别的账号绑定了，不能恢复",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockAccountDeletionService)
+			hdl := new(mockJWTHandler)
+			tt.mockSetup(svc, hdl)
+			resp := doAccountRequest(t, NewAccountHandler(svc, hdl), nil,
+				http.MethodPost, "/users/restore", RestoreAccountReq{RestoreToken: "restore-token"})
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			svc.AssertExpectations(t)
+			hdl.AssertExpectations(t)
+		})
+	}
+}
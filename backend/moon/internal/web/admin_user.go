@@ -0,0 +1,180 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxAdminPageSize = 100
+
+// AdminUserHandler 管理后台的用户管理，所有路由都要求 user:admin 权限
+type AdminUserHandler struct {
+	svc     service.UserService
+	lockout service.LoginLockoutService
+	hdl     ijwt.Handler
+	perm    *middleware.PermissionMiddlewareBuilder
+}
+
+func NewAdminUserHandler(svc service.UserService, lockout service.LoginLockoutService,
+	hdl ijwt.Handler, perm *middleware.PermissionMiddlewareBuilder) *AdminUserHandler {
+	return &AdminUserHandler{
+		svc:     svc,
+		lockout: lockout,
+		hdl:     hdl,
+		perm:    perm,
+	}
+}
+
+func (h *AdminUserHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	ag := server.Group("/admin/users", h.perm.RequirePermission("user:admin"))
+	ag.GET("", ginx.WrapBody(h.Search))
+	ag.GET("/:id", ginx.Wrap(h.Detail))
+	ag.POST("/:id/disable", ginx.Wrap(h.Disable))
+	ag.POST("/:id/enable", ginx.Wrap(h.Enable))
+	// 解除登录失败次数过多导致的锁定
+	ag.POST("/:id/unlock", ginx.Wrap(h.Unlock))
+	// 强制下线，撤销这个用户的所有会话
+	ag.POST("/:id/logout", ginx.Wrap(h.ForceLogout))
+}
+
+func (h *AdminUserHandler) Search(ctx *gin.Context, req AdminSearchUserReq) (ginx.Result, error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > maxAdminPageSize {
+		req.PageSize = 20
+	}
+	// 手机号保存的是 E.164 格式，没有带国家码的按国内号码查
+	phone := strings.TrimSpace(req.Phone)
+	if phone != "" && !strings.HasPrefix(phone, "+") {
+		phone = "+" + defaultCountryCode + phone
+	}
+	users, total, err := h.svc.Search(ctx.Request.Context(), domain.UserQuery{
+		Email:    req.Email,
+		Phone:    phone,
+		Nickname: req.Nickname,
+		Offset:   (req.Page - 1) * req.PageSize,
+		Limit:    req.PageSize,
+	})
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	list := make([]AdminUserVO, 0, len(users))
+	for _, u := range users {
+		list = append(list, toAdminUserVO(u))
+	}
+	return ginx.Result{Msg: "success", Data: AdminUserListVO{
+		Total: total,
+		Users: list,
+	}}, nil
+}
+
+func (h *AdminUserHandler) Detail(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "非法用户 ID"}, nil
+	}
+	u, err := h.svc.FindById(ctx.Request.Context(), id)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "success", Data: toAdminUserVO(u)}, nil
+	case service.ErrInvalidUserOrPassword:
+		return ginx.Result{Code: errs.UserNotFound, Msg: "用户不存在"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *AdminUserHandler) Disable(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "非法用户 ID"}, nil
+	}
+	err = h.svc.Disable(ctx.Request.Context(), id)
+	switch err {
+	case nil:
+	case service.ErrUserNotFound:
+		return ginx.Result{Code: errs.UserNotFound, Msg: "用户不存在"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	// 数据库里已经禁用了，这里让他已经签发的 token 立刻失效
+	err = h.hdl.BlockUser(ctx.Request.Context(), id)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *AdminUserHandler) Enable(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "非法用户 ID"}, nil
+	}
+	err = h.svc.Enable(ctx.Request.Context(), id)
+	switch err {
+	case nil:
+	case service.ErrUserNotFound:
+		return ginx.Result{Code: errs.UserNotFound, Msg: "用户不存在"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	err = h.hdl.UnblockUser(ctx.Request.Context(), id)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *AdminUserHandler) Unlock(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "非法用户 ID"}, nil
+	}
+	u, err := h.svc.FindById(ctx.Request.Context(), id)
+	switch err {
+	case nil:
+	case service.ErrInvalidUserOrPassword:
+		return ginx.Result{Code: errs.UserNotFound, Msg: "用户不存在"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	err = h.lockout.Unlock(ctx.Request.Context(), u.Email)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *AdminUserHandler) ForceLogout(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "非法用户 ID"}, nil
+	}
+	err = h.hdl.RevokeAllSessions(ctx.Request.Context(), id)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func toAdminUserVO(u domain.User) AdminUserVO {
+	return AdminUserVO{
+		Id:       u.Id,
+		Email:    u.Email,
+		Nickname: u.Nickname,
+		Phone:    u.Phone,
+		Roles:    u.Roles,
+		Disabled: u.Disabled(),
+		Ctime:    u.Ctime.UnixMilli(),
+	}
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// adminChecker 有 admin 角色就认为有所有权限
+type adminChecker struct{}
+
+func (adminChecker) HasPermission(ctx context.Context, roles []string, perm string) (bool, error) {
+	for _, r := range roles {
+		if r == "admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestAdminUserHandler_Disable(t *testing.T) {
+	tests := []struct {
+		name       string
+		roles      []string
+		mockSetup  func(*mockUserService, *mockJWTHandler)
+		wantStatus int
+		wantCode   int
+	}{
+		{
+			name:  "禁用成功",
+			roles: []string{"admin"},
+			mockSetup: func(svc *mockUserService, h *mockJWTHandler) {
+				svc.On("Disable", mock.Anything, int64(2)).Return(nil)
+				h.On("BlockUser", mock.Anything, int64(2)).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "用户不存在",
+			roles: []string{"admin"},
+			mockSetup: func(svc *mockUserService, h *mockJWTHandler) {
+				svc.On("Disable", mock.Anything, int64(2)).Return(service.ErrUserNotFound)
+			},
+			wantStatus: http.StatusOK,
+			wantCode:   errs.UserNotFound,
+		},
+		{
+			name:       "没有权限",
+			roles:      []string{"user"},
+			mockSetup:  func(svc *mockUserService, h *mockJWTHandler) {},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(mockUserService)
+			mockHdl := new(mockJWTHandler)
+			tt.mockSetup(mockSvc, mockHdl)
+
+			perm := middleware.NewPermissionMiddlewareBuilder(adminChecker{}, logger.NewNopLogger())
+			handler := NewAdminUserHandler(mockSvc, new(mockLockoutService), mockHdl, perm)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				ctx.Set("user", ijwt.UserClaims{Uid: 1, Roles: tt.roles})
+			})
+			handler.RegisterRoutes(router, middleware.NewPublicRoutes())
+
+			req, _ := http.NewRequest(http.MethodPost, "/admin/users/2/disable", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if w.Code == http.StatusOK {
+				var resp ginx.Result
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			}
+			mockSvc.AssertExpectations(t)
+			mockHdl.AssertExpectations(t)
+		})
+	}
+}
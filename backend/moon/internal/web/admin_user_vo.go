@@ -0,0 +1,25 @@
+package web
+
+type AdminSearchUserReq struct {
+	Email    string `form:"email"`
+	Phone    string `form:"phone"`
+	Nickname string `form:"nickname"`
+	// Page 从 1 开始
+	Page     int `form:"page"`
+	PageSize int `form:"page_size"`
+}
+
+type AdminUserVO struct {
+	Id       int64    `json:"id"`
+	Email    string   `json:"email"`
+	Nickname string   `json:"nickname"`
+	Phone    string   `json:"phone"`
+	Roles    []string `json:"roles"`
+	Disabled bool     `json:"disabled"`
+	Ctime    int64    `json:"ctime"`
+}
+
+type AdminUserListVO struct {
+	Total int64         `json:"total"`
+	Users []AdminUserVO `json:"users"`
+}
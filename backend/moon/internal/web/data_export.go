@@ -0,0 +1,97 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DataExportHandler 用户导出自己的数据，只有登录会话能用，个人访问令牌不能导出
+type DataExportHandler struct {
+	svc service.DataExportService
+}
+
+func NewDataExportHandler(svc service.DataExportService) *DataExportHandler {
+	return &DataExportHandler{svc: svc}
+}
+
+func (h *DataExportHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	g := server.Group("/users/me/export", middleware.RequireSession())
+	g.POST("", ginx.WrapClaims(h.Start))
+	g.GET("/:id", ginx.WrapClaims(h.Get))
+	g.GET("/:id/download", h.Download)
+}
+
+// Start 导出在后台进行，前端拿着返回的 ID 轮询状态
+func (h *DataExportHandler) Start(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	e, err := h.svc.Start(ctx, uc.Uid)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "开始导出", Data: toDataExportVO(e)}, nil
+	case service.ErrExportInProgress:
+		return ginx.Result{Code: errs.UserExportInProgress, Msg: "上一次导出还没有完成，请稍后再试"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *DataExportHandler) Get(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	e, err := h.svc.Get(ctx, uc.Uid, ctx.Param("id"))
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "OK", Data: toDataExportVO(e)}, nil
+	case service.ErrExportNotFound:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "导出不存在或者已经过期，请重新导出"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// Download 成功的时候直接返回 ZIP 压缩包，出错的时候和别的接口一样返回 JSON
+func (h *DataExportHandler) Download(ctx *gin.Context) {
+	val, _ := ctx.Get("user")
+	uc, ok := val.(ijwt.UserClaims)
+	if !ok {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	id := ctx.Param("id")
+	data, err := h.svc.Download(ctx, uc.Uid, id)
+	switch err {
+	case nil:
+	case service.ErrExportNotFound:
+		ctx.JSON(http.StatusOK, ginx.Result{Code: errs.UserInvalidInput, Msg: "导出不存在或者已经过期，请重新导出"})
+		return
+	case service.ErrExportNotReady:
+		ctx.JSON(http.StatusOK, ginx.Result{Code: errs.UserInvalidInput, Msg: "导出还没有完成"})
+		return
+	default:
+		ginx.L.Error("下载导出的数据失败", logger.Int64("uid", uc.Uid), logger.Error(err))
+		ctx.JSON(http.StatusOK, ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"})
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="moon-export-%s.zip"`, id))
+	ctx.Data(http.StatusOK, "application/zip", data)
+}
+
+func toDataExportVO(e domain.DataExport) DataExportVO {
+	vo := DataExportVO{
+		Id:     e.Id,
+		Status: e.Status.String(),
+		Size:   e.Size,
+		Ctime:  e.Ctime.UnixMilli(),
+	}
+	if !e.ExpiresAt.IsZero() {
+		vo.ExpiresAt = e.ExpiresAt.UnixMilli()
+	}
+	return vo
+}
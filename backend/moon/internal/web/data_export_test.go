@@ -0,0 +1,142 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockDataExportService struct {
+	mock.Mock
+}
+
+func (m *mockDataExportService) Start(ctx context.Context, uid int64) (domain.DataExport, error) {
+	args := m.Called(ctx, uid)
+	return args.Get(0).(domain.DataExport), args.Error(1)
+}
+
+func (m *mockDataExportService) Get(ctx context.Context, uid int64, id string) (domain.DataExport, error) {
+	args := m.Called(ctx, uid, id)
+	return args.Get(0).(domain.DataExport), args.Error(1)
+}
+
+func (m *mockDataExportService) Download(ctx context.Context, uid int64, id string) ([]byte, error) {
+	args := m.Called(ctx, uid, id)
+	data, _ := args.Get(0).([]byte)
+	return data, args.Error(1)
+}
+
+func doDataExportRequest(svc *mockDataExportService, method, path string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user", ijwt.UserClaims{Uid: 1, Ssid: "ssid"})
+	})
+	NewDataExportHandler(svc).RegisterRoutes(router, middleware.NewPublicRoutes())
+	req, _ := http.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDataExportHandler_Start(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*mockDataExportService)
+		wantCode  int
+		wantData  any
+	}{
+		{
+			name: "开始导出",
+			mockSetup: func(s *mockDataExportService) {
+				s.On("Start", mock.Anything, int64(1)).Return(domain.DataExport{Id: "e1", Uid: 1,
+					Status: domain.DataExportStatusRunning, Ctime: time.UnixMilli(1700000000000)}, nil)
+			},
+			wantData: map[string]any{"id": "e1", "status": "running", "size": float64(0),
+				"ctime": float64(1700000000000), "expires_at": float64(0)},
+		},
+		{
+			name: "上一次还没导出完",
+			mockSetup: func(s *mockDataExportService) {
+				s.On("Start", mock.Anything, int64(1)).Return(domain.DataExport{}, service.ErrExportInProgress)
+			},
+			wantCode: errs.UserExportInProgress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockDataExportService)
+			tt.mockSetup(svc)
+			w := doDataExportRequest(svc, http.MethodPost, "/users/me/export")
+			require.Equal(t, http.StatusOK, w.Code)
+			var resp ginx.Result
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantData, resp.Data)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDataExportHandler_Download(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*mockDataExportService)
+		// wantCode 为 0 的时候返回的是压缩包
+		wantCode int
+	}{
+		{
+			name: "下载成功",
+			mockSetup: func(s *mockDataExportService) {
+				s.On("Download", mock.Anything, int64(1), "e1").Return([]byte("zip"), nil)
+			},
+		},
+		{
+			name: "还没导出完",
+			mockSetup: func(s *mockDataExportService) {
+				s.On("Download", mock.Anything, int64(1), "e1").Return(nil, service.ErrExportNotReady)
+			},
+			wantCode: errs.UserInvalidInput,
+		},
+		{
+			name: "不存在或者已经过期",
+			mockSetup: func(s *mockDataExportService) {
+				s.On("Download", mock.Anything, int64(1), "e1").Return(nil, service.ErrExportNotFound)
+			},
+			wantCode: errs.UserInvalidInput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockDataExportService)
+			tt.mockSetup(svc)
+			w := doDataExportRequest(svc, http.MethodGet, "/users/me/export/e1/download")
+			require.Equal(t, http.StatusOK, w.Code)
+			if tt.wantCode == 0 {
+				assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename="moon-export-e1.zip"`, w.Header().Get("Content-Disposition"))
+				assert.Equal(t, "zip", w.Body.String())
+			} else {
+				var resp ginx.Result
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			}
+			svc.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"net/http"
+
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	regexp "github.com/dlclark/regexp2"
+	"github.com/gin-gonic/gin"
+)
+
+// EmailHandler 修改邮箱
+type EmailHandler struct {
+	emailRexExp *regexp.Regexp
+	svc         service.EmailChangeService
+}
+
+func NewEmailHandler(svc service.EmailChangeService) *EmailHandler {
+	return &EmailHandler{
+		emailRexExp: regexp.MustCompile(emailRegexPattern, regexp.None),
+		svc:         svc,
+	}
+}
+
+func (h *EmailHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	ug := server.Group("/users/email")
+	// 确认链接是在邮件里点开的，不一定登录了
+	public.Add(ug, http.MethodGet, "/confirm")
+	// 个人访问令牌不能用来改邮箱
+	ug.PUT("", middleware.RequireSession(), ginx.WrapBodyAndClaims(h.Change))
+	ug.GET("/confirm", ginx.Wrap(h.Confirm))
+}
+
+// Change 只发确认邮件，新邮箱点了链接之后才真的换，在这之前还是用原来的邮箱登录
+func (h *EmailHandler) Change(ctx *gin.Context, req ChangeEmailReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	isEmail, err := h.emailRexExp.MatchString(req.NewEmail)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if !isEmail {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "非法邮箱格式"}, nil
+	}
+	err = h.svc.Request(ctx, uc.Uid, req.Password, req.NewEmail)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "确认邮件已经发到新邮箱，点击里面的链接之后才会生效"}, nil
+	case service.ErrInvalidUserOrPassword:
+		return ginx.Result{Code: errs.UserInvalidOrPassword, Msg: "密码不对"}, nil
+	case service.ErrPasswordNotSet:
+		return ginx.Result{Code: errs.UserPasswordNotSet, Msg: "账号没有设置密码，不能修改邮箱"}, nil
+	case service.ErrSameEmail:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "新邮箱和现在的邮箱一样"}, nil
+	case service.ErrDuplicateEmail:
+		return ginx.Result{Code: errs.UserDuplicateEmail, Msg: "邮箱冲突"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *EmailHandler) Confirm(ctx *gin.Context) (ginx.Result, error) {
+	uid, err := h.svc.Confirm(ctx, ctx.Query("token"))
+	switch err {
+	case nil:
+		ginx.L.Info("用户修改了邮箱", logger.Int64("uid", uid), logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Msg: "邮箱已修改，请用新邮箱登录"}, nil
+	case service.ErrInvalidEmailToken:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "确认链接无效或者已经过期"}, nil
+	case service.ErrDuplicateEmail:
+		return ginx.Result{Code: errs.UserDuplicateEmail, Msg: "这个邮箱已经被别的账号使用了"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
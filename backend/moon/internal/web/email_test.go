@@ -0,0 +1,149 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockEmailChangeService struct {
+	mock.Mock
+}
+
+func (m *mockEmailChangeService) Request(ctx context.Context, uid int64, password string, newEmail string) error {
+	return m.Called(ctx, uid, password, newEmail).Error(0)
+}
+
+func (m *mockEmailChangeService) Confirm(ctx context.Context, token string) (int64, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func doEmailRequest(t *testing.T, svc *mockEmailChangeService, method, path string, body any) ginx.Result {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user", ijwt.UserClaims{Uid: 1, Ssid: "ssid"})
+	})
+	NewEmailHandler(svc).RegisterRoutes(router, middleware.NewPublicRoutes())
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ginx.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestEmailHandler_Change(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       ChangeEmailReq
+		mockSetup func(*mockEmailChangeService)
+		wantCode  int
+	}{
+		{
+			name: "发送确认邮件",
+			req:  ChangeEmailReq{Password: "correct horse battery", NewEmail: "new@example.com"},
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Request", mock.Anything, int64(1), "correct horse battery", "new@example.com").Return(nil)
+			},
+		},
+		{
+			name:      "邮箱格式不对",
+			req:       ChangeEmailReq{Password: "correct horse battery", NewEmail: "new"},
+			mockSetup: func(s *mockEmailChangeService) {},
+			wantCode:  errs.UserInvalidInput,
+		},
+		{
+			name: "密码不对",
+			req:  ChangeEmailReq{Password: "wrong", NewEmail: "new@example.com"},
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Request", mock.Anything, int64(1), "wrong", "new@example.com").
+					Return(service.ErrInvalidUserOrPassword)
+			},
+			wantCode: errs.UserInvalidOrPassword,
+		},
+		{
+			name: "账号没有设置密码",
+			req:  ChangeEmailReq{Password: "whatever", NewEmail: "new@example.com"},
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Request", mock.Anything, int64(1), "whatever", "new@example.com").
+					Return(service.ErrPasswordNotSet)
+			},
+			wantCode: errs.UserPasswordNotSet,
+		},
+		{
+			name: "新邮箱已经被别人用了",
+			req:  ChangeEmailReq{Password: "correct horse battery", NewEmail: "new@example.com"},
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Request", mock.Anything, int64(1), "correct horse battery", "new@example.com").
+					Return(service.ErrDuplicateEmail)
+			},
+			wantCode: errs.UserDuplicateEmail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockEmailChangeService)
+			tt.mockSetup(svc)
+			resp := doEmailRequest(t, svc, http.MethodPut, "/users/email", tt.req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEmailHandler_Confirm(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*mockEmailChangeService)
+		wantCode  int
+	}{
+		{
+			name: "修改成功",
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Confirm", mock.Anything, "tk").Return(int64(1), nil)
+			},
+		},
+		{
+			name: "链接无效",
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Confirm", mock.Anything, "tk").Return(int64(0), service.ErrInvalidEmailToken)
+			},
+			wantCode: errs.UserInvalidInput,
+		},
+		{
+			name: "确认之前新邮箱被别人注册了",
+			mockSetup: func(s *mockEmailChangeService) {
+				s.On("Confirm", mock.Anything, "tk").Return(int64(0), service.ErrDuplicateEmail)
+			},
+			wantCode: errs.UserDuplicateEmail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockEmailChangeService)
+			tt.mockSetup(svc)
+			resp := doEmailRequest(t, svc, http.MethodGet, "/users/email/confirm?token=tk", nil)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
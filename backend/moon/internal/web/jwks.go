@@ -0,0 +1,31 @@
+package web
+
+import (
+	"net/http"
+
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler 发布 access token 的公钥，
+// 其它服务拿到公钥之后就可以自己校验 UserClaims，不需要持有我们的密钥
+type JWKSHandler struct {
+	keys *ijwt.KeyRing
+}
+
+func NewJWKSHandler(keys *ijwt.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	public.Add(server, http.MethodGet, "/.well-known/jwks.json")
+	server.GET("/.well-known/jwks.json", h.JWKS)
+}
+
+// JWKS 按照 RFC 7517 的格式直接返回，不套 ginx.Result，方便标准的 jwt 库直接使用
+func (h *JWKSHandler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.keys.JWKS())
+}
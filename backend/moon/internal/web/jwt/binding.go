@@ -0,0 +1,75 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ErrClientMismatch = errors.New("token 和当前客户端不匹配")
+
+// ClientBinding access token 和客户端的绑定策略
+type ClientBinding string
+
+const (
+	// BindingOff 不校验客户端
+	BindingOff ClientBinding = "off"
+	// BindingUserAgent 要求 User-Agent 和签发 token 时一致
+	BindingUserAgent ClientBinding = "user_agent"
+	// BindingFingerprint 要求 User-Agent 加上前端上报的客户端指纹和签发 token 时一致
+	BindingFingerprint ClientBinding = "fingerprint"
+)
+
+// FingerprintHeader 前端上报客户端指纹用的 header
+const FingerprintHeader = "X-Client-Fingerprint"
+
+func ParseClientBinding(s string) (ClientBinding, error) {
+	switch b := ClientBinding(s); b {
+	case "":
+		return BindingOff, nil
+	case BindingOff, BindingUserAgent, BindingFingerprint:
+		return b, nil
+	default:
+		return "", fmt.Errorf("未知的客户端绑定策略 %s", s)
+	}
+}
+
+// Option RedisJWTHandler 的可选配置
+type Option func(h *RedisJWTHandler)
+
+func WithClientBinding(b ClientBinding) Option {
+	return func(h *RedisJWTHandler) {
+		h.binding = b
+	}
+}
+
+// CheckClient 按照绑定策略比较 token 里记录的客户端和当前请求的客户端
+func (h *RedisJWTHandler) CheckClient(ctx *gin.Context, uc UserClaims) error {
+	switch h.binding {
+	case BindingUserAgent:
+		if uc.UserAgent != ctx.GetHeader("User-Agent") {
+			return ErrClientMismatch
+		}
+	case BindingFingerprint:
+		// 签发的时候没有指纹，那么永远都对不上
+		if uc.Fingerprint == "" ||
+			subtle.ConstantTimeCompare([]byte(uc.Fingerprint), []byte(fingerprint(ctx))) != 1 {
+			return ErrClientMismatch
+		}
+	}
+	return nil
+}
+
+// fingerprint 只在 token 里保存哈希，避免把前端上报的原始指纹暴露出去
+func fingerprint(ctx *gin.Context) string {
+	fp := ctx.GetHeader(FingerprintHeader)
+	if fp == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(ctx.GetHeader("User-Agent") + "\x00" + fp))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,85 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisJWTHandler_CheckClient(t *testing.T) {
+	newCtx := func(ua, fp string) *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/users/profile", nil)
+		ctx.Request.Header.Set("User-Agent", ua)
+		if fp != "" {
+			ctx.Request.Header.Set(FingerprintHeader, fp)
+		}
+		return ctx
+	}
+
+	testCases := []struct {
+		name    string
+		binding ClientBinding
+		uc      UserClaims
+		ctx     *gin.Context
+		wantErr error
+	}{
+		{
+			name:    "不校验",
+			binding: BindingOff,
+			uc:      UserClaims{UserAgent: "chrome"},
+			ctx:     newCtx("curl", ""),
+		},
+		{
+			name:    "User-Agent 一致",
+			binding: BindingUserAgent,
+			uc:      UserClaims{UserAgent: "chrome"},
+			ctx:     newCtx("chrome", ""),
+		},
+		{
+			name:    "User-Agent 不一致",
+			binding: BindingUserAgent,
+			uc:      UserClaims{UserAgent: "chrome"},
+			ctx:     newCtx("curl", ""),
+			wantErr: ErrClientMismatch,
+		},
+		{
+			name:    "指纹一致",
+			binding: BindingFingerprint,
+			uc:      UserClaims{UserAgent: "chrome", Fingerprint: fingerprint(newCtx("chrome", "device-1"))},
+			ctx:     newCtx("chrome", "device-1"),
+		},
+		{
+			name:    "指纹不一致",
+			binding: BindingFingerprint,
+			uc:      UserClaims{UserAgent: "chrome", Fingerprint: fingerprint(newCtx("chrome", "device-1"))},
+			ctx:     newCtx("chrome", "device-2"),
+			wantErr: ErrClientMismatch,
+		},
+		{
+			name:    "指纹一致但 User-Agent 不一致",
+			binding: BindingFingerprint,
+			uc:      UserClaims{UserAgent: "chrome", Fingerprint: fingerprint(newCtx("chrome", "device-1"))},
+			ctx:     newCtx("curl", "device-1"),
+			wantErr: ErrClientMismatch,
+		},
+		{
+			name:    "签发时没有指纹",
+			binding: BindingFingerprint,
+			uc:      UserClaims{UserAgent: "chrome"},
+			ctx:     newCtx("chrome", ""),
+			wantErr: ErrClientMismatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewRedisJWTHandler(nil, nil, WithClientBinding(tc.binding))
+			err := h.CheckClient(tc.ctx, tc.uc)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"context"
+	"time"
+)
+
+// SessionExporter 导出用户当前的会话，实现了 service.Exporter
+type SessionExporter struct {
+	hdl Handler
+}
+
+func NewSessionExporter(hdl Handler) *SessionExporter {
+	return &SessionExporter{hdl: hdl}
+}
+
+func (e *SessionExporter) Name() string {
+	return "sessions"
+}
+
+type sessionExport struct {
+	Ssid      string `json:"ssid"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Ctime     string `json:"ctime"`
+	LastSeen  string `json:"last_seen"`
+}
+
+func (e *SessionExporter) Export(ctx context.Context, uid int64) (any, error) {
+	sessions, err := e.hdl.ListSessions(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]sessionExport, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, sessionExport{
+			Ssid:      s.Ssid,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Ctime:     s.Ctime.UTC().Format(time.RFC3339),
+			LastSeen:  s.LastSeen.UTC().Format(time.RFC3339),
+		})
+	}
+	return res, nil
+}
+
+// LoginHistoryExporter 导出最近的登录记录，实现了 service.Exporter
+type LoginHistoryExporter struct {
+	hdl Handler
+}
+
+func NewLoginHistoryExporter(hdl Handler) *LoginHistoryExporter {
+	return &LoginHistoryExporter{hdl: hdl}
+}
+
+func (e *LoginHistoryExporter) Name() string {
+	return "login_history"
+}
+
+type loginRecordExport struct {
+	Ssid      string `json:"ssid"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Time      string `json:"time"`
+}
+
+func (e *LoginHistoryExporter) Export(ctx context.Context, uid int64) (any, error) {
+	records, err := e.hdl.LoginHistory(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]loginRecordExport, 0, len(records))
+	for _, r := range records {
+		res = append(res, loginRecordExport{
+			Ssid:      r.Ssid,
+			IP:        r.IP,
+			UserAgent: r.UserAgent,
+			Time:      r.Time.UTC().Format(time.RFC3339),
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,160 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrKeyNotFound = errors.New("jwt 密钥不存在")
+	ErrKeyRetired  = errors.New("jwt 密钥已退役")
+)
+
+// Key 一组签名密钥，access token 和 refresh token 分别使用不同的密钥
+type Key struct {
+	Kid string
+	// Method access token 的签名算法，为空时使用 HS512
+	// 使用 RS256、EdDSA 这类非对称算法时，其它服务只需要公钥就能校验 access token
+	Method jwt.SigningMethod
+	// AccessKey access token 的签名密钥
+	// HMAC 为 []byte，RSA 为 *rsa.PrivateKey，EdDSA 为 ed25519.PrivateKey
+	AccessKey any
+	// RefreshKey refresh token 只有我们自己校验，所以始终使用 HMAC
+	RefreshKey []byte
+	// RetiredAt 退役时间，零值表示仍在使用
+	// 退役之后不再用于签名，但在宽限期内仍然可以用来校验
+	RetiredAt time.Time
+}
+
+// verifyKey 校验 access token 用的密钥，非对称算法返回公钥
+func (k Key) verifyKey() any {
+	switch key := k.AccessKey.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case ed25519.PrivateKey:
+		return key.Public()
+	default:
+		return key
+	}
+}
+
+func (k Key) validate() error {
+	if k.Kid == "" {
+		return errors.New("jwt 密钥缺少 kid")
+	}
+	if len(k.RefreshKey) == 0 {
+		return fmt.Errorf("jwt 密钥 %s 缺少 refresh 密钥", k.Kid)
+	}
+	var ok bool
+	switch k.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		var key []byte
+		key, ok = k.AccessKey.([]byte)
+		ok = ok && len(key) > 0
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = k.AccessKey.(*rsa.PrivateKey)
+	case *jwt.SigningMethodEd25519:
+		_, ok = k.AccessKey.(ed25519.PrivateKey)
+	default:
+		return fmt.Errorf("jwt 密钥 %s 使用了不支持的签名算法", k.Kid)
+	}
+	if !ok {
+		return fmt.Errorf("jwt 密钥 %s 的 access 密钥和签名算法 %s 不匹配", k.Kid, k.Method.Alg())
+	}
+	return nil
+}
+
+// KeyRing 管理多把 jwt 密钥，签发时使用 active 密钥，并在 header 里写入 kid，
+// 校验时根据 kid 找到对应的密钥，这样轮换密钥的时候不会把所有人踢下线
+type KeyRing struct {
+	active string
+	keys   map[string]Key
+	// grace 退役密钥的宽限期
+	grace time.Duration
+	now   func() time.Time
+}
+
+func NewKeyRing(active string, grace time.Duration, keys ...Key) (*KeyRing, error) {
+	r := &KeyRing{
+		active: active,
+		keys:   make(map[string]Key, len(keys)),
+		grace:  grace,
+		now:    time.Now,
+	}
+	for _, k := range keys {
+		if k.Method == nil {
+			k.Method = jwt.SigningMethodHS512
+		}
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := r.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("jwt 密钥 %s 重复", k.Kid)
+		}
+		r.keys[k.Kid] = k
+	}
+	ak, ok := r.keys[active]
+	if !ok {
+		return nil, fmt.Errorf("jwt 当前密钥 %s 不存在", active)
+	}
+	if !ak.RetiredAt.IsZero() {
+		return nil, fmt.Errorf("jwt 当前密钥 %s 已经退役", active)
+	}
+	return r, nil
+}
+
+// Active 用于签名的密钥
+func (r *KeyRing) Active() Key {
+	return r.keys[r.active]
+}
+
+// Lookup 根据 kid 查找可以用于校验的密钥
+func (r *KeyRing) Lookup(kid string) (Key, error) {
+	k, ok := r.keys[kid]
+	if !ok {
+		return Key{}, ErrKeyNotFound
+	}
+	if !k.RetiredAt.IsZero() && r.now().After(k.RetiredAt.Add(r.grace)) {
+		return Key{}, ErrKeyRetired
+	}
+	return k, nil
+}
+
+// AccessKeyFunc 校验 access token 用的 jwt.Keyfunc
+func (r *KeyRing) AccessKeyFunc() jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		k, err := r.lookupByToken(token)
+		if err != nil {
+			return nil, err
+		}
+		// 防止有人改掉 alg 来绕过校验，比如用公钥当作 HMAC 密钥
+		if token.Method.Alg() != k.Method.Alg() {
+			return nil, fmt.Errorf("签名算法 %s 和密钥 %s 不匹配", token.Method.Alg(), k.Kid)
+		}
+		return k.verifyKey(), nil
+	}
+}
+
+// RefreshKeyFunc 校验 refresh token 用的 jwt.Keyfunc
+func (r *KeyRing) RefreshKeyFunc() jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("不支持的签名算法 %v", token.Header["alg"])
+		}
+		k, err := r.lookupByToken(token)
+		if err != nil {
+			return nil, err
+		}
+		return k.RefreshKey, nil
+	}
+}
+
+func (r *KeyRing) lookupByToken(token *jwt.Token) (Key, error) {
+	kid, _ := token.Header["kid"].(string)
+	return r.Lookup(kid)
+}
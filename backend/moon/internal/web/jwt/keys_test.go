@@ -0,0 +1,208 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyRing(t *testing.T) {
+	testCases := []struct {
+		name    string
+		active  string
+		keys    []Key
+		wantErr bool
+	}{
+		{
+			name:   "正常",
+			active: "k2",
+			keys: []Key{
+				{Kid: "k1", AccessKey: []byte("a1"), RefreshKey: []byte("r1"), RetiredAt: time.Now()},
+				{Kid: "k2", AccessKey: []byte("a2"), RefreshKey: []byte("r2")},
+			},
+		},
+		{
+			name:    "当前密钥不存在",
+			active:  "k3",
+			keys:    []Key{{Kid: "k1", AccessKey: []byte("a1"), RefreshKey: []byte("r1")}},
+			wantErr: true,
+		},
+		{
+			name:    "当前密钥已经退役",
+			active:  "k1",
+			keys:    []Key{{Kid: "k1", AccessKey: []byte("a1"), RefreshKey: []byte("r1"), RetiredAt: time.Now()}},
+			wantErr: true,
+		},
+		{
+			name:   "kid 重复",
+			active: "k1",
+			keys: []Key{
+				{Kid: "k1", AccessKey: []byte("a1"), RefreshKey: []byte("r1")},
+				{Kid: "k1", AccessKey: []byte("a2"), RefreshKey: []byte("r2")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "缺少密钥",
+			active:  "k1",
+			keys:    []Key{{Kid: "k1", AccessKey: []byte("a1")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewKeyRing(tc.active, time.Hour, tc.keys...)
+			assert.Equal(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestKeyRing_AccessKeyFunc(t *testing.T) {
+	now := time.Now()
+	ring, err := NewKeyRing("new", time.Hour,
+		Key{Kid: "old", AccessKey: []byte("old-access"), RefreshKey: []byte("old-refresh"), RetiredAt: now.Add(-time.Minute * 30)},
+		Key{Kid: "expired", AccessKey: []byte("exp-access"), RefreshKey: []byte("exp-refresh"), RetiredAt: now.Add(-time.Hour * 2)},
+		Key{Kid: "new", AccessKey: []byte("new-access"), RefreshKey: []byte("new-refresh")},
+	)
+	require.NoError(t, err)
+
+	sign := func(kid string, key []byte) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, UserClaims{Uid: 123})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		str, err := token.SignedString(key)
+		require.NoError(t, err)
+		return str
+	}
+
+	testCases := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{
+			name:  "当前密钥",
+			token: sign("new", []byte("new-access")),
+		},
+		{
+			name:  "宽限期内的退役密钥",
+			token: sign("old", []byte("old-access")),
+		},
+		{
+			name:    "超过宽限期的退役密钥",
+			token:   sign("expired", []byte("exp-access")),
+			wantErr: ErrKeyRetired,
+		},
+		{
+			name:    "未知 kid",
+			token:   sign("unknown", []byte("new-access")),
+			wantErr: ErrKeyNotFound,
+		},
+		{
+			name:    "没有 kid",
+			token:   sign("", []byte("new-access")),
+			wantErr: ErrKeyNotFound,
+		},
+		{
+			name:    "用 refresh 密钥签名",
+			token:   sign("new", []byte("new-refresh")),
+			wantErr: jwt.ErrSignatureInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var uc UserClaims
+			_, err := jwt.ParseWithClaims(tc.token, &uc, ring.AccessKeyFunc())
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(123), uc.Uid)
+		})
+	}
+}
+
+func TestKeyRing_Asymmetric(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ring, err := NewKeyRing("ed", time.Hour,
+		Key{Kid: "ed", Method: jwt.SigningMethodEdDSA, AccessKey: edKey, RefreshKey: []byte("r1")},
+		Key{Kid: "rsa", Method: jwt.SigningMethodRS256, AccessKey: rsaKey, RefreshKey: []byte("r2")},
+		Key{Kid: "hmac", AccessKey: []byte("a3"), RefreshKey: []byte("r3")},
+	)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr bool
+	}{
+		{
+			name: "EdDSA",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, UserClaims{Uid: 123})
+				token.Header["kid"] = "ed"
+				str, err := token.SignedString(edKey)
+				require.NoError(t, err)
+				return str
+			},
+		},
+		{
+			name: "RS256",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, UserClaims{Uid: 123})
+				token.Header["kid"] = "rsa"
+				str, err := token.SignedString(rsaKey)
+				require.NoError(t, err)
+				return str
+			},
+		},
+		{
+			name: "用公钥当作 HMAC 密钥",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{Uid: 123})
+				token.Header["kid"] = "ed"
+				str, err := token.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+				require.NoError(t, err)
+				return str
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var uc UserClaims
+			_, err := jwt.ParseWithClaims(tc.token(t), &uc, ring.AccessKeyFunc())
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(123), uc.Uid)
+		})
+	}
+
+	set := ring.JWKS()
+	// HMAC 密钥不能出现在 JWKS 里
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, "ed", set.Keys[0].Kid)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+	assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+	assert.Equal(t, "rsa", set.Keys[1].Kid)
+	assert.Equal(t, "RSA", set.Keys[1].Kty)
+	assert.Equal(t, "AQAB", set.Keys[1].E)
+}
@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginRecord 一次成功的登录，不管是密码、短信还是第三方登录，最后都会创建会话
+type LoginRecord struct {
+	Ssid      string
+	IP        string
+	UserAgent string
+	Time      time.Time
+}
+
+type loginRecordEntity struct {
+	Ssid      string `json:"ssid"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"ua"`
+	// Time 毫秒时间戳
+	Time int64 `json:"time"`
+}
+
+// WithLoginHistory 每个用户保留最近 size 次登录，最后一次登录之后 ttl 没有登录就全部清掉
+// size 为 0 表示不记录
+func WithLoginHistory(size int, ttl time.Duration) Option {
+	return func(h *RedisJWTHandler) {
+		h.loginHistorySize = size
+		h.loginHistoryTTL = ttl
+	}
+}
+
+// recordLogin 和创建会话放在同一个事务里
+func (h *RedisJWTHandler) recordLogin(ctx context.Context, pipe redis.Pipeliner, uid int64, r loginRecordEntity) error {
+	if h.loginHistorySize <= 0 {
+		return nil
+	}
+	val, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := h.loginHistoryKey(uid)
+	pipe.LPush(ctx, key, val)
+	pipe.LTrim(ctx, key, 0, int64(h.loginHistorySize-1))
+	pipe.Expire(ctx, key, h.loginHistoryTTL)
+	return nil
+}
+
+func (h *RedisJWTHandler) LoginHistory(ctx context.Context, uid int64) ([]LoginRecord, error) {
+	vals, err := h.client.LRange(ctx, h.loginHistoryKey(uid), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]LoginRecord, 0, len(vals))
+	for _, val := range vals {
+		var e loginRecordEntity
+		if err = json.Unmarshal([]byte(val), &e); err != nil {
+			return nil, err
+		}
+		res = append(res, LoginRecord{
+			Ssid:      e.Ssid,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Time:      time.UnixMilli(e.Time),
+		})
+	}
+	return res, nil
+}
+
+func (h *RedisJWTHandler) loginHistoryKey(uid int64) string {
+	return fmt.Sprintf("users:logins:%d", uid)
+}
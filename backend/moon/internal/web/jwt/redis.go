@@ -3,7 +3,6 @@ package jwt
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,17 +12,46 @@ import (
 )
 
 type RedisJWTHandler struct {
-	client        redis.Cmdable
+	client redis.Cmdable
+	// signingMethod refresh token 的签名算法，access token 的签名算法由密钥决定
 	signingMethod jwt.SigningMethod
+	keys          *KeyRing
+	expiration    time.Duration
 	rcExpiration  time.Duration
+	binding       ClientBinding
+	transport     Transport
+	cookie        CookieConfig
+	roles         RoleLoader
+	// loginHistorySize 每个用户保留最近几次登录
+	loginHistorySize int
+	loginHistoryTTL  time.Duration
 }
 
-func NewRedisJWTHandler(client redis.Cmdable) Handler {
-	return &RedisJWTHandler{
+func NewRedisJWTHandler(client redis.Cmdable, keys *KeyRing, opts ...Option) Handler {
+	h := &RedisJWTHandler{
 		client:        client,
 		signingMethod: jwt.SigningMethodHS512,
+		keys:          keys,
+		expiration:    time.Minute * 30,
 		rcExpiration:  time.Hour * 24 * 7,
+		binding:       BindingOff,
+		transport:     TransportHeader,
+
+		loginHistorySize: 50,
+		loginHistoryTTL:  time.Hour * 24 * 90,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
+}
+
+func (h *RedisJWTHandler) AccessKeyFunc() jwt.Keyfunc {
+	return h.keys.AccessKeyFunc()
+}
+
+func (h *RedisJWTHandler) RefreshKeyFunc() jwt.Keyfunc {
+	return h.keys.RefreshKeyFunc()
 }
 
 func (h *RedisJWTHandler) CheckSession(ctx *gin.Context, ssid string) error {
@@ -37,39 +65,48 @@ func (h *RedisJWTHandler) CheckSession(ctx *gin.Context, ssid string) error {
 	return nil
 }
 
-// ExtractToken 根据约定，token 在 Authorization 头部
-// Bearer XXXX
-func (h *RedisJWTHandler) ExtractToken(ctx *gin.Context) string {
-	authCode := ctx.GetHeader("Authorization")
-	if authCode == "" {
-		return authCode
-	}
-	segs := strings.Split(authCode, " ")
-	if len(segs) != 2 {
-		return ""
-	}
-	return segs[1]
-}
-
 var _ Handler = &RedisJWTHandler{}
 
 func (h *RedisJWTHandler) SetLoginToken(ctx *gin.Context, uid int64) error {
 	ssid := uuid.New().String()
-	err := h.setRefreshToken(ctx, uid, ssid)
+	jti := uuid.New().String()
+	err := h.setRefreshToken(ctx, uid, ssid, jti)
+	if err != nil {
+		return err
+	}
+	err = h.createSession(ctx, uid, ssid, jti)
 	if err != nil {
 		return err
 	}
 	return h.SetJWTToken(ctx, uid, ssid)
 }
 
+// RotateTokens 每次刷新都换一个新的 refresh token，旧的立刻作废。
+// 如果拿来刷新的 refresh token 已经被换掉了，说明它很可能被人偷了，
+// 这时候直接撤销整个会话，不管是攻击者还是用户本人都需要重新登录
+func (h *RedisJWTHandler) RotateTokens(ctx *gin.Context, rc RefreshClaims) error {
+	jti := uuid.New().String()
+	err := h.rotateSession(ctx, rc.Uid, rc.Ssid, rc.ID, jti)
+	if err == ErrRefreshTokenReused {
+		if er := h.revoke(ctx, rc.Uid, rc.Ssid); er != nil {
+			return er
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	err = h.setRefreshToken(ctx, rc.Uid, rc.Ssid, jti)
+	if err != nil {
+		return err
+	}
+	return h.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+}
+
 func (h *RedisJWTHandler) ClearToken(ctx *gin.Context) error {
-	ctx.Header("x-jwt-token", "")
-	ctx.Header("x-refresh-token", "")
+	h.clearTransport(ctx)
 	uc := ctx.MustGet("user").(UserClaims)
-
-	return h.client.Set(ctx,
-		fmt.Sprintf("users:ssid:%s", uc.Ssid),
-		"", h.rcExpiration).Err()
+	return h.revoke(ctx, uc.Uid, uc.Ssid)
 }
 
 func (h *RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
@@ -78,39 +115,52 @@ func (h *RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string)
 		Ssid:      ssid,
 		UserAgent: ctx.GetHeader("User-Agent"),
 		RegisteredClaims: jwt.RegisteredClaims{
-			// 1 分钟过期
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)),
+			// 30 分钟过期
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.expiration)),
 		},
 	}
-	token := jwt.NewWithClaims(h.signingMethod, uc)
-	tokenStr, err := token.SignedString(JWTKey)
+	if h.binding == BindingFingerprint {
+		uc.Fingerprint = fingerprint(ctx)
+	}
+	if h.roles != nil {
+		// 每次签发都重新加载，角色的变更最迟在下一次刷新 token 的时候生效
+		roles, err := h.roles.Roles(ctx, uid)
+		if err != nil {
+			return err
+		}
+		uc.Roles = roles
+	}
+	key := h.keys.Active()
+	token := jwt.NewWithClaims(key.Method, uc)
+	token.Header["kid"] = key.Kid
+	tokenStr, err := token.SignedString(key.AccessKey)
 	if err != nil {
 		return err
 	}
-	ctx.Header("x-jwt-token", tokenStr)
-	return nil
+	h.writeAccessToken(ctx, tokenStr, h.expiration)
+	return h.touchSession(ctx, ssid)
 }
 
-func (h *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid string) error {
+func (h *RedisJWTHandler) setRefreshToken(ctx *gin.Context, uid int64, ssid string, jti string) error {
 	rc := RefreshClaims{
 		Uid:  uid,
 		Ssid: ssid,
 		RegisteredClaims: jwt.RegisteredClaims{
+			// 用 jti 区分同一个会话里先后签发的 refresh token
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.rcExpiration)),
 		},
 	}
+	key := h.keys.Active()
 	token := jwt.NewWithClaims(h.signingMethod, rc)
-	tokenStr, err := token.SignedString(RCJWTKey)
+	token.Header["kid"] = key.Kid
+	tokenStr, err := token.SignedString(key.RefreshKey)
 	if err != nil {
 		return err
 	}
-	ctx.Header("x-refresh-token", tokenStr)
-	return nil
+	return h.writeRefreshToken(ctx, tokenStr)
 }
 
-var JWTKey = []byte("k6CswdUm77WKcbM68UQUuxVsHSpTCwgK")
-var RCJWTKey = []byte("k6CswdUm77WKcbM68UQUuxVsHSpTCwgA")
-
 type RefreshClaims struct {
 	jwt.RegisteredClaims
 	Uid  int64
@@ -122,4 +172,17 @@ type UserClaims struct {
 	Uid       int64
 	Ssid      string
 	UserAgent string
+	// Fingerprint User-Agent 和客户端指纹的哈希，只在 BindingFingerprint 策略下才有
+	Fingerprint string `json:",omitempty"`
+	// Roles 签发时用户的角色，权限校验用
+	Roles []string `json:",omitempty"`
+	// TokenId 用个人访问令牌认证的时候才有，这时候没有 Ssid
+	TokenId int64 `json:",omitempty"`
+	// Scopes 个人访问令牌的权限范围，权限校验的时候和 Roles 取交集
+	Scopes []string `json:",omitempty"`
+}
+
+// ViaAccessToken 是不是用个人访问令牌认证的
+func (uc UserClaims) ViaAccessToken() bool {
+	return uc.TokenId != 0
 }
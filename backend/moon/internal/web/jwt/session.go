@@ -0,0 +1,248 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("会话不存在")
+	ErrRefreshTokenReused = errors.New("refresh token 被重复使用")
+	ErrUserBlocked        = errors.New("用户已被禁用")
+)
+
+// touchScript 只在会话还存在的时候更新，避免把已经撤销的会话又写回去
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], "last_seen", ARGV[1], "ip", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// rotateScript 比较并替换会话当前的 refresh token
+// 返回 -1 表示会话不存在，0 表示 refresh token 已经被换掉了，1 表示替换成功
+var rotateScript = redis.NewScript(`
+local cur = redis.call("HGET", KEYS[1], "rt")
+if not cur then
+	return -1
+end
+if cur ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "rt", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+redis.call("PEXPIRE", KEYS[2], ARGV[3])
+return 1
+`)
+
+// Session 一次登录对应一个 ssid，也就是一个会话
+type Session struct {
+	Ssid      string
+	Uid       int64
+	UserAgent string
+	IP        string
+	Ctime     time.Time
+	// LastSeen 最近一次签发 access token 的时间
+	LastSeen time.Time
+}
+
+// createSession 登录的时候记录会话，并把 ssid 加入用户的会话索引，同时记一条登录历史
+// jti 是当前唯一有效的 refresh token
+func (h *RedisJWTHandler) createSession(ctx *gin.Context, uid int64, ssid string, jti string) error {
+	now := time.Now().UnixMilli()
+	key := h.sessionKey(ssid)
+	ua, ip := ctx.GetHeader("User-Agent"), ctx.ClientIP()
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]any{
+			"uid":       uid,
+			"ua":        ua,
+			"ip":        ip,
+			"ctime":     now,
+			"last_seen": now,
+			"rt":        jti,
+		})
+		pipe.Expire(ctx, key, h.rcExpiration)
+		pipe.SAdd(ctx, h.sessionsKey(uid), ssid)
+		pipe.Expire(ctx, h.sessionsKey(uid), h.rcExpiration)
+		return h.recordLogin(ctx, pipe, uid, loginRecordEntity{Ssid: ssid, IP: ip, UserAgent: ua, Time: now})
+	})
+	return err
+}
+
+// rotateSession 把会话的 refresh token 从 oldJti 换成 newJti，并且续期
+func (h *RedisJWTHandler) rotateSession(ctx *gin.Context, uid int64, ssid string, oldJti, newJti string) error {
+	res, err := rotateScript.Run(ctx, h.client,
+		[]string{h.sessionKey(ssid), h.sessionsKey(uid)},
+		oldJti, newJti, h.rcExpiration.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+		return nil
+	case 0:
+		return ErrRefreshTokenReused
+	default:
+		return ErrSessionNotFound
+	}
+}
+
+// touchSession 更新最近活跃时间，会话已经过期的话什么也不做
+func (h *RedisJWTHandler) touchSession(ctx *gin.Context, ssid string) error {
+	return touchScript.Run(ctx, h.client, []string{h.sessionKey(ssid)},
+		time.Now().UnixMilli(), ctx.ClientIP()).Err()
+}
+
+func (h *RedisJWTHandler) ListSessions(ctx context.Context, uid int64) ([]Session, error) {
+	ssids, err := h.client.SMembers(ctx, h.sessionsKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.MapStringStringCmd, len(ssids))
+	_, err = h.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, ssid := range ssids {
+			cmds[i] = pipe.HGetAll(ctx, h.sessionKey(ssid))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Session, 0, len(ssids))
+	var expired []any
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if len(vals) == 0 {
+			// 会话已经过期了，顺手把索引清理掉
+			expired = append(expired, ssids[i])
+			continue
+		}
+		res = append(res, toSession(ssids[i], vals))
+	}
+	if len(expired) > 0 {
+		err = h.client.SRem(ctx, h.sessionsKey(uid), expired...).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (h *RedisJWTHandler) RevokeSession(ctx context.Context, uid int64, ssid string) error {
+	ok, err := h.client.SIsMember(ctx, h.sessionsKey(uid), ssid).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return h.revoke(ctx, uid, ssid)
+}
+
+func (h *RedisJWTHandler) RevokeAllSessions(ctx context.Context, uid int64) error {
+	ssids, err := h.client.SMembers(ctx, h.sessionsKey(uid)).Result()
+	if err != nil {
+		return err
+	}
+	return h.revoke(ctx, uid, ssids...)
+}
+
+func (h *RedisJWTHandler) RevokeOtherSessions(ctx context.Context, uid int64, ssid string) error {
+	ssids, err := h.client.SMembers(ctx, h.sessionsKey(uid)).Result()
+	if err != nil {
+		return err
+	}
+	others := make([]string, 0, len(ssids))
+	for _, s := range ssids {
+		if s != ssid {
+			others = append(others, s)
+		}
+	}
+	return h.revoke(ctx, uid, others...)
+}
+
+// revoke 把 ssid 标记为无效，同时从会话索引里删除
+func (h *RedisJWTHandler) revoke(ctx context.Context, uid int64, ssids ...string) error {
+	if len(ssids) == 0 {
+		return nil
+	}
+	_, err := h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members := make([]any, 0, len(ssids))
+		for _, ssid := range ssids {
+			pipe.Set(ctx, fmt.Sprintf("users:ssid:%s", ssid), "", h.rcExpiration)
+			pipe.Del(ctx, h.sessionKey(ssid))
+			members = append(members, ssid)
+		}
+		pipe.SRem(ctx, h.sessionsKey(uid), members...)
+		return nil
+	})
+	return err
+}
+
+// BlockUser 禁用用户：撤销所有会话，并且在解除之前拒绝他所有还没过期的 token
+func (h *RedisJWTHandler) BlockUser(ctx context.Context, uid int64) error {
+	return h.blockUser(ctx, uid, 0)
+}
+
+// BlockUserUntil 和 BlockUser 一样，但是 until 之后再过一个 refresh token 的有效期自动解除，
+// 那时候之前签发的 token 都已经过期了，比如注销的账号到时间就会被彻底删除，不需要一直留着标记
+func (h *RedisJWTHandler) BlockUserUntil(ctx context.Context, uid int64, until time.Time) error {
+	return h.blockUser(ctx, uid, time.Until(until)+h.rcExpiration)
+}
+
+func (h *RedisJWTHandler) blockUser(ctx context.Context, uid int64, expiration time.Duration) error {
+	err := h.client.Set(ctx, h.blockedKey(uid), "", expiration).Err()
+	if err != nil {
+		return err
+	}
+	return h.RevokeAllSessions(ctx, uid)
+}
+
+func (h *RedisJWTHandler) UnblockUser(ctx context.Context, uid int64) error {
+	return h.client.Del(ctx, h.blockedKey(uid)).Err()
+}
+
+func (h *RedisJWTHandler) CheckUser(ctx *gin.Context, uid int64) error {
+	cnt, err := h.client.Exists(ctx, h.blockedKey(uid)).Result()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrUserBlocked
+	}
+	return nil
+}
+
+func (h *RedisJWTHandler) blockedKey(uid int64) string {
+	return fmt.Sprintf("users:blocked:%d", uid)
+}
+
+func (h *RedisJWTHandler) sessionKey(ssid string) string {
+	return fmt.Sprintf("users:session:%s", ssid)
+}
+
+func (h *RedisJWTHandler) sessionsKey(uid int64) string {
+	return fmt.Sprintf("users:sessions:%d", uid)
+}
+
+func toSession(ssid string, vals map[string]string) Session {
+	uid, _ := strconv.ParseInt(vals["uid"], 10, 64)
+	ctime, _ := strconv.ParseInt(vals["ctime"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(vals["last_seen"], 10, 64)
+	return Session{
+		Ssid:      ssid,
+		Uid:       uid,
+		UserAgent: vals["ua"],
+		IP:        vals["ip"],
+		Ctime:     time.UnixMilli(ctime),
+		LastSeen:  time.UnixMilli(lastSeen),
+	}
+}
@@ -0,0 +1,90 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisJWTHandler_RevokeOtherSessions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	h := NewRedisJWTHandler(redis.NewClient(&redis.Options{Addr: mr.Addr()}), nil).(*RedisJWTHandler)
+	ctx := context.Background()
+	for _, ssid := range []string{"s1", "s2", "s3"} {
+		_, err := mr.SAdd(h.sessionsKey(1), ssid)
+		require.NoError(t, err)
+		mr.HSet(h.sessionKey(ssid), "uid", "1")
+	}
+	_, err := mr.SAdd(h.sessionsKey(2), "s4")
+	require.NoError(t, err)
+
+	require.NoError(t, h.RevokeOtherSessions(ctx, 1, "s2"))
+
+	members, err := mr.Members(h.sessionsKey(1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s2"}, members)
+	// 被撤销的 ssid 会被标记为无效
+	assert.True(t, mr.Exists("users:ssid:s1"))
+	assert.True(t, mr.Exists("users:ssid:s3"))
+	assert.False(t, mr.Exists("users:ssid:s2"))
+	assert.True(t, mr.Exists(h.sessionKey("s2")))
+	assert.False(t, mr.Exists(h.sessionKey("s1")))
+	// 别的用户不受影响
+	assert.False(t, mr.Exists("users:ssid:s4"))
+}
+
+func TestRedisJWTHandler_LoginHistory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	h := NewRedisJWTHandler(redis.NewClient(&redis.Options{Addr: mr.Addr()}), nil,
+		WithLoginHistory(2, time.Hour)).(*RedisJWTHandler)
+	for _, ssid := range []string{"s1", "s2", "s3"} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/users/login", nil)
+		ctx.Request.Header.Set("User-Agent", "ua-"+ssid)
+		require.NoError(t, h.createSession(ctx, 1, ssid, "jti-"+ssid))
+	}
+
+	records, err := h.LoginHistory(context.Background(), 1)
+	require.NoError(t, err)
+	// 只保留最近两次，新的在前面
+	require.Len(t, records, 2)
+	assert.Equal(t, "s3", records[0].Ssid)
+	assert.Equal(t, "ua-s3", records[0].UserAgent)
+	assert.Equal(t, "s2", records[1].Ssid)
+	assert.WithinDuration(t, time.Now(), records[0].Time, time.Second)
+
+	records, err = h.LoginHistory(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	mr.FastForward(time.Hour + time.Second)
+	records, err = h.LoginHistory(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestRedisJWTHandler_BlockUserUntil(t *testing.T) {
+	mr := miniredis.RunT(t)
+	h := NewRedisJWTHandler(redis.NewClient(&redis.Options{Addr: mr.Addr()}), nil).(*RedisJWTHandler)
+	ctx := context.Background()
+
+	require.NoError(t, h.BlockUser(ctx, 1))
+	require.NoError(t, h.BlockUserUntil(ctx, 2, time.Now().Add(time.Hour)))
+	// 永久禁用的没有过期时间
+	assert.Equal(t, time.Duration(0), mr.TTL(h.blockedKey(1)))
+
+	// 到时间之后还要等之前签发的 refresh token 都过期
+	mr.FastForward(time.Hour + time.Second)
+	assert.True(t, mr.Exists(h.blockedKey(2)))
+	mr.FastForward(h.rcExpiration)
+	assert.False(t, mr.Exists(h.blockedKey(2)))
+	assert.True(t, mr.Exists(h.blockedKey(1)))
+}
@@ -0,0 +1,168 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Transport token 在前后端之间的传递方式
+type Transport string
+
+const (
+	// TransportHeader 通过 x-jwt-token / x-refresh-token 响应头返回，前端放在 Authorization 里带回来
+	TransportHeader Transport = "header"
+	// TransportCookie 通过 HttpOnly 的 cookie 传递，前端的 js 读不到 token，
+	// 需要配合 CSRF 中间件使用
+	TransportCookie Transport = "cookie"
+)
+
+const (
+	AccessTokenCookie  = "jwt_token"
+	RefreshTokenCookie = "refresh_token"
+	// CSRFCookie double submit 用的 cookie，前端需要把它的值放到 CSRFHeader 里
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+
+	// refresh token 的 cookie 只会发给刷新接口
+	refreshTokenPath = "/users/refresh_token"
+)
+
+func ParseTransport(s string) (Transport, error) {
+	switch t := Transport(s); t {
+	case "":
+		return TransportHeader, nil
+	case TransportHeader, TransportCookie:
+		return t, nil
+	default:
+		return "", fmt.Errorf("未知的 token 传递方式 %s", s)
+	}
+}
+
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("未知的 SameSite 配置 %s", s)
+	}
+}
+
+func WithCookieTransport(cfg CookieConfig) Option {
+	return func(h *RedisJWTHandler) {
+		h.transport = TransportCookie
+		h.cookie = cfg
+	}
+}
+
+// ExtractToken 根据约定，token 在 Authorization 头部
+// Bearer XXXX
+// cookie 模式下优先从 cookie 里取，取不到再看 Authorization，方便脚本之类的非浏览器客户端
+func (h *RedisJWTHandler) ExtractToken(ctx *gin.Context) string {
+	if h.transport == TransportCookie {
+		if token, err := ctx.Cookie(AccessTokenCookie); err == nil && token != "" {
+			return token
+		}
+	}
+	return extractBearer(ctx)
+}
+
+func (h *RedisJWTHandler) ExtractRefreshToken(ctx *gin.Context) string {
+	if h.transport == TransportCookie {
+		if token, err := ctx.Cookie(RefreshTokenCookie); err == nil && token != "" {
+			return token
+		}
+	}
+	return extractBearer(ctx)
+}
+
+func extractBearer(ctx *gin.Context) string {
+	authCode := ctx.GetHeader("Authorization")
+	if authCode == "" {
+		return authCode
+	}
+	segs := strings.Split(authCode, " ")
+	if len(segs) != 2 {
+		return ""
+	}
+	return segs[1]
+}
+
+func (h *RedisJWTHandler) writeAccessToken(ctx *gin.Context, token string, expiration time.Duration) {
+	if h.transport != TransportCookie {
+		ctx.Header("x-jwt-token", token)
+		return
+	}
+	h.setCookie(ctx, AccessTokenCookie, token, "/", expiration, true)
+}
+
+// writeRefreshToken cookie 模式下每次换 refresh token 的时候顺便换一个 CSRF token
+func (h *RedisJWTHandler) writeRefreshToken(ctx *gin.Context, token string) error {
+	if h.transport != TransportCookie {
+		ctx.Header("x-refresh-token", token)
+		return nil
+	}
+	h.setCookie(ctx, RefreshTokenCookie, token, refreshTokenPath, h.rcExpiration, true)
+
+	csrf, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+	// 前端和后端不同源的时候读不到后端域名下的 cookie，所以也放在响应头里
+	ctx.Header("x-csrf-token", csrf)
+	h.setCookie(ctx, CSRFCookie, csrf, "/", h.rcExpiration, false)
+	return nil
+}
+
+func (h *RedisJWTHandler) clearTransport(ctx *gin.Context) {
+	if h.transport != TransportCookie {
+		ctx.Header("x-jwt-token", "")
+		ctx.Header("x-refresh-token", "")
+		return
+	}
+	h.setCookie(ctx, AccessTokenCookie, "", "/", -1, true)
+	h.setCookie(ctx, RefreshTokenCookie, "", refreshTokenPath, -1, true)
+	h.setCookie(ctx, CSRFCookie, "", "/", -1, false)
+}
+
+// setCookie expiration 小于 0 表示删除 cookie
+func (h *RedisJWTHandler) setCookie(ctx *gin.Context, name, value, path string,
+	expiration time.Duration, httpOnly bool) {
+	maxAge := int(expiration.Seconds())
+	if expiration < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   h.cookie.Secure,
+		HttpOnly: httpOnly,
+		SameSite: h.cookie.SameSite,
+	})
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
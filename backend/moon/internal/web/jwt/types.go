@@ -1,11 +1,58 @@
 package jwt
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type Handler interface {
 	ClearToken(ctx *gin.Context) error
 	ExtractToken(ctx *gin.Context) string
+	// ExtractRefreshToken 刷新接口用来取 refresh token
+	ExtractRefreshToken(ctx *gin.Context) string
 	SetLoginToken(ctx *gin.Context, uid int64) error
 	SetJWTToken(ctx *gin.Context, uid int64, ssid string) error
+	// RotateTokens 用 refresh token 换一对新的 access token 和 refresh token
+	// 旧的 refresh token 被重复使用时，撤销整个会话并返回 ErrRefreshTokenReused
+	RotateTokens(ctx *gin.Context, rc RefreshClaims) error
 	CheckSession(ctx *gin.Context, ssid string) error
+	// CheckClient 按照配置的绑定策略校验 token 是否属于当前客户端，不匹配时返回 ErrClientMismatch
+	CheckClient(ctx *gin.Context, uc UserClaims) error
+	// AccessKeyFunc 根据 token header 里的 kid 选择校验 access token 的密钥
+	AccessKeyFunc() jwt.Keyfunc
+	// RefreshKeyFunc 根据 token header 里的 kid 选择校验 refresh token 的密钥
+	RefreshKeyFunc() jwt.Keyfunc
+
+	// ListSessions 列出用户所有还有效的会话
+	ListSessions(ctx context.Context, uid int64) ([]Session, error)
+	// LoginHistory 最近的登录记录，新的在前面
+	LoginHistory(ctx context.Context, uid int64) ([]LoginRecord, error)
+	// RevokeSession 撤销用户的某个会话，ssid 不属于该用户时返回 ErrSessionNotFound
+	RevokeSession(ctx context.Context, uid int64, ssid string) error
+	// RevokeAllSessions 撤销用户的所有会话，也就是在所有设备上退出登录
+	RevokeAllSessions(ctx context.Context, uid int64) error
+	// RevokeOtherSessions 撤销除了 ssid 之外的所有会话，比如修改密码之后
+	RevokeOtherSessions(ctx context.Context, uid int64, ssid string) error
+
+	// BlockUser 禁用用户，撤销所有会话并拒绝他的所有 token，直到 UnblockUser
+	BlockUser(ctx context.Context, uid int64) error
+	// BlockUserUntil 和 BlockUser 一样，until 之后自动解除
+	BlockUserUntil(ctx context.Context, uid int64, until time.Time) error
+	UnblockUser(ctx context.Context, uid int64) error
+	// CheckUser 用户被禁用时返回 ErrUserBlocked
+	CheckUser(ctx *gin.Context, uid int64) error
+}
+
+// RoleLoader 签发 access token 的时候加载用户当前的角色
+type RoleLoader interface {
+	Roles(ctx context.Context, uid int64) ([]string, error)
+}
+
+func WithRoleLoader(l RoleLoader) Option {
+	return func(h *RedisJWTHandler) {
+		h.roles = l
+	}
 }
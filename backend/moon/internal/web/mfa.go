@@ -0,0 +1,182 @@
+package web
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler 绑定、关闭 TOTP 两步验证，以及登录的第二步
+type MFAHandler struct {
+	ijwt.Handler
+	svc     service.UserService
+	mfaSvc  service.MFAService
+	lockout service.LoginLockoutService
+}
+
+func NewMFAHandler(svc service.UserService, mfaSvc service.MFAService,
+	lockout service.LoginLockoutService, hdl ijwt.Handler) *MFAHandler {
+	return &MFAHandler{
+		Handler: hdl,
+		svc:     svc,
+		mfaSvc:  mfaSvc,
+		lockout: lockout,
+	}
+}
+
+// beginMFA 开启了两步验证的账号，第一步通过之后只发 mfa token，验证码通过之后才发 token
+// 密码、短信验证码和第三方登录都要走这一步
+func beginMFA(ctx *gin.Context, mfaSvc service.MFAService, uid int64) (ginx.Result, error) {
+	challenge, err := mfaSvc.Begin(ctx, uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Code: errs.UserMFARequired,
+		Msg:  "请输入两步验证的验证码",
+		Data: MFARequiredResp{
+			MFAToken:  challenge.Token,
+			ExpiresIn: int64(challenge.ExpiresIn / time.Second),
+		},
+	}, nil
+}
+
+func (h *MFAHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	ug := server.Group("/users")
+	// 登录的第二步，身份由请求里的 mfa token 证明
+	public.Add(ug, http.MethodPost, "/login/mfa")
+	ug.POST("/login/mfa", ginx.WrapBody(h.Login))
+	mg := ug.Group("/mfa/totp", middleware.RequireSession())
+	mg.POST("/enroll", ginx.WrapClaims(h.Enroll))
+	mg.POST("/confirm", ginx.WrapBodyAndClaims(h.Confirm))
+	mg.DELETE("", ginx.WrapBodyAndClaims(h.Disable))
+}
+
+// Enroll 生成新的密钥，返回给验证器 App 扫的二维码
+func (h *MFAHandler) Enroll(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	res, err := h.mfaSvc.Enroll(ctx, uc.Uid)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "OK", Data: MFAEnrollResp{
+			Secret: res.Secret,
+			URI:    res.URI,
+			QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(res.QRCode),
+		}}, nil
+	case service.ErrMFAAlreadyEnabled:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "已经开启了两步验证，需要先关闭"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// Confirm 提交第一个验证码，通过之后两步验证才生效，返回恢复码
+func (h *MFAHandler) Confirm(ctx *gin.Context, req MFACodeReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	codes, err := h.mfaSvc.Confirm(ctx, uc.Uid, req.Code)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "两步验证已开启，请妥善保存恢复码，只会显示这一次", Data: codes}, nil
+	case service.ErrMFAAlreadyEnabled:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "已经开启了两步验证"}, nil
+	case service.ErrMFANotEnrolled:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "请先获取二维码"}, nil
+	case service.ErrInvalidMFACode:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证码不对"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// Disable 关闭两步验证，验证码或者恢复码都可以
+func (h *MFAHandler) Disable(ctx *gin.Context, req MFACodeReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	err := h.mfaSvc.Disable(ctx, uc.Uid, req.Code)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "两步验证已关闭"}, nil
+	case service.ErrMFANotEnabled:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "没有开启两步验证"}, nil
+	case service.ErrInvalidMFACode:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证码不对"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// Login 用密码登录返回的 mfa token 加上验证码完成登录
+// 验证码错误和密码错误记在同一个账号上，重新输密码拿新的 mfa token 也绕不过锁定
+func (h *MFAHandler) Login(ctx *gin.Context, req LoginMFAReq) (ginx.Result, error) {
+	uid, verifyErr := h.mfaSvc.Verify(ctx, req.MFAToken, req.Code)
+	switch verifyErr {
+	case nil, service.ErrInvalidMFACode:
+	case service.ErrInvalidMFAToken:
+		return ginx.Result{Code: errs.UserInvalidOrPassword, Msg: "登录已经过期，请重新登录"}, nil
+	case service.ErrMFATooManyAttempts:
+		return ginx.Result{Code: errs.UserCodeVerifyTooMany, Msg: "验证码错误次数太多，请重新登录"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, verifyErr
+	}
+	// 输密码之后的这几分钟里可能被禁用或者注销了
+	u, err := h.svc.FindById(ctx, uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	account, ip := lockoutAccount(u), ctx.ClientIP()
+	if verifyErr == service.ErrInvalidMFACode {
+		d, err := h.lockout.Fail(ctx, account, ip)
+		switch err {
+		case nil:
+		case service.ErrAccountLocked:
+			ginx.L.Warn("两步验证失败次数过多，已锁定",
+				logger.Int64("uid", u.Id),
+				logger.String("ip", ip),
+				logger.String("duration", d.String()))
+			return lockedResult(ctx, d), nil
+		default:
+			ginx.L.Error("记录登录失败次数失败", logger.Error(err))
+		}
+		return ginx.Result{Code: errs.UserInvalidOrPassword, Msg: "验证码不对"}, nil
+	}
+	// 锁定期间验证码对了也不行，不然还是能一直猜下去
+	d, err := h.lockout.Check(ctx, account, ip)
+	switch err {
+	case nil:
+	case service.ErrAccountLocked:
+		return lockedResult(ctx, d), nil
+	default:
+		// 和密码登录一样，Redis 出问题的时候降级为不限制
+		ginx.L.Error("检查登录锁定失败", logger.Error(err))
+	}
+	// 重新用密码登录的时候会走恢复账号的流程
+	if u.Deleted() {
+		return ginx.Result{Code: errs.UserInvalidOrPassword, Msg: "登录已经过期，请重新登录"}, nil
+	}
+	if u.Disabled() {
+		return ginx.Result{Code: errs.UserDisabled, Msg: "账号已被禁用"}, nil
+	}
+	if err = h.lockout.Succeed(ctx, account); err != nil {
+		ginx.L.Error("清空登录失败次数失败", logger.Error(err))
+	}
+	err = h.SetLoginToken(ctx, uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+// lockoutAccount 登录锁定按邮箱统计，短信和第三方登录注册的账号没有邮箱，按用户 ID 统计
+func lockoutAccount(u domain.User) string {
+	if u.Email != "" {
+		return u.Email
+	}
+	return "uid:" + strconv.FormatInt(u.Id, 10)
+}
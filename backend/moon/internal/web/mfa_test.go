@@ -0,0 +1,306 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/repository/cache"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMFAService struct {
+	mock.Mock
+}
+
+func (m *mockMFAService) Enroll(ctx context.Context, uid int64) (service.MFAEnrollment, error) {
+	args := m.Called(ctx, uid)
+	return args.Get(0).(service.MFAEnrollment), args.Error(1)
+}
+
+func (m *mockMFAService) Confirm(ctx context.Context, uid int64, code string) ([]string, error) {
+	args := m.Called(ctx, uid, code)
+	codes, _ := args.Get(0).([]string)
+	return codes, args.Error(1)
+}
+
+func (m *mockMFAService) Disable(ctx context.Context, uid int64, code string) error {
+	args := m.Called(ctx, uid, code)
+	return args.Error(0)
+}
+
+func (m *mockMFAService) Begin(ctx context.Context, uid int64) (service.MFAChallenge, error) {
+	args := m.Called(ctx, uid)
+	return args.Get(0).(service.MFAChallenge), args.Error(1)
+}
+
+func (m *mockMFAService) Verify(ctx context.Context, token, code string) (int64, error) {
+	args := m.Called(ctx, token, code)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func doMFARequest(t *testing.T, h *MFAHandler, method, path string, body any) ginx.Result {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user", ijwt.UserClaims{Uid: 1, Ssid: "current-ssid"})
+	})
+	h.RegisterRoutes(router, middleware.NewPublicRoutes())
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ginx.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestMFAHandler_Enroll(t *testing.T) {
+	mfaSvc := new(mockMFAService)
+	mfaSvc.On("Enroll", mock.Anything, int64(1)).Return(service.MFAEnrollment{
+		Secret: "SECRET",
+		URI:    "otpauth://totp/Moon:a@example.com?secret=SECRET",
+		QRCode: []byte{0x89, 'P', 'N', 'G'},
+	}, nil)
+	resp := doMFARequest(t, NewMFAHandler(new(mockUserService), mfaSvc, new(mockLockoutService), new(mockJWTHandler)),
+		http.MethodPost, "/users/mfa/totp/enroll", nil)
+	assert.Equal(t, map[string]any{
+		"secret":  "SECRET",
+		"uri":     "otpauth://totp/Moon:a@example.com?secret=SECRET",
+		"qr_code": "data:image/png;base64,iVBORw==",
+	}, resp.Data)
+}
+
+func TestMFAHandler_Confirm(t *testing.T) {
+	tests := []struct {
+		name     string
+		svcErr   error
+		wantCode int
+		wantMsg  string
+	}{
+		{name: "开启成功", wantMsg: "两步验证已开启，请妥善保存恢复码，只会显示这一次"},
+		{name: "验证码不对", svcErr: service.ErrInvalidMFACode, wantCode: errs.UserInvalidInput, wantMsg: "验证码不对"},
+		{name: "还没有获取二维码", svcErr: service.ErrMFANotEnrolled, wantCode: errs.UserInvalidInput, wantMsg: "请先获取二维码"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mfaSvc := new(mockMFAService)
+			var codes []string
+			if tt.svcErr == nil {
+				codes = []string{"abcde-fghjk"}
+			}
+			mfaSvc.On("Confirm", mock.Anything, int64(1), "123456").Return(codes, tt.svcErr)
+			resp := doMFARequest(t, NewMFAHandler(new(mockUserService), mfaSvc, new(mockLockoutService), new(mockJWTHandler)),
+				http.MethodPost, "/users/mfa/totp/confirm", MFACodeReq{Code: "123456"})
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			if tt.svcErr == nil {
+				assert.Equal(t, []any{"abcde-fghjk"}, resp.Data)
+			}
+		})
+	}
+}
+
+func TestMFAHandler_Login(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*mockUserService, *mockMFAService, *mockLockoutService, *mockJWTHandler)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "登录成功",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), nil)
+				u.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1, Email: "a@example.com"}, nil)
+				l.On("Check", mock.Anything, "a@example.com", mock.Anything).Return(time.Duration(0), nil)
+				// 验证码通过之后才清空失败次数
+				l.On("Succeed", mock.Anything, "a@example.com").Return(nil)
+				h.On("SetLoginToken", mock.Anything, int64(1)).Return(nil)
+			},
+			wantMsg: "OK",
+		},
+		{
+			name: "没有邮箱的账号按用户 ID 统计",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), nil)
+				u.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1, Phone: "+8613800138000"}, nil)
+				l.On("Check", mock.Anything, "uid:1", mock.Anything).Return(time.Duration(0), nil)
+				l.On("Succeed", mock.Anything, "uid:1").Return(nil)
+				h.On("SetLoginToken", mock.Anything, int64(1)).Return(nil)
+			},
+			wantMsg: "OK",
+		},
+		{
+			name: "验证码不对",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), service.ErrInvalidMFACode)
+				u.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1, Email: "a@example.com"}, nil)
+				l.On("Fail", mock.Anything, "a@example.com", mock.Anything).Return(time.Duration(0), nil)
+			},
+			wantCode: errs.UserInvalidOrPassword,
+			wantMsg:  "验证码不对",
+		},
+		{
+			name: "验证码错误次数过多触发锁定",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), service.ErrInvalidMFACode)
+				u.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1, Email: "a@example.com"}, nil)
+				l.On("Fail", mock.Anything, "a@example.com", mock.Anything).Return(time.Minute, service.ErrAccountLocked)
+			},
+			wantCode: errs.UserLocked,
+			wantMsg:  "登录失败次数过多，请稍后再试",
+		},
+		{
+			name: "锁定期间验证码对了也不行",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), nil)
+				u.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1, Email: "a@example.com"}, nil)
+				l.On("Check", mock.Anything, "a@example.com", mock.Anything).Return(time.Minute, service.ErrAccountLocked)
+			},
+			wantCode: errs.UserLocked,
+			wantMsg:  "登录失败次数过多，请稍后再试",
+		},
+		{
+			name: "错误次数太多",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(0), service.ErrMFATooManyAttempts)
+			},
+			wantCode: errs.UserCodeVerifyTooMany,
+			wantMsg:  "验证码错误次数太多，请重新登录",
+		},
+		{
+			name: "输完密码之后被禁用了",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), nil)
+				u.On("FindById", mock.Anything, int64(1)).
+					Return(domain.User{Id: 1, Status: domain.UserStatusDisabled}, nil)
+				l.On("Check", mock.Anything, "uid:1", mock.Anything).Return(time.Duration(0), nil)
+			},
+			wantCode: errs.UserDisabled,
+			wantMsg:  "账号已被禁用",
+		},
+		{
+			name: "输完密码之后注销了",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(1), nil)
+				u.On("FindById", mock.Anything, int64(1)).
+					Return(domain.User{Id: 1, Status: domain.UserStatusDeleted}, nil)
+				l.On("Check", mock.Anything, "uid:1", mock.Anything).Return(time.Duration(0), nil)
+			},
+			wantCode: errs.UserInvalidOrPassword,
+			wantMsg:  "登录已经过期，请重新登录",
+		},
+		{
+			name: "系统错误",
+			mockSetup: func(u *mockUserService, m *mockMFAService, l *mockLockoutService, h *mockJWTHandler) {
+				m.On("Verify", mock.Anything, "mfa-token", "123456").Return(int64(0), errors.New("redis down"))
+			},
+			wantCode: errs.UserInternalServerError,
+			wantMsg:  "系统错误",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userSvc := new(mockUserService)
+			mfaSvc := new(mockMFAService)
+			lockout := new(mockLockoutService)
+			hdl := new(mockJWTHandler)
+			tt.mockSetup(userSvc, mfaSvc, lockout, hdl)
+			h := NewMFAHandler(userSvc, mfaSvc, lockout, hdl)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			h.RegisterRoutes(router, middleware.NewPublicRoutes())
+			data, _ := json.Marshal(LoginMFAReq{MFAToken: "mfa-token", Code: "123456"})
+			req, _ := http.NewRequest(http.MethodPost, "/users/login/mfa", bytes.NewBuffer(data))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if tt.wantCode == errs.UserInternalServerError {
+				// 出错的时候 ginx 只打日志，不写响应
+				assert.Empty(t, w.Body.String())
+				return
+			}
+			var resp ginx.Result
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			userSvc.AssertExpectations(t)
+			lockout.AssertExpectations(t)
+			hdl.AssertExpectations(t)
+		})
+	}
+}
+
+// 知道密码的人每次重新输密码都能拿到新的 mfa token，验证码的失败次数不能因此清零
+func TestMFAHandler_LoginLockoutAcrossPasswordLogins(t *testing.T) {
+	mr := miniredis.RunT(t)
+	lockout := service.NewLoginLockoutService(
+		cache.NewLoginAttemptCache(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+		service.LockoutConfig{
+			Account: cache.LockoutPolicy{Threshold: 5, Window: time.Minute * 15,
+				BaseLock: time.Minute, MaxLock: time.Hour, ResetAfter: time.Hour * 24},
+			IP: cache.LockoutPolicy{Threshold: 50, Window: time.Minute * 15,
+				BaseLock: time.Minute, MaxLock: time.Hour, ResetAfter: time.Hour * 24},
+		})
+	u := domain.User{Id: 1, Email: "a@example.com", TOTP: domain.TOTPInfo{Enabled: true}}
+	userSvc := new(mockUserService)
+	userSvc.On("Login", mock.Anything, "a@example.com", "correct horse battery").Return(u, nil)
+	userSvc.On("FindById", mock.Anything, int64(1)).Return(u, nil)
+	mfaSvc := new(mockMFAService)
+	mfaSvc.On("Begin", mock.Anything, int64(1)).
+		Return(service.MFAChallenge{Token: "mfa-token", ExpiresIn: time.Minute * 5}, nil)
+	mfaSvc.On("Verify", mock.Anything, "mfa-token", "000000").Return(int64(1), service.ErrInvalidMFACode)
+	emailSvc := new(mockEmailVerificationService)
+	emailSvc.On("CheckLogin", mock.Anything).Return(nil)
+	hdl := new(mockJWTHandler)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewUserHandler(userSvc, new(mockCodeService), emailSvc, mfaSvc, new(mockAccountDeletionService), lockout,
+		newTestPasswordPolicy(), hdl).RegisterRoutes(router, middleware.NewPublicRoutes())
+	NewMFAHandler(userSvc, mfaSvc, lockout, hdl).RegisterRoutes(router, middleware.NewPublicRoutes())
+	post := func(path string, body any) ginx.Result {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp ginx.Result
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// 每次只猜一次验证码，然后重新输密码
+	for i := 0; i < 4; i++ {
+		resp := post("/users/login", LoginJWTReq{Email: "a@example.com", Password: "correct horse battery"})
+		require.Equal(t, errs.UserMFARequired, resp.Code)
+		resp = post("/users/login/mfa", LoginMFAReq{MFAToken: "mfa-token", Code: "000000"})
+		require.Equal(t, errs.UserInvalidOrPassword, resp.Code)
+	}
+	resp := post("/users/login", LoginJWTReq{Email: "a@example.com", Password: "correct horse battery"})
+	require.Equal(t, errs.UserMFARequired, resp.Code)
+	resp = post("/users/login/mfa", LoginMFAReq{MFAToken: "mfa-token", Code: "000000"})
+	assert.Equal(t, errs.UserLocked, resp.Code)
+	// 锁定之后密码对了也拿不到新的 mfa token
+	resp = post("/users/login", LoginJWTReq{Email: "a@example.com", Password: "correct horse battery"})
+	assert.Equal(t, errs.UserLocked, resp.Code)
+}
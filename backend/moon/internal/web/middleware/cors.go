@@ -2,29 +2,62 @@ package middleware
 
 import (
 	"log"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Cors() gin.HandlerFunc {
+// AnyOrigin 白名单里写这个表示允许任意来源，只能在 header 模式下用
+const AnyOrigin = "*"
+
+// CorsMiddlewareBuilder 只有白名单里的来源才能带着凭证跨域访问
+// cookie 模式下如果回显任意 Origin，任意网站都能带着 cookie 发请求，
+// 再从响应头里读到 CSRF token，double submit 就形同虚设了
+type CorsMiddlewareBuilder struct {
+	origins   map[string]struct{}
+	anyOrigin bool
+}
+
+func NewCorsMiddlewareBuilder(origins ...string) *CorsMiddlewareBuilder {
+	b := &CorsMiddlewareBuilder{origins: make(map[string]struct{}, len(origins))}
+	for _, o := range origins {
+		if o == AnyOrigin {
+			b.anyOrigin = true
+			continue
+		}
+		b.origins[o] = struct{}{}
+	}
+	return b
+}
+
+func (b *CorsMiddlewareBuilder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		origin := ctx.Request.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
+		// 响应内容和 Origin 有关，不能被缓存给别的来源
+		ctx.Writer.Header().Add("Vary", "Origin")
+		allowed := origin != "" && b.allowed(origin)
+		if allowed {
+			ctx.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Authorization, X-Requested-With, X-Client-Fingerprint, X-CSRF-Token")
+			ctx.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			ctx.Writer.Header().Set("Access-Control-Expose-Headers", "x-jwt-token, x-refresh-token, x-csrf-token, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
+		} else if origin != "" {
+			log.Printf("CORS: 拒绝来自 %s 的跨域请求 %s %s", origin, ctx.Request.Method, ctx.Request.URL.Path)
 		}
-		ctx.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Authorization, X-Requested-With")
-		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		ctx.Writer.Header().Set("Access-Control-Expose-Headers", "x-jwt-token, x-refresh-token")
-
-		if ctx.Request.Method == "OPTIONS" {
-			log.Printf("CORS: OPTIONS request to %s from %s", ctx.Request.URL.Path, origin)
-			ctx.AbortWithStatus(204)
+
+		if ctx.Request.Method == http.MethodOptions {
+			ctx.AbortWithStatus(http.StatusNoContent)
 			return
 		}
-
-		log.Printf("CORS: %s request to %s from %s", ctx.Request.Method, ctx.Request.URL.Path, origin)
 		ctx.Next()
 	}
 }
+
+func (b *CorsMiddlewareBuilder) allowed(origin string) bool {
+	if b.anyOrigin {
+		return true
+	}
+	_, ok := b.origins[origin]
+	return ok
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorsMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name       string
+		origins    []string
+		method     string
+		origin     string
+		wantOrigin string
+		wantCode   int
+	}{
+		{
+			name:       "白名单里的来源",
+			origins:    []string{"http://localhost:5173"},
+			method:     http.MethodPost,
+			origin:     "http://localhost:5173",
+			wantOrigin: "http://localhost:5173",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:     "不在白名单里的来源",
+			origins:  []string{"http://localhost:5173"},
+			method:   http.MethodPost,
+			origin:   "https://evil.example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "不在白名单里的预检请求",
+			origins:  []string{"http://localhost:5173"},
+			method:   http.MethodOptions,
+			origin:   "https://evil.example.com",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "没有配置白名单",
+			method:   http.MethodGet,
+			origin:   "http://localhost:5173",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "允许任意来源",
+			origins:    []string{AnyOrigin},
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			wantOrigin: "https://app.example.com",
+			wantCode:   http.StatusNoContent,
+		},
+		{
+			name:     "同源请求没有 Origin",
+			origins:  []string{"http://localhost:5173"},
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			server := gin.New()
+			server.Use(NewCorsMiddlewareBuilder(tc.origins...).Build())
+			server.Any("/users/profile", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(tc.method, "/users/profile", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			if tc.wantOrigin == "" {
+				// 拿不到 CSRF token
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+				assert.Empty(t, w.Header().Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ijwt "moon/internal/web/jwt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRFMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		cookies  map[string]string
+		header   string
+		wantCode int
+	}{
+		{
+			name:     "GET 请求不校验",
+			method:   http.MethodGet,
+			cookies:  map[string]string{ijwt.AccessTokenCookie: "token"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "没有登录 cookie 不校验",
+			method:   http.MethodPost,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "token 一致",
+			method: http.MethodPost,
+			cookies: map[string]string{
+				ijwt.AccessTokenCookie: "token",
+				ijwt.CSRFCookie:        "csrf",
+			},
+			header:   "csrf",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "token 不一致",
+			method: http.MethodPut,
+			cookies: map[string]string{
+				ijwt.AccessTokenCookie: "token",
+				ijwt.CSRFCookie:        "csrf",
+			},
+			header:   "other",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "缺少 CSRF cookie",
+			method:   http.MethodDelete,
+			cookies:  map[string]string{ijwt.RefreshTokenCookie: "token"},
+			header:   "csrf",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			server := gin.New()
+			server.Use(NewCSRFMiddlewareBuilder().Build())
+			server.Handle(tc.method, "/users/profile", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tc.method, "/users/profile", nil)
+			for name, val := range tc.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: val})
+			}
+			if tc.header != "" {
+				req.Header.Set(ijwt.CSRFHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
@@ -1,41 +1,70 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
+	"moon/internal/domain"
+	"moon/internal/errs"
 	ijwt "moon/internal/web/jwt"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenScheme 个人访问令牌用的 Authorization 方案，和 access token 的 Bearer 区分开
+// Authorization: Token moon_pat_XXXX
+const AccessTokenScheme = "Token"
+
+// AccessTokenAuthenticator 校验个人访问令牌，由 service.AccessTokenService 实现
+type AccessTokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (domain.AccessToken, error)
+	Touch(ctx context.Context, t domain.AccessToken) error
+}
+
 type LoginJWTMiddlewareBuilder struct {
 	ijwt.Handler
+	l      logger.LoggerV1
+	public *PublicRoutes
+	// tokens 为 nil 的时候不接受个人访问令牌
+	tokens AccessTokenAuthenticator
+	roles  ijwt.RoleLoader
 }
 
-func NewLoginJWTMiddlewareBuilder(hdl ijwt.Handler) *LoginJWTMiddlewareBuilder {
+func NewLoginJWTMiddlewareBuilder(hdl ijwt.Handler, l logger.LoggerV1,
+	public *PublicRoutes) *LoginJWTMiddlewareBuilder {
 	return &LoginJWTMiddlewareBuilder{
 		Handler: hdl,
+		l:       l,
+		public:  public,
 	}
 }
 
+// WithAccessTokens 接受个人访问令牌，令牌没有会话，角色在每次请求的时候用 roles 加载
+func (m *LoginJWTMiddlewareBuilder) WithAccessTokens(tokens AccessTokenAuthenticator,
+	roles ijwt.RoleLoader) *LoginJWTMiddlewareBuilder {
+	m.tokens = tokens
+	m.roles = roles
+	return m
+}
+
 func (m *LoginJWTMiddlewareBuilder) CheckLogin() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		path := ctx.Request.URL.Path
-		if path == "/users/signup" ||
-			path == "/users/login" ||
-			path == "/users/login_sms/code/send" ||
-			path == "/users/login_sms" ||
-			path == "/oauth2/wechat/authurl" ||
-			path == "/oauth2/wechat/callback" ||
-			path == "/health" {
+		// 公开路由由各个 handler 在 RegisterRoutes 里声明
+		if m.public.Match(ctx.Request.Method, ctx.Request.URL.Path) {
+			return
+		}
+		if scheme, token, ok := strings.Cut(ctx.GetHeader("Authorization"), " "); ok &&
+			scheme == AccessTokenScheme && m.tokens != nil {
+			m.checkAccessToken(ctx, token)
 			return
 		}
 		tokenStr := m.ExtractToken(ctx)
 		var uc ijwt.UserClaims
-		token, err := jwt.ParseWithClaims(tokenStr, &uc, func(token *jwt.Token) (interface{}, error) {
-			return ijwt.JWTKey, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenStr, &uc, m.AccessKeyFunc())
 		if err != nil {
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
@@ -51,6 +80,59 @@ func (m *LoginJWTMiddlewareBuilder) CheckLogin() gin.HandlerFunc {
 			return
 		}
 
+		err = m.CheckUser(ctx, uc.Uid)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		err = m.CheckClient(ctx, uc)
+		if err != nil {
+			// 安全事件，token 很可能被人拿到别的客户端上用了
+			m.l.Warn("安全事件：token 和客户端不匹配",
+				logger.String("event", "client_mismatch"),
+				logger.Int64("uid", uc.Uid),
+				logger.String("ssid", uc.Ssid),
+				logger.String("ip", ctx.ClientIP()),
+				logger.String("user_agent", ctx.GetHeader("User-Agent")),
+				logger.String("token_user_agent", uc.UserAgent))
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, ginx.Result{
+				Code: errs.UserClientMismatch,
+				Msg:  "登录环境发生变化，请重新登录",
+			})
+			return
+		}
+
 		ctx.Set("user", uc)
 	}
 }
+
+func (m *LoginJWTMiddlewareBuilder) checkAccessToken(ctx *gin.Context, token string) {
+	at, err := m.tokens.Authenticate(ctx, token)
+	if err != nil {
+		m.l.Warn("个人访问令牌校验失败", logger.Error(err), logger.String("ip", ctx.ClientIP()))
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	err = m.CheckUser(ctx, at.Uid)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	// 令牌的生命周期很长，角色每次都重新加载，收回的角色马上生效
+	roles, err := m.roles.Roles(ctx, at.Uid)
+	if err != nil {
+		m.l.Error("加载用户角色失败", logger.Error(err), logger.Int64("uid", at.Uid))
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err = m.tokens.Touch(ctx, at); err != nil {
+		m.l.Error("更新个人访问令牌使用时间失败", logger.Error(err), logger.Int64("token_id", at.Id))
+	}
+	ctx.Set("user", ijwt.UserClaims{
+		Uid:     at.Uid,
+		Roles:   roles,
+		TokenId: at.Id,
+		Scopes:  at.Scopes,
+	})
+}
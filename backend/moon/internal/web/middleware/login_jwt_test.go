@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moon/internal/domain"
+	ijwt "moon/internal/web/jwt"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubJWTHandler 个人访问令牌只用到 CheckUser，别的方法调用了就 panic
+type stubJWTHandler struct {
+	ijwt.Handler
+	blocked map[int64]bool
+}
+
+func (h *stubJWTHandler) CheckUser(ctx *gin.Context, uid int64) error {
+	if h.blocked[uid] {
+		return ijwt.ErrUserBlocked
+	}
+	return nil
+}
+
+type stubAccessTokens struct {
+	tokens  map[string]domain.AccessToken
+	touched []int64
+}
+
+func (s *stubAccessTokens) Authenticate(ctx context.Context, token string) (domain.AccessToken, error) {
+	if t, ok := s.tokens[token]; ok {
+		return t, nil
+	}
+	return domain.AccessToken{}, errors.New("令牌无效")
+}
+
+func (s *stubAccessTokens) Touch(ctx context.Context, t domain.AccessToken) error {
+	s.touched = append(s.touched, t.Id)
+	return nil
+}
+
+type stubRoles map[int64][]string
+
+func (s stubRoles) Roles(ctx context.Context, uid int64) ([]string, error) {
+	return s[uid], nil
+}
+
+// stubPermissionChecker 有角色就有所有权限
+type stubPermissionChecker struct{}
+
+func (stubPermissionChecker) HasPermission(ctx context.Context, roles []string, perm string) (bool, error) {
+	return len(roles) > 0, nil
+}
+
+func TestLoginJWTMiddleware_AccessToken(t *testing.T) {
+	tokens := &stubAccessTokens{tokens: map[string]domain.AccessToken{
+		"moon_pat_admin":   {Id: 1, Uid: 1, Scopes: []string{"user:*"}},
+		"moon_pat_noscope": {Id: 2, Uid: 1},
+		"moon_pat_other":   {Id: 4, Uid: 1, Scopes: []string{"order:read"}},
+		"moon_pat_blocked": {Id: 3, Uid: 2, Scopes: []string{"*"}},
+	}}
+	roles := stubRoles{1: {"admin"}, 2: {"admin"}}
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(NewLoginJWTMiddlewareBuilder(&stubJWTHandler{blocked: map[int64]bool{2: true}},
+		logger.NewNopLogger(), NewPublicRoutes()).WithAccessTokens(tokens, roles).CheckLogin())
+	server.GET("/profile", RequireScope("user:profile:read"), func(ctx *gin.Context) {
+		uc := ctx.MustGet("user").(ijwt.UserClaims)
+		assert.Equal(t, []string{"admin"}, uc.Roles)
+		assert.True(t, uc.ViaAccessToken())
+		ctx.Status(http.StatusOK)
+	})
+	perm := NewPermissionMiddlewareBuilder(stubPermissionChecker{}, logger.NewNopLogger())
+	server.GET("/admin", perm.RequirePermission("user:admin"), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	server.GET("/sessions", RequireSession(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name   string
+		auth   string
+		path   string
+		status int
+	}{
+		{name: "在 scope 范围内", auth: "Token moon_pat_admin", path: "/profile", status: http.StatusOK},
+		{name: "没有 scope 不能访问", auth: "Token moon_pat_noscope", path: "/profile", status: http.StatusForbidden},
+		{name: "scope 不相关", auth: "Token moon_pat_other", path: "/profile", status: http.StatusForbidden},
+		{name: "在权限范围内", auth: "Token moon_pat_admin", path: "/admin", status: http.StatusOK},
+		{name: "角色有权限，但是令牌没有", auth: "Token moon_pat_noscope", path: "/admin", status: http.StatusForbidden},
+		{name: "令牌不能访问会话接口", auth: "Token moon_pat_admin", path: "/sessions", status: http.StatusForbidden},
+		{name: "令牌不存在", auth: "Token moon_pat_unknown", path: "/profile", status: http.StatusUnauthorized},
+		{name: "用户被禁用", auth: "Token moon_pat_blocked", path: "/profile", status: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Authorization", tc.auth)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+	assert.Contains(t, tokens.touched, int64(1))
+}
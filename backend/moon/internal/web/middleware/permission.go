@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"moon/internal/domain"
+	ijwt "moon/internal/web/jwt"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionChecker 判定角色是否拥有权限，由 service.RBACService 实现
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, roles []string, perm string) (bool, error)
+}
+
+// PermissionMiddlewareBuilder 在登录校验之后使用，根据 UserClaims 里的角色判定权限
+type PermissionMiddlewareBuilder struct {
+	checker PermissionChecker
+	l       logger.LoggerV1
+}
+
+func NewPermissionMiddlewareBuilder(checker PermissionChecker, l logger.LoggerV1) *PermissionMiddlewareBuilder {
+	return &PermissionMiddlewareBuilder{
+		checker: checker,
+		l:       l,
+	}
+}
+
+// RequirePermission 要求当前用户拥有 perm 权限，比如
+// server.Group("/admin", b.RequirePermission("user:admin"))
+func (b *PermissionMiddlewareBuilder) RequirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, ok := ctx.Get("user")
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		uc, ok := val.(ijwt.UserClaims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		// 个人访问令牌还要在令牌自己的权限范围内
+		if uc.ViaAccessToken() && !domain.MatchPermission(uc.Scopes, perm) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		allowed, err := b.checker.HasPermission(ctx.Request.Context(), uc.Roles, perm)
+		if err != nil {
+			b.l.Error("权限校验失败", logger.Error(err),
+				logger.Int64("uid", uc.Uid), logger.String("permission", perm))
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+)
+
+// PublicRoutes 不需要登录的路由
+// handler 在 RegisterRoutes 的时候声明自己的哪些路由是公开的，
+// 额外的路由（比如静态资源）可以通过配置加进来
+type PublicRoutes struct {
+	mu     sync.RWMutex
+	routes []publicRoute
+}
+
+type publicRoute struct {
+	// method 为空表示所有方法
+	method string
+	segs   []string
+}
+
+func NewPublicRoutes() *PublicRoutes {
+	return &PublicRoutes{}
+}
+
+// Add 声明 group 下的路由不需要登录
+// method 为空表示所有方法，pattern 和 gin 的写法一样，支持 :param 和 *wildcard
+func (r *PublicRoutes) Add(group interface{ BasePath() string }, method, pattern string) *PublicRoutes {
+	return r.AddPath(method, joinPath(group.BasePath(), pattern))
+}
+
+// AddPath 和 Add 一样，只是 path 是完整路径
+func (r *PublicRoutes) AddPath(method, path string) *PublicRoutes {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, publicRoute{
+		method: strings.ToUpper(method),
+		segs:   splitPath(path),
+	})
+	return r
+}
+
+// Match 请求是否命中公开路由
+func (r *PublicRoutes) Match(method, path string) bool {
+	segs := splitPath(path)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, route := range r.routes {
+		if route.method != "" && route.method != method {
+			continue
+		}
+		if matchSegs(route.segs, segs) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegs(pattern, segs []string) bool {
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if segs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segs[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(segs)
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func joinPath(base, relative string) string {
+	if relative == "" {
+		return base
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(relative, "/")
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicRoutes_Match(t *testing.T) {
+	server := gin.New()
+	ug := server.Group("/users")
+	public := NewPublicRoutes().
+		Add(ug, http.MethodPost, "/login").
+		Add(ug, http.MethodGet, "/verify/:token").
+		Add(server, "", "/health").
+		AddPath(http.MethodGet, "/static/*filepath")
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "精确匹配", method: http.MethodPost, path: "/users/login", want: true},
+		{name: "方法不匹配", method: http.MethodGet, path: "/users/login", want: false},
+		{name: "末尾斜杠", method: http.MethodPost, path: "/users/login/", want: true},
+		{name: "路径参数", method: http.MethodGet, path: "/users/verify/abc", want: true},
+		{name: "路径参数不能为空", method: http.MethodGet, path: "/users/verify", want: false},
+		{name: "路径参数只匹配一段", method: http.MethodGet, path: "/users/verify/abc/def", want: false},
+		{name: "任意方法", method: http.MethodHead, path: "/health", want: true},
+		{name: "通配符", method: http.MethodGet, path: "/static/js/app.js", want: true},
+		{name: "前缀不算匹配", method: http.MethodPost, path: "/users/login/extra", want: false},
+		{name: "没有声明", method: http.MethodGet, path: "/users/profile", want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, public.Match(tc.method, tc.path))
+		})
+	}
+}
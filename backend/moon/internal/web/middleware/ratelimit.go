@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"moon/internal/errs"
+	ijwt "moon/internal/web/jwt"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitRule window 内最多 Limit 次请求
+type RateLimitRule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// KeyFunc 决定按什么限流，返回空字符串表示这个请求不限流
+type KeyFunc func(ctx *gin.Context) string
+
+// KeyByIP 按客户端 IP 限流
+func KeyByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// KeyByUser 按登录用户限流，没有登录的请求退化成按 IP 限流
+// 需要放在登录校验的中间件后面
+func KeyByUser(ctx *gin.Context) string {
+	if val, ok := ctx.Get("user"); ok {
+		if uc, ok := val.(ijwt.UserClaims); ok {
+			return "uid:" + strconv.FormatInt(uc.Uid, 10)
+		}
+	}
+	return KeyByIP(ctx)
+}
+
+// KeyByHeader 按某个请求头限流，比如 API key，没有这个头部的请求按 IP 限流
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *gin.Context) string {
+		if v := ctx.GetHeader(name); v != "" {
+			return "header:" + name + ":" + v
+		}
+		return KeyByIP(ctx)
+	}
+}
+
+// ParseKeyFunc 解析配置里的限流维度：ip、user 或者 header:<名字>
+func ParseKeyFunc(s string) (KeyFunc, error) {
+	switch {
+	case s == "" || s == "ip":
+		return KeyByIP, nil
+	case s == "user":
+		return KeyByUser, nil
+	case strings.HasPrefix(s, "header:") && len(s) > len("header:"):
+		return KeyByHeader(strings.TrimPrefix(s, "header:")), nil
+	default:
+		return nil, fmt.Errorf("未知的限流维度 %s", s)
+	}
+}
+
+type rateLimitRoute struct {
+	rule    RateLimitRule
+	keyFunc KeyFunc
+}
+
+// RateLimitMiddlewareBuilder 按路由限流
+// 路由用注册时的写法，比如 /users/:id，同一个路由的不同参数共用一个额度
+type RateLimitMiddlewareBuilder struct {
+	limiter Limiter
+	l       logger.LoggerV1
+	routes  map[string]rateLimitRoute
+}
+
+func NewRateLimitMiddlewareBuilder(limiter Limiter, l logger.LoggerV1) *RateLimitMiddlewareBuilder {
+	return &RateLimitMiddlewareBuilder{
+		limiter: limiter,
+		l:       l,
+		routes:  make(map[string]rateLimitRoute),
+	}
+}
+
+// Add 给 method + path 加上限流，keyFunc 为 nil 表示按 IP 限流
+func (b *RateLimitMiddlewareBuilder) Add(method, path string, rule RateLimitRule, keyFunc KeyFunc) *RateLimitMiddlewareBuilder {
+	if keyFunc == nil {
+		keyFunc = KeyByIP
+	}
+	b.routes[b.routeKey(strings.ToUpper(method), path)] = rateLimitRoute{
+		rule:    rule,
+		keyFunc: keyFunc,
+	}
+	return b
+}
+
+func (b *RateLimitMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// FullPath 是注册路由时的写法，没有命中路由的时候是空字符串
+		routeKey := b.routeKey(ctx.Request.Method, ctx.FullPath())
+		route, ok := b.routes[routeKey]
+		if !ok {
+			return
+		}
+		key := route.keyFunc(ctx)
+		if key == "" {
+			return
+		}
+		res, err := b.limiter.Limit(ctx.Request.Context(), routeKey+":"+key, route.rule)
+		if err != nil {
+			// 限流器出问题的时候放行，不能因为限流把整个接口搞挂
+			b.l.Error("限流失败", logger.Error(err), logger.String("route", routeKey))
+			return
+		}
+
+		h := ctx.Writer.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(route.rule.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ginx.Result{
+				Code: errs.TooManyRequests,
+				Msg:  "请求太频繁，请稍后再试",
+			})
+			return
+		}
+	}
+}
+
+func (b *RateLimitMiddlewareBuilder) routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// ceilSeconds 向上取整，避免告诉客户端 0 秒之后重试
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
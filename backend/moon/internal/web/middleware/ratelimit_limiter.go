@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiter 滑动窗口限流器
+type Limiter interface {
+	// Limit 判断 key 还能不能再请求一次，允许的话同时记下这次请求
+	Limit(ctx context.Context, key string, rule RateLimitRule) (LimitResult, error)
+}
+
+type LimitResult struct {
+	Allowed bool
+	// Remaining 这次请求之后窗口内还剩多少次
+	Remaining int
+	// Reset 多久之后窗口里最早的请求过期，也就是多久之后可以再请求
+	Reset time.Duration
+}
+
+// slidingWindowScript 用有序集合记录窗口内每次请求的时间
+// KEYS[1] 限流的 key，ARGV 依次是当前毫秒时间戳、窗口毫秒数、阈值、这次请求的唯一标识
+// 返回 {是否允许, 剩余次数, 多少毫秒后重置}
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local cnt = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if cnt < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	cnt = cnt + 1
+	allowed = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local reset = 0
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - cnt, reset}
+`)
+
+type RedisSlidingWindowLimiter struct {
+	cmd    redis.Cmdable
+	prefix string
+}
+
+func NewRedisSlidingWindowLimiter(cmd redis.Cmdable) *RedisSlidingWindowLimiter {
+	return &RedisSlidingWindowLimiter{
+		cmd:    cmd,
+		prefix: "ratelimit:",
+	}
+}
+
+func (l *RedisSlidingWindowLimiter) Limit(ctx context.Context, key string, rule RateLimitRule) (LimitResult, error) {
+	res, err := slidingWindowScript.Run(ctx, l.cmd, []string{l.prefix + key},
+		time.Now().UnixMilli(), rule.Window.Milliseconds(), rule.Limit, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return LimitResult{}, err
+	}
+	return LimitResult{
+		Allowed:   res[0] == 1,
+		Remaining: int(res[1]),
+		Reset:     time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+// MemorySlidingWindowLimiter 进程内的限流器，只适合单机部署或者测试
+type MemorySlidingWindowLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryWindow
+	// lastSweep 定期清理已经没有请求的 key，避免 map 无限增长
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryWindow struct {
+	// hits 按时间排好序
+	hits   []time.Time
+	window time.Duration
+}
+
+func NewMemorySlidingWindowLimiter() *MemorySlidingWindowLimiter {
+	return &MemorySlidingWindowLimiter{
+		entries: make(map[string]*memoryWindow),
+		now:     time.Now,
+	}
+}
+
+func (l *MemorySlidingWindowLimiter) Limit(ctx context.Context, key string, rule RateLimitRule) (LimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	w, ok := l.entries[key]
+	if !ok {
+		w = &memoryWindow{}
+		l.entries[key] = w
+	}
+	w.window = rule.Window
+	w.prune(now)
+	allowed := len(w.hits) < rule.Limit
+	if allowed {
+		w.hits = append(w.hits, now)
+	}
+
+	var reset time.Duration
+	if len(w.hits) > 0 {
+		reset = w.hits[0].Add(rule.Window).Sub(now)
+	}
+	return LimitResult{
+		Allowed:   allowed,
+		Remaining: rule.Limit - len(w.hits),
+		Reset:     reset,
+	}, nil
+}
+
+func (l *MemorySlidingWindowLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, w := range l.entries {
+		w.prune(now)
+		if len(w.hits) == 0 {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// prune 去掉已经滑出窗口的请求
+func (w *memoryWindow) prune(now time.Time) {
+	since := now.Add(-w.window)
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(since) {
+		i++
+	}
+	w.hits = w.hits[i:]
+}
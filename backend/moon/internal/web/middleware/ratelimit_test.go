@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"moon/pkg/logger"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddlewareBuilder_Build(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(NewRateLimitMiddlewareBuilder(NewMemorySlidingWindowLimiter(), logger.NewNopLogger()).
+		Add(http.MethodPost, "/users/login", RateLimitRule{Limit: 2, Window: time.Minute}, KeyByIP).
+		Add(http.MethodGet, "/users/:id", RateLimitRule{Limit: 1, Window: time.Minute}, KeyByHeader("X-Api-Key")).
+		Build())
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	server.POST("/users/login", ok)
+	server.GET("/users/:id", ok)
+	server.GET("/health", ok)
+
+	do := func(method, path, ip, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/users/login", "1.1.1.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+
+	w = do(http.MethodPost, "/users/login", "1.1.1.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = do(http.MethodPost, "/users/login", "1.1.1.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// 不同 IP 分开计数
+	w = do(http.MethodPost, "/users/login", "2.2.2.2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 同一个路由的不同参数共用额度，按 header 区分
+	w = do(http.MethodGet, "/users/1", "1.1.1.1", "key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do(http.MethodGet, "/users/2", "1.1.1.1", "key-a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	w = do(http.MethodGet, "/users/2", "1.1.1.1", "key-b")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 没有配置的路由不限流
+	for i := 0; i < 3; i++ {
+		w = do(http.MethodGet, "/health", "1.1.1.1", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	}
+}
+
+type errLimiter struct{}
+
+func (errLimiter) Limit(ctx context.Context, key string, rule RateLimitRule) (LimitResult, error) {
+	return LimitResult{}, errors.New("redis 挂了")
+}
+
+func TestRateLimitMiddlewareBuilder_LimiterError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(NewRateLimitMiddlewareBuilder(errLimiter{}, logger.NewNopLogger()).
+		Add(http.MethodPost, "/users/login", RateLimitRule{Limit: 1, Window: time.Minute}, nil).
+		Build())
+	server.POST("/users/login", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/login", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	testCases := []struct {
+		name    string
+		limiter Limiter
+	}{
+		{
+			name:    "redis",
+			limiter: NewRedisSlidingWindowLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+		},
+		{
+			name:    "memory",
+			limiter: NewMemorySlidingWindowLimiter(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			rule := RateLimitRule{Limit: 3, Window: time.Millisecond * 200}
+			for i := 0; i < 3; i++ {
+				res, err := tc.limiter.Limit(ctx, "k", rule)
+				require.NoError(t, err)
+				assert.True(t, res.Allowed)
+				assert.Equal(t, 2-i, res.Remaining)
+			}
+			res, err := tc.limiter.Limit(ctx, "k", rule)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+			assert.True(t, res.Reset > 0 && res.Reset <= rule.Window)
+
+			// 其他 key 不受影响
+			res, err = tc.limiter.Limit(ctx, "other", rule)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+
+			// 窗口滑过去之后恢复
+			time.Sleep(rule.Window + time.Millisecond*20)
+			res, err = tc.limiter.Limit(ctx, "k", rule)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 2, res.Remaining)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"moon/internal/domain"
+	ijwt "moon/internal/web/jwt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireSession 只允许登录会话访问，个人访问令牌不行
+// 用在管理令牌、修改密码、两步验证这些敏感的接口上，免得泄露的令牌被用来扩大权限
+func RequireSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, _ := ctx.Get("user")
+		uc, ok := val.(ijwt.UserClaims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if uc.ViaAccessToken() {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+}
+
+// RequireScope 个人访问令牌的 scopes 里要有 scope 才能访问，登录会话不受限制
+// 令牌能访问的接口都要加上这个或者 RequirePermission，不然令牌的 scopes 就形同虚设
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, _ := ctx.Get("user")
+		uc, ok := val.(ijwt.UserClaims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if uc.ViaAccessToken() && !domain.MatchPermission(uc.Scopes, scope) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+
+	"moon/internal/errs"
+	"moon/internal/service"
+	"moon/internal/service/oauth2/oidc"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const oidcStateCookie = "oidc-state"
+
+type OIDCHandler struct {
+	ijwt.Handler
+	providers   map[string]*oidc.Provider
+	identitySvc service.ExternalIdentityService
+	mfaSvc      service.MFAService
+	deletionSvc service.AccountDeletionService
+	// stateKey 签名 state cookie 的密钥，和 access token 的密钥分开
+	stateKey     []byte
+	cookieSecure bool
+}
+
+func NewOIDCHandler(providers []*oidc.Provider, identitySvc service.ExternalIdentityService,
+	mfaSvc service.MFAService, deletionSvc service.AccountDeletionService,
+	hdl ijwt.Handler, stateKey []byte, cookieSecure bool) *OIDCHandler {
+	m := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		m[p.Name()] = p
+	}
+	return &OIDCHandler{
+		Handler:      hdl,
+		providers:    m,
+		identitySvc:  identitySvc,
+		mfaSvc:       mfaSvc,
+		deletionSvc:  deletionSvc,
+		stateKey:     stateKey,
+		cookieSecure: cookieSecure,
+	}
+}
+
+func (h *OIDCHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	g := server.Group("/oauth2/oidc")
+	public.Add(g, http.MethodGet, "/:provider/authurl").
+		Add(g, http.MethodGet, "/:provider/callback")
+	g.GET("/:provider/authurl", ginx.Wrap(h.AuthURL))
+	g.GET("/:provider/callback", ginx.Wrap(h.Callback))
+}
+
+// AuthURL state、nonce 和 PKCE 的 verifier 都签名之后放在 cookie 里，回调的时候取出来
+func (h *OIDCHandler) AuthURL(ctx *gin.Context) (ginx.Result, error) {
+	p, ok := h.providers[ctx.Param("provider")]
+	if !ok {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "不支持的登录方式"}, nil
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	sc := OIDCStateClaims{
+		Provider: p.Name(),
+		State:    uuid.NewString(),
+		Nonce:    nonce,
+		Verifier: verifier,
+	}
+	authURL, err := p.AuthURL(ctx, sc.State, sc.Nonce, sc.Verifier)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "构造登录 URL 失败"}, err
+	}
+	if err = h.setStateCookie(ctx, sc); err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: authURL}, nil
+}
+
+func (h *OIDCHandler) Callback(ctx *gin.Context) (ginx.Result, error) {
+	p, ok := h.providers[ctx.Param("provider")]
+	if !ok {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "不支持的登录方式"}, nil
+	}
+	sc, err := h.verifyState(ctx, p.Name())
+	// state 只能用一次
+	h.clearStateCookie(ctx, p.Name())
+	if err != nil {
+		ginx.L.Warn("OIDC 登录 state 校验失败", logger.Error(err),
+			logger.String("provider", p.Name()), logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "登录失败，请重试"}, nil
+	}
+	if e := ctx.Query("error"); e != "" {
+		// 用户在 IdP 那边点了拒绝之类的
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "登录失败，请重试"}, nil
+	}
+
+	ei, err := p.Exchange(ctx, ctx.Query("code"), sc.Verifier, sc.Nonce)
+	if err != nil {
+		ginx.L.Warn("OIDC 换取 id token 失败", logger.Error(err),
+			logger.String("provider", p.Name()), logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "登录失败，请重试"}, nil
+	}
+	u, err := h.identitySvc.FindOrCreateUser(ctx, ei, p.LinkByEmail())
+	switch err {
+	case nil:
+	// 注销之后第三方账号还绑定在原来的用户上，彻底删除之前不能用它登录，
+	// IdP 已经证明了身份，和密码登录一样可以恢复
+	case service.ErrUserPendingDeletion:
+		return beginOAuth2Restore(h.deletionSvc, u)
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if u.Disabled() {
+		return ginx.Result{Code: errs.UserDisabled, Msg: "账号已被禁用"}, nil
+	}
+	// 第三方账号被盗不应该绕过两步验证
+	if u.TOTP.Enabled {
+		return beginMFA(ctx, h.mfaSvc, u.Id)
+	}
+	err = h.SetLoginToken(ctx, u.Id)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+type OIDCStateClaims struct {
+	jwt.RegisteredClaims
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func oidcCallbackPath(provider string) string {
+	return "/oauth2/oidc/" + provider + "/callback"
+}
+
+func (h *OIDCHandler) setStateCookie(ctx *gin.Context, sc OIDCStateClaims) error {
+	// 给用户十分钟在 IdP 那边登录
+	sc.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute * 10))
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS512, sc).SignedString(h.stateKey)
+	if err != nil {
+		return err
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, tokenStr, 600, oidcCallbackPath(sc.Provider), "", h.cookieSecure, true)
+	return nil
+}
+
+func (h *OIDCHandler) clearStateCookie(ctx *gin.Context, provider string) {
+	ctx.SetCookie(oidcStateCookie, "", -1, oidcCallbackPath(provider), "", h.cookieSecure, true)
+}
+
+func (h *OIDCHandler) verifyState(ctx *gin.Context, provider string) (OIDCStateClaims, error) {
+	state := ctx.Query("state")
+	cookie, err := ctx.Cookie(oidcStateCookie)
+	if err != nil {
+		return OIDCStateClaims{}, fmt.Errorf("拿不到 state 的 cookie %w", err)
+	}
+	var sc OIDCStateClaims
+	token, err := jwt.ParseWithClaims(cookie, &sc, func(token *jwt.Token) (any, error) {
+		return h.stateKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	if err != nil || !token.Valid {
+		return OIDCStateClaims{}, fmt.Errorf("state cookie 不合法 %w", err)
+	}
+	if sc.Provider != provider {
+		return OIDCStateClaims{}, errStateMismatch
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(sc.State), []byte(state)) != 1 {
+		return OIDCStateClaims{}, errStateMismatch
+	}
+	return sc, nil
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+	"moon/pkg/passwordx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordHandler 修改密码、忘记密码和重置密码
+type PasswordHandler struct {
+	ijwt.Handler
+	passwordPolicy *passwordx.Policy
+	svc            service.UserService
+	resetSvc       service.PasswordResetService
+}
+
+func NewPasswordHandler(svc service.UserService, resetSvc service.PasswordResetService,
+	passwordPolicy *passwordx.Policy, hdl ijwt.Handler) *PasswordHandler {
+	return &PasswordHandler{
+		Handler:        hdl,
+		passwordPolicy: passwordPolicy,
+		svc:            svc,
+		resetSvc:       resetSvc,
+	}
+}
+
+func (h *PasswordHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	g := server.Group("/users/password")
+	public.Add(g, http.MethodPost, "/forgot").
+		Add(g, http.MethodPost, "/reset")
+	g.PUT("", middleware.RequireSession(), ginx.WrapBodyAndClaims(h.Change))
+	g.POST("/forgot", ginx.WrapBody(h.Forgot))
+	g.POST("/reset", ginx.WrapBody(h.Reset))
+}
+
+// Change 修改密码，当前会话保留，其他设备都要重新登录
+func (h *PasswordHandler) Change(ctx *gin.Context, req ChangePasswordReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if req.NewPassword != req.ConfirmPassword {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "两次输入的密码不相等"}, nil
+	}
+	if req.NewPassword == req.OldPassword {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "新密码不能和原密码一样"}, nil
+	}
+	u, err := h.svc.FindById(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if res, ok := checkPasswordPolicy(h.passwordPolicy, req.NewPassword, passwordUserInputs(u)...); !ok {
+		return res, nil
+	}
+
+	err = h.svc.ChangePassword(ctx, uc.Uid, req.OldPassword, req.NewPassword)
+	switch err {
+	case nil:
+	case service.ErrInvalidUserOrPassword:
+		return ginx.Result{Code: errs.UserInvalidOrPassword, Msg: "原密码不对"}, nil
+	case service.ErrPasswordNotSet:
+		return ginx.Result{Code: errs.UserPasswordNotSet, Msg: "账号没有设置密码，不能修改"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	err = h.RevokeOtherSessions(ctx, uc.Uid, uc.Ssid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "密码已修改，其他设备需要重新登录"}, nil
+}
+
+// Forgot 不管邮箱存不存在都返回一样的结果
+func (h *PasswordHandler) Forgot(ctx *gin.Context, req ForgotPasswordReq) (ginx.Result, error) {
+	// 在后台发邮件，不然邮箱不存在的请求明显更快，还是能通过响应时间探测账号
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		err := h.resetSvc.Forgot(ctx, req.Email)
+		if err != nil && err != service.ErrUserNotFound {
+			ginx.L.Error("发送重置密码邮件失败", logger.Error(err), logger.String("email", req.Email))
+		}
+	}()
+	return ginx.Result{Msg: "如果这个邮箱已经注册，重置密码的邮件已经发出"}, nil
+}
+
+func (h *PasswordHandler) Reset(ctx *gin.Context, req ResetPasswordReq) (ginx.Result, error) {
+	if req.Password != req.ConfirmPassword {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "两次输入的密码不相等"}, nil
+	}
+	// 先看看 token 是谁的，密码不符合要求的时候不消耗 token
+	u, err := h.resetSvc.Peek(ctx, req.Token)
+	switch err {
+	case nil:
+	case service.ErrInvalidResetToken:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "链接无效或者已经过期，请重新申请"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if res, ok := checkPasswordPolicy(h.passwordPolicy, req.Password, passwordUserInputs(u)...); !ok {
+		return res, nil
+	}
+
+	uid, err := h.resetSvc.Reset(ctx, req.Token, req.Password)
+	switch err {
+	case nil:
+	case service.ErrInvalidResetToken:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "链接无效或者已经过期，请重新申请"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	// 密码可能就是因为泄露了才重置的，所有设备都要重新登录
+	err = h.RevokeAllSessions(ctx, uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError,
+			Msg: "密码已重置，但是退出其他设备失败，请登录后在会话管理里手动退出"}, err
+	}
+	return ginx.Result{Msg: "密码已重置，请重新登录"}, nil
+}
+
+// passwordUserInputs 和注册的时候一样，邮箱前缀和昵称不能出现在密码里
+func passwordUserInputs(u domain.User) []string {
+	return []string{strings.Split(u.Email, "@")[0], u.Nickname}
+}
+
+// checkPasswordPolicy 注册、修改和重置密码用同一套密码规则，不通过的时候告诉前端原因
+func checkPasswordPolicy(policy *passwordx.Policy, password string, userInputs ...string) (ginx.Result, bool) {
+	err := policy.Check(password, userInputs...)
+	if err == nil {
+		return ginx.Result{}, true
+	}
+	var pe *passwordx.PolicyError
+	if !errors.As(err, &pe) {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: err.Error()}, false
+	}
+	return ginx.Result{
+		Code: errs.UserInvalidInput,
+		Msg:  pe.Msg,
+		Data: PasswordRejectedResp{Reason: pe.Reason},
+	}, false
+}
@@ -0,0 +1,252 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/passwordx"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPasswordResetService struct {
+	mock.Mock
+}
+
+func (m *mockPasswordResetService) Forgot(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *mockPasswordResetService) Peek(ctx context.Context, token string) (domain.User, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(domain.User), args.Error(1)
+}
+
+func (m *mockPasswordResetService) Reset(ctx context.Context, token, password string) (int64, error) {
+	args := m.Called(ctx, token, password)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func doPasswordRequest(t *testing.T, h *PasswordHandler, method, path string, body any) ginx.Result {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user", ijwt.UserClaims{Uid: 1, Ssid: "current-ssid"})
+	})
+	h.RegisterRoutes(router, middleware.NewPublicRoutes())
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ginx.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+// newTestPasswordPolicy 和默认配置一样，常见密码列表只放几个
+func newTestPasswordPolicy() *passwordx.Policy {
+	return passwordx.NewPolicy(passwordx.PolicyConfig{MinLength: 8, MaxLength: 64, MinEntropy: 40},
+		[]string{"password", "qwerty", "123456"})
+}
+
+func TestPasswordHandler_Forgot(t *testing.T) {
+	for _, svcErr := range []error{nil, service.ErrUserNotFound} {
+		svc := new(mockPasswordResetService)
+		done := make(chan struct{})
+		svc.On("Forgot", mock.Anything, "a@example.com").Return(svcErr).
+			Run(func(args mock.Arguments) { close(done) })
+		resp := doPasswordRequest(t, NewPasswordHandler(new(mockUserService), svc, newTestPasswordPolicy(), new(mockJWTHandler)),
+			http.MethodPost, "/users/password/forgot", ForgotPasswordReq{Email: "a@example.com"})
+		// 邮箱存不存在返回的结果一样
+		assert.Equal(t, 0, resp.Code)
+		assert.Equal(t, "如果这个邮箱已经注册，重置密码的邮件已经发出", resp.Msg)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("没有发送重置邮件")
+		}
+	}
+}
+
+func TestPasswordHandler_Reset(t *testing.T) {
+	resetUser := domain.User{Id: 1, Email: "alice@example.com", Nickname: "xiaoming"}
+	tests := []struct {
+		name      string
+		req       ResetPasswordReq
+		mockSetup func(*mockPasswordResetService, *mockJWTHandler)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "重置成功，撤销所有会话",
+			req:  ResetPasswordReq{Token: "1.abc", Password: "correct horse battery", ConfirmPassword: "correct horse battery"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {
+				s.On("Peek", mock.Anything, "1.abc").Return(resetUser, nil)
+				s.On("Reset", mock.Anything, "1.abc", "correct horse battery").Return(int64(1), nil)
+				h.On("RevokeAllSessions", mock.Anything, int64(1)).Return(nil)
+			},
+			wantMsg: "密码已重置，请重新登录",
+		},
+		{
+			name:      "两次密码不一样",
+			req:       ResetPasswordReq{Token: "1.abc", Password: "Password123!", ConfirmPassword: "Password1234!"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {},
+			wantCode:  errs.UserInvalidInput,
+			wantMsg:   "两次输入的密码不相等",
+		},
+		{
+			name: "密码太简单的时候不消耗 token",
+			req:  ResetPasswordReq{Token: "1.abc", Password: "simple", ConfirmPassword: "simple"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {
+				s.On("Peek", mock.Anything, "1.abc").Return(resetUser, nil)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "密码至少 8 位",
+		},
+		{
+			name: "常见密码的简单变形",
+			req:  ResetPasswordReq{Token: "1.abc", Password: "P@ssw0rd2024!", ConfirmPassword: "P@ssw0rd2024!"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {
+				s.On("Peek", mock.Anything, "1.abc").Return(resetUser, nil)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "这个密码太常见了，很容易被猜到，请换一个",
+		},
+		{
+			name: "密码包含 token 对应用户的昵称",
+			req:  ResetPasswordReq{Token: "1.abc", Password: "xiaoming horse battery", ConfirmPassword: "xiaoming horse battery"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {
+				s.On("Peek", mock.Anything, "1.abc").Return(resetUser, nil)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "密码不能包含邮箱、昵称这些个人信息",
+		},
+		{
+			name: "token 无效",
+			req:  ResetPasswordReq{Token: "1.abc", Password: "correct horse battery", ConfirmPassword: "correct horse battery"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {
+				s.On("Peek", mock.Anything, "1.abc").Return(domain.User{}, service.ErrInvalidResetToken)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "链接无效或者已经过期，请重新申请",
+		},
+		{
+			name: "检查完密码之后 token 被用掉了",
+			req:  ResetPasswordReq{Token: "1.abc", Password: "correct horse battery", ConfirmPassword: "correct horse battery"},
+			mockSetup: func(s *mockPasswordResetService, h *mockJWTHandler) {
+				s.On("Peek", mock.Anything, "1.abc").Return(resetUser, nil)
+				s.On("Reset", mock.Anything, "1.abc", "correct horse battery").Return(int64(0), service.ErrInvalidResetToken)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "链接无效或者已经过期，请重新申请",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockPasswordResetService)
+			hdl := new(mockJWTHandler)
+			tt.mockSetup(svc, hdl)
+			resp := doPasswordRequest(t, NewPasswordHandler(new(mockUserService), svc, newTestPasswordPolicy(), hdl), http.MethodPost, "/users/password/reset", tt.req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			svc.AssertExpectations(t)
+			hdl.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPasswordHandler_Change(t *testing.T) {
+	u := domain.User{Id: 1, Email: "alice@example.com", Nickname: "xiaoming"}
+	tests := []struct {
+		name      string
+		req       ChangePasswordReq
+		mockSetup func(*mockUserService, *mockJWTHandler)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "修改成功，只保留当前会话",
+			req:  ChangePasswordReq{OldPassword: "Password123!", NewPassword: "NewPassword123!", ConfirmPassword: "NewPassword123!"},
+			mockSetup: func(s *mockUserService, h *mockJWTHandler) {
+				s.On("FindById", mock.Anything, int64(1)).Return(u, nil)
+				s.On("ChangePassword", mock.Anything, int64(1), "Password123!", "NewPassword123!").Return(nil)
+				h.On("RevokeOtherSessions", mock.Anything, int64(1), "current-ssid").Return(nil)
+			},
+			wantMsg: "密码已修改，其他设备需要重新登录",
+		},
+		{
+			name: "原密码不对",
+			req:  ChangePasswordReq{OldPassword: "Wrong123!", NewPassword: "NewPassword123!", ConfirmPassword: "NewPassword123!"},
+			mockSetup: func(s *mockUserService, h *mockJWTHandler) {
+				s.On("FindById", mock.Anything, int64(1)).Return(u, nil)
+				s.On("ChangePassword", mock.Anything, int64(1), "Wrong123!", "NewPassword123!").Return(service.ErrInvalidUserOrPassword)
+			},
+			wantCode: errs.UserInvalidOrPassword,
+			wantMsg:  "原密码不对",
+		},
+		{
+			name: "账号没有设置密码",
+			req:  ChangePasswordReq{OldPassword: "Wrong123!", NewPassword: "NewPassword123!", ConfirmPassword: "NewPassword123!"},
+			mockSetup: func(s *mockUserService, h *mockJWTHandler) {
+				s.On("FindById", mock.Anything, int64(1)).Return(u, nil)
+				s.On("ChangePassword", mock.Anything, int64(1), "Wrong123!", "NewPassword123!").Return(service.ErrPasswordNotSet)
+			},
+			wantCode: errs.UserPasswordNotSet,
+			wantMsg:  "账号没有设置密码，不能修改",
+		},
+		{
+			name: "新密码太简单",
+			req:  ChangePasswordReq{OldPassword: "Password123!", NewPassword: "simple", ConfirmPassword: "simple"},
+			mockSetup: func(s *mockUserService, h *mockJWTHandler) {
+				s.On("FindById", mock.Anything, int64(1)).Return(u, nil)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "密码至少 8 位",
+		},
+		{
+			name: "新密码包含邮箱前缀",
+			req:  ChangePasswordReq{OldPassword: "Password123!", NewPassword: "Alice horse battery", ConfirmPassword: "Alice horse battery"},
+			mockSetup: func(s *mockUserService, h *mockJWTHandler) {
+				s.On("FindById", mock.Anything, int64(1)).Return(u, nil)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "密码不能包含邮箱、昵称这些个人信息",
+		},
+		{
+			name:      "新密码和原密码一样",
+			req:       ChangePasswordReq{OldPassword: "Password123!", NewPassword: "Password123!", ConfirmPassword: "Password123!"},
+			mockSetup: func(s *mockUserService, h *mockJWTHandler) {},
+			wantCode:  errs.UserInvalidInput,
+			wantMsg:   "新密码不能和原密码一样",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockUserService)
+			hdl := new(mockJWTHandler)
+			tt.mockSetup(svc, hdl)
+			resp := doPasswordRequest(t, NewPasswordHandler(svc, new(mockPasswordResetService), newTestPasswordPolicy(), hdl),
+				http.MethodPut, "/users/password", tt.req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			svc.AssertExpectations(t)
+			hdl.AssertExpectations(t)
+		})
+	}
+}
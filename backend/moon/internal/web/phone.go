@@ -0,0 +1,108 @@
+package web
+
+import (
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+	"moon/pkg/phonex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PhoneHandler 绑定和解绑手机号，都要验证短信验证码，只有登录会话能用
+type PhoneHandler struct {
+	svc service.PhoneService
+}
+
+func NewPhoneHandler(svc service.PhoneService) *PhoneHandler {
+	return &PhoneHandler{svc: svc}
+}
+
+func (h *PhoneHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	g := server.Group("/users/phone", middleware.RequireSession())
+	g.POST("/code", ginx.WrapBodyAndClaims(h.SendBindCode))
+	g.PUT("", ginx.WrapBodyAndClaims(h.Bind))
+	g.POST("/unbind/code", ginx.WrapClaims(h.SendUnbindCode))
+	g.DELETE("", ginx.WrapBodyAndClaims(h.Unbind))
+}
+
+func (h *PhoneHandler) SendBindCode(ctx *gin.Context, req SendSMSCodeReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	phone, err := phonex.Normalize(req.Phone, defaultCountryCode)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "手机号码格式不对"}, nil
+	}
+	err = h.svc.SendBindCode(ctx, uc.Uid, phone)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "发送成功"}, nil
+	case service.ErrSamePhone:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "已经绑定了这个手机号"}, nil
+	case service.ErrDuplicatePhone:
+		return ginx.Result{Code: errs.UserDuplicatePhone, Msg: "手机号已经被别的账号绑定了"}, nil
+	case service.ErrCodeSendTooMany:
+		return ginx.Result{Code: errs.UserCodeSendTooMany, Msg: "短信发送太频繁，请稍后再试"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// Bind 已经绑定过的直接换成新的号码
+func (h *PhoneHandler) Bind(ctx *gin.Context, req BindPhoneReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	phone, err := phonex.Normalize(req.Phone, defaultCountryCode)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "手机号码格式不对"}, nil
+	}
+	err = h.svc.Bind(ctx, uc.Uid, phone, req.Code)
+	switch err {
+	case nil:
+		ginx.L.Info("用户绑定了手机号", logger.Int64("uid", uc.Uid), logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Msg: "绑定成功"}, nil
+	case service.ErrInvalidCode:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证码有误"}, nil
+	case service.ErrCodeVerifyTooMany:
+		return ginx.Result{Code: errs.UserCodeVerifyTooMany, Msg: "验证次数太多，请重新获取验证码"}, nil
+	case service.ErrDuplicatePhone:
+		return ginx.Result{Code: errs.UserDuplicatePhone, Msg: "手机号已经被别的账号绑定了"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// SendUnbindCode 验证码发到当前绑定的手机号
+func (h *PhoneHandler) SendUnbindCode(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	phone, err := h.svc.SendUnbindCode(ctx, uc.Uid)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "发送成功", Data: SendUnbindPhoneCodeResp{Phone: phonex.Mask(phone)}}, nil
+	case service.ErrPhoneNotBound:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "还没有绑定手机号"}, nil
+	case service.ErrPhoneRequired:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "手机号是唯一的登录方式，不能解绑，可以直接换绑"}, nil
+	case service.ErrCodeSendTooMany:
+		return ginx.Result{Code: errs.UserCodeSendTooMany, Msg: "短信发送太频繁，请稍后再试"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *PhoneHandler) Unbind(ctx *gin.Context, req UnbindPhoneReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	err := h.svc.Unbind(ctx, uc.Uid, req.Code)
+	switch err {
+	case nil:
+		ginx.L.Info("用户解绑了手机号", logger.Int64("uid", uc.Uid), logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Msg: "解绑成功"}, nil
+	case service.ErrInvalidCode:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证码有误"}, nil
+	case service.ErrCodeVerifyTooMany:
+		return ginx.Result{Code: errs.UserCodeVerifyTooMany, Msg: "验证次数太多，请重新获取验证码"}, nil
+	case service.ErrPhoneNotBound:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "还没有绑定手机号"}, nil
+	case service.ErrPhoneRequired:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "手机号是唯一的登录方式，不能解绑，可以直接换绑"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moon/internal/errs"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPhoneService struct {
+	mock.Mock
+}
+
+func (m *mockPhoneService) SendBindCode(ctx context.Context, uid int64, phone string) error {
+	return m.Called(ctx, uid, phone).Error(0)
+}
+
+func (m *mockPhoneService) Bind(ctx context.Context, uid int64, phone, code string) error {
+	return m.Called(ctx, uid, phone, code).Error(0)
+}
+
+func (m *mockPhoneService) SendUnbindCode(ctx context.Context, uid int64) (string, error) {
+	args := m.Called(ctx, uid)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockPhoneService) Unbind(ctx context.Context, uid int64, code string) error {
+	return m.Called(ctx, uid, code).Error(0)
+}
+
+func doPhoneRequest(t *testing.T, svc *mockPhoneService, method, path string, body any) ginx.Result {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user", ijwt.UserClaims{Uid: 1, Ssid: "ssid"})
+	})
+	NewPhoneHandler(svc).RegisterRoutes(router, middleware.NewPublicRoutes())
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ginx.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestPhoneHandler_Bind(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       BindPhoneReq
+		mockSetup func(*mockPhoneService)
+		wantCode  int
+	}{
+		{
+			name: "绑定成功，号码规范化成 E.164",
+			req:  BindPhoneReq{Phone: "138 0013 8000", Code: "123456"},
+			mockSetup: func(s *mockPhoneService) {
+				s.On("Bind", mock.Anything, int64(1), "+8613800138000", "123456").Return(nil)
+			},
+		},
+		{
+			name:      "手机号格式不对",
+			req:       BindPhoneReq{Phone: "12345", Code: "123456"},
+			mockSetup: func(s *mockPhoneService) {},
+			wantCode:  errs.UserInvalidInput,
+		},
+		{
+			name: "验证码有误",
+			req:  BindPhoneReq{Phone: "+8613800138000", Code: "000000"},
+			mockSetup: func(s *mockPhoneService) {
+				s.On("Bind", mock.Anything, int64(1), "+8613800138000", "000000").Return(service.ErrInvalidCode)
+			},
+			wantCode: errs.UserInvalidInput,
+		},
+		{
+			name: "已经被别人绑定了",
+			req:  BindPhoneReq{Phone: "+8613800138000", Code: "123456"},
+			mockSetup: func(s *mockPhoneService) {
+				s.On("Bind", mock.Anything, int64(1), "+8613800138000", "123456").Return(service.ErrDuplicatePhone)
+			},
+			wantCode: errs.UserDuplicatePhone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mockPhoneService)
+			tt.mockSetup(svc)
+			resp := doPhoneRequest(t, svc, http.MethodPut, "/users/phone", tt.req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPhoneHandler_SendBindCode(t *testing.T) {
+	svc := new(mockPhoneService)
+	svc.On("SendBindCode", mock.Anything, int64(1), "+8613800138000").Return(service.ErrDuplicatePhone)
+	resp := doPhoneRequest(t, svc, http.MethodPost, "/users/phone/code", SendSMSCodeReq{Phone: "13800138000"})
+	assert.Equal(t, errs.UserDuplicatePhone, resp.Code)
+	svc.AssertExpectations(t)
+}
+
+func TestPhoneHandler_Unbind(t *testing.T) {
+	svc := new(mockPhoneService)
+	svc.On("SendUnbindCode", mock.Anything, int64(1)).Return("+8613800138000", nil)
+	resp := doPhoneRequest(t, svc, http.MethodPost, "/users/phone/unbind/code", nil)
+	assert.Equal(t, 0, resp.Code)
+	assert.Equal(t, map[string]any{"phone": "+86138****8000"}, resp.Data)
+
+	svc.On("Unbind", mock.Anything, int64(1), "123456").Return(service.ErrPhoneRequired)
+	resp = doPhoneRequest(t, svc, http.MethodDelete, "/users/phone", UnbindPhoneReq{Code: "123456"})
+	assert.Equal(t, errs.UserInvalidInput, resp.Code)
+	svc.AssertExpectations(t)
+}
@@ -3,12 +3,18 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"moon/internal/errs"
 	"moon/internal/service"
 	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
 	"moon/pkg/ginx"
+	"moon/pkg/logger"
+	"moon/pkg/passwordx"
+	"moon/pkg/phonex"
 
 	regexp "github.com/dlclark/regexp2"
 	"github.com/gin-contrib/sessions"
@@ -18,38 +24,77 @@ import (
 
 const (
 	emailRegexPattern = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
-	// 和上面比起来，用 ` 看起来就比较清爽
-	passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)(?=.*[$@$!%*#?&])[A-Za-z\d$@$!%*#?&]{8,}$`
-	bizLogin             = "login"
+	// defaultCountryCode 用户输入的手机号没有带国家码的时候按国内号码处理
+	defaultCountryCode = "86"
+	bizLogin           = "login"
+)
+
+// 个人访问令牌访问个人资料需要的 scope
+const (
+	ScopeProfileRead  = "user:profile:read"
+	ScopeProfileWrite = "user:profile:write"
 )
 
 type UserHandler struct {
 	ijwt.Handler
 	emailRexExp    *regexp.Regexp
-	passwordRexExp *regexp.Regexp
+	passwordPolicy *passwordx.Policy
 	svc            service.UserService
-	// codeSvc        service.CodeService
+	lockout        service.LoginLockoutService
+	codeSvc        service.CodeService
+	emailSvc       service.EmailVerificationService
+	mfaSvc         service.MFAService
+	deletionSvc    service.AccountDeletionService
 }
 
 func NewUserHandler(svc service.UserService,
+	codeSvc service.CodeService,
+	emailSvc service.EmailVerificationService,
+	mfaSvc service.MFAService,
+	deletionSvc service.AccountDeletionService,
+	lockout service.LoginLockoutService,
+	passwordPolicy *passwordx.Policy,
 	hdl ijwt.Handler,
 ) *UserHandler {
 	return &UserHandler{
 		emailRexExp:    regexp.MustCompile(emailRegexPattern, regexp.None),
-		passwordRexExp: regexp.MustCompile(passwordRegexPattern, regexp.None),
+		passwordPolicy: passwordPolicy,
 		svc:            svc,
+		codeSvc:        codeSvc,
+		emailSvc:       emailSvc,
+		mfaSvc:         mfaSvc,
+		deletionSvc:    deletionSvc,
+		lockout:        lockout,
 		Handler:        hdl,
 	}
 }
 
-func (h *UserHandler) RegisterRoutes(server *gin.Engine) {
+func (h *UserHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
 	ug := server.Group("/users")
+	public.Add(ug, http.MethodPost, "/signup").
+		Add(ug, http.MethodPost, "/login").
+		Add(ug, http.MethodPost, "/login_sms/code/send").
+		Add(ug, http.MethodPost, "/login_sms").
+		Add(ug, http.MethodGet, "/verify_email").
+		Add(ug, http.MethodPost, "/verify_email/resend").
+		// refresh token 由 RefreshToken 自己校验
+		Add(ug, http.MethodPost, "/refresh_token")
 	ug.POST("/signup", ginx.WrapBody(h.SignUp))
 	ug.POST("/login", ginx.WrapBody(h.LoginJWT))
-	ug.POST("/logout", h.LogoutJWT)
-	ug.GET("/refresh_token", h.RefreshToken)
-	ug.GET("/profile", h.Profile)
-	ug.PUT("/profile", ginx.WrapBody(h.UpdateProfile))
+	ug.POST("/login_sms/code/send", ginx.WrapBody(h.SendSMSLoginCode))
+	ug.POST("/login_sms", ginx.WrapBody(h.LoginSMS))
+	ug.GET("/verify_email", ginx.Wrap(h.VerifyEmail))
+	ug.POST("/verify_email/resend", ginx.WrapBody(h.ResendVerifyEmail))
+	// 个人访问令牌没有会话，会话相关的接口只有登录会话能用
+	ug.POST("/logout", middleware.RequireSession(), h.LogoutJWT)
+	// 刷新会换掉 refresh token 和 CSRF cookie，要用 POST，cookie 模式下才会经过 CSRF 校验
+	ug.POST("/refresh_token", h.RefreshToken)
+	ug.GET("/profile", middleware.RequireScope(ScopeProfileRead), h.Profile)
+	ug.PUT("/profile", middleware.RequireScope(ScopeProfileWrite), ginx.WrapBody(h.UpdateProfile))
+	ug.GET("/sessions", middleware.RequireSession(), ginx.WrapClaims(h.Sessions))
+	ug.DELETE("/sessions/:ssid", middleware.RequireSession(), ginx.WrapClaims(h.RevokeSession))
+	// 在所有设备上退出登录
+	ug.DELETE("/sessions", middleware.RequireSession(), ginx.WrapClaims(h.RevokeAllSessions))
 }
 
 func (h *UserHandler) SignUp(ctx *gin.Context, req SignUpReq) (ginx.Result, error) {
@@ -74,23 +119,19 @@ func (h *UserHandler) SignUp(ctx *gin.Context, req SignUpReq) (ginx.Result, erro
 		}, nil
 	}
 
-	isPassword, err := h.passwordRexExp.MatchString(req.Password)
-	if err != nil {
-		return ginx.Result{
-			Code: errs.UserInternalServerError,
-			Msg:  "系统错误",
-		}, err
-	}
-	if !isPassword {
-		return ginx.Result{
-			Code: errs.UserInvalidInput,
-			Msg:  "密码必须包含字母、数字、特殊字符",
-		}, nil
+	// 邮箱前缀和昵称也不能出现在密码里
+	if res, ok := checkPasswordPolicy(h.passwordPolicy, req.Password,
+		strings.Split(req.Email, "@")[0], req.Nickname); !ok {
+		return res, nil
 	}
 
 	err = h.svc.Signup(ctx.Request.Context(), req.Email, req.Password, req.Nickname)
 	switch err {
 	case nil:
+		// 邮件发不出去不影响注册，用户可以重新发送
+		if err = h.emailSvc.Send(ctx, req.Email); err != nil {
+			ginx.L.Error("发送邮箱验证邮件失败", logger.Error(err), logger.String("email", req.Email))
+		}
 		return ginx.Result{
 			Msg: "注册成功",
 		}, nil
@@ -110,10 +151,32 @@ func (h *UserHandler) SignUp(ctx *gin.Context, req SignUpReq) (ginx.Result, erro
 func (h *UserHandler) LoginJWT(ctx *gin.Context, req LoginJWTReq) (ginx.Result, error) {
 	fmt.Printf("LoginJWT: 收到登录请求，邮箱: %s\n", req.Email)
 
+	ip := ctx.ClientIP()
+	d, err := h.lockout.Check(ctx, req.Email, ip)
+	switch err {
+	case nil:
+	case service.ErrAccountLocked:
+		return lockedResult(ctx, d), nil
+	default:
+		// Redis 出问题的时候不能让所有人都登录不了，降级为不限制
+		ginx.L.Error("检查登录锁定失败", logger.Error(err))
+	}
+
 	u, err := h.svc.Login(ctx, req.Email, req.Password)
 	switch err {
 	case nil:
 		fmt.Printf("LoginJWT: 登录成功，用户ID: %d\n", u.Id)
+		if err = h.emailSvc.CheckLogin(u); err != nil {
+			return ginx.Result{Code: errs.UserEmailNotVerified, Msg: "邮箱还没有验证，请先查收验证邮件"}, nil
+		}
+		// 开启了两步验证的，验证码通过之后才发 token，也才清空失败次数，
+		// 不然知道密码的人每次重新登录都能再猜几次验证码
+		if u.TOTP.Enabled {
+			return beginMFA(ctx, h.mfaSvc, u.Id)
+		}
+		if err = h.lockout.Succeed(ctx, req.Email); err != nil {
+			ginx.L.Error("清空登录失败次数失败", logger.Error(err))
+		}
 		err = h.SetLoginToken(ctx, u.Id)
 		if err != nil {
 			fmt.Printf("LoginJWT: 设置token失败: %v\n", err)
@@ -128,13 +191,142 @@ func (h *UserHandler) LoginJWT(ctx *gin.Context, req LoginJWTReq) (ginx.Result,
 		}, nil
 	case service.ErrInvalidUserOrPassword:
 		fmt.Printf("LoginJWT: 用户名或密码错误\n")
+		d, err = h.lockout.Fail(ctx, req.Email, ip)
+		switch err {
+		case nil:
+		case service.ErrAccountLocked:
+			ginx.L.Warn("登录失败次数过多，已锁定",
+				logger.String("email", req.Email),
+				logger.String("ip", ip),
+				logger.String("duration", d.String()))
+			return lockedResult(ctx, d), nil
+		default:
+			ginx.L.Error("记录登录失败次数失败", logger.Error(err))
+		}
 		return ginx.Result{Msg: "用户名或者密码错误"}, nil
+	case service.ErrUserPendingDeletion:
+		if err = h.lockout.Succeed(ctx, req.Email); err != nil {
+			ginx.L.Error("清空登录失败次数失败", logger.Error(err))
+		}
+		res, err := beginRestore(h.deletionSvc, u)
+		switch err {
+		case nil:
+			return res, nil
+		case service.ErrRestoreExpired:
+			// 马上就要被清理了，当成不存在
+			return ginx.Result{Msg: "用户名或者密码错误"}, nil
+		default:
+			return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+		}
+	case service.ErrUserDisabled:
+		return ginx.Result{Code: errs.UserDisabled, Msg: "账号已被禁用"}, nil
 	default:
 		fmt.Printf("LoginJWT: 系统错误: %v\n", err)
 		return ginx.Result{Msg: "系统错误"}, err
 	}
 }
 
+func (h *UserHandler) SendSMSLoginCode(ctx *gin.Context, req SendSMSCodeReq) (ginx.Result, error) {
+	phone, err := phonex.Normalize(req.Phone, defaultCountryCode)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "手机号码格式不对"}, nil
+	}
+	err = h.codeSvc.Send(ctx, bizLogin, phone)
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "发送成功"}, nil
+	case service.ErrCodeSendTooMany:
+		ginx.L.Warn("频繁发送验证码", logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Code: errs.UserCodeSendTooMany, Msg: "短信发送太频繁，请稍后再试"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *UserHandler) LoginSMS(ctx *gin.Context, req LoginSMSReq) (ginx.Result, error) {
+	// 和发送验证码的时候一样规范化，不然同一个号码换个写法就对不上了
+	phone, err := phonex.Normalize(req.Phone, defaultCountryCode)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "手机号码格式不对"}, nil
+	}
+	ok, err := h.codeSvc.Verify(ctx, bizLogin, phone, req.Code)
+	switch err {
+	case nil:
+	case service.ErrCodeVerifyTooMany:
+		return ginx.Result{Code: errs.UserCodeVerifyTooMany, Msg: "验证次数太多，请重新获取验证码"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if !ok {
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证码有误"}, nil
+	}
+
+	u, err := h.svc.FindOrCreate(ctx, phone)
+	switch err {
+	case nil:
+	case service.ErrUserPendingDeletion:
+		// 验证码已经证明了手机号，和密码登录一样可以恢复
+		res, err := beginRestore(h.deletionSvc, u)
+		switch err {
+		case nil:
+			return res, nil
+		case service.ErrRestoreExpired:
+			// 清理掉之后手机号才能用来注册新账号
+			return ginx.Result{Code: errs.UserInvalidInput, Msg: "这个手机号的账号正在注销，请稍后再试"}, nil
+		default:
+			return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+		}
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if u.Disabled() {
+		return ginx.Result{Code: errs.UserDisabled, Msg: "账号已被禁用"}, nil
+	}
+	// 验证码只证明了手机号，开启了两步验证的一样要输入 TOTP
+	if u.TOTP.Enabled {
+		return beginMFA(ctx, h.mfaSvc, u.Id)
+	}
+	err = h.SetLoginToken(ctx, u.Id)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "登录成功"}, nil
+}
+
+func (h *UserHandler) VerifyEmail(ctx *gin.Context) (ginx.Result, error) {
+	err := h.emailSvc.Verify(ctx, ctx.Query("token"))
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "邮箱验证成功"}, nil
+	case service.ErrInvalidEmailToken:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "验证链接无效或者已经过期"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+// ResendVerifyEmail 不管邮箱存不存在都返回成功，不能用来探测账号
+func (h *UserHandler) ResendVerifyEmail(ctx *gin.Context, req ResendVerifyEmailReq) (ginx.Result, error) {
+	err := h.emailSvc.Send(ctx, req.Email)
+	switch err {
+	case nil, service.ErrUserNotFound:
+		return ginx.Result{Msg: "如果这个邮箱已经注册并且还没有验证，验证邮件已经发出"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func lockedResult(ctx *gin.Context, d time.Duration) ginx.Result {
+	// 向上取整，避免提示 0 秒之后重试
+	secs := int64((d + time.Second - 1) / time.Second)
+	ctx.Header("Retry-After", strconv.FormatInt(secs, 10))
+	return ginx.Result{
+		Code: errs.UserLocked,
+		Msg:  "登录失败次数过多，请稍后再试",
+		Data: LockedVO{RetryAfter: secs},
+	}
+}
+
 //func (h *UserHandler) Logout(ctx *gin.Context) {
 //	sess := sessions.Default(ctx)
 //	sess.Options(sessions.Options{
@@ -175,12 +367,10 @@ func (h *UserHandler) Login(ctx *gin.Context) {
 }
 
 func (h *UserHandler) RefreshToken(ctx *gin.Context) {
-	// 约定，前端在 Authorization 里面带上这个 refresh_token
-	tokenStr := h.ExtractToken(ctx)
+	// 约定，前端在 Authorization 里面带上这个 refresh_token，cookie 模式下则在 cookie 里
+	tokenStr := h.ExtractRefreshToken(ctx)
 	var rc ijwt.RefreshClaims
-	token, err := jwt.ParseWithClaims(tokenStr, &rc, func(token *jwt.Token) (interface{}, error) {
-		return ijwt.RCJWTKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &rc, h.RefreshKeyFunc())
 	if err != nil {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
@@ -197,7 +387,44 @@ func (h *UserHandler) RefreshToken(ctx *gin.Context) {
 		return
 	}
 
-	err = h.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+	err = h.CheckUser(ctx, rc.Uid)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	// Redis 里的禁用标记可能丢了，换发 token 的时候以数据库里的状态为准
+	u, err := h.svc.FindById(ctx, rc.Uid)
+	switch err {
+	case nil:
+	case service.ErrInvalidUserOrPassword:
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	default:
+		ginx.L.Error("刷新 token 时查询用户失败", logger.Error(err), logger.Int64("uid", rc.Uid))
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if u.Deleted() {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if u.Disabled() {
+		// 顺便把标记补回去，其他还没过期的 access token 也会被拒绝
+		if err = h.BlockUser(ctx, u.Id); err != nil {
+			ginx.L.Error("重新禁用用户失败", logger.Error(err), logger.Int64("uid", u.Id))
+		}
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	err = h.RotateTokens(ctx, rc)
+	if err == ijwt.ErrRefreshTokenReused {
+		ginx.L.Warn("refresh token 被重复使用，已撤销整个会话",
+			logger.Int64("uid", rc.Uid),
+			logger.String("ssid", rc.Ssid),
+			logger.String("ip", ctx.ClientIP()),
+			logger.String("user_agent", ctx.GetHeader("User-Agent")))
+	}
 	if err != nil {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
@@ -225,12 +452,14 @@ func (h *UserHandler) Profile(ctx *gin.Context) {
 	}
 
 	resp := ProfileResp{
-		Id:       u.Id,
-		Email:    u.Email,
-		Nickname: u.Nickname,
-		Birthday: u.Birthday.UnixMilli(),
-		AboutMe:  u.AboutMe,
-		Phone:    u.Phone,
+		Id:            u.Id,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		MFAEnabled:    u.TOTP.Enabled,
+		Nickname:      u.Nickname,
+		Birthday:      u.Birthday.UnixMilli(),
+		AboutMe:       u.AboutMe,
+		Phone:         u.Phone,
 	}
 	ctx.JSON(http.StatusOK, ginx.Result{Msg: "success", Data: resp})
 }
@@ -244,7 +473,6 @@ func (h *UserHandler) UpdateProfile(ctx *gin.Context, req UpdateProfileReq) (gin
 
 	u.Nickname = req.Nickname
 	u.AboutMe = req.AboutMe
-	u.Phone = req.Phone
 	if req.Birthday != 0 {
 		u.Birthday = time.UnixMilli(req.Birthday)
 	}
@@ -256,3 +484,47 @@ func (h *UserHandler) UpdateProfile(ctx *gin.Context, req UpdateProfileReq) (gin
 
 	return ginx.Result{Msg: "更新成功"}, nil
 }
+
+func (h *UserHandler) Sessions(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	sessions, err := h.ListSessions(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	res := make([]SessionVO, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, SessionVO{
+			Ssid:      s.Ssid,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Ctime:     s.Ctime.UnixMilli(),
+			LastSeen:  s.LastSeen.UnixMilli(),
+			Current:   s.Ssid == uc.Ssid,
+		})
+	}
+	return ginx.Result{Msg: "success", Data: res}, nil
+}
+
+func (h *UserHandler) RevokeSession(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	err := h.Handler.RevokeSession(ctx.Request.Context(), uc.Uid, ctx.Param("ssid"))
+	switch err {
+	case nil:
+		return ginx.Result{Msg: "OK"}, nil
+	case ijwt.ErrSessionNotFound:
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "会话不存在"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+func (h *UserHandler) RevokeAllSessions(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	err := h.Handler.RevokeAllSessions(ctx.Request.Context(), uc.Uid)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	// 当前会话已经撤销了，这里只是顺便清掉客户端的 token
+	err = h.ClearToken(ctx)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "已在所有设备上退出登录"}, nil
+}
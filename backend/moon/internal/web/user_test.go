@@ -4,15 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"moon/internal/domain"
+	"moon/internal/errs"
 	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
 	"moon/pkg/ginx"
 	"moon/pkg/logger"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -46,11 +52,105 @@ func (m *mockUserService) FindById(ctx context.Context, id int64) (domain.User,
 	return args.Get(0).(domain.User), args.Error(1)
 }
 
+func (m *mockUserService) FindOrCreate(ctx context.Context, phone string) (domain.User, error) {
+	args := m.Called(ctx, phone)
+	return args.Get(0).(domain.User), args.Error(1)
+}
+
+func (m *mockUserService) FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error) {
+	args := m.Called(ctx, info)
+	return args.Get(0).(domain.User), args.Error(1)
+}
+
+func (m *mockUserService) BindWechat(ctx context.Context, uid int64, info domain.WechatInfo) error {
+	return m.Called(ctx, uid, info).Error(0)
+}
+
 func (m *mockUserService) Update(ctx context.Context, u domain.User) error {
 	args := m.Called(ctx, u)
 	return args.Error(0)
 }
 
+func (m *mockUserService) ChangePassword(ctx context.Context, uid int64, oldPassword, newPassword string) error {
+	args := m.Called(ctx, uid, oldPassword, newPassword)
+	return args.Error(0)
+}
+
+func (m *mockUserService) Search(ctx context.Context, q domain.UserQuery) ([]domain.User, int64, error) {
+	args := m.Called(ctx, q)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]domain.User), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockUserService) Disable(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockUserService) Enable(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type mockCodeService struct {
+	mock.Mock
+}
+
+func (m *mockCodeService) Send(ctx context.Context, biz, phone string) error {
+	args := m.Called(ctx, biz, phone)
+	return args.Error(0)
+}
+
+func (m *mockCodeService) Verify(ctx context.Context, biz, phone, code string) (bool, error) {
+	args := m.Called(ctx, biz, phone, code)
+	return args.Bool(0), args.Error(1)
+}
+
+type mockEmailVerificationService struct {
+	mock.Mock
+}
+
+func (m *mockEmailVerificationService) Send(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *mockEmailVerificationService) Verify(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *mockEmailVerificationService) CheckLogin(u domain.User) error {
+	args := m.Called(u)
+	return args.Error(0)
+}
+
+type mockLockoutService struct {
+	mock.Mock
+}
+
+func (m *mockLockoutService) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	args := m.Called(ctx, email, ip)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *mockLockoutService) Fail(ctx context.Context, email, ip string) (time.Duration, error) {
+	args := m.Called(ctx, email, ip)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *mockLockoutService) Succeed(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *mockLockoutService) Unlock(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
 type mockJWTHandler struct {
 	mock.Mock
 }
@@ -65,6 +165,11 @@ func (m *mockJWTHandler) ExtractToken(ctx *gin.Context) string {
 	return args.String(0)
 }
 
+func (m *mockJWTHandler) ExtractRefreshToken(ctx *gin.Context) string {
+	args := m.Called(ctx)
+	return args.String(0)
+}
+
 func (m *mockJWTHandler) CheckSession(ctx *gin.Context, ssid string) error {
 	args := m.Called(ctx, ssid)
 	return args.Error(0)
@@ -75,15 +180,80 @@ func (m *mockJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string) e
 	return args.Error(0)
 }
 
+func (m *mockJWTHandler) CheckClient(ctx *gin.Context, uc ijwt.UserClaims) error {
+	args := m.Called(ctx, uc)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) RotateTokens(ctx *gin.Context, rc ijwt.RefreshClaims) error {
+	args := m.Called(ctx, rc)
+	return args.Error(0)
+}
+
 func (m *mockJWTHandler) ClearToken(ctx *gin.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
 }
 
+func (m *mockJWTHandler) ListSessions(ctx context.Context, uid int64) ([]ijwt.Session, error) {
+	args := m.Called(ctx, uid)
+	return args.Get(0).([]ijwt.Session), args.Error(1)
+}
+
+func (m *mockJWTHandler) LoginHistory(ctx context.Context, uid int64) ([]ijwt.LoginRecord, error) {
+	args := m.Called(ctx, uid)
+	return args.Get(0).([]ijwt.LoginRecord), args.Error(1)
+}
+
+func (m *mockJWTHandler) RevokeSession(ctx context.Context, uid int64, ssid string) error {
+	args := m.Called(ctx, uid, ssid)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) RevokeAllSessions(ctx context.Context, uid int64) error {
+	args := m.Called(ctx, uid)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) RevokeOtherSessions(ctx context.Context, uid int64, ssid string) error {
+	args := m.Called(ctx, uid, ssid)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) BlockUser(ctx context.Context, uid int64) error {
+	args := m.Called(ctx, uid)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) BlockUserUntil(ctx context.Context, uid int64, until time.Time) error {
+	args := m.Called(ctx, uid, until)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) UnblockUser(ctx context.Context, uid int64) error {
+	args := m.Called(ctx, uid)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) CheckUser(ctx *gin.Context, uid int64) error {
+	args := m.Called(ctx, uid)
+	return args.Error(0)
+}
+
+func (m *mockJWTHandler) AccessKeyFunc() jwt.Keyfunc {
+	args := m.Called()
+	return args.Get(0).(jwt.Keyfunc)
+}
+
+func (m *mockJWTHandler) RefreshKeyFunc() jwt.Keyfunc {
+	args := m.Called()
+	return args.Get(0).(jwt.Keyfunc)
+}
+
 func setupTestRouter(handler *UserHandler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	handler.RegisterRoutes(router)
+	handler.RegisterRoutes(router, middleware.NewPublicRoutes())
 	return router
 }
 
@@ -99,12 +269,13 @@ func TestUserHandler_SignUp(t *testing.T) {
 			name: "成功注册",
 			reqBody: SignUpReq{
 				Email:           "test@example.com",
-				Password:        "Password123!",
-				ConfirmPassword: "Password123!",
+				Password:        "correct horse battery",
+				ConfirmPassword: "correct horse battery",
 				Nickname:        "testuser",
 			},
 			mockSetup: func(m *mockUserService) {
-				m.On("Signup", mock.Anything, "test@example.com", "Password123!", "testuser").Return(nil)
+				// 没有特殊字符的口令短语也可以
+				m.On("Signup", mock.Anything, "test@example.com", "correct horse battery", "testuser").Return(nil)
 			},
 			wantCode: http.StatusOK,
 			wantMsg:  "注册成功",
@@ -134,7 +305,7 @@ func TestUserHandler_SignUp(t *testing.T) {
 			wantMsg:   "两次输入的密码不相等",
 		},
 		{
-			name: "密码格式错误",
+			name: "密码太短",
 			reqBody: SignUpReq{
 				Email:           "test@example.com",
 				Password:        "simple",
@@ -143,18 +314,54 @@ func TestUserHandler_SignUp(t *testing.T) {
 			},
 			mockSetup: func(m *mockUserService) {},
 			wantCode:  http.StatusOK,
-			wantMsg:   "密码必须包含字母、数字、特殊字符",
+			wantMsg:   "密码至少 8 位",
 		},
 		{
-			name: "邮箱已存在",
+			name: "有特殊字符但是太常见",
 			reqBody: SignUpReq{
-				Email:           "existing@example.com",
+				Email:           "test@example.com",
 				Password:        "Password123!",
 				ConfirmPassword: "Password123!",
 				Nickname:        "testuser",
 			},
+			mockSetup: func(m *mockUserService) {},
+			wantCode:  http.StatusOK,
+			wantMsg:   "这个密码太常见了，很容易被猜到，请换一个",
+		},
+		{
+			name: "包含邮箱前缀",
+			reqBody: SignUpReq{
+				Email:           "tomcat@example.com",
+				Password:        "Tomcat#2024xyz",
+				ConfirmPassword: "Tomcat#2024xyz",
+				Nickname:        "testuser",
+			},
+			mockSetup: func(m *mockUserService) {},
+			wantCode:  http.StatusOK,
+			wantMsg:   "密码不能包含邮箱、昵称这些个人信息",
+		},
+		{
+			name: "连续的字符太多",
+			reqBody: SignUpReq{
+				Email:           "test@example.com",
+				Password:        "abcdefgh12345678",
+				ConfirmPassword: "abcdefgh12345678",
+				Nickname:        "testuser",
+			},
+			mockSetup: func(m *mockUserService) {},
+			wantCode:  http.StatusOK,
+			wantMsg:   "密码强度不够，可以加长一些，或者混用大小写字母、数字和符号，避免重复和连续的字符",
+		},
+		{
+			name: "邮箱已存在",
+			reqBody: SignUpReq{
+				Email:           "existing@example.com",
+				Password:        "correct horse battery",
+				ConfirmPassword: "correct horse battery",
+				Nickname:        "testuser",
+			},
 			mockSetup: func(m *mockUserService) {
-				m.On("Signup", mock.Anything, "existing@example.com", "Password123!", "testuser").Return(service.ErrDuplicateEmail)
+				m.On("Signup", mock.Anything, "existing@example.com", "correct horse battery", "testuser").Return(service.ErrDuplicateEmail)
 			},
 			wantCode: http.StatusOK,
 			wantMsg:  "邮箱冲突",
@@ -167,7 +374,11 @@ func TestUserHandler_SignUp(t *testing.T) {
 			mockHdl := new(mockJWTHandler)
 			tt.mockSetup(mockSvc)
 
-			handler := NewUserHandler(mockSvc, mockHdl)
+			mockEmail := new(mockEmailVerificationService)
+			// 注册成功才发验证邮件，发送失败也不影响注册
+			mockEmail.On("Send", mock.Anything, tt.reqBody.Email).Return(errors.New("smtp 超时")).Maybe()
+			handler := NewUserHandler(mockSvc, new(mockCodeService), mockEmail, new(mockMFAService), new(mockAccountDeletionService), new(mockLockoutService),
+				newTestPasswordPolicy(), mockHdl)
 			router := setupTestRouter(handler)
 
 			body, _ := json.Marshal(tt.reqBody)
@@ -185,6 +396,11 @@ func TestUserHandler_SignUp(t *testing.T) {
 
 			assert.Equal(t, tt.wantMsg, resp.Msg)
 			mockSvc.AssertExpectations(t)
+			if tt.wantMsg == "注册成功" {
+				mockEmail.AssertCalled(t, "Send", mock.Anything, tt.reqBody.Email)
+			} else {
+				mockEmail.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+			}
 		})
 	}
 }
@@ -193,9 +409,17 @@ func TestUserHandler_LoginJWT(t *testing.T) {
 	tests := []struct {
 		name      string
 		reqBody   LoginJWTReq
-		mockSetup func(*mockUserService, *mockJWTHandler)
-		wantCode  int
-		wantMsg   string
+		mockSetup func(*mockUserService, *mockJWTHandler, *mockLockoutService)
+		// emailErr 邮箱验证检查的结果
+		emailErr error
+		// mfa 开启了两步验证的时候发出的 mfa token
+		mfa *service.MFAChallenge
+		// restore 注销了还在宽限期里的时候发出的恢复 token
+		restore  *service.RestoreChallenge
+		wantCode int
+		wantMsg  string
+		// wantRetryAfter 锁定时的 Retry-After 头部
+		wantRetryAfter string
 	}{
 		{
 			name: "成功登录",
@@ -203,8 +427,10 @@ func TestUserHandler_LoginJWT(t *testing.T) {
 				Email:    "test@example.com",
 				Password: "Password123!",
 			},
-			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
 				m.On("Login", mock.Anything, "test@example.com", "Password123!").Return(domain.User{Id: 1}, nil)
+				l.On("Succeed", mock.Anything, "test@example.com").Return(nil)
 				h.On("SetLoginToken", mock.Anything, int64(1)).Return(nil)
 			},
 			wantCode: http.StatusOK,
@@ -216,21 +442,109 @@ func TestUserHandler_LoginJWT(t *testing.T) {
 				Email:    "test@example.com",
 				Password: "WrongPassword!",
 			},
-			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
 				m.On("Login", mock.Anything, "test@example.com", "WrongPassword!").Return(domain.User{}, service.ErrInvalidUserOrPassword)
+				l.On("Fail", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
 			},
 			wantCode: http.StatusOK,
 			wantMsg:  "用户名或者密码错误",
 		},
+		{
+			name: "失败次数过多触发锁定",
+			reqBody: LoginJWTReq{
+				Email:    "test@example.com",
+				Password: "WrongPassword!",
+			},
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
+				m.On("Login", mock.Anything, "test@example.com", "WrongPassword!").Return(domain.User{}, service.ErrInvalidUserOrPassword)
+				l.On("Fail", mock.Anything, "test@example.com", mock.Anything).Return(time.Minute, service.ErrAccountLocked)
+			},
+			wantCode:       http.StatusOK,
+			wantMsg:        "登录失败次数过多，请稍后再试",
+			wantRetryAfter: "60",
+		},
+		{
+			name: "账号已被锁定",
+			reqBody: LoginJWTReq{
+				Email:    "test@example.com",
+				Password: "Password123!",
+			},
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				// 锁定期间连密码都不校验
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Second*90+time.Millisecond, service.ErrAccountLocked)
+			},
+			wantCode:       http.StatusOK,
+			wantMsg:        "登录失败次数过多，请稍后再试",
+			wantRetryAfter: "91",
+		},
+		{
+			name: "邮箱还没有验证",
+			reqBody: LoginJWTReq{
+				Email:    "test@example.com",
+				Password: "Password123!",
+			},
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
+				m.On("Login", mock.Anything, "test@example.com", "Password123!").Return(domain.User{Id: 1}, nil)
+			},
+			emailErr: service.ErrEmailNotVerified,
+			wantCode: http.StatusOK,
+			wantMsg:  "邮箱还没有验证，请先查收验证邮件",
+		},
+		{
+			name: "开启了两步验证，先不发 token",
+			reqBody: LoginJWTReq{
+				Email:    "test@example.com",
+				Password: "Password123!",
+			},
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
+				m.On("Login", mock.Anything, "test@example.com", "Password123!").
+					Return(domain.User{Id: 1, TOTP: domain.TOTPInfo{Enabled: true}}, nil)
+			},
+			mfa:      &service.MFAChallenge{Token: "mfa-token", ExpiresIn: time.Minute * 5},
+			wantCode: http.StatusOK,
+			wantMsg:  "请输入两步验证的验证码",
+		},
+		{
+			name: "账号已注销，提示可以恢复",
+			reqBody: LoginJWTReq{
+				Email:    "test@example.com",
+				Password: "Password123!",
+			},
+			mockSetup: func(m *mockUserService, h *mockJWTHandler, l *mockLockoutService) {
+				l.On("Check", mock.Anything, "test@example.com", mock.Anything).Return(time.Duration(0), nil)
+				m.On("Login", mock.Anything, "test@example.com", "Password123!").
+					Return(domain.User{Id: 1, Status: domain.UserStatusDeleted}, service.ErrUserPendingDeletion)
+				l.On("Succeed", mock.Anything, "test@example.com").Return(nil)
+			},
+			restore:  &service.RestoreChallenge{Token: "restore-token", PurgeAt: time.UnixMilli(1700000000000)},
+			wantCode: http.StatusOK,
+			wantMsg:  "账号已注销，宽限期内可以恢复",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockSvc := new(mockUserService)
 			mockHdl := new(mockJWTHandler)
-			tt.mockSetup(mockSvc, mockHdl)
+			mockLockout := new(mockLockoutService)
+			tt.mockSetup(mockSvc, mockHdl, mockLockout)
 
-			handler := NewUserHandler(mockSvc, mockHdl)
+			mockEmail := new(mockEmailVerificationService)
+			mockEmail.On("CheckLogin", mock.Anything).Return(tt.emailErr).Maybe()
+			mockMFA := new(mockMFAService)
+			if tt.mfa != nil {
+				mockMFA.On("Begin", mock.Anything, int64(1)).Return(*tt.mfa, nil)
+			}
+			mockDeletion := new(mockAccountDeletionService)
+			if tt.restore != nil {
+				mockDeletion.On("BeginRestore", mock.Anything).Return(*tt.restore, nil)
+			}
+			handler := NewUserHandler(mockSvc, new(mockCodeService), mockEmail, mockMFA, mockDeletion, mockLockout,
+				newTestPasswordPolicy(), mockHdl)
 			router := setupTestRouter(handler)
 
 			body, _ := json.Marshal(tt.reqBody)
@@ -247,6 +561,366 @@ func TestUserHandler_LoginJWT(t *testing.T) {
 			assert.NoError(t, err)
 
 			assert.Equal(t, tt.wantMsg, resp.Msg)
+			assert.Equal(t, tt.wantRetryAfter, w.Header().Get("Retry-After"))
+			if tt.mfa != nil {
+				assert.Equal(t, errs.UserMFARequired, resp.Code)
+				assert.Equal(t, map[string]any{"mfa_token": "mfa-token", "expires_in": float64(300)}, resp.Data)
+			}
+			if tt.restore != nil {
+				assert.Equal(t, errs.UserPendingDeletion, resp.Code)
+				assert.Equal(t, map[string]any{"restore_token": "restore-token", "purge_at": float64(1700000000000)}, resp.Data)
+			}
+			mockSvc.AssertExpectations(t)
+			mockHdl.AssertExpectations(t)
+			mockHdl.AssertExpectations(t)
+			mockLockout.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_LoginSMS(t *testing.T) {
+	tests := []struct {
+		name      string
+		reqBody   LoginSMSReq
+		mockSetup func(*mockUserService, *mockCodeService, *mockJWTHandler)
+		mfa       *service.MFAChallenge
+		// restore 注销了还在宽限期里的时候发出的恢复 token
+		restore  *service.RestoreChallenge
+		wantCode int
+		wantMsg  string
+	}{
+		{
+			name:    "登录成功",
+			reqBody: LoginSMSReq{Phone: "13800138000", Code: "123456"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {
+				c.On("Verify", mock.Anything, bizLogin, "+8613800138000", "123456").Return(true, nil)
+				m.On("FindOrCreate", mock.Anything, "+8613800138000").Return(domain.User{Id: 1, Phone: "+8613800138000"}, nil)
+				h.On("SetLoginToken", mock.Anything, int64(1)).Return(nil)
+			},
+			wantMsg: "登录成功",
+		},
+		{
+			name:      "手机号格式不对",
+			reqBody:   LoginSMSReq{Phone: "12345", Code: "123456"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {},
+			wantCode:  errs.UserInvalidInput,
+			wantMsg:   "手机号码格式不对",
+		},
+		{
+			name:    "验证码有误",
+			reqBody: LoginSMSReq{Phone: "13800138000", Code: "000000"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {
+				c.On("Verify", mock.Anything, bizLogin, "+8613800138000", "000000").Return(false, nil)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "验证码有误",
+		},
+		{
+			name:    "验证次数太多",
+			reqBody: LoginSMSReq{Phone: "13800138000", Code: "000000"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {
+				c.On("Verify", mock.Anything, bizLogin, "+8613800138000", "000000").Return(false, service.ErrCodeVerifyTooMany)
+			},
+			wantCode: errs.UserCodeVerifyTooMany,
+			wantMsg:  "验证次数太多，请重新获取验证码",
+		},
+		{
+			name:    "账号已被禁用",
+			reqBody: LoginSMSReq{Phone: "13800138000", Code: "123456"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {
+				c.On("Verify", mock.Anything, bizLogin, "+8613800138000", "123456").Return(true, nil)
+				m.On("FindOrCreate", mock.Anything, "+8613800138000").
+					Return(domain.User{Id: 1, Status: domain.UserStatusDisabled}, nil)
+			},
+			wantCode: errs.UserDisabled,
+			wantMsg:  "账号已被禁用",
+		},
+		{
+			name:    "开启了两步验证，先不发 token",
+			reqBody: LoginSMSReq{Phone: "13800138000", Code: "123456"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {
+				c.On("Verify", mock.Anything, bizLogin, "+8613800138000", "123456").Return(true, nil)
+				m.On("FindOrCreate", mock.Anything, "+8613800138000").
+					Return(domain.User{Id: 1, Phone: "+8613800138000", TOTP: domain.TOTPInfo{Enabled: true}}, nil)
+			},
+			mfa:      &service.MFAChallenge{Token: "mfa-token", ExpiresIn: time.Minute * 5},
+			wantCode: errs.UserMFARequired,
+			wantMsg:  "请输入两步验证的验证码",
+		},
+		{
+			name:    "账号已注销，提示可以恢复",
+			reqBody: LoginSMSReq{Phone: "13800138000", Code: "123456"},
+			mockSetup: func(m *mockUserService, c *mockCodeService, h *mockJWTHandler) {
+				c.On("Verify", mock.Anything, bizLogin, "+8613800138000", "123456").Return(true, nil)
+				m.On("FindOrCreate", mock.Anything, "+8613800138000").
+					Return(domain.User{Id: 1, Status: domain.UserStatusDeleted}, service.ErrUserPendingDeletion)
+			},
+			restore:  &service.RestoreChallenge{Token: "restore-token", PurgeAt: time.UnixMilli(1700000000000)},
+			wantCode: errs.UserPendingDeletion,
+			wantMsg:  "账号已注销，宽限期内可以恢复",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(mockUserService)
+			mockCode := new(mockCodeService)
+			mockHdl := new(mockJWTHandler)
+			tt.mockSetup(mockSvc, mockCode, mockHdl)
+			mockMFA := new(mockMFAService)
+			if tt.mfa != nil {
+				mockMFA.On("Begin", mock.Anything, int64(1)).Return(*tt.mfa, nil)
+			}
+			mockDeletion := new(mockAccountDeletionService)
+			if tt.restore != nil {
+				mockDeletion.On("BeginRestore", mock.Anything).Return(*tt.restore, nil)
+			}
+
+			handler := NewUserHandler(mockSvc, mockCode, new(mockEmailVerificationService), mockMFA, mockDeletion, new(mockLockoutService),
+				newTestPasswordPolicy(), mockHdl)
+			router := setupTestRouter(handler)
+
+			body, _ := json.Marshal(tt.reqBody)
+			req, _ := http.NewRequest(http.MethodPost, "/users/login_sms", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			var resp ginx.Result
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			if tt.mfa != nil {
+				assert.Equal(t, map[string]any{"mfa_token": "mfa-token", "expires_in": float64(300)}, resp.Data)
+			}
+			if tt.restore != nil {
+				assert.Equal(t, map[string]any{"restore_token": "restore-token", "purge_at": float64(1700000000000)}, resp.Data)
+			}
+			mockSvc.AssertExpectations(t)
+			mockCode.AssertExpectations(t)
+			mockHdl.AssertExpectations(t)
+			mockMFA.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_RevokeSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		ssid      string
+		mockSetup func(*mockJWTHandler)
+		wantCode  int
+		wantMsg   string
+	}{
+		{
+			name: "撤销成功",
+			ssid: "other-ssid",
+			mockSetup: func(h *mockJWTHandler) {
+				h.On("RevokeSession", mock.Anything, int64(1), "other-ssid").Return(nil)
+			},
+			wantMsg: "OK",
+		},
+		{
+			name: "会话不属于当前用户",
+			ssid: "someone-else",
+			mockSetup: func(h *mockJWTHandler) {
+				h.On("RevokeSession", mock.Anything, int64(1), "someone-else").Return(ijwt.ErrSessionNotFound)
+			},
+			wantCode: errs.UserInvalidInput,
+			wantMsg:  "会话不存在",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(mockUserService)
+			mockHdl := new(mockJWTHandler)
+			tt.mockSetup(mockHdl)
+
+			handler := NewUserHandler(mockSvc, new(mockCodeService), new(mockEmailVerificationService), new(mockMFAService), new(mockAccountDeletionService), new(mockLockoutService),
+				newTestPasswordPolicy(), mockHdl)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				ctx.Set("user", ijwt.UserClaims{Uid: 1, Ssid: "current-ssid"})
+			})
+			handler.RegisterRoutes(router, middleware.NewPublicRoutes())
+
+			req, _ := http.NewRequest(http.MethodDelete, "/users/sessions/"+tt.ssid, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var resp ginx.Result
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantMsg, resp.Msg)
+			mockHdl.AssertExpectations(t)
+		})
+	}
+}
+
+// cookie 模式下刷新会换掉 refresh token 和 CSRF cookie，别的网站不能借着浏览器带的 cookie 触发
+func TestUserHandler_RefreshTokenCSRF(t *testing.T) {
+	// 没有设置 ExtractRefreshToken，走到 RefreshToken 的话会 panic
+	handler := NewUserHandler(new(mockUserService), new(mockCodeService), new(mockEmailVerificationService), new(mockMFAService), new(mockAccountDeletionService), new(mockLockoutService),
+		newTestPasswordPolicy(), new(mockJWTHandler))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.NewCSRFMiddlewareBuilder().Build())
+	handler.RegisterRoutes(router, middleware.NewPublicRoutes())
+
+	// 跳转只能发 GET，已经没有这个路由了；POST 没带 CSRF 头部的被拦下来
+	for method, want := range map[string]int{http.MethodGet: http.StatusNotFound, http.MethodPost: http.StatusForbidden} {
+		req, _ := http.NewRequest(method, "/users/refresh_token", nil)
+		req.AddCookie(&http.Cookie{Name: ijwt.RefreshTokenCookie, Value: "refresh"})
+		req.AddCookie(&http.Cookie{Name: ijwt.CSRFCookie, Value: "csrf"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, method)
+	}
+}
+
+func TestUserHandler_ProfileAccessTokenScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		claims ijwt.UserClaims
+		status int
+	}{
+		{name: "登录会话不受 scope 限制", method: http.MethodGet, claims: ijwt.UserClaims{Uid: 1, Ssid: "ssid"}, status: http.StatusOK},
+		{name: "令牌有读权限", method: http.MethodGet,
+			claims: ijwt.UserClaims{Uid: 1, TokenId: 1, Scopes: []string{ScopeProfileRead}}, status: http.StatusOK},
+		{name: "令牌没有 scope", method: http.MethodGet, claims: ijwt.UserClaims{Uid: 1, TokenId: 1}, status: http.StatusForbidden},
+		{name: "只读令牌不能修改", method: http.MethodPut,
+			claims: ijwt.UserClaims{Uid: 1, TokenId: 1, Scopes: []string{ScopeProfileRead}}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(mockUserService)
+			mockSvc.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1}, nil).Maybe()
+			handler := NewUserHandler(mockSvc, new(mockCodeService), new(mockEmailVerificationService), new(mockMFAService), new(mockAccountDeletionService), new(mockLockoutService),
+				newTestPasswordPolicy(), new(mockJWTHandler))
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				ctx.Set("user", tt.claims)
+			})
+			handler.RegisterRoutes(router, middleware.NewPublicRoutes())
+
+			req, _ := http.NewRequest(tt.method, "/users/profile", bytes.NewBufferString(`{"nickname":"moon"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestUserHandler_RefreshToken(t *testing.T) {
+	ring, err := ijwt.NewKeyRing("k1", time.Hour,
+		ijwt.Key{Kid: "k1", AccessKey: []byte("access"), RefreshKey: []byte("refresh")})
+	assert.NoError(t, err)
+	rc := ijwt.RefreshClaims{
+		Uid:  1,
+		Ssid: "ssid",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, rc)
+	token.Header["kid"] = "k1"
+	tokenStr, err := token.SignedString([]byte("refresh"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		mockSetup func(*mockUserService, *mockJWTHandler)
+		wantCode  int
+	}{
+		{
+			name: "刷新成功",
+			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+				h.On("CheckSession", mock.Anything, "ssid").Return(nil)
+				h.On("CheckUser", mock.Anything, int64(1)).Return(nil)
+				m.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1}, nil)
+				h.On("RotateTokens", mock.Anything, rc).Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "refresh token 被重复使用",
+			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+				h.On("CheckSession", mock.Anything, "ssid").Return(nil)
+				h.On("CheckUser", mock.Anything, int64(1)).Return(nil)
+				m.On("FindById", mock.Anything, int64(1)).Return(domain.User{Id: 1}, nil)
+				h.On("RotateTokens", mock.Anything, rc).Return(ijwt.ErrRefreshTokenReused)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "用户已被禁用",
+			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+				h.On("CheckSession", mock.Anything, "ssid").Return(nil)
+				h.On("CheckUser", mock.Anything, int64(1)).Return(ijwt.ErrUserBlocked)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "Redis 里没有禁用标记，数据库里已被禁用",
+			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+				h.On("CheckSession", mock.Anything, "ssid").Return(nil)
+				h.On("CheckUser", mock.Anything, int64(1)).Return(nil)
+				m.On("FindById", mock.Anything, int64(1)).
+					Return(domain.User{Id: 1, Status: domain.UserStatusDisabled}, nil)
+				// 把标记补回去
+				h.On("BlockUser", mock.Anything, int64(1)).Return(nil)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "账号已注销",
+			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+				h.On("CheckSession", mock.Anything, "ssid").Return(nil)
+				h.On("CheckUser", mock.Anything, int64(1)).Return(nil)
+				m.On("FindById", mock.Anything, int64(1)).
+					Return(domain.User{Id: 1, Status: domain.UserStatusDeleted}, nil)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "用户不存在",
+			mockSetup: func(m *mockUserService, h *mockJWTHandler) {
+				h.On("CheckSession", mock.Anything, "ssid").Return(nil)
+				h.On("CheckUser", mock.Anything, int64(1)).Return(nil)
+				m.On("FindById", mock.Anything, int64(1)).Return(domain.User{}, service.ErrInvalidUserOrPassword)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(mockUserService)
+			mockHdl := new(mockJWTHandler)
+			mockHdl.On("ExtractRefreshToken", mock.Anything).Return(tokenStr)
+			mockHdl.On("RefreshKeyFunc").Return(ring.RefreshKeyFunc())
+			tt.mockSetup(mockSvc, mockHdl)
+
+			handler := NewUserHandler(mockSvc, new(mockCodeService), new(mockEmailVerificationService), new(mockMFAService), new(mockAccountDeletionService), new(mockLockoutService),
+				newTestPasswordPolicy(), mockHdl)
+			router := setupTestRouter(handler)
+
+			req, _ := http.NewRequest(http.MethodPost, "/users/refresh_token", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
 			mockSvc.AssertExpectations(t)
 			mockHdl.AssertExpectations(t)
 		})
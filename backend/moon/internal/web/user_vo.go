@@ -7,23 +7,177 @@ type SignUpReq struct {
 	Nickname        string `json:"nickname" binding:"required"`
 }
 
+type ResendVerifyEmailReq struct {
+	Email string `json:"email"`
+}
+
+type ChangePasswordReq struct {
+	OldPassword     string `json:"old_password"`
+	NewPassword     string `json:"new_password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type ChangeEmailReq struct {
+	Password string `json:"password"`
+	NewEmail string `json:"new_email"`
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordReq struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+// PasswordRejectedResp 密码不符合要求的时候返回，Reason 见 passwordx.Reason 开头的常量
+type PasswordRejectedResp struct {
+	Reason string `json:"reason"`
+}
+
 type LoginJWTReq struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+type SendSMSCodeReq struct {
+	Phone string `json:"phone"`
+}
+
+type LoginSMSReq struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+type BindPhoneReq struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+type UnbindPhoneReq struct {
+	Code string `json:"code"`
+}
+
+type SendUnbindPhoneCodeResp struct {
+	// Phone 打码之后的手机号，比如 +86138****8000
+	Phone string `json:"phone"`
+}
+
+// PendingDeletionVO 注销了还在宽限期里的账号登录时返回，用 RestoreToken 调用恢复接口
+type PendingDeletionVO struct {
+	RestoreToken string `json:"restore_token"`
+	// PurgeAt 毫秒时间戳，到了这个时间账号会被彻底删除
+	PurgeAt int64 `json:"purge_at"`
+}
+
+// DeleteAccountReq 设置了密码的账号填 Password，没有密码的账号填短信验证码 Code
+type DeleteAccountReq struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type SendDeleteAccountCodeResp struct {
+	// Phone 打码之后的手机号
+	Phone string `json:"phone"`
+}
+
+type DeleteAccountResp struct {
+	// PurgeAt 毫秒时间戳
+	PurgeAt int64 `json:"purge_at"`
+}
+
+type RestoreAccountReq struct {
+	RestoreToken string `json:"restore_token"`
+}
+
+// LockedVO 账号被锁定时返回，RetryAfter 单位是秒
+type LockedVO struct {
+	RetryAfter int64 `json:"retry_after"`
+}
+
 type ProfileResp struct {
-	Id       int64  `json:"id"`
-	Email    string `json:"email"`
-	Nickname string `json:"nickname"`
-	Birthday int64  `json:"birthday"`
-	AboutMe  string `json:"about_me"`
-	Phone    string `json:"phone"`
+	Id            int64  `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
+	Nickname      string `json:"nickname"`
+	Birthday      int64  `json:"birthday"`
+	AboutMe       string `json:"about_me"`
+	Phone         string `json:"phone"`
 }
 
+// UpdateProfileReq 手机号要验证，在 /users/phone 绑定
 type UpdateProfileReq struct {
 	Nickname string `json:"nickname"`
 	Birthday int64  `json:"birthday"`
 	AboutMe  string `json:"about_me"`
-	Phone    string `json:"phone"`
+}
+
+type SessionVO struct {
+	Ssid      string `json:"ssid"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Ctime     int64  `json:"ctime"`
+	LastSeen  int64  `json:"last_seen"`
+	// Current 是否是发起请求的这个会话
+	Current bool `json:"current"`
+}
+
+type MFACodeReq struct {
+	Code string `json:"code"`
+}
+
+type LoginMFAReq struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFAEnrollResp struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	// QRCode data URI 格式的 PNG，前端直接放到 img 的 src 里
+	QRCode string `json:"qr_code"`
+}
+
+type MFARequiredResp struct {
+	MFAToken string `json:"mfa_token"`
+	// ExpiresIn 秒
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type DataExportVO struct {
+	Id string `json:"id"`
+	// Status running、ready 或者 failed，ready 之后才能下载
+	Status string `json:"status"`
+	// Size 压缩包的字节数
+	Size int64 `json:"size"`
+	// 下面都是 Unix 毫秒时间戳，ExpiresAt 导出完成之后才有，过期之后需要重新导出
+	Ctime     int64 `json:"ctime"`
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+type CreateAccessTokenReq struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays 0 表示不过期
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type AccessTokenVO struct {
+	Id     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// 下面都是 Unix 毫秒时间戳，0 表示不过期或者还没用过
+	ExpiresAt  int64 `json:"expires_at"`
+	LastUsedAt int64 `json:"last_used_at"`
+	Ctime      int64 `json:"ctime"`
+}
+
+type CreateAccessTokenResp struct {
+	AccessTokenVO
+	// Token 令牌明文，只返回这一次
+	Token string `json:"token"`
 }
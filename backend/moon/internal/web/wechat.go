@@ -0,0 +1,193 @@
+package web
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	"moon/internal/service/oauth2/wechat"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	wechatStateCookie = "jwt-state"
+	// state 只会发给回调接口
+	wechatCallbackPath = "/oauth2/wechat/callback"
+)
+
+var errStateMismatch = errors.New("state 不匹配")
+
+type OAuth2WechatHandler struct {
+	ijwt.Handler
+	svc         wechat.Service
+	userSvc     service.UserService
+	mfaSvc      service.MFAService
+	deletionSvc service.AccountDeletionService
+	// stateKey 签名 state cookie 的密钥，和 access token 的密钥分开
+	stateKey     []byte
+	cookieSecure bool
+}
+
+func NewOAuth2WechatHandler(svc wechat.Service, userSvc service.UserService, mfaSvc service.MFAService,
+	deletionSvc service.AccountDeletionService, hdl ijwt.Handler, stateKey []byte, cookieSecure bool) *OAuth2WechatHandler {
+	return &OAuth2WechatHandler{
+		Handler:      hdl,
+		svc:          svc,
+		userSvc:      userSvc,
+		mfaSvc:       mfaSvc,
+		deletionSvc:  deletionSvc,
+		stateKey:     stateKey,
+		cookieSecure: cookieSecure,
+	}
+}
+
+func (h *OAuth2WechatHandler) RegisterRoutes(server *gin.Engine, public *middleware.PublicRoutes) {
+	g := server.Group("/oauth2/wechat")
+	public.Add(g, http.MethodGet, "/authurl").
+		Add(g, http.MethodGet, "/callback")
+	g.GET("/authurl", ginx.Wrap(h.AuthURL))
+	g.GET("/callback", ginx.Wrap(h.Callback))
+	// 已经登录的用户绑定微信，回调和登录共用一个地址
+	g.GET("/bind/authurl", middleware.RequireSession(), ginx.WrapClaims(h.BindAuthURL))
+}
+
+// AuthURL 生成一个随机的 state，签名之后放在 cookie 里，回调的时候比较
+// 这样攻击者没法把自己的 code 塞给受害者，让受害者登录到攻击者的账号
+func (h *OAuth2WechatHandler) AuthURL(ctx *gin.Context) (ginx.Result, error) {
+	return h.authURL(ctx, 0)
+}
+
+// BindAuthURL 当前用户的 uid 签名在 state cookie 里，回调的时候把微信绑定到这个用户上
+// 微信回调是浏览器跳转过来的，header 模式下带不上 token，只能靠 state 认出是谁
+func (h *OAuth2WechatHandler) BindAuthURL(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	return h.authURL(ctx, uc.Uid)
+}
+
+func (h *OAuth2WechatHandler) authURL(ctx *gin.Context, uid int64) (ginx.Result, error) {
+	state := uuid.NewString()
+	authURL, err := h.svc.AuthURL(ctx, state)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "构造扫码登录 URL 失败"}, err
+	}
+	if err = h.setStateCookie(ctx, state, uid); err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: authURL}, nil
+}
+
+func (h *OAuth2WechatHandler) Callback(ctx *gin.Context) (ginx.Result, error) {
+	sc, err := h.verifyState(ctx)
+	// state 只能用一次
+	h.clearStateCookie(ctx)
+	if err != nil {
+		ginx.L.Warn("微信登录 state 校验失败", logger.Error(err),
+			logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "登录失败，请重试"}, nil
+	}
+
+	info, err := h.svc.VerifyCode(ctx, ctx.Query("code"))
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if sc.Uid != 0 {
+		return h.bind(ctx, sc.Uid, info)
+	}
+	u, err := h.userSvc.FindOrCreateByWechat(ctx, info)
+	switch err {
+	case nil:
+	// 注销之后微信还绑定在原来的用户上，彻底删除之前不能用它登录，
+	// 扫码已经证明了身份，和密码登录一样可以恢复
+	case service.ErrUserPendingDeletion:
+		return beginOAuth2Restore(h.deletionSvc, u)
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	if u.Disabled() {
+		return ginx.Result{Code: errs.UserDisabled, Msg: "账号已被禁用"}, nil
+	}
+	// 第三方账号被盗不应该绕过两步验证
+	if u.TOTP.Enabled {
+		return beginMFA(ctx, h.mfaSvc, u.Id)
+	}
+	err = h.SetLoginToken(ctx, u.Id)
+	if err != nil {
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *OAuth2WechatHandler) bind(ctx *gin.Context, uid int64, info domain.WechatInfo) (ginx.Result, error) {
+	err := h.userSvc.BindWechat(ctx, uid, info)
+	switch err {
+	case nil:
+		ginx.L.Info("用户绑定了微信", logger.Int64("uid", uid), logger.String("ip", ctx.ClientIP()))
+		return ginx.Result{Msg: "绑定成功"}, nil
+	case service.ErrDuplicateWechat:
+		return ginx.Result{Code: errs.UserDuplicateWechat, Msg: "这个微信已经绑定了别的账号"}, nil
+	case service.ErrUserNotFound:
+		// 发起绑定之后账号注销了
+		return ginx.Result{Code: errs.UserInvalidInput, Msg: "绑定失败，请重新登录"}, nil
+	default:
+		return ginx.Result{Code: errs.UserInternalServerError, Msg: "系统错误"}, err
+	}
+}
+
+type StateClaims struct {
+	jwt.RegisteredClaims
+	State string
+	// Uid 不为 0 表示是这个用户在绑定微信，而不是登录
+	Uid int64
+}
+
+func (h *OAuth2WechatHandler) setStateCookie(ctx *gin.Context, state string, uid int64) error {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, StateClaims{
+		State: state,
+		Uid:   uid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			// 给用户十分钟扫码
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 10)),
+		},
+	})
+	tokenStr, err := token.SignedString(h.stateKey)
+	if err != nil {
+		return err
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(wechatStateCookie, tokenStr, 600, wechatCallbackPath, "", h.cookieSecure, true)
+	return nil
+}
+
+func (h *OAuth2WechatHandler) clearStateCookie(ctx *gin.Context) {
+	ctx.SetCookie(wechatStateCookie, "", -1, wechatCallbackPath, "", h.cookieSecure, true)
+}
+
+func (h *OAuth2WechatHandler) verifyState(ctx *gin.Context) (StateClaims, error) {
+	state := ctx.Query("state")
+	cookie, err := ctx.Cookie(wechatStateCookie)
+	if err != nil {
+		return StateClaims{}, fmt.Errorf("拿不到 state 的 cookie %w", err)
+	}
+	var sc StateClaims
+	token, err := jwt.ParseWithClaims(cookie, &sc, func(token *jwt.Token) (any, error) {
+		return h.stateKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	if err != nil || !token.Valid {
+		return StateClaims{}, fmt.Errorf("state cookie 不合法 %w", err)
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(sc.State), []byte(state)) != 1 {
+		return StateClaims{}, errStateMismatch
+	}
+	return sc, nil
+}
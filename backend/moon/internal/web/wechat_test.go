@@ -0,0 +1,216 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/errs"
+	"moon/internal/service"
+	"moon/internal/service/oauth2/wechat"
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+	"moon/pkg/ginx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuth2WechatHandler_Callback(t *testing.T) {
+	// 假的微信服务，任何 code 都换成同一个 openid
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(wechat.Result{OpenId: "openid-1", UnionId: "unionid-1"})
+	}))
+	defer fake.Close()
+	svc := wechat.NewService(wechat.Config{AppId: "app-id", APIBase: fake.URL}, fake.Client())
+
+	newRouter := func(userSvc *mockUserService, mfaSvc *mockMFAService, hdl *mockJWTHandler,
+		deletionSvc ...*mockAccountDeletionService) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		// 代替登录校验的中间件，带着 X-Uid 的请求当作这个用户已经登录了
+		router.Use(func(ctx *gin.Context) {
+			if uid, err := strconv.ParseInt(ctx.GetHeader("X-Uid"), 10, 64); err == nil {
+				ctx.Set("user", ijwt.UserClaims{Uid: uid, Ssid: "ssid"})
+			}
+		})
+		ds := new(mockAccountDeletionService)
+		if len(deletionSvc) > 0 {
+			ds = deletionSvc[0]
+		}
+		NewOAuth2WechatHandler(svc, userSvc, mfaSvc, ds, hdl, []byte("state-key"), false).
+			RegisterRoutes(router, middleware.NewPublicRoutes())
+		return router
+	}
+
+	// authurl 返回的 state 和 cookie
+	authURL := func(router *gin.Engine) (string, *http.Cookie) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth2/wechat/authurl", nil))
+		var resp ginx.Result
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		u, err := url.Parse(resp.Data.(string))
+		require.NoError(t, err)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return u.Query().Get("state"), cookies[0]
+	}
+
+	// bindAuthURL 以 uid 的身份发起绑定
+	bindAuthURL := func(router *gin.Engine, uid int64) (string, *http.Cookie) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/oauth2/wechat/bind/authurl", nil)
+		req.Header.Set("X-Uid", strconv.FormatInt(uid, 10))
+		router.ServeHTTP(w, req)
+		var resp ginx.Result
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		u, err := url.Parse(resp.Data.(string))
+		require.NoError(t, err)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return u.Query().Get("state"), cookies[0]
+	}
+
+	callback := func(router *gin.Engine, state string, cookie *http.Cookie) ginx.Result {
+		req := httptest.NewRequest(http.MethodGet,
+			"/oauth2/wechat/callback?code=code&state="+url.QueryEscape(state), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp ginx.Result
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("登录成功", func(t *testing.T) {
+		userSvc := new(mockUserService)
+		hdl := new(mockJWTHandler)
+		userSvc.On("FindOrCreateByWechat", mock.Anything,
+			domain.WechatInfo{OpenId: "openid-1", UnionId: "unionid-1"}).Return(domain.User{Id: 1}, nil)
+		hdl.On("SetLoginToken", mock.Anything, int64(1)).Return(nil)
+		router := newRouter(userSvc, new(mockMFAService), hdl)
+
+		state, cookie := authURL(router)
+		resp := callback(router, state, cookie)
+		assert.Equal(t, 0, resp.Code)
+		userSvc.AssertExpectations(t)
+		hdl.AssertExpectations(t)
+	})
+
+	t.Run("开启了两步验证，先不发 token", func(t *testing.T) {
+		userSvc := new(mockUserService)
+		mfaSvc := new(mockMFAService)
+		userSvc.On("FindOrCreateByWechat", mock.Anything,
+			domain.WechatInfo{OpenId: "openid-1", UnionId: "unionid-1"}).
+			Return(domain.User{Id: 1, TOTP: domain.TOTPInfo{Enabled: true}}, nil)
+		mfaSvc.On("Begin", mock.Anything, int64(1)).
+			Return(service.MFAChallenge{Token: "mfa-token", ExpiresIn: time.Minute * 5}, nil)
+		// 没有设置 SetLoginToken，调用了的话会 panic
+		hdl := new(mockJWTHandler)
+		router := newRouter(userSvc, mfaSvc, hdl)
+
+		state, cookie := authURL(router)
+		resp := callback(router, state, cookie)
+		assert.Equal(t, errs.UserMFARequired, resp.Code)
+		assert.Equal(t, map[string]any{"mfa_token": "mfa-token", "expires_in": float64(300)}, resp.Data)
+		userSvc.AssertExpectations(t)
+		mfaSvc.AssertExpectations(t)
+	})
+
+	t.Run("账号已注销，返回恢复 token", func(t *testing.T) {
+		deleted := domain.User{Id: 1, Status: domain.UserStatusDeleted}
+		userSvc := new(mockUserService)
+		deletionSvc := new(mockAccountDeletionService)
+		userSvc.On("FindOrCreateByWechat", mock.Anything, mock.Anything).
+			Return(deleted, service.ErrUserPendingDeletion)
+		purgeAt := time.UnixMilli(1700000000000)
+		deletionSvc.On("BeginRestore", deleted).
+			Return(service.RestoreChallenge{Token: "restore-token", PurgeAt: purgeAt}, nil)
+		router := newRouter(userSvc, new(mockMFAService), new(mockJWTHandler), deletionSvc)
+
+		state, cookie := authURL(router)
+		resp := callback(router, state, cookie)
+		assert.Equal(t, errs.UserPendingDeletion, resp.Code)
+		assert.Equal(t, map[string]any{"restore_token": "restore-token", "purge_at": float64(1700000000000)}, resp.Data)
+		deletionSvc.AssertExpectations(t)
+	})
+
+	t.Run("账号已注销，宽限期已过", func(t *testing.T) {
+		userSvc := new(mockUserService)
+		deletionSvc := new(mockAccountDeletionService)
+		userSvc.On("FindOrCreateByWechat", mock.Anything, mock.Anything).
+			Return(domain.User{Id: 1, Status: domain.UserStatusDeleted}, service.ErrUserPendingDeletion)
+		deletionSvc.On("BeginRestore", mock.Anything).
+			Return(service.RestoreChallenge{}, service.ErrRestoreExpired)
+		router := newRouter(userSvc, new(mockMFAService), new(mockJWTHandler), deletionSvc)
+
+		state, cookie := authURL(router)
+		resp := callback(router, state, cookie)
+		assert.Equal(t, errs.UserInvalidInput, resp.Code)
+	})
+
+	t.Run("state 不匹配", func(t *testing.T) {
+		router := newRouter(new(mockUserService), new(mockMFAService), new(mockJWTHandler))
+		_, cookie := authURL(router)
+		resp := callback(router, "attacker-state", cookie)
+		assert.Equal(t, errs.UserInvalidInput, resp.Code)
+	})
+
+	t.Run("没有 state cookie", func(t *testing.T) {
+		router := newRouter(new(mockUserService), new(mockMFAService), new(mockJWTHandler))
+		state, _ := authURL(router)
+		resp := callback(router, state, nil)
+		assert.Equal(t, errs.UserInvalidInput, resp.Code)
+	})
+
+	t.Run("state cookie 签名不对", func(t *testing.T) {
+		other := gin.New()
+		NewOAuth2WechatHandler(svc, new(mockUserService), new(mockMFAService), new(mockAccountDeletionService),
+			new(mockJWTHandler), []byte("other-key"), false).
+			RegisterRoutes(other, middleware.NewPublicRoutes())
+		state, cookie := authURL(other)
+
+		router := newRouter(new(mockUserService), new(mockMFAService), new(mockJWTHandler))
+		resp := callback(router, state, cookie)
+		assert.Equal(t, errs.UserInvalidInput, resp.Code)
+	})
+
+	t.Run("绑定到当前用户", func(t *testing.T) {
+		userSvc := new(mockUserService)
+		userSvc.On("BindWechat", mock.Anything, int64(7),
+			domain.WechatInfo{OpenId: "openid-1", UnionId: "unionid-1"}).Return(nil)
+		// 没有设置 SetLoginToken 和 FindOrCreateByWechat，调用了的话会 panic
+		router := newRouter(userSvc, new(mockMFAService), new(mockJWTHandler))
+
+		state, cookie := bindAuthURL(router, 7)
+		resp := callback(router, state, cookie)
+		assert.Equal(t, 0, resp.Code)
+		userSvc.AssertExpectations(t)
+	})
+
+	t.Run("微信已经绑定了别的账号", func(t *testing.T) {
+		userSvc := new(mockUserService)
+		userSvc.On("BindWechat", mock.Anything, int64(7), mock.Anything).Return(service.ErrDuplicateWechat)
+		router := newRouter(userSvc, new(mockMFAService), new(mockJWTHandler))
+
+		state, cookie := bindAuthURL(router, 7)
+		resp := callback(router, state, cookie)
+		assert.Equal(t, errs.UserDuplicateWechat, resp.Code)
+	})
+
+	t.Run("绑定要先登录", func(t *testing.T) {
+		router := newRouter(new(mockUserService), new(mockMFAService), new(mockJWTHandler))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth2/wechat/bind/authurl", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -0,0 +1,29 @@
+package ioc
+
+import (
+	"fmt"
+
+	"moon/internal/repository"
+	"moon/internal/repository/dao"
+	"moon/internal/service"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+func InitAccessTokenService(db *gorm.DB) service.AccessTokenService {
+	type Config struct {
+		// MaxPerUser 每个用户最多能有几个个人访问令牌
+		MaxPerUser int64 `mapstructure:"max_per_user"`
+	}
+	c := Config{MaxPerUser: 20}
+	err := viper.UnmarshalKey("auth.access_token", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化个人访问令牌配置失败，原因 %v", err))
+	}
+	if c.MaxPerUser < 1 {
+		panic(fmt.Errorf("auth.access_token.max_per_user 至少是 1"))
+	}
+	return service.NewAccessTokenService(
+		repository.NewGORMAccessTokenRepository(dao.NewAccessTokenDAO(db)), c.MaxPerUser)
+}
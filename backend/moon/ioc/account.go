@@ -0,0 +1,55 @@
+package ioc
+
+import (
+	"fmt"
+	"time"
+
+	"moon/internal/job"
+	"moon/internal/repository"
+	"moon/internal/service"
+	"moon/pkg/logger"
+	"moon/pkg/passwordx"
+
+	"github.com/spf13/viper"
+)
+
+type accountDeletionConfig struct {
+	GracePeriod     time.Duration `mapstructure:"grace_period"`
+	TokenKey        string        `mapstructure:"token_key"`
+	TokenExpiration time.Duration `mapstructure:"token_expiration"`
+	PurgeInterval   time.Duration `mapstructure:"purge_interval"`
+	PurgeBatch      int           `mapstructure:"purge_batch"`
+}
+
+func loadAccountDeletionConfig() accountDeletionConfig {
+	c := accountDeletionConfig{
+		GracePeriod:     time.Hour * 24 * 30,
+		TokenExpiration: time.Minute * 10,
+		PurgeInterval:   time.Hour,
+		PurgeBatch:      100,
+	}
+	err := viper.UnmarshalKey("auth.account_deletion", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化注销账号配置失败，原因 %v", err))
+	}
+	if c.TokenKey == "" || c.GracePeriod <= 0 || c.TokenExpiration < time.Minute ||
+		c.PurgeInterval < time.Minute || c.PurgeBatch <= 0 {
+		panic(fmt.Errorf("注销账号配置不合法，token_key 不能为空，token_expiration 和 purge_interval 至少一分钟"))
+	}
+	return c
+}
+
+func InitAccountDeletionService(repo repository.UserRepository, hasher *passwordx.Manager,
+	codeSvc service.CodeService) service.AccountDeletionService {
+	c := loadAccountDeletionConfig()
+	return service.NewAccountDeletionService(repo, hasher, codeSvc, service.AccountDeletionConfig{
+		GracePeriod:     c.GracePeriod,
+		TokenKey:        []byte(c.TokenKey),
+		TokenExpiration: c.TokenExpiration,
+	})
+}
+
+func InitAccountPurgeJob(svc service.AccountDeletionService, l logger.LoggerV1) *job.AccountPurgeJob {
+	c := loadAccountDeletionConfig()
+	return job.NewAccountPurgeJob(svc, c.PurgeInterval, c.PurgeBatch, l)
+}
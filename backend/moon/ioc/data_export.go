@@ -0,0 +1,39 @@
+package ioc
+
+import (
+	"fmt"
+	"time"
+
+	"moon/internal/repository"
+	"moon/internal/repository/cache"
+	"moon/internal/service"
+	ijwt "moon/internal/web/jwt"
+	"moon/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitDataExportService(client redis.Cmdable, repo repository.UserRepository,
+	hdl ijwt.Handler, l logger.LoggerV1) service.DataExportService {
+	type Config struct {
+		Expiration time.Duration `mapstructure:"expiration"`
+		Timeout    time.Duration `mapstructure:"timeout"`
+	}
+	c := Config{Expiration: time.Hour * 24, Timeout: time.Minute * 5}
+	err := viper.UnmarshalKey("export", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化导出数据配置失败，原因 %v", err))
+	}
+	if c.Expiration < time.Minute || c.Timeout < time.Second {
+		panic(fmt.Errorf("导出数据配置不合法，expiration 至少一分钟，timeout 至少一秒"))
+	}
+	// 别的模块要导出自己的数据，在这里加上对应的 Exporter
+	exporters := []service.Exporter{
+		service.NewProfileExporter(repo),
+		ijwt.NewSessionExporter(hdl),
+		ijwt.NewLoginHistoryExporter(hdl),
+	}
+	return service.NewDataExportService(cache.NewDataExportCache(client, c.Expiration), exporters,
+		service.DataExportConfig{Timeout: c.Timeout}, l)
+}
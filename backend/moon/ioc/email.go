@@ -0,0 +1,124 @@
+package ioc
+
+import (
+	"fmt"
+	"time"
+
+	"moon/internal/repository"
+	"moon/internal/repository/cache"
+	"moon/internal/service"
+	"moon/internal/service/email"
+	"moon/internal/service/email/local"
+	"moon/internal/service/email/smtp"
+	"moon/pkg/logger"
+	"moon/pkg/passwordx"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitEmailService(l logger.LoggerV1) email.Service {
+	type Config struct {
+		Provider string `mapstructure:"provider"`
+		Local    struct {
+			// Dir 为空表示只打日志
+			Dir string `mapstructure:"dir"`
+		} `mapstructure:"local"`
+		SMTP struct {
+			Host     string `mapstructure:"host"`
+			Port     int    `mapstructure:"port"`
+			Username string `mapstructure:"username"`
+			Password string `mapstructure:"password"`
+			From     string `mapstructure:"from"`
+		} `mapstructure:"smtp"`
+	}
+	c := Config{Provider: "local"}
+	err := viper.UnmarshalKey("email", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化邮件配置失败，原因 %v", err))
+	}
+	switch c.Provider {
+	case "local":
+		return local.NewService(l, c.Local.Dir)
+	case "smtp":
+		if c.SMTP.Host == "" || c.SMTP.Port == 0 || c.SMTP.From == "" {
+			panic(fmt.Errorf("email.smtp 缺少 host、port 或者 from"))
+		}
+		return smtp.NewService(smtp.Config{
+			Host:     c.SMTP.Host,
+			Port:     c.SMTP.Port,
+			Username: c.SMTP.Username,
+			Password: c.SMTP.Password,
+			From:     c.SMTP.From,
+		})
+	default:
+		panic(fmt.Errorf("未知的邮件服务商 %s", c.Provider))
+	}
+}
+
+func InitEmailVerificationService(repo repository.UserRepository, mailer email.Service) service.EmailVerificationService {
+	type Config struct {
+		Key             string        `mapstructure:"key"`
+		Expiration      time.Duration `mapstructure:"expiration"`
+		LinkBase        string        `mapstructure:"link_base"`
+		RequireForLogin bool          `mapstructure:"require_for_login"`
+	}
+	c := Config{Expiration: time.Hour * 24}
+	err := viper.UnmarshalKey("email.verify", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化邮箱验证配置失败，原因 %v", err))
+	}
+	if c.Key == "" || c.LinkBase == "" || c.Expiration < time.Minute {
+		panic(fmt.Errorf("邮箱验证配置不合法，key 和 link_base 不能为空，expiration 至少一分钟"))
+	}
+	return service.NewEmailVerificationService(repo, mailer, service.EmailVerificationConfig{
+		Key:             []byte(c.Key),
+		Expiration:      c.Expiration,
+		LinkBase:        c.LinkBase,
+		RequireForLogin: c.RequireForLogin,
+	})
+}
+
+func InitEmailChangeService(repo repository.UserRepository, mailer email.Service,
+	hasher *passwordx.Manager) service.EmailChangeService {
+	type Config struct {
+		Expiration time.Duration `mapstructure:"expiration"`
+		LinkBase   string        `mapstructure:"link_base"`
+	}
+	c := Config{Expiration: time.Hour * 24}
+	err := viper.UnmarshalKey("email.change", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化修改邮箱配置失败，原因 %v", err))
+	}
+	// 和验证邮箱共用密钥，token 里的 Purpose 不一样
+	key := viper.GetString("email.verify.key")
+	if key == "" || c.LinkBase == "" || c.Expiration < time.Minute {
+		panic(fmt.Errorf("修改邮箱配置不合法，email.verify.key 和 link_base 不能为空，expiration 至少一分钟"))
+	}
+	return service.NewEmailChangeService(repo, mailer, hasher, service.EmailChangeConfig{
+		Key:        []byte(key),
+		Expiration: c.Expiration,
+		LinkBase:   c.LinkBase,
+	})
+}
+
+func InitPasswordResetService(client redis.Cmdable, repo repository.UserRepository,
+	mailer email.Service, hasher *passwordx.Manager) service.PasswordResetService {
+	type Config struct {
+		Expiration time.Duration `mapstructure:"expiration"`
+		LinkBase   string        `mapstructure:"link_base"`
+	}
+	c := Config{Expiration: time.Minute * 30}
+	err := viper.UnmarshalKey("auth.password_reset", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化重置密码配置失败，原因 %v", err))
+	}
+	if c.LinkBase == "" || c.Expiration < time.Minute {
+		panic(fmt.Errorf("重置密码配置不合法，link_base 不能为空，expiration 至少一分钟"))
+	}
+	return service.NewPasswordResetService(repo, cache.NewPasswordResetCache(client, c.Expiration),
+		mailer, hasher, service.PasswordResetConfig{
+			Expiration: c.Expiration,
+			LinkBase:   c.LinkBase,
+		})
+}
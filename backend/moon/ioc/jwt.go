@@ -0,0 +1,147 @@
+package ioc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	ijwt "moon/internal/web/jwt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitJWTHandler(client redis.Cmdable, keys *ijwt.KeyRing, roles ijwt.RoleLoader) ijwt.Handler {
+	type CookieConfig struct {
+		Domain string `mapstructure:"domain"`
+		Secure bool   `mapstructure:"secure"`
+		// lax、strict 或者 none
+		SameSite string `mapstructure:"same_site"`
+	}
+	type Config struct {
+		// off、user_agent 或者 fingerprint
+		ClientBinding string `mapstructure:"client_binding"`
+		// header 或者 cookie
+		Transport    string       `mapstructure:"transport"`
+		Cookie       CookieConfig `mapstructure:"cookie"`
+		LoginHistory struct {
+			// Size 每个用户保留最近几次登录，0 表示不记录
+			Size int           `mapstructure:"size"`
+			TTL  time.Duration `mapstructure:"ttl"`
+		} `mapstructure:"login_history"`
+	}
+	var c Config
+	c.LoginHistory.Size = 50
+	c.LoginHistory.TTL = time.Hour * 24 * 90
+	err := viper.UnmarshalKey("jwt", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化 jwt 配置失败，原因 %v", err))
+	}
+	binding, err := ijwt.ParseClientBinding(c.ClientBinding)
+	if err != nil {
+		panic(err)
+	}
+	if c.LoginHistory.Size < 0 || c.LoginHistory.Size > 0 && c.LoginHistory.TTL <= 0 {
+		panic(fmt.Errorf("jwt.login_history 配置不合法 %+v", c.LoginHistory))
+	}
+	opts := []ijwt.Option{ijwt.WithClientBinding(binding), ijwt.WithRoleLoader(roles),
+		ijwt.WithLoginHistory(c.LoginHistory.Size, c.LoginHistory.TTL)}
+
+	transport, err := ijwt.ParseTransport(c.Transport)
+	if err != nil {
+		panic(err)
+	}
+	if transport == ijwt.TransportCookie {
+		sameSite, err := ijwt.ParseSameSite(c.Cookie.SameSite)
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, ijwt.WithCookieTransport(ijwt.CookieConfig{
+			Domain:   c.Cookie.Domain,
+			Secure:   c.Cookie.Secure,
+			SameSite: sameSite,
+		}))
+	}
+	return ijwt.NewRedisJWTHandler(client, keys, opts...)
+}
+
+func InitJWTKeyRing() *ijwt.KeyRing {
+	type KeyConfig struct {
+		Kid string `mapstructure:"kid"`
+		// HS256/HS384/HS512、RS256/RS384/RS512、PS256/PS384/PS512 或者 EdDSA，默认 HS512
+		Method string `mapstructure:"method"`
+		// HMAC 使用 access_secret，非对称算法使用 private_key_file 指向的 PEM 文件
+		AccessSecret   string `mapstructure:"access_secret"`
+		PrivateKeyFile string `mapstructure:"private_key_file"`
+		RefreshSecret  string `mapstructure:"refresh_secret"`
+		// RFC3339 格式，为空表示仍在使用
+		RetiredAt string `mapstructure:"retired_at"`
+	}
+	type Config struct {
+		ActiveKid string        `mapstructure:"active_kid"`
+		Grace     time.Duration `mapstructure:"grace"`
+		Keys      []KeyConfig   `mapstructure:"keys"`
+	}
+
+	c := Config{
+		// 至少要覆盖 refresh token 的有效期
+		Grace: time.Hour * 24 * 7,
+	}
+	err := viper.UnmarshalKey("jwt", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化 jwt 配置失败，原因 %v", err))
+	}
+
+	keys := make([]ijwt.Key, 0, len(c.Keys))
+	for _, kc := range c.Keys {
+		k := ijwt.Key{
+			Kid:        kc.Kid,
+			RefreshKey: []byte(kc.RefreshSecret),
+		}
+		k.Method, k.AccessKey, err = loadAccessKey(kc.Method, kc.AccessSecret, kc.PrivateKeyFile)
+		if err != nil {
+			panic(fmt.Errorf("加载 jwt 密钥 %s 失败，原因 %v", kc.Kid, err))
+		}
+		if kc.RetiredAt != "" {
+			k.RetiredAt, err = time.Parse(time.RFC3339, kc.RetiredAt)
+			if err != nil {
+				panic(fmt.Errorf("jwt 密钥 %s 的 retired_at 格式错误，原因 %v", kc.Kid, err))
+			}
+		}
+		keys = append(keys, k)
+	}
+
+	ring, err := ijwt.NewKeyRing(c.ActiveKid, c.Grace, keys...)
+	if err != nil {
+		panic(fmt.Errorf("初始化 jwt 密钥失败，原因 %v", err))
+	}
+	return ring
+}
+
+func loadAccessKey(method, secret, privateKeyFile string) (jwt.SigningMethod, any, error) {
+	if method == "" {
+		method = jwt.SigningMethodHS512.Alg()
+	}
+	m := jwt.GetSigningMethod(method)
+	switch m.(type) {
+	case *jwt.SigningMethodHMAC:
+		return m, []byte(secret), nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		return m, key, err
+	case *jwt.SigningMethodEd25519:
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		return m, key, err
+	default:
+		return nil, nil, fmt.Errorf("不支持的签名算法 %s", method)
+	}
+}
@@ -0,0 +1,62 @@
+package ioc
+
+import (
+	"fmt"
+	"time"
+
+	"moon/internal/repository/cache"
+	"moon/internal/service"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitLoginLockoutService(client redis.Cmdable) service.LoginLockoutService {
+	type PolicyConfig struct {
+		Threshold  int           `mapstructure:"threshold"`
+		Window     time.Duration `mapstructure:"window"`
+		BaseLock   time.Duration `mapstructure:"base_lock"`
+		MaxLock    time.Duration `mapstructure:"max_lock"`
+		ResetAfter time.Duration `mapstructure:"reset_after"`
+	}
+	type Config struct {
+		Account PolicyConfig `mapstructure:"account"`
+		IP      PolicyConfig `mapstructure:"ip"`
+	}
+	c := Config{
+		Account: PolicyConfig{
+			Threshold:  5,
+			Window:     time.Minute * 15,
+			BaseLock:   time.Minute,
+			MaxLock:    time.Hour * 24,
+			ResetAfter: time.Hour * 24,
+		},
+		IP: PolicyConfig{
+			Threshold:  50,
+			Window:     time.Minute * 15,
+			BaseLock:   time.Minute,
+			MaxLock:    time.Hour,
+			ResetAfter: time.Hour * 24,
+		},
+	}
+	err := viper.UnmarshalKey("auth.lockout", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化登录锁定配置失败，原因 %v", err))
+	}
+	toPolicy := func(p PolicyConfig) cache.LockoutPolicy {
+		if p.Threshold <= 0 || p.BaseLock <= 0 || p.MaxLock < p.BaseLock {
+			panic(fmt.Errorf("登录锁定配置不合法 %+v", p))
+		}
+		return cache.LockoutPolicy{
+			Threshold:  p.Threshold,
+			Window:     p.Window,
+			BaseLock:   p.BaseLock,
+			MaxLock:    p.MaxLock,
+			ResetAfter: p.ResetAfter,
+		}
+	}
+	return service.NewLoginLockoutService(cache.NewLoginAttemptCache(client), service.LockoutConfig{
+		Account: toPolicy(c.Account),
+		IP:      toPolicy(c.IP),
+	})
+}
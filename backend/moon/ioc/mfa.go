@@ -0,0 +1,48 @@
+package ioc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"moon/internal/repository"
+	"moon/internal/repository/cache"
+	"moon/internal/service"
+	"moon/pkg/cryptox"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitMFAService(client redis.Cmdable, repo repository.UserRepository) service.MFAService {
+	type Config struct {
+		Issuer string `mapstructure:"issuer"`
+		// EncryptionKey base64 编码的 32 字节密钥，加密数据库里的 TOTP 密钥，换了之后已经绑定的都解不开了
+		EncryptionKey   string        `mapstructure:"encryption_key"`
+		TokenKey        string        `mapstructure:"token_key"`
+		TokenExpiration time.Duration `mapstructure:"token_expiration"`
+		MaxAttempts     int64         `mapstructure:"max_attempts"`
+	}
+	c := Config{Issuer: "Moon", TokenExpiration: time.Minute * 5, MaxAttempts: 5}
+	err := viper.UnmarshalKey("mfa", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化两步验证配置失败，原因 %v", err))
+	}
+	if c.TokenKey == "" || c.TokenExpiration < time.Minute || c.MaxAttempts < 1 {
+		panic(fmt.Errorf("两步验证配置不合法，token_key 不能为空，token_expiration 至少一分钟，max_attempts 至少 1"))
+	}
+	key, err := base64.StdEncoding.DecodeString(c.EncryptionKey)
+	if err != nil {
+		panic(fmt.Errorf("mfa.encryption_key 不是合法的 base64，原因 %v", err))
+	}
+	aead, err := cryptox.NewAEAD(key)
+	if err != nil {
+		panic(fmt.Errorf("mfa.encryption_key 不合法，原因 %v", err))
+	}
+	return service.NewMFAService(repo, cache.NewMFACache(client), aead, service.MFAConfig{
+		Issuer:          c.Issuer,
+		TokenKey:        []byte(c.TokenKey),
+		TokenExpiration: c.TokenExpiration,
+		MaxAttempts:     c.MaxAttempts,
+	})
+}
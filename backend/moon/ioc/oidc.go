@@ -0,0 +1,77 @@
+package ioc
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"moon/internal/repository"
+	"moon/internal/repository/dao"
+	"moon/internal/service"
+	"moon/internal/service/oauth2/oidc"
+	"moon/internal/web"
+	ijwt "moon/internal/web/jwt"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// provider 的名字会出现在路由里
+var oidcProviderNameRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+func InitOIDCHandler(db *gorm.DB, userRepo repository.UserRepository, mfaSvc service.MFAService,
+	deletionSvc service.AccountDeletionService, hdl ijwt.Handler) *web.OIDCHandler {
+	type ProviderConfig struct {
+		Name         string   `mapstructure:"name"`
+		Issuer       string   `mapstructure:"issuer"`
+		ClientId     string   `mapstructure:"client_id"`
+		ClientSecret string   `mapstructure:"client_secret"`
+		RedirectURL  string   `mapstructure:"redirect_url"`
+		Scopes       []string `mapstructure:"scopes"`
+		LinkByEmail  bool     `mapstructure:"link_by_email"`
+	}
+	type Config struct {
+		// StateKey 签名 state cookie 的密钥
+		StateKey  string           `mapstructure:"state_key"`
+		Providers []ProviderConfig `mapstructure:"providers"`
+	}
+	var c Config
+	err := viper.UnmarshalKey("oidc", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化 OIDC 配置失败，原因 %v", err))
+	}
+	if len(c.Providers) > 0 && c.StateKey == "" {
+		panic(fmt.Errorf("oidc.state_key 不能为空"))
+	}
+
+	client := &http.Client{Timeout: time.Second * 5}
+	providers := make([]*oidc.Provider, 0, len(c.Providers))
+	seen := make(map[string]bool, len(c.Providers))
+	for _, pc := range c.Providers {
+		if !oidcProviderNameRegexp.MatchString(pc.Name) {
+			panic(fmt.Errorf("oidc provider 的名字 %q 不合法", pc.Name))
+		}
+		if seen[pc.Name] {
+			panic(fmt.Errorf("oidc provider %s 重复了", pc.Name))
+		}
+		seen[pc.Name] = true
+		if pc.Issuer == "" || pc.ClientId == "" || pc.RedirectURL == "" {
+			panic(fmt.Errorf("oidc provider %s 缺少 issuer、client_id 或者 redirect_url", pc.Name))
+		}
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         pc.Name,
+			Issuer:       pc.Issuer,
+			ClientId:     pc.ClientId,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       pc.Scopes,
+			LinkByEmail:  pc.LinkByEmail,
+		}, client))
+	}
+
+	identityRepo := repository.NewGORMExternalIdentityRepository(dao.NewExternalIdentityDAO(db))
+	identitySvc := service.NewExternalIdentityService(identityRepo, userRepo)
+	return web.NewOIDCHandler(providers, identitySvc, mfaSvc, deletionSvc, hdl, []byte(c.StateKey),
+		viper.GetBool("jwt.cookie.secure"))
+}
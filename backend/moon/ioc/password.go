@@ -0,0 +1,57 @@
+package ioc
+
+import (
+	"fmt"
+
+	"moon/pkg/passwordx"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// InitPasswordHasher 新密码用 algorithm 配置的算法，另一个算法只用来校验老的密码，登录的时候自动升级
+func InitPasswordHasher() *passwordx.Manager {
+	type Config struct {
+		Algorithm string `mapstructure:"algorithm"`
+		Argon2id  struct {
+			// Memory 单位 KiB
+			Memory  uint32 `mapstructure:"memory"`
+			Time    uint32 `mapstructure:"time"`
+			Threads uint8  `mapstructure:"threads"`
+		} `mapstructure:"argon2id"`
+		Bcrypt struct {
+			Cost int `mapstructure:"cost"`
+		} `mapstructure:"bcrypt"`
+	}
+	c := Config{Algorithm: "argon2id"}
+	c.Argon2id.Memory = passwordx.DefaultArgon2idParams.Memory
+	c.Argon2id.Time = passwordx.DefaultArgon2idParams.Time
+	c.Argon2id.Threads = passwordx.DefaultArgon2idParams.Threads
+	c.Bcrypt.Cost = bcrypt.DefaultCost
+	err := viper.UnmarshalKey("auth.password_hash", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化密码哈希配置失败，原因 %v", err))
+	}
+	if c.Argon2id.Memory < 8*1024 || c.Argon2id.Time < 1 || c.Argon2id.Threads < 1 {
+		panic(fmt.Errorf("argon2id 参数太弱，memory 至少 8192 KiB，time 和 threads 至少 1"))
+	}
+	if c.Bcrypt.Cost < bcrypt.DefaultCost || c.Bcrypt.Cost > bcrypt.MaxCost {
+		panic(fmt.Errorf("bcrypt cost 需要在 %d 到 %d 之间", bcrypt.DefaultCost, bcrypt.MaxCost))
+	}
+	argon := passwordx.NewArgon2id(passwordx.Argon2idParams{
+		Memory:  c.Argon2id.Memory,
+		Time:    c.Argon2id.Time,
+		Threads: c.Argon2id.Threads,
+		SaltLen: passwordx.DefaultArgon2idParams.SaltLen,
+		KeyLen:  passwordx.DefaultArgon2idParams.KeyLen,
+	})
+	bc := passwordx.NewBcrypt(c.Bcrypt.Cost)
+	switch c.Algorithm {
+	case "argon2id":
+		return passwordx.NewManager(argon, bc)
+	case "bcrypt":
+		return passwordx.NewManager(bc, argon)
+	default:
+		panic(fmt.Errorf("未知的密码哈希算法 %s", c.Algorithm))
+	}
+}
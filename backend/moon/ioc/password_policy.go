@@ -0,0 +1,50 @@
+package ioc
+
+import (
+	"fmt"
+	"os"
+
+	"moon/pkg/passwordx"
+
+	"github.com/spf13/viper"
+)
+
+// InitPasswordPolicy 注册、修改和重置密码的强度要求，常见密码列表启动的时候加载一次
+func InitPasswordPolicy() *passwordx.Policy {
+	type Config struct {
+		MinLength     int     `mapstructure:"min_length"`
+		MaxLength     int     `mapstructure:"max_length"`
+		MinEntropy    float64 `mapstructure:"min_entropy"`
+		BlocklistFile string  `mapstructure:"blocklist_file"`
+	}
+	c := Config{
+		MinLength:     8,
+		MaxLength:     64,
+		MinEntropy:    40,
+		BlocklistFile: "data/common_passwords.txt",
+	}
+	err := viper.UnmarshalKey("auth.password_policy", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化密码策略配置失败，原因 %v", err))
+	}
+	if c.MinLength < 8 || c.MaxLength < c.MinLength {
+		panic(fmt.Errorf("密码策略配置不合法，min_length 至少 8，max_length 不能小于 min_length %+v", c))
+	}
+	var blocklist []string
+	if c.BlocklistFile != "" {
+		f, err := os.Open(c.BlocklistFile)
+		if err != nil {
+			panic(fmt.Errorf("打开常见密码列表失败，原因 %v", err))
+		}
+		defer f.Close()
+		blocklist, err = passwordx.LoadBlocklist(f)
+		if err != nil {
+			panic(fmt.Errorf("加载常见密码列表失败，原因 %v", err))
+		}
+	}
+	return passwordx.NewPolicy(passwordx.PolicyConfig{
+		MinLength:  c.MinLength,
+		MaxLength:  c.MaxLength,
+		MinEntropy: c.MinEntropy,
+	}, blocklist)
+}
@@ -0,0 +1,61 @@
+package ioc
+
+import (
+	"fmt"
+	"time"
+
+	"moon/internal/web/middleware"
+	"moon/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitRateLimitMiddleware(client redis.Cmdable, l logger.LoggerV1) gin.HandlerFunc {
+	type Rule struct {
+		Method string `mapstructure:"method"`
+		// Path 和注册路由时的写法一致，比如 /users/:id
+		Path string `mapstructure:"path"`
+		// Key 限流维度：ip、user 或者 header:<名字>，默认 ip
+		Key    string        `mapstructure:"key"`
+		Limit  int           `mapstructure:"limit"`
+		Window time.Duration `mapstructure:"window"`
+	}
+	type Config struct {
+		// Store redis 或者 memory，memory 只适合单机部署
+		Store string `mapstructure:"store"`
+		Rules []Rule `mapstructure:"rules"`
+	}
+	c := Config{Store: "redis"}
+	err := viper.UnmarshalKey("ratelimit", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化限流配置失败，原因 %v", err))
+	}
+
+	var limiter middleware.Limiter
+	switch c.Store {
+	case "redis":
+		limiter = middleware.NewRedisSlidingWindowLimiter(client)
+	case "memory":
+		limiter = middleware.NewMemorySlidingWindowLimiter()
+	default:
+		panic(fmt.Errorf("未知的限流存储 %s", c.Store))
+	}
+
+	b := middleware.NewRateLimitMiddlewareBuilder(limiter, l)
+	for _, r := range c.Rules {
+		if r.Limit <= 0 || r.Window <= 0 {
+			panic(fmt.Errorf("限流规则不合法 %s %s", r.Method, r.Path))
+		}
+		keyFunc, err := middleware.ParseKeyFunc(r.Key)
+		if err != nil {
+			panic(err)
+		}
+		b.Add(r.Method, r.Path, middleware.RateLimitRule{
+			Limit:  r.Limit,
+			Window: r.Window,
+		}, keyFunc)
+	}
+	return b.Build()
+}
@@ -0,0 +1,78 @@
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"moon/internal/domain"
+	"moon/internal/repository"
+	"moon/internal/service"
+	"moon/pkg/passwordx"
+
+	"github.com/spf13/viper"
+)
+
+// InitRBACService 启动的时候让数据库里的角色和配置保持一致，并创建初始管理员，
+// 管理员的密码和用户注册一样要通过 policy 的检查
+func InitRBACService(userSvc service.UserService, userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository, policy *passwordx.Policy) service.RBACService {
+	type RoleConfig struct {
+		Name        string   `mapstructure:"name"`
+		Permissions []string `mapstructure:"permissions"`
+	}
+	type AdminConfig struct {
+		// 为空表示不创建
+		Email    string `mapstructure:"email"`
+		Password string `mapstructure:"password"`
+		Role     string `mapstructure:"role"`
+		// 邮箱已经注册过的时候是否把角色授予这个账号，账号的邮箱必须验证过
+		PromoteExisting bool `mapstructure:"promote_existing"`
+	}
+	type Config struct {
+		Roles []RoleConfig `mapstructure:"roles"`
+		Admin AdminConfig  `mapstructure:"admin"`
+	}
+	c := Config{
+		Admin: AdminConfig{Role: "admin"},
+	}
+	err := viper.UnmarshalKey("rbac", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化 rbac 配置失败，原因 %v", err))
+	}
+
+	if c.Admin.Email != "" {
+		if c.Admin.Password == "" {
+			panic(fmt.Errorf("配置了管理员邮箱 %s 但是没有配置密码", c.Admin.Email))
+		}
+		local, _, _ := strings.Cut(c.Admin.Email, "@")
+		if err = policy.Check(c.Admin.Password, local); err != nil {
+			panic(fmt.Errorf("管理员密码不符合密码策略，原因 %v", err))
+		}
+	}
+
+	svc := service.NewRBACService(userSvc, userRepo, roleRepo)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	roles := make([]domain.Role, 0, len(c.Roles))
+	for _, r := range c.Roles {
+		roles = append(roles, domain.Role{Name: r.Name, Permissions: r.Permissions})
+	}
+	// 配置里删掉的角色也要从数据库里删掉，不然它会一直授予权限
+	if _, err = svc.SyncRoles(ctx, roles); err != nil {
+		panic(fmt.Errorf("初始化角色失败，原因 %v", err))
+	}
+	if c.Admin.Email != "" {
+		err = svc.EnsureUserWithRole(ctx, service.AdminSeed{
+			Email:           c.Admin.Email,
+			Password:        c.Admin.Password,
+			Role:            c.Admin.Role,
+			PromoteExisting: c.Admin.PromoteExisting,
+		})
+		if err != nil {
+			panic(fmt.Errorf("初始化管理员失败，原因 %v", err))
+		}
+	}
+	return svc
+}
@@ -0,0 +1,59 @@
+package ioc
+
+import (
+	"fmt"
+	"time"
+
+	"moon/internal/repository/cache"
+	"moon/internal/service"
+	"moon/internal/service/sms"
+	"moon/internal/service/sms/local"
+	"moon/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitSMSService(l logger.LoggerV1) sms.Service {
+	type Config struct {
+		Provider string `mapstructure:"provider"`
+		Local    struct {
+			// File 为空表示只打日志
+			File string `mapstructure:"file"`
+		} `mapstructure:"local"`
+	}
+	c := Config{Provider: "local"}
+	err := viper.UnmarshalKey("sms", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化短信配置失败，原因 %v", err))
+	}
+	switch c.Provider {
+	case "local":
+		return local.NewService(l, c.Local.File)
+	default:
+		panic(fmt.Errorf("未知的短信服务商 %s", c.Provider))
+	}
+}
+
+func InitCodeService(client redis.Cmdable, smsSvc sms.Service) service.CodeService {
+	type Config struct {
+		TplId          string        `mapstructure:"tpl_id"`
+		Expiration     time.Duration `mapstructure:"expiration"`
+		ResendInterval time.Duration `mapstructure:"resend_interval"`
+		MaxAttempts    int           `mapstructure:"max_attempts"`
+	}
+	c := Config{
+		Expiration:     time.Minute * 10,
+		ResendInterval: time.Minute,
+		MaxAttempts:    3,
+	}
+	err := viper.UnmarshalKey("sms.code", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化验证码配置失败，原因 %v", err))
+	}
+	if c.ResendInterval > c.Expiration || c.MaxAttempts <= 0 {
+		panic(fmt.Errorf("验证码配置不合法 %+v", c))
+	}
+	codeCache := cache.NewCodeCache(client, c.Expiration, c.ResendInterval, c.MaxAttempts)
+	return service.NewCodeService(codeCache, smsSvc, c.TplId)
+}
@@ -0,0 +1,48 @@
+package ioc
+
+import (
+	"fmt"
+	"slices"
+
+	ijwt "moon/internal/web/jwt"
+	"moon/internal/web/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// InitCorsMiddleware 只允许 cors.allow_origins 里的前端带着凭证跨域访问
+func InitCorsMiddleware() gin.HandlerFunc {
+	var origins []string
+	err := viper.UnmarshalKey("cors.allow_origins", &origins)
+	if err != nil {
+		panic(fmt.Errorf("初始化 CORS 配置失败，原因 %v", err))
+	}
+	transport, err := ijwt.ParseTransport(viper.GetString("jwt.transport"))
+	if err != nil {
+		panic(err)
+	}
+	if transport == ijwt.TransportCookie && slices.Contains(origins, middleware.AnyOrigin) {
+		panic(fmt.Errorf("jwt.transport 为 cookie 的时候 cors.allow_origins 不能包含 %s", middleware.AnyOrigin))
+	}
+	return middleware.NewCorsMiddlewareBuilder(origins...).Build()
+}
+
+// InitPublicRoutes 配置文件里额外声明的公开路由，handler 自己的公开路由在 RegisterRoutes 里声明
+func InitPublicRoutes() *middleware.PublicRoutes {
+	type Route struct {
+		// 为空表示所有方法
+		Method string `mapstructure:"method"`
+		Path   string `mapstructure:"path"`
+	}
+	var routes []Route
+	err := viper.UnmarshalKey("auth.public_routes", &routes)
+	if err != nil {
+		panic(fmt.Errorf("初始化公开路由配置失败，原因 %v", err))
+	}
+	public := middleware.NewPublicRoutes()
+	for _, r := range routes {
+		public.AddPath(r.Method, r.Path)
+	}
+	return public
+}
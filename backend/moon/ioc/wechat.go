@@ -0,0 +1,40 @@
+package ioc
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"moon/internal/service"
+	"moon/internal/service/oauth2/wechat"
+	"moon/internal/web"
+	ijwt "moon/internal/web/jwt"
+
+	"github.com/spf13/viper"
+)
+
+func InitOAuth2WechatHandler(userSvc service.UserService, mfaSvc service.MFAService,
+	deletionSvc service.AccountDeletionService, hdl ijwt.Handler) *web.OAuth2WechatHandler {
+	type Config struct {
+		AppId       string `mapstructure:"app_id"`
+		AppSecret   string `mapstructure:"app_secret"`
+		RedirectURL string `mapstructure:"redirect_url"`
+		// StateKey 签名 state cookie 的密钥
+		StateKey string `mapstructure:"state_key"`
+	}
+	var c Config
+	err := viper.UnmarshalKey("wechat", &c)
+	if err != nil {
+		panic(fmt.Errorf("初始化微信登录配置失败，原因 %v", err))
+	}
+	if c.StateKey == "" {
+		panic(fmt.Errorf("wechat.state_key 不能为空"))
+	}
+	svc := wechat.NewService(wechat.Config{
+		AppId:       c.AppId,
+		AppSecret:   c.AppSecret,
+		RedirectURL: c.RedirectURL,
+	}, &http.Client{Timeout: time.Second * 5})
+	return web.NewOAuth2WechatHandler(svc, userSvc, mfaSvc, deletionSvc, hdl, []byte(c.StateKey),
+		viper.GetBool("jwt.cookie.secure"))
+}
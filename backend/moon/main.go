@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
+	"net/http"
+
 	"moon/internal/repository"
 	"moon/internal/repository/dao"
 	"moon/internal/service"
 	"moon/internal/web"
-	"moon/internal/web/jwt"
 	"moon/internal/web/middleware"
 	"moon/ioc"
 	"moon/pkg/ginx"
@@ -34,28 +36,76 @@ func main() {
 
 	userDAO := dao.NewUserDAO(db)
 	userRepo := repository.NewGORMUserRepository(userDAO)
-	userService := service.NewUserService(userRepo)
-
-	jwtHdl := jwt.NewRedisJWTHandler(rdb)
-	userHandler := web.NewUserHandler(userService, jwtHdl)
+	passwordHasher := ioc.InitPasswordHasher()
+	userService := service.NewUserService(userRepo, passwordHasher)
+	roleRepo := repository.NewGORMRoleRepository(dao.NewRoleDAO(db))
+	passwordPolicy := ioc.InitPasswordPolicy()
+	rbacService := ioc.InitRBACService(userService, userRepo, roleRepo, passwordPolicy)
+
+	keyRing := ioc.InitJWTKeyRing()
+	jwtHdl := ioc.InitJWTHandler(rdb, keyRing, rbacService)
+	lockoutService := ioc.InitLoginLockoutService(rdb)
+	codeService := ioc.InitCodeService(rdb, ioc.InitSMSService(log))
+	mailer := ioc.InitEmailService(log)
+	emailVerifyService := ioc.InitEmailVerificationService(userRepo, mailer)
+	mfaService := ioc.InitMFAService(rdb, userRepo)
+	accountDeletionService := ioc.InitAccountDeletionService(userRepo, passwordHasher, codeService)
+	userHandler := web.NewUserHandler(userService, codeService, emailVerifyService, mfaService,
+		accountDeletionService, lockoutService, passwordPolicy, jwtHdl)
+	emailHandler := web.NewEmailHandler(ioc.InitEmailChangeService(userRepo, mailer, passwordHasher))
+	phoneHandler := web.NewPhoneHandler(service.NewPhoneService(userRepo, codeService))
+	accountHandler := web.NewAccountHandler(accountDeletionService, jwtHdl)
+	mfaHandler := web.NewMFAHandler(userService, mfaService, lockoutService, jwtHdl)
+	accessTokenService := ioc.InitAccessTokenService(db)
+	accessTokenHandler := web.NewAccessTokenHandler(accessTokenService)
+	dataExportHandler := web.NewDataExportHandler(ioc.InitDataExportService(rdb, userRepo, jwtHdl, log))
+	passwordHandler := web.NewPasswordHandler(userService,
+		ioc.InitPasswordResetService(rdb, userRepo, mailer, passwordHasher), passwordPolicy, jwtHdl)
+	jwksHandler := web.NewJWKSHandler(keyRing)
+	wechatHandler := ioc.InitOAuth2WechatHandler(userService, mfaService, accountDeletionService, jwtHdl)
+	oidcHandler := ioc.InitOIDCHandler(db, userRepo, mfaService, accountDeletionService, jwtHdl)
+	permMiddleware := middleware.NewPermissionMiddlewareBuilder(rbacService, log)
+	adminUserHandler := web.NewAdminUserHandler(userService, lockoutService, jwtHdl, permMiddleware)
 
 	gin.SetMode(viper.GetString("gin.mode"))
 
 	router := gin.New()
 	router.Use(gin.Recovery())
-	router.Use(middleware.Cors())
+	router.Use(ioc.InitCorsMiddleware())
 
 	log.Info("路由配置完成")
 
-	jwtMiddleware := middleware.NewLoginJWTMiddlewareBuilder(jwtHdl).CheckLogin()
+	// header 模式下没有登录 cookie，这个中间件什么也不做
+	router.Use(middleware.NewCSRFMiddlewareBuilder().Build())
+
+	publicRoutes := ioc.InitPublicRoutes()
+	jwtMiddleware := middleware.NewLoginJWTMiddlewareBuilder(jwtHdl, log, publicRoutes).
+		WithAccessTokens(accessTokenService, rbacService).CheckLogin()
 	router.Use(jwtMiddleware)
+	// 放在登录校验后面，这样才能按用户限流
+	router.Use(ioc.InitRateLimitMiddleware(rdb, log))
 
+	publicRoutes.Add(router, http.MethodGet, "/health")
 	router.GET("/health", func(ctx *gin.Context) {
 		log.Info("收到健康检查请求")
 		ctx.JSON(200, gin.H{"status": "ok"})
 	})
 
-	userHandler.RegisterRoutes(router)
+	userHandler.RegisterRoutes(router, publicRoutes)
+	passwordHandler.RegisterRoutes(router, publicRoutes)
+	emailHandler.RegisterRoutes(router, publicRoutes)
+	phoneHandler.RegisterRoutes(router, publicRoutes)
+	accountHandler.RegisterRoutes(router, publicRoutes)
+	mfaHandler.RegisterRoutes(router, publicRoutes)
+	accessTokenHandler.RegisterRoutes(router, publicRoutes)
+	dataExportHandler.RegisterRoutes(router, publicRoutes)
+	jwksHandler.RegisterRoutes(router, publicRoutes)
+	wechatHandler.RegisterRoutes(router, publicRoutes)
+	oidcHandler.RegisterRoutes(router, publicRoutes)
+	adminUserHandler.RegisterRoutes(router, publicRoutes)
+
+	// 注销之后过了宽限期的账号在后台清理
+	go ioc.InitAccountPurgeJob(accountDeletionService, log).Run(context.Background())
 
 	server := &ginx.Server{
 		Addr:   viper.GetString("server.addr"),
@@ -0,0 +1,56 @@
+// Package cryptox 数据库里需要加密保存的字段
+package cryptox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var ErrCiphertext = errors.New("密文格式不对或者被篡改")
+
+// AEAD AES-256-GCM，密文是 base64 编码的 nonce + 密文 + tag
+type AEAD struct {
+	gcm cipher.AEAD
+}
+
+func NewAEAD(key []byte) (*AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("密钥必须是 32 字节，现在是 %d 字节", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AEAD{gcm: gcm}, nil
+}
+
+// Encrypt ad 是关联数据，比如用户 ID，这样密文没法被挪到别的用户身上用
+func (a *AEAD) Encrypt(plaintext, ad []byte) (string, error) {
+	nonce := make([]byte, a.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := a.gcm.Seal(nonce, nonce, plaintext, ad)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (a *AEAD) Decrypt(ciphertext string, ad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < a.gcm.NonceSize() {
+		return nil, ErrCiphertext
+	}
+	nonce, sealed := data[:a.gcm.NonceSize()], data[a.gcm.NonceSize():]
+	plaintext, err := a.gcm.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, ErrCiphertext
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,38 @@
+package cryptox
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAEAD(t *testing.T) {
+	_, err := NewAEAD([]byte("short"))
+	assert.Error(t, err)
+
+	a, err := NewAEAD(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	c1, err := a.Encrypt([]byte("secret"), []byte("uid:1"))
+	require.NoError(t, err)
+	c2, err := a.Encrypt([]byte("secret"), []byte("uid:1"))
+	require.NoError(t, err)
+	// 每次的 nonce 都不一样
+	assert.NotEqual(t, c1, c2)
+
+	p, err := a.Decrypt(c1, []byte("uid:1"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(p))
+
+	// 挪到别的用户身上不能解密
+	_, err = a.Decrypt(c1, []byte("uid:2"))
+	assert.Equal(t, ErrCiphertext, err)
+	_, err = a.Decrypt("not base64!", nil)
+	assert.Equal(t, ErrCiphertext, err)
+
+	other, err := NewAEAD(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = other.Decrypt(c1, []byte("uid:1"))
+	assert.Equal(t, ErrCiphertext, err)
+}
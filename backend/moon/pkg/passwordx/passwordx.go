@@ -0,0 +1,51 @@
+// Package passwordx 密码哈希，哈希里带上算法和参数，换算法或者调参数之后老的哈希还能校验
+package passwordx
+
+import "errors"
+
+var ErrInvalidHash = errors.New("密码哈希的格式不对")
+
+// Hasher 一种密码哈希算法
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify hash 必须是 Match 的
+	Verify(hash, password string) (bool, error)
+	// Match hash 是不是这个算法生成的
+	Match(hash string) bool
+	// NeedsRehash hash 的参数和当前配置的不一样
+	NeedsRehash(hash string) bool
+}
+
+// Manager 用 current 生成新的哈希，校验的时候按哈希的格式选择算法
+type Manager struct {
+	current Hasher
+	legacy  []Hasher
+}
+
+// NewManager legacy 是以前用过的算法，只用来校验老的哈希
+func NewManager(current Hasher, legacy ...Hasher) *Manager {
+	return &Manager{
+		current: current,
+		legacy:  legacy,
+	}
+}
+
+func (m *Manager) Hash(password string) (string, error) {
+	return m.current.Hash(password)
+}
+
+// Verify 返回密码对不对，以及要不要用当前的算法和参数重新哈希
+// 不认识的格式，比如短信注册的用户没有密码，当成密码不对
+func (m *Manager) Verify(hash, password string) (ok bool, rehash bool, err error) {
+	if m.current.Match(hash) {
+		ok, err = m.current.Verify(hash, password)
+		return ok, ok && m.current.NeedsRehash(hash), err
+	}
+	for _, h := range m.legacy {
+		if h.Match(hash) {
+			ok, err = h.Verify(hash, password)
+			return ok, ok, err
+		}
+	}
+	return false, false, nil
+}
@@ -0,0 +1,136 @@
+package passwordx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams 测试里用小一点的参数，不然跑得太慢
+var testArgon2idParams = Argon2idParams{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2id(t *testing.T) {
+	a := NewArgon2id(testArgon2idParams)
+	hash, err := a.Hash("Password123!")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+	assert.True(t, a.Match(hash))
+	assert.False(t, a.NeedsRehash(hash))
+
+	ok, err := a.Verify(hash, "Password123!")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = a.Verify(hash, "Password123?")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 同样的密码每次的盐都不一样
+	other, err := a.Hash("Password123!")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	// 参数调大之后老的哈希还能校验，但是需要重新哈希
+	stronger := NewArgon2id(Argon2idParams{Memory: 2048, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32})
+	ok, err = stronger.Verify(hash, "Password123!")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, stronger.NeedsRehash(hash))
+
+	for _, bad := range []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+	} {
+		_, err = a.Verify(bad, "Password123!")
+		assert.Equal(t, ErrInvalidHash, err, bad)
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	b := NewBcrypt(bcrypt.MinCost)
+	hash, err := b.Hash("Password123!")
+	require.NoError(t, err)
+	assert.True(t, b.Match(hash))
+	assert.False(t, b.NeedsRehash(hash))
+	ok, err := b.Verify(hash, "Password123!")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.Verify(hash, "wrong")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, NewBcrypt(bcrypt.MinCost+1).NeedsRehash(hash))
+}
+
+func TestManager_Verify(t *testing.T) {
+	legacy := NewBcrypt(bcrypt.MinCost)
+	bcryptHash, err := legacy.Hash("Password123!")
+	require.NoError(t, err)
+	current := NewArgon2id(testArgon2idParams)
+	argonHash, err := current.Hash("Password123!")
+	require.NoError(t, err)
+	weakHash, err := NewArgon2id(Argon2idParams{Memory: 512, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}).
+		Hash("Password123!")
+	require.NoError(t, err)
+
+	m := NewManager(current, legacy)
+	testCases := []struct {
+		name       string
+		hash       string
+		password   string
+		wantOk     bool
+		wantRehash bool
+	}{
+		{name: "当前算法", hash: argonHash, password: "Password123!", wantOk: true},
+		{name: "当前算法密码不对", hash: argonHash, password: "wrong"},
+		{name: "老的算法要升级", hash: bcryptHash, password: "Password123!", wantOk: true, wantRehash: true},
+		{name: "老的算法密码不对不升级", hash: bcryptHash, password: "wrong"},
+		{name: "参数太弱要升级", hash: weakHash, password: "Password123!", wantOk: true, wantRehash: true},
+		{name: "没有密码", hash: "", password: ""},
+		{name: "不认识的格式", hash: "$md5$abc", password: "Password123!"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, rehash, err := m.Verify(tc.hash, tc.password)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantRehash, rehash)
+		})
+	}
+}
+
+// 用来挑选配置里的参数，一次登录大概花 50ms 到 500ms 比较合适
+// go test -bench=. -benchmem ./pkg/passwordx/
+func BenchmarkArgon2id(b *testing.B) {
+	for _, p := range []Argon2idParams{
+		DefaultArgon2idParams,
+		{Memory: 46 * 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+		{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 32},
+	} {
+		b.Run(fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads), func(b *testing.B) {
+			a := NewArgon2id(p)
+			for i := 0; i < b.N; i++ {
+				if _, err := a.Hash("Password123!"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBcrypt(b *testing.B) {
+	for _, cost := range []int{bcrypt.DefaultCost, 12} {
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			h := NewBcrypt(cost)
+			for i := 0; i < b.N; i++ {
+				if _, err := h.Hash("Password123!"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package passwordx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 密码不符合要求的原因，前端可以按这个给出提示
+const (
+	ReasonTooShort = "too_short"
+	ReasonTooLong  = "too_long"
+	// ReasonCommon 在常见密码或者泄露密码的列表里，或者只是它们的简单变形
+	ReasonCommon = "common"
+	// ReasonUserInfo 包含了邮箱之类的个人信息
+	ReasonUserInfo = "user_info"
+	// ReasonWeak 强度不够，比如重复、连续的字符太多
+	ReasonWeak = "weak"
+)
+
+// PolicyError Msg 可以直接给用户看
+type PolicyError struct {
+	Reason string
+	Msg    string
+	// Entropy 估算出来的强度，单位 bit
+	Entropy float64
+}
+
+func (e *PolicyError) Error() string {
+	return e.Msg
+}
+
+type PolicyConfig struct {
+	MinLength int
+	MaxLength int
+	// MinEntropy 估算强度的下限，单位 bit
+	MinEntropy float64
+}
+
+// Policy 密码强度策略，不要求必须有特殊字符，长的口令短语也能通过
+type Policy struct {
+	cfg PolicyConfig
+	// blocklist 小写的常见密码
+	blocklist map[string]struct{}
+}
+
+func NewPolicy(cfg PolicyConfig, blocklist []string) *Policy {
+	m := make(map[string]struct{}, len(blocklist))
+	for _, p := range blocklist {
+		m[strings.ToLower(p)] = struct{}{}
+	}
+	return &Policy{cfg: cfg, blocklist: m}
+}
+
+// LoadBlocklist 一行一个密码，空行和 # 开头的行会被忽略
+func LoadBlocklist(r io.Reader) ([]string, error) {
+	var res []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res, scanner.Err()
+}
+
+// Check 不符合要求的时候返回 *PolicyError
+// userInputs 是邮箱、昵称之类的个人信息，密码里不能包含它们
+func (p *Policy) Check(password string, userInputs ...string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.cfg.MinLength {
+		return &PolicyError{Reason: ReasonTooShort, Msg: fmt.Sprintf("密码至少 %d 位", p.cfg.MinLength)}
+	}
+	if p.cfg.MaxLength > 0 && n > p.cfg.MaxLength {
+		return &PolicyError{Reason: ReasonTooLong, Msg: fmt.Sprintf("密码最多 %d 位", p.cfg.MaxLength)}
+	}
+	lower := strings.ToLower(password)
+	if p.isCommon(lower) {
+		return &PolicyError{Reason: ReasonCommon, Msg: "这个密码太常见了，很容易被猜到，请换一个"}
+	}
+	for _, in := range userInputs {
+		in = strings.ToLower(in)
+		// 太短的比如昵称 "a"，误伤太多
+		if utf8.RuneCountInString(in) >= 4 && strings.Contains(lower, in) {
+			return &PolicyError{Reason: ReasonUserInfo, Msg: "密码不能包含邮箱、昵称这些个人信息"}
+		}
+	}
+	if e := Entropy(password); e < p.cfg.MinEntropy {
+		return &PolicyError{
+			Reason:  ReasonWeak,
+			Msg:     "密码强度不够，可以加长一些，或者混用大小写字母、数字和符号，避免重复和连续的字符",
+			Entropy: e,
+		}
+	}
+	return nil
+}
+
+// isCommon 除了原样比较，还会去掉前后的数字符号、还原 leet 写法之后再比较
+// 这样 Password1!、p@ssw0rd 这种常见密码的简单变形也会被拦下来
+func (p *Policy) isCommon(lower string) bool {
+	// 最常见的是在后面加数字符号，所以先只去掉后面的，前面的 1、@ 之类可能是 leet 写法
+	suffixTrimmed := strings.TrimRightFunc(lower, notLetter)
+	candidates := []string{lower, suffixTrimmed, strings.TrimFunc(lower, notLetter)}
+	for _, c := range candidates[:2] {
+		candidates = append(candidates, leetReplacer.Replace(c))
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if _, ok := p.blocklist[c]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func notLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+var leetReplacer = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i",
+	"0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// keyboardSequences 相邻的字符在这些序列里挨着的话算作连续的，正着反着都算
+var keyboardSequences = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"01234567890",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+}
+
+// Entropy 粗略估算密码的强度，单位 bit
+// 每个字符按照用到的字符集的大小算熵，和前一个字符重复或者连续的只算 1 bit
+func Entropy(password string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		// 中文之类的字符，保守一点按常用字的量级算
+		pool += 1000
+	}
+	perChar := math.Log2(float64(pool))
+	res := perChar
+	for i := 1; i < len(runes); i++ {
+		if predictable(runes[i-1], runes[i]) {
+			res += 1
+			continue
+		}
+		res += perChar
+	}
+	return res
+}
+
+func predictable(prev, cur rune) bool {
+	prev, cur = unicode.ToLower(prev), unicode.ToLower(cur)
+	if prev == cur {
+		return true
+	}
+	for _, seq := range keyboardSequences {
+		i := strings.IndexRune(seq, prev)
+		if i < 0 {
+			continue
+		}
+		if i+1 < len(seq) && rune(seq[i+1]) == cur || i > 0 && rune(seq[i-1]) == cur {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package passwordx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBlocklist(t *testing.T) {
+	list, err := LoadBlocklist(strings.NewReader("# 注释\n\n123456\n  Password \n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123456", "Password"}, list)
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p := NewPolicy(PolicyConfig{MinLength: 8, MaxLength: 64, MinEntropy: 40},
+		[]string{"Password", "iloveyou", "12345678"})
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		wantReason string
+	}{
+		{name: "口令短语", password: "correct horse battery staple"},
+		{name: "大小写字母数字混合", password: "xK9mPq2vLr"},
+		{name: "中文", password: "我的猫叫做大橘子"},
+		{name: "太短", password: "aB3$", wantReason: ReasonTooShort},
+		{name: "太长", password: strings.Repeat("xK9mPq2vLr", 7), wantReason: ReasonTooLong},
+		{name: "原样命中", password: "12345678", wantReason: ReasonCommon},
+		{name: "大小写不敏感", password: "PASSWORD", wantReason: ReasonCommon},
+		{name: "后面加数字和符号", password: "Password1!", wantReason: ReasonCommon},
+		{name: "leet 写法", password: "P@ssw0rd", wantReason: ReasonCommon},
+		{name: "leet 写法加后缀", password: "1l0v3y0u2024", wantReason: ReasonCommon},
+		{name: "包含邮箱前缀", password: "zhangsan#2024!", userInputs: []string{"zhangsan"}, wantReason: ReasonUserInfo},
+		{name: "太短的个人信息不算", password: "correct horse battery", userInputs: []string{"or"}},
+		{name: "重复字符", password: "aaaaaaaaaaaaaaaa", wantReason: ReasonWeak},
+		{name: "键盘上连续的字符", password: "qwertyuiop123", wantReason: ReasonWeak},
+		{name: "全是数字", password: "20240101", wantReason: ReasonWeak},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.password, tt.userInputs...)
+			if tt.wantReason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var pe *PolicyError
+			require.True(t, errors.As(err, &pe), "%v", err)
+			assert.Equal(t, tt.wantReason, pe.Reason)
+			assert.NotEmpty(t, pe.Msg)
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	assert.Equal(t, float64(0), Entropy(""))
+	// 重复和连续的字符每个只算 1 bit
+	assert.InDelta(t, Entropy("a")+7, Entropy("aaaaaaaa"), 0.001)
+	assert.InDelta(t, Entropy("a")+7, Entropy("abcdefgh"), 0.001)
+	assert.Greater(t, Entropy("xK9mPq2vLr"), Entropy("xk9mpq2vlr"))
+}
@@ -0,0 +1,52 @@
+// Package phonex 手机号规范化，统一保存成 E.164 格式，比如 +8613800138000
+package phonex
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("手机号格式不对")
+
+// e164Regexp 国家码加号码最多 15 位，国家码不以 0 开头，最短的号码按 8 位算
+var e164Regexp = regexp.MustCompile(`^\+[1-9]\d{7,14}$`)
+
+// mobileRegexps 知道规则的国家额外校验一下是不是手机号，其他国家只校验 E.164 的格式
+var mobileRegexps = map[string]*regexp.Regexp{
+	"86": regexp.MustCompile(`^\+861[3-9]\d{9}$`),
+}
+
+// separators 用户输入里常见的分隔符
+var separators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+
+// Normalize 把用户输入的手机号转换成 E.164 格式
+// 没有带国家码的按 defaultCountryCode 处理，比如 86，国内号码前面的 0 会去掉
+func Normalize(raw string, defaultCountryCode string) (string, error) {
+	s := separators.Replace(strings.TrimSpace(raw))
+	switch {
+	case strings.HasPrefix(s, "+"):
+	case strings.HasPrefix(s, "00"):
+		// 国际冠字
+		s = "+" + s[2:]
+	default:
+		s = "+" + defaultCountryCode + strings.TrimPrefix(s, "0")
+	}
+	if !e164Regexp.MatchString(s) {
+		return "", ErrInvalidPhone
+	}
+	for cc, re := range mobileRegexps {
+		if strings.HasPrefix(s, "+"+cc) && !re.MatchString(s) {
+			return "", ErrInvalidPhone
+		}
+	}
+	return s, nil
+}
+
+// Mask 给人看的时候隐藏中间几位，+86138****8000
+func Mask(phone string) string {
+	if len(phone) < 8 {
+		return phone
+	}
+	return phone[:len(phone)-8] + "****" + phone[len(phone)-4:]
+}
@@ -0,0 +1,41 @@
+package phonex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{name: "国内手机号", raw: "13800138000", want: "+8613800138000"},
+		{name: "带分隔符", raw: " 138-0013 8000 ", want: "+8613800138000"},
+		{name: "带国家码", raw: "+86 138 0013 8000", want: "+8613800138000"},
+		{name: "国际冠字", raw: "008613800138000", want: "+8613800138000"},
+		{name: "其他国家", raw: "+1 (415) 555-2671", want: "+14155552671"},
+		{name: "去掉国内前缀 0", raw: "013800138000", want: "+8613800138000"},
+		{name: "国内不是手机号", raw: "12345678901", wantErr: ErrInvalidPhone},
+		{name: "国内位数不对", raw: "+86138001380001", wantErr: ErrInvalidPhone},
+		{name: "太长", raw: "+1234567890123456", wantErr: ErrInvalidPhone},
+		{name: "太短", raw: "+11234", wantErr: ErrInvalidPhone},
+		{name: "有字母", raw: "138abc38000", wantErr: ErrInvalidPhone},
+		{name: "空", raw: "", wantErr: ErrInvalidPhone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Normalize(tc.raw, "86")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "+86138****8000", Mask("+8613800138000"))
+	assert.Equal(t, "+1", Mask("+1"))
+}
@@ -0,0 +1,79 @@
+// Package totp RFC 6238 基于时间的一次性密码，和 Google Authenticator 之类的 App 兼容
+// 只支持 App 普遍支持的默认参数：HMAC-SHA1、6 位数字、30 秒一个时间窗口
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret RFC 4226 建议至少 160 位
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	return secret, err
+}
+
+// EncodeSecret App 里手动输入的就是这个 base32 字符串
+func EncodeSecret(secret []byte) string {
+	return b32.EncodeToString(secret)
+}
+
+// URI otpauth URI，二维码里放的就是这个
+func URI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(Period))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Step t 所在的时间窗口
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code 某个时间窗口的验证码
+func Code(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	// RFC 4226 的动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, v%1000000)
+}
+
+// Validate 允许前后各 skew 个时间窗口的误差，返回验证码对应的时间窗口，
+// 调用方要记下来，同一个窗口的验证码不能用两次
+func Validate(secret []byte, code string, t time.Time, skew int64) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	cur := Step(t)
+	for i := -skew; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, cur+i)), []byte(code)) == 1 {
+			return cur + i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量，取后 6 位
+func TestCode_RFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	testCases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, Code(secret, Step(time.Unix(tc.unix, 0))), tc.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	step, ok := Validate(secret, Code(secret, Step(now)), now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// 上一个窗口的验证码还能用
+	step, ok = Validate(secret, Code(secret, Step(now)-1), now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now)-1, step)
+
+	_, ok = Validate(secret, Code(secret, Step(now)-2), now, 1)
+	assert.False(t, ok)
+	_, ok = Validate(secret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Moon", "a@example.com", []byte("12345678901234567890")))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Moon:a@example.com", u.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", u.Query().Get("secret"))
+	assert.Equal(t, "Moon", u.Query().Get("issuer"))
+}
@@ -1,5 +1,5 @@
 import { createContext, useContext, useState, useEffect, type ReactNode } from 'react'
-import { login, logout, register, getUserProfile, getAccessToken, clearAccessToken } from '@/lib/api'
+import { login, logout, register, getUserProfile, getAccessToken, getCsrfToken, clearAccessToken } from '@/lib/api'
 
 export interface UserProfile {
   id: number
@@ -28,7 +28,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   const [isLoading, setIsLoading] = useState(true)
 
   const checkAuth = async () => {
-    const token = getAccessToken()
+    const token = getAccessToken() || getCsrfToken()
     if (token) {
       try {
         const profile = await getUserProfile()
@@ -21,11 +21,19 @@ async function request<T>(url: string, options?: RequestInit): Promise<T> {
     headers['Authorization'] = `Bearer ${token}`
   }
 
+  // cookie 模式下写请求需要带上 CSRF token
+  const csrfToken = getCsrfToken()
+  if (csrfToken) {
+    headers['X-CSRF-Token'] = csrfToken
+  }
+
   const response = await fetch(`${API_BASE_URL}${url}`, {
     ...options,
     headers,
     credentials: 'include',
   })
+  // 刷新 token 的时候后端会换一个 CSRF token，不保存的话之后的写请求都会 403
+  saveCsrfToken(response)
 
   if (!response.ok) {
     if (response.status === 401) {
@@ -58,6 +66,7 @@ export async function login(email: string, password: string): Promise<void> {
   if (token) {
     localStorage.setItem('access_token', token)
   }
+  saveCsrfToken(response)
 
   if (!response.ok) {
     throw new Error('登录失败')
@@ -81,11 +90,12 @@ export async function logout(): Promise<void> {
     method: 'POST',
   })
   localStorage.removeItem('access_token')
+  localStorage.removeItem('csrf_token')
 }
 
 export async function refreshToken(): Promise<void> {
   await request<void>('/users/refresh_token', {
-    method: 'GET',
+    method: 'POST',
   })
 }
 
@@ -99,6 +109,19 @@ export function setAccessToken(token: string): void {
 
 export function clearAccessToken(): void {
   localStorage.removeItem('access_token')
+  localStorage.removeItem('csrf_token')
+}
+
+// cookie 模式下 token 在 HttpOnly cookie 里，js 读不到，只能拿到 CSRF token
+export function getCsrfToken(): string | null {
+  return localStorage.getItem('csrf_token')
+}
+
+function saveCsrfToken(response: Response): void {
+  const csrfToken = response.headers.get('x-csrf-token')
+  if (csrfToken) {
+    localStorage.setItem('csrf_token', csrfToken)
+  }
 }
 
 export interface UserProfile {